@@ -4,50 +4,137 @@ import (
 	"movie-rating-api/db"
 	"movie-rating-api/models"
 	"net/url"
+	"time"
 )
 
 type App interface {
 	GetMovies(query url.Values) ([]models.MoviesReturnObject, error)
+	GetMovieDetails(query url.Values) ([]MovieDetails, error)
+	GetMovieDetail(id int) (MovieDetails, bool, error)
+	GetSimilarMovies(id int, weights SimilarityWeights, limit int) ([]SimilarMovie, bool, error)
+	RateMovie(userID string, movieID int, score int) (bool, error)
+	GetUserRatings(userID string) ([]models.UserRatings, error)
+	GetRecommendations(userID string, limit int) ([]models.Recommendations, error)
+	GetRatingHistory(id int, bucket string, from time.Time, to time.Time) (RatingHistory, bool, error)
+	GetMovieDetailsAsOf(id int, at time.Time) (MovieDetails, bool, error)
+	SetSourceRating(id int, source string, value int, version int, author string) (bool, error)
+	UpdateMovie(id int, patch MoviePatch, version int, author string) (Revision, bool, error)
+	GetMovieRevisions(id int) ([]Revision, bool, error)
+	RollbackMovie(id int, revision int, author string) (Revision, bool, error)
+	AddToWatchlist(userID string, movieID int, priority int, notes string) (bool, error)
+	GetWatchlist(userID string) ([]models.WatchlistEntries, error)
+	RemoveFromWatchlist(userID string, movieID int) (bool, error)
+	LogWatch(userID string, movieID int, watchedOn time.Time, rewatch *bool, score *int, notes string) (models.DiaryEntries, bool, error)
+	GetDiary(userID string, from time.Time, to time.Time) ([]models.DiaryEntries, error)
+	RemoveFromDiary(userID string, id int) (bool, error)
+	GetDiaryStats(userID string, from time.Time, to time.Time) (DiaryStats, error)
+	FilterForUser(userID string, details []MovieDetails, onWatchlist *bool, seen *bool) ([]MovieDetails, error)
 }
 
-func GetMovies(query url.Values) ([]models.MoviesReturnObject, error) {
-	// dbClient represents a slow microservice that brings back data
-	dbClient := db.NewDBCLient(nil)
+// MovieDetails is a movie joined with its ratings, before it is shaped into a versioned response
+type MovieDetails struct {
+	Movie         models.Movies
+	MovieRatings  models.MovieRatings
+	AverageRating int
+	// Poster is nil when the movie has none
+	Poster *models.MediaAssets
+}
 
-	movies, err := dbClient.GetMovies()
-	if err != nil {
-		return []models.MoviesReturnObject{}, err
+type service struct {
+	// client represents a slow microservice that brings back data
+	client db.Client
+}
+
+func New(client db.Client) App {
+	return &service{
+		client: client,
 	}
+}
 
-	ratings, err := dbClient.GetMovieRatings()
+func (s *service) GetMovies(query url.Values) ([]models.MoviesReturnObject, error) {
+	details, err := s.GetMovieDetails(query)
 	if err != nil {
 		return []models.MoviesReturnObject{}, err
 	}
 
 	var movieReturn []models.MoviesReturnObject
+	for _, detail := range details {
+		movieReturn = append(movieReturn, models.MoviesReturnObject{
+			Title:         detail.Movie.Title,
+			Genre:         detail.Movie.Genre,
+			Ratings:       detail.MovieRatings.Ratings,
+			AverageRating: detail.AverageRating,
+			Plot:          detail.Movie.Plot,
+		})
+	}
+
+	return movieReturn, nil
+}
+
+// GetMovieDetails returns every movie that has ratings together with its ratings
+func (s *service) GetMovieDetails(query url.Values) ([]MovieDetails, error) {
+	movies, err := s.client.GetMovies()
+	if err != nil {
+		return []MovieDetails{}, err
+	}
+
+	ratings, err := s.client.GetMovieRatings()
+	if err != nil {
+		return []MovieDetails{}, err
+	}
+
+	posters, err := s.client.GetPosters()
+	if err != nil {
+		return []MovieDetails{}, err
+	}
+
+	var details []MovieDetails
 	for _, movie := range movies {
 		for _, rating := range ratings {
 			if movie.Title == rating.Title {
-				var total int
-				for _, r := range rating.Ratings {
-					total += r.Value
+				detail := MovieDetails{
+					Movie:         movie,
+					MovieRatings:  rating,
+					AverageRating: AverageRating(rating.Ratings),
 				}
-
-				var avg int
-				if len(rating.Ratings) != 0 {
-					avg = total / len(rating.Ratings)
+				if poster, ok := posters[movie.ID]; ok {
+					detail.Poster = &poster
 				}
-
-				movieReturn = append(movieReturn, models.MoviesReturnObject{
-					Title:         movie.Title,
-					Genre:         movie.Genre,
-					Ratings:       rating.Ratings,
-					AverageRating: avg,
-					Plot:          movie.Plot,
-				})
+				details = append(details, detail)
 			}
 		}
 	}
 
-	return movieReturn, nil
+	return details, nil
+}
+
+// GetMovieDetail returns the movie with its ratings, ok is false when there is no movie with the id
+func (s *service) GetMovieDetail(id int) (MovieDetails, bool, error) {
+	details, err := s.GetMovieDetails(nil)
+	if err != nil {
+		return MovieDetails{}, false, err
+	}
+
+	for _, detail := range details {
+		if detail.Movie.ID == id {
+			return detail, true, nil
+		}
+	}
+
+	return MovieDetails{}, false, nil
+}
+
+// AverageRating returns the integer average of the rating values, 0 when there are none
+func AverageRating(ratings []models.Ratings) int {
+	var total int
+	for _, r := range ratings {
+		total += r.Value
+	}
+
+	var avg int
+	if len(ratings) != 0 {
+		avg = total / len(ratings)
+	}
+
+	return avg
 }
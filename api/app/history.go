@@ -0,0 +1,288 @@
+package app
+
+import (
+	"fmt"
+	"movie-rating-api/models"
+	"time"
+)
+
+// The sizes of the buckets a rating history is grouped by
+const (
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+// MaxHistoryBuckets keeps a history request from building an unbounded series
+const MaxHistoryBuckets = 1000
+
+var (
+	ErrInvalidBucket  = fmt.Errorf("bucket must be %s, %s or %s", BucketDay, BucketWeek, BucketMonth)
+	ErrInvalidRange   = fmt.Errorf("from must be before to")
+	ErrTooManyBuckets = fmt.Errorf("the range can not span more than %d buckets", MaxHistoryBuckets)
+	ErrInvalidRating  = fmt.Errorf("value must be between 0 and 100")
+)
+
+type RatingHistory struct {
+	MovieID int
+	Bucket  string
+	From    time.Time
+	To      time.Time
+	// Sources has a series per review source in the order they first rated the movie
+	Sources []RatingSeries
+	// Average is the average of the sources' values at the end of every bucket
+	Average []AveragePoint
+}
+
+type RatingSeries struct {
+	Source string
+	Points []RatingPoint
+}
+
+// RatingPoint is a source's rating during a bucket. Value is the rating at the end of the bucket,
+// buckets without observations carry the previous value forward.
+type RatingPoint struct {
+	Start        time.Time
+	Value        int
+	Min          int
+	Max          int
+	Observations int
+}
+
+type AveragePoint struct {
+	Start time.Time
+	Value int
+}
+
+// GetRatingHistory returns the movie's ratings between from and to grouped by bucket.
+// A zero from starts at the first observation and a zero to ends now. ok is false when there is no movie with the id.
+func (s *service) GetRatingHistory(id int, bucket string, from time.Time, to time.Time) (RatingHistory, bool, error) {
+	if bucket != BucketDay && bucket != BucketWeek && bucket != BucketMonth {
+		return RatingHistory{}, false, ErrInvalidBucket
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if !from.IsZero() && from.After(to) {
+		return RatingHistory{}, false, ErrInvalidRange
+	}
+
+	detail, ok, err := s.GetMovieDetail(id)
+	if err != nil || !ok {
+		return RatingHistory{}, ok, err
+	}
+
+	observations, err := s.client.GetRatingObservations(detail.MovieRatings.ID, to)
+	if err != nil {
+		return RatingHistory{}, false, err
+	}
+
+	if from.IsZero() {
+		from = to
+		if len(observations) != 0 {
+			from = observations[0].ObservedAt
+		}
+	}
+
+	var starts []time.Time
+	for start := bucketStart(from, bucket); !start.After(to); start = nextBucket(start, bucket) {
+		if len(starts) == MaxHistoryBuckets {
+			return RatingHistory{}, false, ErrTooManyBuckets
+		}
+		starts = append(starts, start)
+	}
+
+	history := RatingHistory{
+		MovieID: id,
+		Bucket:  bucket,
+		From:    from,
+		To:      to,
+		Sources: []RatingSeries{},
+		Average: []AveragePoint{},
+	}
+
+	var sources []string
+	bySource := map[string][]models.RatingObservations{}
+	for _, observation := range observations {
+		if _, ok := bySource[observation.Source]; !ok {
+			sources = append(sources, observation.Source)
+		}
+		bySource[observation.Source] = append(bySource[observation.Source], observation)
+	}
+
+	// values holds every source's value at the end of each bucket, -1 before the source rated the movie or after it was removed
+	values := make([][]int, len(starts))
+	for i := range values {
+		values[i] = make([]int, len(sources))
+	}
+
+	for k, source := range sources {
+		series := RatingSeries{Source: source, Points: []RatingPoint{}}
+		current := -1
+		next := 0
+		observed := bySource[source]
+		for i, start := range starts {
+			end := nextBucket(start, bucket)
+			// observations before the first bucket only set the value it starts from
+			for next < len(observed) && observed[next].ObservedAt.Before(start) {
+				current = observed[next].Value
+				if observed[next].Removed {
+					current = -1
+				}
+				next++
+			}
+
+			point := RatingPoint{Start: start, Value: current, Min: current, Max: current}
+			for next < len(observed) && observed[next].ObservedAt.Before(end) {
+				// a removal ends the source's rating, the bucket only gets a point if it rates the movie again
+				if observed[next].Removed {
+					current = -1
+					next++
+					continue
+				}
+				value := observed[next].Value
+				if point.Observations == 0 {
+					point.Min, point.Max = value, value
+					if current >= 0 {
+						point.Min, point.Max = minInt(current, value), maxInt(current, value)
+					}
+				} else {
+					point.Min, point.Max = minInt(point.Min, value), maxInt(point.Max, value)
+				}
+				point.Observations++
+				current = value
+				next++
+			}
+			point.Value = current
+
+			values[i][k] = current
+			if current >= 0 {
+				series.Points = append(series.Points, point)
+			}
+		}
+		history.Sources = append(history.Sources, series)
+	}
+
+	for i, start := range starts {
+		var total, count int
+		for _, value := range values[i] {
+			if value >= 0 {
+				total += value
+				count++
+			}
+		}
+		if count != 0 {
+			history.Average = append(history.Average, AveragePoint{Start: start, Value: total / count})
+		}
+	}
+
+	return history, true, nil
+}
+
+// GetMovieDetailsAsOf returns the movie with the ratings it had at the time, leaving out those deleted by then.
+// ok is false when there is no movie with the id.
+func (s *service) GetMovieDetailsAsOf(id int, at time.Time) (MovieDetails, bool, error) {
+	detail, ok, err := s.GetMovieDetail(id)
+	if err != nil || !ok {
+		return MovieDetails{}, ok, err
+	}
+
+	observations, err := s.client.GetRatingObservations(detail.MovieRatings.ID, at)
+	if err != nil {
+		return MovieDetails{}, false, err
+	}
+
+	var sources []models.Ratings
+	index := map[string]int{}
+	removed := map[string]bool{}
+	for _, observation := range observations {
+		i, ok := index[observation.Source]
+		if !ok {
+			i = len(sources)
+			index[observation.Source] = i
+			sources = append(sources, models.Ratings{
+				MovieRatingsID: observation.MovieRatingsID,
+				Source:         observation.Source,
+			})
+		}
+
+		if observation.Removed {
+			removed[observation.Source] = true
+			continue
+		}
+		// a source that rates the movie again after a removal starts over
+		if removed[observation.Source] || sources[i].CreatedAt.IsZero() {
+			sources[i].CreatedAt = observation.ObservedAt
+		}
+		removed[observation.Source] = false
+		sources[i].Value = observation.Value
+		sources[i].UpdatedAt = observation.ObservedAt
+	}
+
+	var ratings []models.Ratings
+	for _, rating := range sources {
+		if !removed[rating.Source] {
+			ratings = append(ratings, rating)
+		}
+	}
+
+	detail.MovieRatings.Ratings = ratings
+	detail.AverageRating = AverageRating(ratings)
+	return detail, true, nil
+}
+
+// SetSourceRating changes the rating a review source gave the movie, the previous value stays in its history
+// and the movie gets a revision by the author. ok is false when there is no movie with the id.
+// version is the movie ratings' version the change is based on, db.AnyVersion to change it whatever it is.
+func (s *service) SetSourceRating(id int, source string, value int, version int, author string) (bool, error) {
+	if value < 0 || value > 100 {
+		return false, ErrInvalidRating
+	}
+
+	detail, ok, err := s.GetMovieDetail(id)
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	_, err = s.client.ObserveRating(detail.MovieRatings.ID, source, value, version, author, time.Now())
+	return true, err
+}
+
+func bucketStart(t time.Time, bucket string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch bucket {
+	case BucketWeek:
+		// weeks start on monday
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case BucketMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+func nextBucket(start time.Time, bucket string) time.Time {
+	switch bucket {
+	case BucketWeek:
+		return start.AddDate(0, 0, 7)
+	case BucketMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
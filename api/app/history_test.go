@@ -0,0 +1,117 @@
+package app
+
+import (
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"movie-rating-api/models"
+	"testing"
+	"time"
+)
+
+func sources(ratings []models.Ratings) map[string]int {
+	values := map[string]int{}
+	for _, rating := range ratings {
+		values[rating.Source] = rating.Value
+	}
+	return values
+}
+
+func TestDeletedRatingsLeaveAsOfAndHistory(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	s := New(client)
+
+	detail, ok, err := s.GetMovieDetail(1)
+	if err != nil || !ok {
+		t.Fatalf("failed to get movie 1: %v", err)
+	}
+	if len(detail.MovieRatings.Ratings) < 2 {
+		t.Fatalf("expected movie 1 to have at least two ratings")
+	}
+	source := detail.MovieRatings.Ratings[0].Source
+	value := detail.MovieRatings.Ratings[0].Value
+
+	seeded := time.Now()
+	deleted := seeded.Add(48 * time.Hour)
+	restored := seeded.Add(96 * time.Hour)
+
+	ok, err = client.DeleteRating(1, source, db.AnyVersion, "test", deleted)
+	if err != nil || !ok {
+		t.Fatalf("failed to delete rating: %v", err)
+	}
+
+	asOf := func(at time.Time) map[string]int {
+		detail, ok, err := s.GetMovieDetailsAsOf(1, at)
+		if err != nil || !ok {
+			t.Fatalf("failed to get movie 1 as of %s: %v", at, err)
+		}
+		return sources(detail.MovieRatings.Ratings)
+	}
+
+	if _, ok := asOf(deleted.Add(-time.Minute))[source]; !ok {
+		t.Fatalf("expected %s before it was deleted", source)
+	}
+	if _, ok := asOf(deleted.Add(time.Minute))[source]; ok {
+		t.Fatalf("expected %s to be left out once it was deleted", source)
+	}
+
+	ok, err = client.RestoreRating(1, source, "test", restored)
+	if err != nil || !ok {
+		t.Fatalf("failed to restore rating: %v", err)
+	}
+
+	if _, ok := asOf(deleted.Add(time.Minute))[source]; ok {
+		t.Fatalf("expected %s to stay left out while it was in the trash", source)
+	}
+	if got := asOf(restored.Add(time.Minute))[source]; got != value {
+		t.Fatalf("expected %s to be back at %d once restored, got %d", source, value, got)
+	}
+
+	history, ok, err := s.GetRatingHistory(1, BucketDay, seeded, restored.Add(time.Hour))
+	if err != nil || !ok {
+		t.Fatalf("failed to get history: %v", err)
+	}
+	for _, series := range history.Sources {
+		if series.Source != source {
+			continue
+		}
+		for _, point := range series.Points {
+			if !point.Start.Before(bucketStart(deleted, BucketDay)) && point.Start.Before(bucketStart(restored, BucketDay)) {
+				t.Fatalf("expected no point for %s on %s while it was in the trash", source, point.Start)
+			}
+		}
+		if last := series.Points[len(series.Points)-1]; !last.Start.Equal(bucketStart(restored, BucketDay)) || last.Value != value {
+			t.Fatalf("expected %s to be rated %d again on %s, got %+v", source, value, bucketStart(restored, BucketDay), last)
+		}
+	}
+}
+
+func TestTrashedMovieRatingsLeaveAsOf(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	s := New(client)
+
+	deleted := time.Now().Add(time.Hour)
+	ok, err := client.DeleteMovieRatings(1, db.AnyVersion, "test", deleted)
+	if err != nil || !ok {
+		t.Fatalf("failed to delete movie ratings: %v", err)
+	}
+	ok, err = client.RestoreMovieRatings(1, "test", deleted.Add(time.Hour))
+	if err != nil || !ok {
+		t.Fatalf("failed to restore movie ratings: %v", err)
+	}
+
+	detail, ok, err := s.GetMovieDetailsAsOf(1, deleted.Add(time.Minute))
+	if err != nil || !ok {
+		t.Fatalf("failed to get movie 1: %v", err)
+	}
+	if len(detail.MovieRatings.Ratings) != 0 || detail.AverageRating != 0 {
+		t.Fatalf("expected no ratings while the movie ratings were in the trash, got %+v", detail.MovieRatings.Ratings)
+	}
+
+	detail, ok, err = s.GetMovieDetailsAsOf(1, deleted.Add(2*time.Hour))
+	if err != nil || !ok {
+		t.Fatalf("failed to get movie 1: %v", err)
+	}
+	if len(detail.MovieRatings.Ratings) == 0 {
+		t.Fatalf("expected the ratings back once the movie ratings were restored")
+	}
+}
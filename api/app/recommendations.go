@@ -0,0 +1,63 @@
+package app
+
+import (
+	"fmt"
+	"movie-rating-api/models"
+	"time"
+)
+
+// ErrInvalidScore is returned by RateMovie when the score is not between 0 and 100
+var ErrInvalidScore = fmt.Errorf("score must be between 0 and 100")
+
+// RateMovie saves the user's score for the movie. ok is false when there is no movie with the id.
+func (s *service) RateMovie(userID string, movieID int, score int) (bool, error) {
+	if score < 0 || score > 100 {
+		return false, ErrInvalidScore
+	}
+
+	movies, err := s.client.GetMovies()
+	if err != nil {
+		return false, err
+	}
+
+	for _, movie := range movies {
+		if movie.ID == movieID {
+			err = s.client.SaveUserRating(models.UserRatings{
+				UserID:    userID,
+				MovieID:   movieID,
+				Score:     score,
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+			})
+			return true, err
+		}
+	}
+
+	return false, nil
+}
+
+func (s *service) GetUserRatings(userID string) ([]models.UserRatings, error) {
+	return s.client.GetUserRatings(userID)
+}
+
+// GetRecommendations returns up to limit of the user's precomputed recommendations.
+// Users the recommendation job has not seen yet get the recommendations stored for anonymous users.
+func (s *service) GetRecommendations(userID string, limit int) ([]models.Recommendations, error) {
+	recommendations, err := s.client.GetRecommendations(userID)
+	if err != nil {
+		return []models.Recommendations{}, err
+	}
+
+	if len(recommendations) == 0 && userID != "" {
+		recommendations, err = s.client.GetRecommendations("")
+		if err != nil {
+			return []models.Recommendations{}, err
+		}
+	}
+
+	if limit > 0 && len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+
+	return recommendations, nil
+}
@@ -0,0 +1,255 @@
+package app
+
+import (
+	"fmt"
+	"movie-rating-api/db"
+	"movie-rating-api/models"
+	"sort"
+	"time"
+)
+
+var (
+	ErrEmptyTitle     = fmt.Errorf("title can not be empty")
+	ErrDuplicateTitle = fmt.Errorf("another movie has the title")
+)
+
+// MoviePatch holds the movie fields to change, nil fields are left as they are
+type MoviePatch struct {
+	Title    *string
+	Plot     *string
+	Genre    *string
+	Year     *string
+	Rated    *string
+	Director *string
+	Actors   *string
+	Released *string
+}
+
+// Revision is a revision of a movie with what it changed since the previous one
+type Revision struct {
+	models.MovieRevisions
+	Movie db.MovieSnapshot
+	// Changes are empty for the first revision
+	Changes []FieldChange
+}
+
+// FieldChange is a field that differs between two revisions, ratings are named ratings.<source>.
+// Before or After is nil when a rating was added or removed.
+type FieldChange struct {
+	Field  string
+	Before interface{}
+	After  interface{}
+}
+
+// UpdateMovie applies the patch to the movie and records a revision by the author.
+// ok is false when there is no movie with the id. version is the movie's version the patch is based on,
+// db.AnyVersion to apply it whatever the version is.
+func (s *service) UpdateMovie(id int, patch MoviePatch, version int, author string) (Revision, bool, error) {
+	if patch.Title != nil && *patch.Title == "" {
+		return Revision{}, false, ErrEmptyTitle
+	}
+
+	movies, err := s.client.GetMovies()
+	if err != nil {
+		return Revision{}, false, err
+	}
+
+	movie, ok := findMovie(movies, id)
+	if !ok {
+		return Revision{}, false, nil
+	}
+
+	for _, field := range []struct {
+		value *string
+		into  *string
+	}{
+		{patch.Title, &movie.Title},
+		{patch.Plot, &movie.Plot},
+		{patch.Genre, &movie.Genre},
+		{patch.Year, &movie.Year},
+		{patch.Rated, &movie.Rated},
+		{patch.Director, &movie.Director},
+		{patch.Actors, &movie.Actors},
+		{patch.Released, &movie.Released},
+	} {
+		if field.value != nil {
+			*field.into = *field.value
+		}
+	}
+
+	if other, ok := findMovieByTitle(movies, movie.Title); ok && other.ID != id {
+		return Revision{}, false, ErrDuplicateTitle
+	}
+
+	revision, ok, err := s.client.UpdateMovie(movie, version, author, time.Now())
+	if err != nil || !ok {
+		return Revision{}, ok, err
+	}
+
+	return s.revisionWithChanges(revision)
+}
+
+// GetMovieRevisions returns the revisions of the movie oldest first, each with the fields it changed.
+// Movies that were never edited have no revisions. ok is false when there is no movie with the id.
+func (s *service) GetMovieRevisions(id int) ([]Revision, bool, error) {
+	revisions, err := s.client.GetMovieRevisions(id)
+	if err != nil {
+		return []Revision{}, false, err
+	}
+
+	if len(revisions) == 0 {
+		movies, err := s.client.GetMovies()
+		if err != nil {
+			return []Revision{}, false, err
+		}
+
+		_, ok := findMovie(movies, id)
+		return []Revision{}, ok, nil
+	}
+
+	result := make([]Revision, 0, len(revisions))
+	var previous *db.MovieSnapshot
+	for _, revision := range revisions {
+		snapshot, err := db.ParseMovieSnapshot(revision)
+		if err != nil {
+			return []Revision{}, false, fmt.Errorf("failed to parse revision %d: %s", revision.Revision, err.Error())
+		}
+
+		changes := []FieldChange{}
+		if previous != nil {
+			changes = DiffSnapshots(*previous, snapshot)
+		}
+		result = append(result, Revision{MovieRevisions: revision, Movie: snapshot, Changes: changes})
+		previous = &snapshot
+	}
+
+	return result, true, nil
+}
+
+// RollbackMovie brings the movie back to how it was at the revision, as a new revision by the author.
+// ok is false when there is no movie with the id or it has no such revision.
+func (s *service) RollbackMovie(id int, revision int, author string) (Revision, bool, error) {
+	revisions, err := s.client.GetMovieRevisions(id)
+	if err != nil {
+		return Revision{}, false, err
+	}
+
+	var target *models.MovieRevisions
+	for i := range revisions {
+		if revisions[i].Revision == revision {
+			target = &revisions[i]
+		}
+	}
+	if target == nil {
+		return Revision{}, false, nil
+	}
+
+	snapshot, err := db.ParseMovieSnapshot(*target)
+	if err != nil {
+		return Revision{}, false, err
+	}
+
+	movies, err := s.client.GetMovies()
+	if err != nil {
+		return Revision{}, false, err
+	}
+	if other, ok := findMovieByTitle(movies, snapshot.Title); ok && other.ID != id {
+		return Revision{}, false, ErrDuplicateTitle
+	}
+
+	restored, ok, err := s.client.RestoreMovieRevision(id, revision, author, time.Now())
+	if err != nil || !ok {
+		return Revision{}, ok, err
+	}
+
+	return s.revisionWithChanges(restored)
+}
+
+// revisionWithChanges adds what the revision changed since the one before it
+func (s *service) revisionWithChanges(revision models.MovieRevisions) (Revision, bool, error) {
+	revisions, ok, err := s.GetMovieRevisions(revision.MovieID)
+	if err != nil || !ok {
+		return Revision{}, ok, err
+	}
+
+	for _, r := range revisions {
+		if r.Revision == revision.Revision {
+			return r, true, nil
+		}
+	}
+
+	return Revision{}, false, nil
+}
+
+// DiffSnapshots lists the fields that differ between two snapshots of a movie, in a stable order
+func DiffSnapshots(before db.MovieSnapshot, after db.MovieSnapshot) []FieldChange {
+	changes := []FieldChange{}
+	for _, field := range []struct {
+		name          string
+		before, after string
+	}{
+		{"title", before.Title, after.Title},
+		{"plot", before.Plot, after.Plot},
+		{"genre", before.Genre, after.Genre},
+		{"year", before.Year, after.Year},
+		{"rated", before.Rated, after.Rated},
+		{"director", before.Director, after.Director},
+		{"actors", before.Actors, after.Actors},
+		{"released", before.Released, after.Released},
+	} {
+		if field.before != field.after {
+			changes = append(changes, FieldChange{Field: field.name, Before: field.before, After: field.after})
+		}
+	}
+
+	sources := map[string]bool{}
+	for source := range before.Ratings {
+		sources[source] = true
+	}
+	for source := range after.Ratings {
+		sources[source] = true
+	}
+	sorted := make([]string, 0, len(sources))
+	for source := range sources {
+		sorted = append(sorted, source)
+	}
+	sort.Strings(sorted)
+
+	for _, source := range sorted {
+		change := FieldChange{Field: "ratings." + source}
+		beforeValue, hadBefore := before.Ratings[source]
+		afterValue, hasAfter := after.Ratings[source]
+		if hadBefore && hasAfter && beforeValue == afterValue {
+			continue
+		}
+		if hadBefore {
+			change.Before = beforeValue
+		}
+		if hasAfter {
+			change.After = afterValue
+		}
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+func findMovie(movies []models.Movies, id int) (models.Movies, bool) {
+	for _, movie := range movies {
+		if movie.ID == id {
+			return movie, true
+		}
+	}
+
+	return models.Movies{}, false
+}
+
+func findMovieByTitle(movies []models.Movies, title string) (models.Movies, bool) {
+	for _, movie := range movies {
+		if movie.Title == title {
+			return movie, true
+		}
+	}
+
+	return models.Movies{}, false
+}
@@ -0,0 +1,201 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SimilarityWeights sets how much each signal counts towards the similarity of two movies.
+// Only the ratio between the weights matters.
+type SimilarityWeights struct {
+	Genre    float64
+	Director float64
+	Actors   float64
+	Era      float64
+	Ratings  float64
+}
+
+func DefaultSimilarityWeights() SimilarityWeights {
+	return SimilarityWeights{
+		Genre:    3,
+		Director: 2,
+		Actors:   2,
+		Era:      1,
+		Ratings:  2,
+	}
+}
+
+// eraSpan is how many years apart two movies can be released before they stop counting as the same era
+const eraSpan = 20
+
+type SimilarMovie struct {
+	Details MovieDetails
+	// Score is between 0 and 1, 1 being the most similar
+	Score float64
+	// Explanation lists why the movie matched
+	Explanation []string
+}
+
+// GetSimilarMovies returns up to limit movies ordered by how similar they are to the movie with the id.
+// ok is false when there is no movie with the id.
+func (s *service) GetSimilarMovies(id int, weights SimilarityWeights, limit int) ([]SimilarMovie, bool, error) {
+	details, err := s.GetMovieDetails(nil)
+	if err != nil {
+		return []SimilarMovie{}, false, err
+	}
+
+	var target *MovieDetails
+	for i := range details {
+		if details[i].Movie.ID == id {
+			target = &details[i]
+		}
+	}
+	if target == nil {
+		return []SimilarMovie{}, false, nil
+	}
+
+	similar := []SimilarMovie{}
+	for _, candidate := range details {
+		if candidate.Movie.ID == id {
+			continue
+		}
+
+		score, explanation := Similarity(*target, candidate, weights)
+		if score <= 0 {
+			continue
+		}
+
+		similar = append(similar, SimilarMovie{
+			Details:     candidate,
+			Score:       score,
+			Explanation: explanation,
+		})
+	}
+
+	sort.SliceStable(similar, func(i, j int) bool {
+		return similar[i].Score > similar[j].Score
+	})
+
+	if limit > 0 && len(similar) > limit {
+		similar = similar[:limit]
+	}
+
+	return similar, true, nil
+}
+
+// Similarity is the weighted average of every signal, each of which is between 0 and 1,
+// and the reasons the movies matched
+func Similarity(a MovieDetails, b MovieDetails, weights SimilarityWeights) (float64, []string) {
+	var explanation []string
+	var total float64
+
+	sharedGenres, genreScore := overlap(SplitList(a.Movie.Genre), SplitList(b.Movie.Genre))
+	if len(sharedGenres) != 0 {
+		explanation = append(explanation, fmt.Sprintf("shares genres %s", strings.Join(sharedGenres, ", ")))
+	}
+	total += weights.Genre * genreScore
+
+	sharedDirectors, _ := overlap(SplitList(a.Movie.Director), SplitList(b.Movie.Director))
+	if len(sharedDirectors) != 0 {
+		explanation = append(explanation, fmt.Sprintf("directed by %s", strings.Join(sharedDirectors, ", ")))
+		total += weights.Director
+	}
+
+	sharedActors, actorScore := overlap(SplitList(a.Movie.Actors), SplitList(b.Movie.Actors))
+	if len(sharedActors) != 0 {
+		explanation = append(explanation, fmt.Sprintf("stars %s", strings.Join(sharedActors, ", ")))
+	}
+	total += weights.Actors * actorScore
+
+	if yearA, errA := strconv.Atoi(a.Movie.Year); errA == nil {
+		if yearB, errB := strconv.Atoi(b.Movie.Year); errB == nil {
+			apart := math.Abs(float64(yearA - yearB))
+			if apart < eraSpan {
+				explanation = append(explanation, fmt.Sprintf("released %d years apart", int(apart)))
+				total += weights.Era * (1 - apart/eraSpan)
+			}
+		}
+	}
+
+	closeness, sources := ratingCloseness(a, b)
+	if len(sources) != 0 && closeness >= 0.9 {
+		explanation = append(explanation, fmt.Sprintf("rated alike by %s", strings.Join(sources, ", ")))
+	}
+	total += weights.Ratings * closeness
+
+	sum := weights.Genre + weights.Director + weights.Actors + weights.Era + weights.Ratings
+	if sum <= 0 {
+		return 0, explanation
+	}
+
+	return total / sum, explanation
+}
+
+// overlap returns the values in both lists and their jaccard index, ignoring case
+func overlap(a []string, b []string) ([]string, float64) {
+	inA := map[string]bool{}
+	union := map[string]bool{}
+	for _, v := range a {
+		inA[strings.ToLower(v)] = true
+		union[strings.ToLower(v)] = true
+	}
+
+	seen := map[string]bool{}
+	var shared []string
+	for _, v := range b {
+		key := strings.ToLower(v)
+		union[key] = true
+		if inA[key] && !seen[key] {
+			seen[key] = true
+			shared = append(shared, v)
+		}
+	}
+
+	if len(union) == 0 {
+		return shared, 0
+	}
+
+	return shared, float64(len(shared)) / float64(len(union))
+}
+
+// ratingCloseness compares the ratings both movies got from the same sources.
+// It is 1 when every shared source gave the same value and 0 when there is no shared source.
+func ratingCloseness(a MovieDetails, b MovieDetails) (float64, []string) {
+	valuesA := map[string]int{}
+	for _, rating := range a.MovieRatings.Ratings {
+		valuesA[rating.Source] = rating.Value
+	}
+
+	var sources []string
+	var distance float64
+	for _, rating := range b.MovieRatings.Ratings {
+		value, ok := valuesA[rating.Source]
+		if !ok {
+			continue
+		}
+
+		sources = append(sources, rating.Source)
+		distance += math.Abs(float64(value-rating.Value)) / 100
+	}
+
+	if len(sources) == 0 {
+		return 0, nil
+	}
+
+	return 1 - distance/float64(len(sources)), sources
+}
+
+// SplitList turns a comma separated column such as Genre or Actors into a list
+func SplitList(list string) []string {
+	var values []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" && v != "N/A" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,308 @@
+package app
+
+import (
+	"fmt"
+	"movie-rating-api/db"
+	"movie-rating-api/models"
+	"sort"
+	"time"
+)
+
+// DefaultPriority is the priority of watchlist entries added without one
+const DefaultPriority = 3
+
+var (
+	ErrInvalidPriority = fmt.Errorf("priority must be between 1 and 5")
+	ErrFutureWatch     = fmt.Errorf("watched_on can not be in the future")
+)
+
+type DiaryStats struct {
+	Watched   int
+	Rewatches int
+	// Scored is how many entries have a score, AverageScore is 0 when none do
+	Scored       int
+	AverageScore float64
+	// Months are ordered from the oldest, Genres from the most watched
+	Months []DiaryGroupStats
+	Genres []DiaryGroupStats
+}
+
+// DiaryGroupStats are the stats of the diary entries of a month, such as 2024-01, or of a genre
+type DiaryGroupStats struct {
+	Key          string
+	Watched      int
+	Rewatches    int
+	Scored       int
+	AverageScore float64
+}
+
+// AddToWatchlist puts the movie on the user's watchlist or updates its priority and notes.
+// A priority of 0 is DefaultPriority. ok is false when there is no movie with the id.
+func (s *service) AddToWatchlist(userID string, movieID int, priority int, notes string) (bool, error) {
+	if priority == 0 {
+		priority = DefaultPriority
+	}
+	if priority < 1 || priority > 5 {
+		return false, ErrInvalidPriority
+	}
+
+	ok, err := s.movieExists(movieID)
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	now := time.Now()
+	return true, s.client.SaveWatchlistEntry(models.WatchlistEntries{
+		UserID:    userID,
+		MovieID:   movieID,
+		Priority:  priority,
+		Notes:     notes,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+}
+
+func (s *service) GetWatchlist(userID string) ([]models.WatchlistEntries, error) {
+	return s.client.GetWatchlist(userID)
+}
+
+func (s *service) RemoveFromWatchlist(userID string, movieID int) (bool, error) {
+	return s.client.DeleteWatchlistEntry(userID, movieID)
+}
+
+// LogWatch adds a diary entry and takes the movie off the user's watchlist. When rewatch is nil
+// the entry is a rewatch if the diary already has the movie. ok is false when there is no movie with the id.
+func (s *service) LogWatch(userID string, movieID int, watchedOn time.Time, rewatch *bool, score *int, notes string) (models.DiaryEntries, bool, error) {
+	if score != nil && (*score < 0 || *score > 100) {
+		return models.DiaryEntries{}, false, ErrInvalidScore
+	}
+	if watchedOn.IsZero() {
+		watchedOn = time.Now()
+	}
+	if watchedOn.After(time.Now()) {
+		return models.DiaryEntries{}, false, ErrFutureWatch
+	}
+
+	ok, err := s.movieExists(movieID)
+	if err != nil || !ok {
+		return models.DiaryEntries{}, ok, err
+	}
+
+	// the entry and the watchlist removal are one unit, so a failed removal does not leave an entry behind
+	var entry models.DiaryEntries
+	err = s.client.WithTx(func(tx db.Client) error {
+		if rewatch == nil {
+			diary, err := tx.GetDiary(userID)
+			if err != nil {
+				return err
+			}
+
+			seen := false
+			for _, entry := range diary {
+				if entry.MovieID == movieID && entry.WatchedOn.Before(watchedOn) {
+					seen = true
+				}
+			}
+			rewatch = &seen
+		}
+
+		var err error
+		entry, err = tx.CreateDiaryEntry(models.DiaryEntries{
+			UserID:    userID,
+			MovieID:   movieID,
+			WatchedOn: watchedOn,
+			Rewatch:   *rewatch,
+			Score:     score,
+			Notes:     notes,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.DeleteWatchlistEntry(userID, movieID)
+		return err
+	})
+	if err != nil {
+		return models.DiaryEntries{}, false, err
+	}
+
+	return entry, true, nil
+}
+
+// GetDiary returns the user's diary entries watched between from and to, a zero time leaves that end open
+func (s *service) GetDiary(userID string, from time.Time, to time.Time) ([]models.DiaryEntries, error) {
+	diary, err := s.client.GetDiary(userID)
+	if err != nil {
+		return []models.DiaryEntries{}, err
+	}
+
+	result := []models.DiaryEntries{}
+	for _, entry := range diary {
+		if (from.IsZero() || !entry.WatchedOn.Before(from)) && (to.IsZero() || !entry.WatchedOn.After(to)) {
+			result = append(result, entry)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *service) RemoveFromDiary(userID string, id int) (bool, error) {
+	return s.client.DeleteDiaryEntry(userID, id)
+}
+
+// GetDiaryStats summarises the diary entries watched between from and to by month and by genre
+func (s *service) GetDiaryStats(userID string, from time.Time, to time.Time) (DiaryStats, error) {
+	diary, err := s.GetDiary(userID, from, to)
+	if err != nil {
+		return DiaryStats{}, err
+	}
+
+	movies, err := s.client.GetMovies()
+	if err != nil {
+		return DiaryStats{}, err
+	}
+
+	genres := map[int][]string{}
+	for _, movie := range movies {
+		genres[movie.ID] = SplitList(movie.Genre)
+	}
+
+	var total diaryTally
+	months := map[string]*diaryTally{}
+	byGenre := map[string]*diaryTally{}
+	for _, entry := range diary {
+		total.add(entry)
+
+		month := entry.WatchedOn.UTC().Format("2006-01")
+		if months[month] == nil {
+			months[month] = &diaryTally{}
+		}
+		months[month].add(entry)
+
+		for _, genre := range genres[entry.MovieID] {
+			if byGenre[genre] == nil {
+				byGenre[genre] = &diaryTally{}
+			}
+			byGenre[genre].add(entry)
+		}
+	}
+
+	stats := DiaryStats{
+		Watched:      total.watched,
+		Rewatches:    total.rewatches,
+		Scored:       total.scored,
+		AverageScore: total.average(),
+		Months:       []DiaryGroupStats{},
+		Genres:       []DiaryGroupStats{},
+	}
+
+	for month, tally := range months {
+		stats.Months = append(stats.Months, tally.stats(month))
+	}
+	sort.Slice(stats.Months, func(i, j int) bool {
+		return stats.Months[i].Key < stats.Months[j].Key
+	})
+
+	for genre, tally := range byGenre {
+		stats.Genres = append(stats.Genres, tally.stats(genre))
+	}
+	sort.Slice(stats.Genres, func(i, j int) bool {
+		if stats.Genres[i].Watched != stats.Genres[j].Watched {
+			return stats.Genres[i].Watched > stats.Genres[j].Watched
+		}
+		return stats.Genres[i].Key < stats.Genres[j].Key
+	})
+
+	return stats, nil
+}
+
+// FilterForUser keeps the movies that are or are not on the user's watchlist and that the user has or has not seen,
+// a nil filter keeps every movie
+func (s *service) FilterForUser(userID string, details []MovieDetails, onWatchlist *bool, seen *bool) ([]MovieDetails, error) {
+	watchlisted := map[int]bool{}
+	if onWatchlist != nil {
+		watchlist, err := s.client.GetWatchlist(userID)
+		if err != nil {
+			return []MovieDetails{}, err
+		}
+		for _, entry := range watchlist {
+			watchlisted[entry.MovieID] = true
+		}
+	}
+
+	watched := map[int]bool{}
+	if seen != nil {
+		diary, err := s.client.GetDiary(userID)
+		if err != nil {
+			return []MovieDetails{}, err
+		}
+		for _, entry := range diary {
+			watched[entry.MovieID] = true
+		}
+	}
+
+	var result []MovieDetails
+	for _, detail := range details {
+		if onWatchlist != nil && watchlisted[detail.Movie.ID] != *onWatchlist {
+			continue
+		}
+		if seen != nil && watched[detail.Movie.ID] != *seen {
+			continue
+		}
+		result = append(result, detail)
+	}
+
+	return result, nil
+}
+
+func (s *service) movieExists(movieID int) (bool, error) {
+	movies, err := s.client.GetMovies()
+	if err != nil {
+		return false, err
+	}
+
+	for _, movie := range movies {
+		if movie.ID == movieID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+type diaryTally struct {
+	watched   int
+	rewatches int
+	scored    int
+	scoreSum  int
+}
+
+func (t *diaryTally) add(entry models.DiaryEntries) {
+	t.watched++
+	if entry.Rewatch {
+		t.rewatches++
+	}
+	if entry.Score != nil {
+		t.scored++
+		t.scoreSum += *entry.Score
+	}
+}
+
+func (t *diaryTally) average() float64 {
+	if t.scored == 0 {
+		return 0
+	}
+
+	return float64(t.scoreSum) / float64(t.scored)
+}
+
+func (t *diaryTally) stats(key string) DiaryGroupStats {
+	return DiaryGroupStats{
+		Key:          key,
+		Watched:      t.watched,
+		Rewatches:    t.rewatches,
+		Scored:       t.scored,
+		AverageScore: t.average(),
+	}
+}
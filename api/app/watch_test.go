@@ -0,0 +1,48 @@
+package app
+
+import (
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"testing"
+	"time"
+)
+
+func TestLogWatchIsOneUnit(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{
+		Script: map[string][]string{db.MethodDeleteWatchlistEntry: {"watchlist unavailable"}},
+	})
+	s := New(client)
+
+	ok, err := s.AddToWatchlist("alice", 1, DefaultPriority, "")
+	if err != nil || !ok {
+		t.Fatalf("failed to add to watchlist: %v", err)
+	}
+
+	counts := func() (int, int) {
+		diary, err := s.GetDiary("alice", time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("failed to get diary: %s", err.Error())
+		}
+		watchlist, err := s.GetWatchlist("alice")
+		if err != nil {
+			t.Fatalf("failed to get watchlist: %s", err.Error())
+		}
+		return len(diary), len(watchlist)
+	}
+
+	_, _, err = s.LogWatch("alice", 1, time.Time{}, nil, nil, "")
+	if err == nil {
+		t.Fatalf("expected the failed watchlist removal to fail the watch")
+	}
+	if diary, watchlist := counts(); diary != 0 || watchlist != 1 {
+		t.Fatalf("expected the diary entry to be rolled back with the movie still on the watchlist, got %d entries and %d on the watchlist", diary, watchlist)
+	}
+
+	_, ok, err = s.LogWatch("alice", 1, time.Time{}, nil, nil, "")
+	if err != nil || !ok {
+		t.Fatalf("failed to log watch: %v", err)
+	}
+	if diary, watchlist := counts(); diary != 1 || watchlist != 0 {
+		t.Fatalf("expected one diary entry and an empty watchlist, got %d entries and %d on the watchlist", diary, watchlist)
+	}
+}
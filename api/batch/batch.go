@@ -0,0 +1,355 @@
+package batch
+
+import (
+	"fmt"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/models"
+	"time"
+)
+
+const (
+	// ModeAtomic writes every item of a batch or none of them, it is the mode when none is given
+	ModeAtomic = "atomic"
+	// ModePerItem writes the items that can be written and reports why the others could not
+	ModePerItem = "per_item"
+)
+
+var (
+	ErrUnknownMode     = fmt.Errorf("mode must be %s or %s", ModeAtomic, ModePerItem)
+	ErrEmpty           = fmt.Errorf("a batch needs at least one item")
+	ErrTooLarge        = fmt.Errorf("the batch holds too many items")
+	ErrNotFound        = fmt.Errorf("movie not found")
+	ErrEmptySource     = fmt.Errorf("source can not be empty")
+	ErrDuplicateSource = fmt.Errorf("a source can only rate a movie once")
+	// ErrAborted is the error of the items of an atomic batch that were left out because another item failed
+	ErrAborted = fmt.Errorf("left out because another item of the atomic batch failed")
+)
+
+// errItemFailed rolls back an atomic batch once one of its items fails
+var errItemFailed = fmt.Errorf("an item of the batch failed")
+
+// Movie is a movie to create along with the ratings it starts with
+type Movie struct {
+	Title    string
+	Plot     string
+	Genre    string
+	Year     string
+	Rated    string
+	Director string
+	Actors   string
+	Released string
+	Ratings  []models.Ratings
+}
+
+// Rating sets the rating a review source gave a movie
+type Rating struct {
+	MovieID int
+	Source  string
+	Value   int
+	// Version is the version of the movie's ratings the write is based on, db.AnyVersion skips the check
+	Version int
+}
+
+// MovieResult is the outcome of an item that creates or gets a movie, Err is nil when it succeeded
+type MovieResult struct {
+	Detail app.MovieDetails
+	Err    error
+}
+
+// RatingResult is the outcome of an item that sets a rating, Err is nil when it succeeded
+type RatingResult struct {
+	// Changed is false when the source had already given the movie the value
+	Changed bool
+	Err     error
+}
+
+// Processor runs batches of movie and rating reads and writes
+type Processor struct {
+	client db.Client
+	app    app.App
+	config Config
+}
+
+func NewProcessor(client db.Client, a app.App, config Config) *Processor {
+	return &Processor{
+		client: client,
+		app:    a,
+		config: config,
+	}
+}
+
+// CreateMovies creates the movies with their ratings in one transaction and returns a result per movie, in order.
+// In atomic mode nothing is created unless every movie can be. In per item mode each movie is created in
+// a savepoint of its own, so one that fails only leaves itself out.
+func (p *Processor) CreateMovies(movies []Movie, mode string) ([]MovieResult, error) {
+	mode, err := p.check(len(movies), mode)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := p.client.GetMovies()
+	if err != nil {
+		return nil, err
+	}
+	taken := map[string]bool{}
+	for _, movie := range existing {
+		taken[movie.Title] = true
+	}
+
+	results := make([]MovieResult, len(movies))
+	for i, movie := range movies {
+		results[i].Err = validateMovie(movie, taken)
+		if results[i].Err == nil {
+			taken[movie.Title] = true
+		}
+	}
+	if mode == ModeAtomic && anyMovieFailed(results) {
+		abortMovies(results)
+		return results, nil
+	}
+
+	err = p.client.WithTx(func(tx db.Client) error {
+		for i, movie := range movies {
+			if results[i].Err != nil {
+				continue
+			}
+
+			results[i].Err = tx.WithTx(func(item db.Client) error {
+				return createMovie(item, movie)
+			})
+			if results[i].Err != nil && mode == ModeAtomic {
+				return errItemFailed
+			}
+		}
+
+		// the created movies are read back in the transaction for their ids
+		details, err := app.New(tx).GetMovieDetails(nil)
+		if err != nil {
+			return err
+		}
+		for i, movie := range movies {
+			if results[i].Err != nil {
+				continue
+			}
+			for _, detail := range details {
+				if detail.Movie.Title == movie.Title {
+					results[i].Detail = detail
+				}
+			}
+		}
+
+		return nil
+	})
+	if err == errItemFailed {
+		abortMovies(results)
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// UpsertRatings sets the ratings in one transaction and returns a result per rating, in order.
+// In atomic mode nothing is set unless every rating can be. In per item mode each rating is set in
+// a savepoint of its own, so one that fails only leaves itself out.
+func (p *Processor) UpsertRatings(ratings []Rating, mode string, author string) ([]RatingResult, error) {
+	mode, err := p.check(len(ratings), mode)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := p.app.GetMovieDetails(nil)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int]app.MovieDetails{}
+	for _, detail := range details {
+		byID[detail.Movie.ID] = detail
+	}
+
+	results := make([]RatingResult, len(ratings))
+	for i, rating := range ratings {
+		results[i].Err = validateRating(rating, byID)
+	}
+	if mode == ModeAtomic && anyRatingFailed(results) {
+		abortRatings(results)
+		return results, nil
+	}
+
+	now := time.Now()
+	err = p.client.WithTx(func(tx db.Client) error {
+		for i, rating := range ratings {
+			if results[i].Err != nil {
+				continue
+			}
+
+			results[i].Err = tx.WithTx(func(item db.Client) error {
+				var err error
+				results[i].Changed, err = item.ObserveRating(byID[rating.MovieID].MovieRatings.ID, rating.Source, rating.Value, rating.Version, author, now)
+				return err
+			})
+			if results[i].Err != nil && mode == ModeAtomic {
+				return errItemFailed
+			}
+		}
+
+		return nil
+	})
+	if err == errItemFailed {
+		abortRatings(results)
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// GetMovies returns a result per id, in order, with ErrNotFound for the ids that have no movie.
+// In atomic mode every id gets an error when one of them has no movie.
+func (p *Processor) GetMovies(ids []int, mode string) ([]MovieResult, error) {
+	mode, err := p.check(len(ids), mode)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := p.app.GetMovieDetails(nil)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int]app.MovieDetails{}
+	for _, detail := range details {
+		byID[detail.Movie.ID] = detail
+	}
+
+	results := make([]MovieResult, len(ids))
+	for i, id := range ids {
+		detail, ok := byID[id]
+		if !ok {
+			results[i].Err = ErrNotFound
+			continue
+		}
+		results[i].Detail = detail
+	}
+	if mode == ModeAtomic && anyMovieFailed(results) {
+		abortMovies(results)
+	}
+
+	return results, nil
+}
+
+// check returns the mode of a batch of n items, or why the batch can not run
+func (p *Processor) check(n int, mode string) (string, error) {
+	if mode == "" {
+		mode = ModeAtomic
+	}
+	if mode != ModeAtomic && mode != ModePerItem {
+		return "", ErrUnknownMode
+	}
+	if n == 0 {
+		return "", ErrEmpty
+	}
+	if n > p.config.MaxSize {
+		return "", fmt.Errorf("%w, the most is %d", ErrTooLarge, p.config.MaxSize)
+	}
+
+	return mode, nil
+}
+
+func validateMovie(movie Movie, taken map[string]bool) error {
+	if movie.Title == "" {
+		return app.ErrEmptyTitle
+	}
+	if taken[movie.Title] {
+		return app.ErrDuplicateTitle
+	}
+
+	sources := map[string]bool{}
+	for _, rating := range movie.Ratings {
+		switch {
+		case rating.Source == "":
+			return ErrEmptySource
+		case sources[rating.Source]:
+			return ErrDuplicateSource
+		case rating.Value < 0 || rating.Value > 100:
+			return app.ErrInvalidRating
+		}
+		sources[rating.Source] = true
+	}
+
+	return nil
+}
+
+func validateRating(rating Rating, byID map[int]app.MovieDetails) error {
+	switch {
+	case rating.Source == "":
+		return ErrEmptySource
+	case rating.Value < 0 || rating.Value > 100:
+		return app.ErrInvalidRating
+	}
+
+	if _, ok := byID[rating.MovieID]; !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func createMovie(client db.Client, movie Movie) error {
+	err := client.CreateMovie(models.Movies{
+		Title:    movie.Title,
+		Plot:     movie.Plot,
+		Genre:    movie.Genre,
+		Year:     movie.Year,
+		Rated:    movie.Rated,
+		Director: movie.Director,
+		Actors:   movie.Actors,
+		Released: movie.Released,
+	})
+	if err != nil {
+		return err
+	}
+
+	// a movie is only listed once it has movie ratings, even without ratings in them
+	return client.CreateMovieRating(models.MovieRatings{Title: movie.Title, Ratings: movie.Ratings})
+}
+
+func anyMovieFailed(results []MovieResult) bool {
+	for _, result := range results {
+		if result.Err != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func anyRatingFailed(results []RatingResult) bool {
+	for _, result := range results {
+		if result.Err != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// abortMovies fails the items of an atomic batch that did not fail themselves
+func abortMovies(results []MovieResult) {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i] = MovieResult{Err: ErrAborted}
+		}
+	}
+}
+
+func abortRatings(results []RatingResult) {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i] = RatingResult{Err: ErrAborted}
+		}
+	}
+}
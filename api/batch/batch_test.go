@@ -0,0 +1,277 @@
+package batch
+
+import (
+	"errors"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"movie-rating-api/models"
+	"testing"
+)
+
+// errScripted is the error of a write the fake db is scripted to fail
+var errScripted = errors.New("disk full")
+
+func newTestProcessor(t *testing.T, config db.FakeConfig) (*Processor, db.Client) {
+	client := dbtest.NewFake(t, config)
+	batchConfig := DefaultConfig()
+	batchConfig.MaxSize = 5
+	return NewProcessor(client, app.New(client), batchConfig), client
+}
+
+// checkErrors compares the errors of the results to the expected ones, in order
+func checkErrors(t *testing.T, got []error, want []error) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d results, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if want[i] == errScripted {
+			if got[i] == nil || got[i].Error() != errScripted.Error() {
+				t.Errorf("expected item %d to fail with the db, got %v", i, got[i])
+			}
+			continue
+		}
+		if !errors.Is(got[i], want[i]) {
+			t.Errorf("expected item %d to give %v, got %v", i, want[i], got[i])
+		}
+	}
+}
+
+func titles(t *testing.T, client db.Client) map[string]bool {
+	movies, err := client.GetMovies()
+	if err != nil {
+		t.Fatalf("failed to get movies: %s", err.Error())
+	}
+	byTitle := map[string]bool{}
+	for _, movie := range movies {
+		byTitle[movie.Title] = true
+	}
+	return byTitle
+}
+
+func TestBatchSize(t *testing.T) {
+	processor, _ := newTestProcessor(t, db.FakeConfig{})
+
+	for _, test := range []struct {
+		name string
+		ids  []int
+		mode string
+		err  error
+	}{
+		{"atomic by default", []int{1}, "", nil},
+		{"per item", []int{1}, ModePerItem, nil},
+		{"unknown mode", []int{1}, "some", ErrUnknownMode},
+		{"empty", []int{}, ModeAtomic, ErrEmpty},
+		{"the most items", []int{1, 2, 3, 4, 5}, ModeAtomic, nil},
+		{"too many items", []int{1, 2, 3, 4, 5, 6}, ModePerItem, ErrTooLarge},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := processor.GetMovies(test.ids, test.mode)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestCreateMovies(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		mode   string
+		script map[string][]string
+		movies []Movie
+		errs   []error
+		// created are the titles that are written
+		created []string
+	}{
+		{
+			name:    "atomic",
+			mode:    ModeAtomic,
+			movies:  []Movie{{Title: "Brazil", Ratings: []models.Ratings{{Source: "Metacritic", Value: 84}}}, {Title: "Alien"}},
+			errs:    []error{nil, nil},
+			created: []string{"Brazil", "Alien"},
+		},
+		{
+			name:   "atomic with an invalid movie",
+			mode:   ModeAtomic,
+			movies: []Movie{{Title: "Brazil"}, {Title: "Life of Brian"}},
+			errs:   []error{ErrAborted, app.ErrDuplicateTitle},
+		},
+		{
+			name:   "atomic with a failed write",
+			mode:   ModeAtomic,
+			script: map[string][]string{"CreateMovie": {"", errScripted.Error()}},
+			movies: []Movie{{Title: "Brazil"}, {Title: "Alien"}, {Title: "Delicatessen"}},
+			errs:   []error{ErrAborted, errScripted, ErrAborted},
+		},
+		{
+			name: "per item with invalid movies",
+			mode: ModePerItem,
+			movies: []Movie{
+				{Title: "Brazil"},
+				{Title: ""},
+				{Title: "Alien", Ratings: []models.Ratings{{Source: "Metacritic", Value: 1}, {Source: "Metacritic", Value: 2}}},
+				{Title: "Brazil"},
+				{Title: "Delicatessen", Ratings: []models.Ratings{{Source: "Metacritic", Value: 101}}},
+			},
+			errs:    []error{nil, app.ErrEmptyTitle, ErrDuplicateSource, app.ErrDuplicateTitle, app.ErrInvalidRating},
+			created: []string{"Brazil"},
+		},
+		{
+			name:    "per item with a failed write",
+			mode:    ModePerItem,
+			script:  map[string][]string{"CreateMovieRating": {"", errScripted.Error()}},
+			movies:  []Movie{{Title: "Brazil"}, {Title: "Alien"}, {Title: "Delicatessen"}},
+			errs:    []error{nil, errScripted, nil},
+			created: []string{"Brazil", "Delicatessen"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			processor, client := newTestProcessor(t, db.FakeConfig{Script: test.script})
+
+			results, err := processor.CreateMovies(test.movies, test.mode)
+			if err != nil {
+				t.Fatalf("failed to create movies: %s", err.Error())
+			}
+			var errs []error
+			for _, result := range results {
+				errs = append(errs, result.Err)
+			}
+			checkErrors(t, errs, test.errs)
+			for i, result := range results {
+				if result.Err == nil && result.Detail.Movie.Title != test.movies[i].Title {
+					t.Errorf("expected item %d to hold the created movie, got %+v", i, result.Detail.Movie)
+				}
+			}
+
+			// a failed item leaves nothing behind, the movie it created before its ratings failed included
+			written := titles(t, client)
+			for _, title := range []string{"Brazil", "Alien", "Delicatessen"} {
+				want := false
+				for _, created := range test.created {
+					want = want || created == title
+				}
+				if written[title] != want {
+					t.Errorf("expected %s to be written %t, got %t", title, want, written[title])
+				}
+			}
+		})
+	}
+}
+
+func TestUpsertRatings(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		mode    string
+		ratings []Rating
+		errs    []error
+		// set are the values of the batch source on movies 1 and 2 afterwards, 0 when it has none
+		set [2]int
+	}{
+		{
+			name:    "atomic",
+			mode:    ModeAtomic,
+			ratings: []Rating{{MovieID: 1, Source: "Batch", Value: 10}, {MovieID: 2, Source: "Batch", Value: 20}},
+			errs:    []error{nil, nil},
+			set:     [2]int{10, 20},
+		},
+		{
+			name:    "atomic with an unknown movie",
+			mode:    ModeAtomic,
+			ratings: []Rating{{MovieID: 1, Source: "Batch", Value: 10}, {MovieID: 999, Source: "Batch", Value: 20}},
+			errs:    []error{ErrAborted, ErrNotFound},
+		},
+		{
+			name:    "atomic with a stale version",
+			mode:    ModeAtomic,
+			ratings: []Rating{{MovieID: 1, Source: "Batch", Value: 10}, {MovieID: 2, Source: "Batch", Value: 20, Version: 999}},
+			errs:    []error{ErrAborted, db.ErrVersionMismatch},
+		},
+		{
+			name: "per item",
+			mode: ModePerItem,
+			ratings: []Rating{
+				{MovieID: 1, Source: "Batch", Value: 10},
+				{MovieID: 1, Source: "", Value: 10},
+				{MovieID: 1, Source: "Batch", Value: 101},
+				{MovieID: 999, Source: "Batch", Value: 10},
+				{MovieID: 2, Source: "Batch", Value: 20, Version: 999},
+			},
+			errs: []error{nil, ErrEmptySource, app.ErrInvalidRating, ErrNotFound, db.ErrVersionMismatch},
+			set:  [2]int{10, 0},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			processor, client := newTestProcessor(t, db.FakeConfig{})
+
+			results, err := processor.UpsertRatings(test.ratings, test.mode, "alice")
+			if err != nil {
+				t.Fatalf("failed to upsert ratings: %s", err.Error())
+			}
+			var errs []error
+			for _, result := range results {
+				errs = append(errs, result.Err)
+			}
+			checkErrors(t, errs, test.errs)
+
+			for i, want := range test.set {
+				ratings, _, err := client.GetMovieRatingsOf(i + 1)
+				if err != nil {
+					t.Fatalf("failed to get ratings: %s", err.Error())
+				}
+				got := 0
+				for _, rating := range ratings.Ratings {
+					if rating.Source == "Batch" {
+						got = rating.Value
+					}
+				}
+				if got != want {
+					t.Errorf("expected movie %d to be rated %d, got %d", i+1, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestUpsertRatingsReportsUnchangedRatings(t *testing.T) {
+	processor, _ := newTestProcessor(t, db.FakeConfig{})
+	ratings := []Rating{{MovieID: 1, Source: "Batch", Value: 10}}
+
+	for _, changed := range []bool{true, false} {
+		results, err := processor.UpsertRatings(ratings, ModeAtomic, "alice")
+		if err != nil || results[0].Err != nil {
+			t.Fatalf("failed to upsert ratings: %v %v", err, results)
+		}
+		if results[0].Changed != changed {
+			t.Fatalf("expected changed to be %t, got %t", changed, results[0].Changed)
+		}
+	}
+}
+
+func TestGetMovies(t *testing.T) {
+	for _, test := range []struct {
+		mode string
+		errs []error
+	}{
+		{ModeAtomic, []error{ErrAborted, ErrNotFound, ErrAborted}},
+		{ModePerItem, []error{nil, ErrNotFound, nil}},
+	} {
+		t.Run(test.mode, func(t *testing.T) {
+			processor, _ := newTestProcessor(t, db.FakeConfig{})
+
+			results, err := processor.GetMovies([]int{1, 999, 2}, test.mode)
+			if err != nil {
+				t.Fatalf("failed to get movies: %s", err.Error())
+			}
+			var errs []error
+			for _, result := range results {
+				errs = append(errs, result.Err)
+			}
+			checkErrors(t, errs, test.errs)
+			if test.mode == ModePerItem && (results[0].Detail.Movie.ID != 1 || results[2].Detail.Movie.ID != 2) {
+				t.Fatalf("expected the movies in the order of their ids, got %+v", results)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package batch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ConfigPath is where the playground docker-compose mounts its config directory
+const ConfigPath = "/config/batch.json"
+
+type Config struct {
+	// MaxSize is the most items a batch request can hold
+	MaxSize int `json:"max_size"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxSize: 100,
+	}
+}
+
+// LoadConfig reads the config file at path, DefaultConfig is returned when the file does not exist
+func LoadConfig(path string) (Config, error) {
+	bytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read batch config: %s", err.Error())
+	}
+
+	config := DefaultConfig()
+	err = json.Unmarshal(bytes, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse batch config: %s", err.Error())
+	}
+
+	if config.MaxSize <= 0 {
+		return Config{}, fmt.Errorf("batch max_size must be positive")
+	}
+	return config, nil
+}
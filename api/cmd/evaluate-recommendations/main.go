@@ -0,0 +1,177 @@
+// evaluate-recommendations measures how well the recommendations predict what users like.
+// A share of every user's liked movies is held out, the model is trained on the rest,
+// and precision@k is how many of the top k recommendations are held out movies.
+// The same is measured for recommending the best rated movies to everyone as a baseline.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/models"
+	"movie-rating-api/recommend"
+	"time"
+)
+
+// likedScore is the lowest score that counts as a hit when held out
+const likedScore = 70
+
+func main() {
+	dbKind := flag.String("db", "fake", "postgres, or fake for an in memory db seeded with the same movies")
+	k := flag.Int("k", 5, "number of recommendations scored per user")
+	holdout := flag.Float64("holdout", 0.2, "share of every user's liked movies held out of training")
+	seed := flag.Int64("seed", 1, "seed of the holdout split and the synthetic users")
+	syntheticUsers := flag.Int("synthetic-users", 0, "number of users with random genre tastes added to the stored ratings")
+	flag.Parse()
+
+	client, err := connect(*dbKind)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	catalogue, err := app.New(client).GetMovieDetails(nil)
+	if err != nil {
+		log.Fatalf("failed to get movies: %s\n", err.Error())
+	}
+
+	ratings, err := client.GetUserRatings("")
+	if err != nil {
+		log.Fatalf("failed to get user ratings: %s\n", err.Error())
+	}
+
+	random := rand.New(rand.NewSource(*seed))
+	ratings = append(ratings, synthesize(random, catalogue, *syntheticUsers)...)
+	if len(ratings) == 0 {
+		log.Fatalln("there are no user ratings to evaluate, rate some movies or pass -synthetic-users")
+	}
+
+	train, test := split(random, ratings, *holdout)
+	model := recommend.Train(train)
+	popular := recommend.Recommend(recommend.Train(nil), recommend.AnonymousUser, catalogue, 0, time.Now())
+
+	var users int
+	var hits, baselineHits float64
+	for userID, heldOut := range test {
+		users++
+		recommendations := recommend.Recommend(model, userID, catalogue, *k, time.Now())
+		hits += precision(recommendations, heldOut, *k)
+
+		// the baseline skips the movies the user rated in training just like the model does
+		var unseen []models.Recommendations
+		for _, recommendation := range popular {
+			if _, rated := model.Rated(userID)[recommendation.MovieID]; !rated {
+				unseen = append(unseen, recommendation)
+			}
+		}
+		baselineHits += precision(unseen, heldOut, *k)
+	}
+
+	if users == 0 {
+		log.Fatalln("no user has a liked movie to hold out, lower the holdout or add ratings")
+	}
+
+	fmt.Printf("%-26s %d\n", "users evaluated:", users)
+	fmt.Printf("%-26s %d\n", "ratings used in training:", len(train))
+	fmt.Printf("%-26s %.3f\n", fmt.Sprintf("precision@%d:", *k), hits/float64(users))
+	fmt.Printf("%-26s %.3f\n", fmt.Sprintf("popularity precision@%d:", *k), baselineHits/float64(users))
+}
+
+func connect(kind string) (db.Client, error) {
+	switch kind {
+	case "fake":
+		return db.NewFakeClient(db.FakeConfig{})
+	case "postgres":
+		gormDB, err := db.InitializeDB()
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize db: %s", err.Error())
+		}
+		return db.NewDBCLient(gormDB), nil
+	default:
+		return nil, fmt.Errorf("unknown db %q", kind)
+	}
+}
+
+// synthesize makes up users who like one or two genres and rate movies in them higher
+func synthesize(random *rand.Rand, catalogue []app.MovieDetails, users int) []models.UserRatings {
+	var genres []string
+	seen := map[string]bool{}
+	for _, details := range catalogue {
+		for _, genre := range app.SplitList(details.Movie.Genre) {
+			if !seen[genre] {
+				seen[genre] = true
+				genres = append(genres, genre)
+			}
+		}
+	}
+	if len(genres) == 0 {
+		return nil
+	}
+
+	var ratings []models.UserRatings
+	for i := 0; i < users; i++ {
+		userID := fmt.Sprintf("synthetic-%d", i)
+		likes := map[string]bool{}
+		for j := 0; j < 1+random.Intn(2); j++ {
+			likes[genres[random.Intn(len(genres))]] = true
+		}
+
+		for _, details := range catalogue {
+			// users only rate about half of the movies
+			if random.Float64() < 0.5 {
+				continue
+			}
+
+			score := 20 + random.Intn(40)
+			for _, genre := range app.SplitList(details.Movie.Genre) {
+				if likes[genre] {
+					score = 70 + random.Intn(31)
+				}
+			}
+
+			ratings = append(ratings, models.UserRatings{
+				UserID:    userID,
+				MovieID:   details.Movie.ID,
+				Score:     score,
+				UpdatedAt: time.Now(),
+			})
+		}
+	}
+
+	return ratings
+}
+
+// split holds out a share of every user's liked movies, test maps each user to their held out movie ids
+func split(random *rand.Rand, ratings []models.UserRatings, holdout float64) ([]models.UserRatings, map[string]map[int]bool) {
+	var train []models.UserRatings
+	test := map[string]map[int]bool{}
+	for _, rating := range ratings {
+		if rating.Score >= likedScore && random.Float64() < holdout {
+			if test[rating.UserID] == nil {
+				test[rating.UserID] = map[int]bool{}
+			}
+			test[rating.UserID][rating.MovieID] = true
+			continue
+		}
+
+		train = append(train, rating)
+	}
+
+	return train, test
+}
+
+func precision(recommendations []models.Recommendations, heldOut map[int]bool, k int) float64 {
+	var hits int
+	for i, recommendation := range recommendations {
+		if i == k {
+			break
+		}
+		if heldOut[recommendation.MovieID] {
+			hits++
+		}
+	}
+
+	return float64(hits) / float64(k)
+}
@@ -0,0 +1,90 @@
+// load-movies bulk loads a catalogue of movies and their ratings, in the json of the seeded movies and ratings.
+// Movies and movie ratings whose title is already taken are skipped, so a load can be run again after it fails.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"movie-rating-api/db"
+	"movie-rating-api/models"
+	"os"
+)
+
+func main() {
+	dbKind := flag.String("db", "postgres", "postgres, sqlite for the file given by -sqlite, or fake for an in memory db seeded with the same movies")
+	sqlitePath := flag.String("sqlite", "movies.db", "sqlite file loaded into with -db sqlite")
+	moviesPath := flag.String("movies", "", "json file with an array of movies")
+	ratingsPath := flag.String("ratings", "", "json file with an array of movie ratings, each with its ratings")
+	flag.Parse()
+
+	if *moviesPath == "" && *ratingsPath == "" {
+		log.Fatalln("nothing to load, pass -movies or -ratings")
+	}
+
+	var movies []models.Movies
+	err := readJSON(*moviesPath, &movies)
+	if err != nil {
+		log.Fatalf("failed to read movies: %s\n", err.Error())
+	}
+
+	var movieRatings []models.MovieRatings
+	err = readJSON(*ratingsPath, &movieRatings)
+	if err != nil {
+		log.Fatalf("failed to read movie ratings: %s\n", err.Error())
+	}
+
+	client, err := connect(*dbKind, *sqlitePath)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	result, err := client.BulkLoad(movies, movieRatings, func(progress db.BulkProgress) {
+		log.Printf("%s: %d of %d rows\n", progress.Table, progress.Written, progress.Total)
+	})
+	if err != nil {
+		log.Fatalf("failed to load movies: %s\n", err.Error())
+	}
+
+	fmt.Printf("%-15s %d\n", "movies:", result.Movies)
+	fmt.Printf("%-15s %d\n", "movie ratings:", result.MovieRatings)
+	fmt.Printf("%-15s %d\n", "ratings:", result.Ratings)
+	fmt.Printf("%-15s %d\n", "skipped:", result.Skipped)
+}
+
+// readJSON decodes the file into v, leaving v alone when no file is given
+func readJSON(path string, v interface{}) error {
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewDecoder(file).Decode(v)
+}
+
+func connect(kind string, sqlitePath string) (db.Client, error) {
+	switch kind {
+	case "fake":
+		return db.NewFakeClient(db.FakeConfig{})
+	case "sqlite":
+		gormDB, err := db.Connect("sqlite3", sqlitePath, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open sqlite db: %s", err.Error())
+		}
+		return db.NewDBCLient(gormDB), nil
+	case "postgres":
+		gormDB, err := db.InitializeDB()
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize db: %s", err.Error())
+		}
+		return db.NewDBCLient(gormDB), nil
+	default:
+		return nil, fmt.Errorf("unknown db %q", kind)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"movie-rating-api/db"
+	"movie-rating-api/models"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, name string, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(contents), 0644)
+	if err != nil {
+		t.Fatalf("failed to write %s: %s", name, err.Error())
+	}
+	return path
+}
+
+func TestReadJSON(t *testing.T) {
+	movies := []models.Movies{{Title: "Brazil"}}
+	err := readJSON("", &movies)
+	if err != nil || len(movies) != 1 {
+		t.Fatalf("expected no file to leave the movies alone, got %v %v", movies, err)
+	}
+
+	path := writeFile(t, "ratings.json", `[{"Title": "Brazil", "ratings": [{"source": "Metacritic", "value": 84}]}]`)
+	var movieRatings []models.MovieRatings
+	err = readJSON(path, &movieRatings)
+	if err != nil {
+		t.Fatalf("failed to read ratings: %s", err.Error())
+	}
+	if len(movieRatings) != 1 || movieRatings[0].Title != "Brazil" || movieRatings[0].Ratings[0].Value != 84 {
+		t.Fatalf("expected the movie ratings of the file, got %+v", movieRatings)
+	}
+
+	if err = readJSON(filepath.Join(t.TempDir(), "missing.json"), &movies); err == nil {
+		t.Fatalf("expected a missing file to fail")
+	}
+	if err = readJSON(writeFile(t, "bad.json", `{`), &movies); err == nil {
+		t.Fatalf("expected bad json to fail")
+	}
+}
+
+func TestLoadIntoSQLiteCanBeRunAgain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "movies.db")
+	movies := []models.Movies{{Title: "Brazil"}, {Title: "Alien"}}
+	movieRatings := []models.MovieRatings{{Title: "Brazil", Ratings: []models.Ratings{{Source: "Metacritic", Value: 84}}}}
+
+	expected := []db.BulkResult{{Movies: 2, MovieRatings: 1, Ratings: 1}, {Skipped: 3}}
+	for run, want := range expected {
+		client, err := connect("sqlite", path)
+		if err != nil {
+			t.Fatalf("failed to connect: %s", err.Error())
+		}
+		result, err := client.BulkLoad(movies, movieRatings, nil)
+		if err != nil {
+			t.Fatalf("failed to load: %s", err.Error())
+		}
+		if result != want {
+			t.Fatalf("expected run %d to give %+v, got %+v", run+1, want, result)
+		}
+	}
+
+	if _, err := connect("mysql", path); err == nil {
+		t.Fatalf("expected an unknown db to be refused")
+	}
+}
@@ -0,0 +1,587 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"movie-rating-api/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// progressEvery is about how many rows are written between progress reports
+	progressEvery = 10000
+	// sqliteMaxVariables is the most placeholders sqlite takes in one statement
+	sqliteMaxVariables = 999
+	// titleChunk is how many titles are looked up in one query
+	titleChunk = 500
+)
+
+type BulkDB interface {
+	// BulkLoad writes the movies and movie ratings in one transaction, with the ratings of the movie ratings it writes.
+	// Those whose title or id is already taken, trashed ones included, are skipped rather than failing the load.
+	// Postgres copies the rows into staging tables with COPY and merges them with INSERT ... ON CONFLICT,
+	// other databases insert them a batch at a time. Every row written is logged in the change log like any
+	// other create. progress, when not nil, is called as the rows of each table are written.
+	BulkLoad(movies []models.Movies, movieRatings []models.MovieRatings, progress func(BulkProgress)) (BulkResult, error)
+}
+
+// BulkProgress is how far a BulkLoad has got with one table
+type BulkProgress struct {
+	Table   string
+	Written int
+	Total   int
+}
+
+// BulkResult counts what a BulkLoad wrote and skipped
+type BulkResult struct {
+	Movies       int `json:"movies"`
+	MovieRatings int `json:"movie_ratings"`
+	Ratings      int `json:"ratings"`
+	// Skipped counts the movies and movie ratings whose title or id was taken
+	Skipped int `json:"skipped"`
+}
+
+func (d dbClient) BulkLoad(movies []models.Movies, movieRatings []models.MovieRatings, progress func(BulkProgress)) (BulkResult, error) {
+	if progress == nil {
+		progress = func(BulkProgress) {}
+	}
+
+	var result BulkResult
+	var events []Event
+	at := time.Now()
+	err := d.transaction(func(tx *gorm.DB) error {
+		load := bulkLoad{tx: tx, progress: progress, postgres: tx.Dialect().GetName() == "postgres"}
+
+		createdMovies, err := load.movies(movies, at)
+		if err != nil {
+			return err
+		}
+		createdMovieRatings, err := load.movieRatings(movieRatings, at)
+		if err != nil {
+			return err
+		}
+
+		var changes []Change
+		for _, movie := range createdMovies {
+			changes = append(changes, Change{
+				Entity:    EntityMovie,
+				EntityID:  strconv.Itoa(movie.ID),
+				Operation: OperationCreate,
+				After:     movie,
+				EventType: EventMovieCreated,
+				EventData: MovieEvent{ID: movie.ID, Title: movie.Title, Year: movie.Year, Genre: movie.Genre},
+			})
+		}
+
+		var titles []string
+		for _, rating := range createdMovieRatings {
+			titles = append(titles, rating.Title)
+		}
+		movieIDs, err := idsByTitle(tx, "movies", titles, false)
+		if err != nil {
+			return err
+		}
+
+		var ratings, observations [][]interface{}
+		for _, rating := range createdMovieRatings {
+			// the ratings are logged as changes of their own
+			after := rating
+			after.Ratings = nil
+			changes = append(changes, Change{
+				Entity:    EntityMovieRatings,
+				EntityID:  strconv.Itoa(rating.ID),
+				Operation: OperationCreate,
+				After:     after,
+			})
+
+			for _, r := range rating.Ratings {
+				ratings = append(ratings, []interface{}{r.MovieRatingsID, r.Source, r.Value, r.CreatedAt, r.UpdatedAt})
+				observations = append(observations, []interface{}{r.MovieRatingsID, r.Source, r.Value, rating.CreatedAt})
+				changes = append(changes, Change{
+					Entity:    EntityRating,
+					EntityID:  ratingID(rating.ID, r.Source),
+					Operation: OperationCreate,
+					After:     r,
+					EventType: EventRatingCreated,
+					EventData: RatingEvent{
+						MovieRatingsID: rating.ID,
+						MovieID:        movieIDs[rating.Title],
+						Title:          rating.Title,
+						Source:         r.Source,
+						Value:          r.Value,
+					},
+				})
+			}
+		}
+
+		err = load.write("ratings", []string{"movie_ratings_id", "source", "value", "created_at", "updated_at"}, ratings)
+		if err != nil {
+			return err
+		}
+		err = load.write("rating_observations", []string{"movie_ratings_id", "source", "value", "observed_at"}, observations)
+		if err != nil {
+			return err
+		}
+
+		events, err = d.recordChanges(load, changes, at)
+		if err != nil {
+			return err
+		}
+
+		result = BulkResult{
+			Movies:       len(createdMovies),
+			MovieRatings: len(createdMovieRatings),
+			Ratings:      len(ratings),
+			Skipped:      len(movies) - len(createdMovies) + len(movieRatings) - len(createdMovieRatings),
+		}
+		return nil
+	})
+	if err != nil {
+		return BulkResult{}, err
+	}
+
+	if result.Movies+result.MovieRatings != 0 {
+		d.committed(events...)
+	}
+	return result, nil
+}
+
+// recordChanges appends the changes to the change log like recordChange does one at a time. Replicas are
+// told to reload rather than sent the events, there would be too many to announce one by one.
+func (d dbClient) recordChanges(load bulkLoad, changes []Change, now time.Time) ([]Event, error) {
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	var events []Event
+	var rows [][]interface{}
+	for _, change := range changes {
+		var event Event
+		if change.EventType != "" {
+			var err error
+			event, err = newEvent(change.EventType, change.EventData, now)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		}
+
+		row, err := newChangeEvent(change, event, now)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, []interface{}{
+			row.EventID, row.Type, row.Entity, row.EntityID, row.Operation, row.Before, row.After, row.Data, d.origin, row.CreatedAt,
+		})
+	}
+
+	if load.postgres {
+		err := load.tx.Exec("SELECT pg_advisory_xact_lock(?)", changeLogLock).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := load.write("change_events", []string{
+		"event_id", "type", "entity", "entity_id", "operation", "before", "after", "data", "origin", "created_at",
+	}, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.invalidateReplicas(load.tx)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// bulkLoad writes rows inside the transaction of a BulkLoad
+type bulkLoad struct {
+	tx       *gorm.DB
+	progress func(BulkProgress)
+	postgres bool
+}
+
+// movies writes the movies whose title and id are free and returns them as written
+func (b bulkLoad) movies(movies []models.Movies, at time.Time) ([]models.Movies, error) {
+	// a title given twice is written once, from its first row
+	seen := map[string]bool{}
+	var unique []models.Movies
+	for _, movie := range movies {
+		if !seen[movie.Title] {
+			seen[movie.Title] = true
+			unique = append(unique, movie)
+		}
+	}
+	movies = unique
+
+	var rows [][]interface{}
+	for _, movie := range movies {
+		movie.CreatedAt, movie.UpdatedAt = createdAt(movie.CreatedAt, movie.UpdatedAt, at)
+		rows = append(rows, []interface{}{
+			optionalID(movie.ID), movie.Title, movie.Plot, movie.Genre, movie.Year, movie.Rated,
+			movie.Director, movie.Actors, movie.Released, movie.CreatedAt, movie.UpdatedAt,
+		})
+	}
+
+	ids, err := b.merge("movies", []string{
+		"id", "title", "plot", "genre", "year", "rated", "director", "actors", "released", "created_at", "updated_at",
+	}, []string{"integer", "text", "text", "text", "text", "text", "text", "text", "text", "timestamptz", "timestamptz"}, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []models.Movies
+	for _, movie := range movies {
+		id, ok := ids[movie.Title]
+		if !ok {
+			continue
+		}
+
+		movie.ID = id
+		movie.Version = 1
+		movie.CreatedAt, movie.UpdatedAt = createdAt(movie.CreatedAt, movie.UpdatedAt, at)
+		movie.DeletedAt = nil
+		created = append(created, movie)
+	}
+
+	return created, nil
+}
+
+// movieRatings writes the movie ratings whose title and id are free and returns them as written,
+// with their ratings pointing at them. The ratings themselves are left to the caller.
+func (b bulkLoad) movieRatings(movieRatings []models.MovieRatings, at time.Time) ([]models.MovieRatings, error) {
+	seen := map[string]bool{}
+	var unique []models.MovieRatings
+	for _, rating := range movieRatings {
+		if !seen[rating.Title] {
+			seen[rating.Title] = true
+			unique = append(unique, rating)
+		}
+	}
+	movieRatings = unique
+
+	var rows [][]interface{}
+	for _, rating := range movieRatings {
+		rating.CreatedAt, rating.UpdatedAt = createdAt(rating.CreatedAt, rating.UpdatedAt, at)
+		rows = append(rows, []interface{}{optionalID(rating.ID), rating.Title, rating.CreatedAt, rating.UpdatedAt})
+	}
+
+	ids, err := b.merge("movie_ratings", []string{"id", "title", "created_at", "updated_at"}, []string{"integer", "text", "timestamptz", "timestamptz"}, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []models.MovieRatings
+	for _, rating := range movieRatings {
+		id, ok := ids[rating.Title]
+		if !ok {
+			continue
+		}
+
+		rating.ID = id
+		rating.Version = 1
+		rating.CreatedAt, rating.UpdatedAt = createdAt(rating.CreatedAt, rating.UpdatedAt, at)
+		rating.DeletedAt = nil
+		rating.Ratings = append([]models.Ratings{}, rating.Ratings...)
+		for i := range rating.Ratings {
+			rating.Ratings[i].MovieRatingsID = id
+			rating.Ratings[i].MovieRatings = nil
+			rating.Ratings[i].CreatedAt, rating.Ratings[i].UpdatedAt = createdAt(rating.Ratings[i].CreatedAt, rating.Ratings[i].UpdatedAt, at)
+			rating.Ratings[i].DeletedAt = nil
+		}
+		created = append(created, rating)
+	}
+
+	return created, nil
+}
+
+// merge writes the rows of a table with a unique title, skipping those whose title or id is taken,
+// and returns the ids of the titles it wrote. columns start with id and title, an id may be nil for the
+// table's sequence to pick one. types are the postgres types of the columns for the staging table.
+func (b bulkLoad) merge(table string, columns []string, types []string, rows [][]interface{}) (map[string]int, error) {
+	if len(rows) == 0 {
+		return map[string]int{}, nil
+	}
+
+	if b.postgres {
+		return b.mergeCopy(table, columns, types, rows)
+	}
+	return b.mergeInsert(table, columns, rows)
+}
+
+func (b bulkLoad) mergeCopy(table string, columns []string, types []string, rows [][]interface{}) (map[string]int, error) {
+	staging := "bulk_" + table
+	var definitions []string
+	for i, column := range columns {
+		definitions = append(definitions, column+" "+types[i])
+	}
+	err := b.tx.Exec("CREATE TEMPORARY TABLE " + staging + " (ord serial, " + strings.Join(definitions, ", ") + ")").Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.copyRows(staging, table, columns, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// the rows go in the order they were given, the sequence fills in the ids that were not
+	values := append([]string{fmt.Sprintf("COALESCE(id, nextval(pg_get_serial_sequence('%s', 'id')))", table)}, columns[1:]...)
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) SELECT %s FROM %s ORDER BY ord ON CONFLICT DO NOTHING RETURNING id, title",
+		table, strings.Join(columns, ", "), strings.Join(values, ", "), staging,
+	)
+	result, err := b.tx.Raw(query).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	ids := map[string]int{}
+	for result.Next() {
+		var id int
+		var title string
+		err = result.Scan(&id, &title)
+		if err != nil {
+			return nil, err
+		}
+		ids[title] = id
+	}
+	if err = result.Err(); err != nil {
+		return nil, err
+	}
+	// the connection is busy until the rows are closed
+	result.Close()
+
+	err = b.tx.Exec("DROP TABLE " + staging).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		if row[0] != nil {
+			// rows given an id leave the sequence behind, it is moved past them so later creates do not collide
+			return ids, b.catchUpSequence(table)
+		}
+	}
+	return ids, nil
+}
+
+// catchUpSequence moves the id sequence of a table past the highest id, it never goes back
+func (b bulkLoad) catchUpSequence(table string) error {
+	var sequence string
+	err := b.tx.Raw("SELECT pg_get_serial_sequence(?, 'id')", table).Row().Scan(&sequence)
+	if err != nil {
+		return err
+	}
+
+	return b.tx.Exec(fmt.Sprintf(
+		"SELECT setval('%[1]s', GREATEST((SELECT MAX(id) FROM %[2]s), (SELECT last_value FROM %[1]s)))", sequence, table,
+	)).Error
+}
+
+func (b bulkLoad) mergeInsert(table string, columns []string, rows [][]interface{}) (map[string]int, error) {
+	var titles []string
+	var givenIDs []int
+	for _, row := range rows {
+		titles = append(titles, row[1].(string))
+		if id, ok := row[0].(int); ok {
+			givenIDs = append(givenIDs, id)
+		}
+	}
+
+	takenTitles, err := idsByTitle(b.tx, table, titles, true)
+	if err != nil {
+		return nil, err
+	}
+	takenIDs, err := existingIDs(b.tx, table, givenIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var free [][]interface{}
+	var freeTitles []string
+	for _, row := range rows {
+		title := row[1].(string)
+		if _, taken := takenTitles[title]; taken {
+			continue
+		}
+		if id, ok := row[0].(int); ok {
+			if takenIDs[id] {
+				continue
+			}
+			takenIDs[id] = true
+		}
+
+		free = append(free, row)
+		freeTitles = append(freeTitles, title)
+	}
+
+	err = b.insertRows(table, table, columns, free)
+	if err != nil {
+		return nil, err
+	}
+
+	return idsByTitle(b.tx, table, freeTitles, true)
+}
+
+// write adds rows to a table that has no unique columns to clash with
+func (b bulkLoad) write(table string, columns []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if b.postgres {
+		return b.copyRows(table, table, columns, rows)
+	}
+	return b.insertRows(table, table, columns, rows)
+}
+
+// copyRows streams the rows into a table with COPY, reporting progress as the rows of report
+func (b bulkLoad) copyRows(table string, report string, columns []string, rows [][]interface{}) error {
+	sqlTx, ok := b.tx.CommonDB().(*sql.Tx)
+	if !ok {
+		return fmt.Errorf("COPY into %s needs a transaction", table)
+	}
+
+	stmt, err := sqlTx.Prepare(pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, row := range rows {
+		_, err = stmt.Exec(row...)
+		if err != nil {
+			return err
+		}
+		if (i+1)%progressEvery == 0 {
+			b.progress(BulkProgress{Table: report, Written: i + 1, Total: len(rows)})
+		}
+	}
+
+	// the buffered rows are flushed and the COPY finished by an Exec without arguments
+	_, err = stmt.Exec()
+	if err != nil {
+		return err
+	}
+
+	b.progress(BulkProgress{Table: report, Written: len(rows), Total: len(rows)})
+	return nil
+}
+
+// insertRows adds the rows to a table with multi-row INSERTs, as many rows at a time as sqlite takes placeholders
+func (b bulkLoad) insertRows(table string, report string, columns []string, rows [][]interface{}) error {
+	batch := sqliteMaxVariables / len(columns)
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	var quoted []string
+	for _, column := range columns {
+		quoted = append(quoted, b.tx.Dialect().Quote(column))
+	}
+
+	for start := 0; start < len(rows); start += batch {
+		end := start + batch
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var values []string
+		var args []interface{}
+		for _, row := range rows[start:end] {
+			values = append(values, placeholders)
+			args = append(args, row...)
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, strings.Join(quoted, ", "), strings.Join(values, ", "))
+		err := b.tx.Exec(query, args...).Error
+		if err != nil {
+			return err
+		}
+		if end/progressEvery != start/progressEvery || end == len(rows) {
+			b.progress(BulkProgress{Table: report, Written: end, Total: len(rows)})
+		}
+	}
+
+	return nil
+}
+
+// idsByTitle returns the ids of the rows of a table with the titles, trashed ones only when trashed is true
+func idsByTitle(tx *gorm.DB, table string, titles []string, trashed bool) (map[string]int, error) {
+	ids := map[string]int{}
+	for start := 0; start < len(titles); start += titleChunk {
+		end := start + titleChunk
+		if end > len(titles) {
+			end = len(titles)
+		}
+
+		query := tx.Table(table).Select("id, title").Where("title IN (?)", titles[start:end])
+		if !trashed {
+			query = query.Where("deleted_at IS NULL")
+		}
+
+		var found []struct {
+			ID    int
+			Title string
+		}
+		err := query.Scan(&found).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range found {
+			ids[row.Title] = row.ID
+		}
+	}
+
+	return ids, nil
+}
+
+// existingIDs returns which of the ids a table already has, trashed rows included
+func existingIDs(tx *gorm.DB, table string, ids []int) (map[int]bool, error) {
+	existing := map[int]bool{}
+	for start := 0; start < len(ids); start += titleChunk {
+		end := start + titleChunk
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		var found []struct {
+			ID int
+		}
+		err := tx.Table(table).Select("id").Where("id IN (?)", ids[start:end]).Scan(&found).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range found {
+			existing[row.ID] = true
+		}
+	}
+
+	return existing, nil
+}
+
+// optionalID is nil for a row without an id, for the database to pick one
+func optionalID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+
+	return id
+}
+
+// createdAt fills in the timestamps of a row that was given none, like gorm does on create
+func createdAt(created time.Time, updated time.Time, at time.Time) (time.Time, time.Time) {
+	if created.IsZero() {
+		created = at
+	}
+	if updated.IsZero() {
+		updated = at
+	}
+
+	return created, updated
+}
@@ -0,0 +1,217 @@
+package db_test
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"movie-rating-api/models"
+	"testing"
+	"time"
+)
+
+// bulkDBs are the dbs bulk loads are tested on, sqlite inserts the rows a batch at a time and
+// postgres copies them into staging tables. The postgres tests only run with TEST_POSTGRES_URL set.
+var bulkDBs = map[string]func(testing.TB) (db.Client, *gorm.DB){
+	"sqlite":   dbtest.NewSQLite,
+	"postgres": dbtest.NewPostgres,
+}
+
+func count(t *testing.T, gormDB *gorm.DB, table string) int {
+	var n int
+	err := gormDB.Table(table).Count(&n).Error
+	if err != nil {
+		t.Fatalf("failed to count %s: %s", table, err.Error())
+	}
+	return n
+}
+
+func TestBulkLoadWritesEveryRow(t *testing.T) {
+	for name, newDB := range bulkDBs {
+		t.Run(name, func(t *testing.T) {
+			client, gormDB := newDB(t)
+			var events []db.Event
+			client.OnEvent(func(event db.Event) { events = append(events, event) })
+
+			// more rows than a sqlite statement takes placeholders for, and more titles than are looked up at once
+			var movies []models.Movies
+			for i := 0; i < 1000; i++ {
+				movies = append(movies, models.Movies{Title: fmt.Sprintf("Movie %04d", i), Year: "1985"})
+			}
+			movies = append(movies, models.Movies{ID: 5000, Title: "Given"})
+			var movieRatings []models.MovieRatings
+			for i := 0; i < 300; i++ {
+				movieRatings = append(movieRatings, models.MovieRatings{
+					Title:   fmt.Sprintf("Movie %04d", i),
+					Ratings: []models.Ratings{{Source: "Metacritic", Value: i % 100}, {Source: "Rotten Tomatoes", Value: 50}},
+				})
+			}
+
+			progress := map[string]db.BulkProgress{}
+			result, err := client.BulkLoad(movies, movieRatings, func(p db.BulkProgress) { progress[p.Table] = p })
+			if err != nil {
+				t.Fatalf("failed to bulk load: %s", err.Error())
+			}
+			if result != (db.BulkResult{Movies: 1001, MovieRatings: 300, Ratings: 600}) {
+				t.Fatalf("expected every row written, got %+v", result)
+			}
+
+			for table, total := range map[string]int{
+				"movies": 1001, "movie_ratings": 300, "ratings": 600, "rating_observations": 600, "change_events": 1901,
+			} {
+				if n := count(t, gormDB, table); n != total {
+					t.Fatalf("expected %d rows in %s, got %d", total, table, n)
+				}
+				if p := progress[table]; p.Written != total || p.Total != total {
+					t.Fatalf("expected the last progress of %s to be all %d rows, got %+v", table, total, p)
+				}
+			}
+			if len(events) != 1601 || events[0].Type != db.EventMovieCreated || events[len(events)-1].Type != db.EventRatingCreated {
+				t.Fatalf("expected an event per movie and rating, got %d", len(events))
+			}
+
+			// the rows without an id are numbered in the order given
+			movie, ok, err := client.GetMovie(1)
+			if err != nil || !ok || movie.Title != "Movie 0000" || movie.Version != 1 {
+				t.Fatalf("expected the first movie at id 1, got %+v %v", movie, err)
+			}
+			ratings, ok, err := client.GetMovieRatingsOf(1)
+			if err != nil || !ok || len(ratings.Ratings) != 2 {
+				t.Fatalf("expected the ratings of the first movie, got %+v %v", ratings, err)
+			}
+			if movie, ok, _ := client.GetMovie(5000); !ok || movie.Title != "Given" {
+				t.Fatalf("expected the movie given an id to keep it, got %+v", movie)
+			}
+
+			// later creates carry on after the highest id
+			err = client.CreateMovie(models.Movies{Title: "Brazil"})
+			if err != nil {
+				t.Fatalf("failed to create movie: %s", err.Error())
+			}
+			if movie, ok, _ := client.GetMovie(5001); !ok || movie.Title != "Brazil" {
+				t.Fatalf("expected the created movie after the loaded ones, got %+v", movie)
+			}
+		})
+	}
+}
+
+func TestBulkLoadSkipsTakenTitlesAndIDs(t *testing.T) {
+	for name, newDB := range bulkDBs {
+		t.Run(name, func(t *testing.T) {
+			client, gormDB := newDB(t)
+			for _, title := range []string{"Brazil", "Alien"} {
+				err := client.CreateMovie(models.Movies{Title: title})
+				if err != nil {
+					t.Fatalf("failed to create movie: %s", err.Error())
+				}
+			}
+			err := client.CreateMovieRating(models.MovieRatings{Title: "Brazil", Ratings: []models.Ratings{{Source: "Metacritic", Value: 84}}})
+			if err != nil {
+				t.Fatalf("failed to create movie rating: %s", err.Error())
+			}
+			// trashed titles are taken too, they can still be restored
+			_, err = client.DeleteMovie(2, db.AnyVersion, time.Now())
+			if err != nil {
+				t.Fatalf("failed to delete movie: %s", err.Error())
+			}
+			changes := count(t, gormDB, "change_events")
+
+			var events []db.Event
+			client.OnEvent(func(event db.Event) { events = append(events, event) })
+			movies := []models.Movies{
+				{Title: "Brazil"},
+				{Title: "Alien"},
+				{Title: "Delicatessen", Plot: "first"},
+				{Title: "Delicatessen", Plot: "second"},
+				{ID: 1, Title: "Taken ID"},
+				{Title: "Amélie"},
+			}
+			movieRatings := []models.MovieRatings{
+				{Title: "Brazil", Ratings: []models.Ratings{{Source: "Metacritic", Value: 1}}},
+				{Title: "Delicatessen", Ratings: []models.Ratings{{Source: "Metacritic", Value: 66}}},
+			}
+			result, err := client.BulkLoad(movies, movieRatings, nil)
+			if err != nil {
+				t.Fatalf("failed to bulk load: %s", err.Error())
+			}
+			if result != (db.BulkResult{Movies: 2, MovieRatings: 1, Ratings: 1, Skipped: 5}) {
+				t.Fatalf("expected the taken titles and ids to be skipped, got %+v", result)
+			}
+
+			// a title given twice is written from its first row
+			var delicatessen models.Movies
+			err = gormDB.Where("title = ?", "Delicatessen").First(&delicatessen).Error
+			if err != nil || delicatessen.Plot != "first" {
+				t.Fatalf("expected the first Delicatessen, got %+v %v", delicatessen, err)
+			}
+			if brazil, _, _ := client.GetMovieRatingsOf(1); len(brazil.Ratings) != 1 || brazil.Ratings[0].Value != 84 {
+				t.Fatalf("expected the ratings of Brazil untouched, got %+v", brazil)
+			}
+			if n := count(t, gormDB, "change_events"); n != changes+4 {
+				t.Fatalf("expected a change per row written, got %d new", n-changes)
+			}
+			if len(events) != 3 {
+				t.Fatalf("expected the two movies and the rating to be published, got %v", events)
+			}
+			rating := events[2].Data.(db.RatingEvent)
+			if rating.Title != "Delicatessen" || rating.MovieID != delicatessen.ID {
+				t.Fatalf("expected the rating event to point at Delicatessen, got %+v", rating)
+			}
+
+			// a load run again writes nothing
+			result, err = client.BulkLoad(movies, movieRatings, nil)
+			if err != nil {
+				t.Fatalf("failed to bulk load again: %s", err.Error())
+			}
+			if result != (db.BulkResult{Skipped: 8}) {
+				t.Fatalf("expected everything to be skipped, got %+v", result)
+			}
+			if n := count(t, gormDB, "change_events"); n != changes+4 || len(events) != 3 {
+				t.Fatalf("expected nothing logged or published for a load that wrote nothing")
+			}
+		})
+	}
+}
+
+func TestPostgresBulkLoadWaitsForTheChangeLog(t *testing.T) {
+	client, _ := dbtest.NewPostgres(t)
+
+	loaded := make(chan error, 1)
+	err := client.WithTx(func(tx db.Client) error {
+		err := tx.CreateMovie(models.Movies{Title: "Brazil"})
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			_, err := client.BulkLoad([]models.Movies{{Title: "Alien"}}, nil, nil)
+			loaded <- err
+		}()
+		// the unit holds the change log lock until it commits
+		select {
+		case err := <-loaded:
+			return fmt.Errorf("expected the load to wait for the unit, it finished with %v", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to commit unit: %s", err.Error())
+	}
+
+	select {
+	case err := <-loaded:
+		if err != nil {
+			t.Fatalf("failed to bulk load: %s", err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the load")
+	}
+	changes, err := client.GetChanges(0, 10)
+	if err != nil {
+		t.Fatalf("failed to get changes: %s", err.Error())
+	}
+	if len(changes) != 2 || changes[0].EntityID != "1" || changes[1].EntityID != "2" {
+		t.Fatalf("expected the changes in commit order, got %+v", changes)
+	}
+}
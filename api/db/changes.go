@@ -0,0 +1,224 @@
+package db
+
+import (
+	"encoding/json"
+	"github.com/jinzhu/gorm"
+	"movie-rating-api/models"
+	"strconv"
+	"time"
+)
+
+// The entities in the change log
+const (
+	EntityMovie        = "movie"
+	EntityMovieRatings = "movie_ratings"
+	EntityRating       = "rating"
+	EntityMovieImage   = "movie_image"
+)
+
+// The operations in the change log
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+// changeLogLock is the postgres advisory lock held while a transaction appends to the change log.
+// Appending one transaction at a time makes the ids follow the commit order, so a consumer that has seen
+// an id never misses a lower one committed later.
+//
+// The lock is taken at a transaction's first change and held until it commits, so every catalogue write
+// waits for the ones before it, across all replicas. That is the price of consumers being able to resume
+// after an id. Catalogue writes are rare next to reads and most commit within milliseconds, and a bulk load
+// only takes the lock once its rows are merged, to append its changes last. Writes that record no change,
+// such as views, rate limits and idempotency keys, never take it. Letting writers commit in parallel would
+// need consumers to wait out gaps in the ids, with a sequence per commit or by rereading recent ids.
+const changeLogLock = 7262001
+
+// Change is a mutation to record in the change log
+type Change struct {
+	Entity    string
+	EntityID  string
+	Operation string
+	// Before and After are copies of the entity, nil when it did not exist before or after the change
+	Before interface{}
+	After  interface{}
+	// EventType is the event published for the change, empty when it has none
+	EventType string
+	EventData interface{}
+}
+
+type ChangeDB interface {
+	// GetChanges returns up to limit changes with an id above since, oldest first
+	GetChanges(since int64, limit int) ([]models.ChangeEvents, error)
+	// RelayChanges passes up to limit changes after the sink's cursor to publish and moves the cursor past them
+	// once publish succeeds. It returns how many changes were published, ok is false when another replica
+	// is relaying to the sink.
+	RelayChanges(sink string, limit int, publish func([]models.ChangeEvents) error) (int, bool, error)
+}
+
+// ratingID is the entity id of a source's rating of a movie, ratings have no id of their own
+func ratingID(movieRatingsID int, source string) string {
+	return strconv.Itoa(movieRatingsID) + "/" + source
+}
+
+// newChangeEvent builds the change log row of the change and its event, event is the zero Event when the change has none
+func newChangeEvent(change Change, event Event, now time.Time) (models.ChangeEvents, error) {
+	row := models.ChangeEvents{
+		EventID:   event.ID,
+		Type:      event.Type,
+		Entity:    change.Entity,
+		EntityID:  change.EntityID,
+		Operation: change.Operation,
+		CreatedAt: now,
+	}
+
+	for _, field := range []struct {
+		value interface{}
+		into  *string
+	}{
+		{change.Before, &row.Before},
+		{change.After, &row.After},
+		{event.Data, &row.Data},
+	} {
+		if field.value == nil {
+			continue
+		}
+
+		bytes, err := json.Marshal(field.value)
+		if err != nil {
+			return models.ChangeEvents{}, err
+		}
+		*field.into = string(bytes)
+	}
+
+	return row, nil
+}
+
+// ChangeEvent rebuilds the event of a change, ok is false when the change has none
+func ChangeEvent(change models.ChangeEvents) (Event, bool) {
+	if change.EventID == "" {
+		return Event{}, false
+	}
+
+	event := Event{ID: change.EventID, Type: change.Type, CreatedAt: change.CreatedAt, Data: json.RawMessage(change.Data)}
+	if data, err := eventData(change.Type, json.RawMessage(change.Data)); err == nil {
+		event.Data = data
+	}
+
+	return event, true
+}
+
+// recordChange appends the change to the change log and announces its event to the other replicas
+// in the transaction that makes the change. The event is returned so it can be published once the transaction commits,
+// it is the zero Event when the change has none.
+func (d dbClient) recordChange(tx *gorm.DB, change Change, now time.Time) (Event, error) {
+	var event Event
+	if change.EventType != "" {
+		var err error
+		event, err = newEvent(change.EventType, change.EventData, now)
+		if err != nil {
+			return Event{}, err
+		}
+	}
+
+	row, err := newChangeEvent(change, event, now)
+	if err != nil {
+		return Event{}, err
+	}
+	row.Origin = d.origin
+
+	if tx.Dialect().GetName() == "postgres" {
+		err = tx.Exec("SELECT pg_advisory_xact_lock(?)", changeLogLock).Error
+		if err != nil {
+			return Event{}, err
+		}
+	}
+
+	err = tx.Create(&row).Error
+	if err != nil {
+		return Event{}, err
+	}
+
+	if event.ID != "" {
+		err = d.notifyReplicas(tx, event)
+		if err != nil {
+			return Event{}, err
+		}
+	}
+
+	return event, nil
+}
+
+func (d dbClient) GetChanges(since int64, limit int) ([]models.ChangeEvents, error) {
+	var result []models.ChangeEvents
+	err := d.Gorm.Where("id > ?", since).Order("id").Limit(limit).Find(&result).Error
+	if err != nil {
+		return []models.ChangeEvents{}, err
+	}
+
+	return result, nil
+}
+
+func (d dbClient) RelayChanges(sink string, limit int, publish func([]models.ChangeEvents) error) (int, bool, error) {
+	if d.Gorm.Dialect().GetName() != "postgres" {
+		// sqlite has one writer at a time, a transaction held while publishing would lock out sinks that write
+		return relayChanges(d.Gorm, sink, limit, publish)
+	}
+
+	var published int
+	ok := true
+	err := d.transaction(func(tx *gorm.DB) error {
+		var err error
+		published, ok, err = relayChanges(tx, sink, limit, publish)
+		return err
+	})
+	if err != nil {
+		return 0, true, err
+	}
+
+	return published, ok, nil
+}
+
+// relayChanges publishes the changes after the sink's cursor. On postgres the cursor stays locked
+// until tx ends, so replicas never publish to the same sink at once.
+func relayChanges(tx *gorm.DB, sink string, limit int, publish func([]models.ChangeEvents) error) (int, bool, error) {
+	now := time.Now()
+	err := tx.Exec("INSERT INTO outbox_cursors (sink, last_change_id, updated_at) VALUES (?, 0, ?) ON CONFLICT DO NOTHING", sink, now).Error
+	if err != nil {
+		return 0, true, err
+	}
+
+	query := tx
+	if tx.Dialect().GetName() == "postgres" {
+		query = tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED")
+	}
+
+	var cursor models.OutboxCursors
+	err = query.Where("sink = ?", sink).First(&cursor).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, true, err
+	}
+
+	var changes []models.ChangeEvents
+	err = tx.Where("id > ?", cursor.LastChangeID).Order("id").Limit(limit).Find(&changes).Error
+	if err != nil || len(changes) == 0 {
+		return 0, true, err
+	}
+
+	err = publish(changes)
+	if err != nil {
+		return 0, true, err
+	}
+
+	err = tx.Model(&models.OutboxCursors{}).Where("sink = ?", sink).
+		Updates(map[string]interface{}{"last_change_id": changes[len(changes)-1].ID, "updated_at": now}).Error
+	if err != nil {
+		return 0, true, err
+	}
+
+	return len(changes), true, nil
+}
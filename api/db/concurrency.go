@@ -0,0 +1,35 @@
+package db
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+)
+
+// AnyVersion skips the version check of a write, for callers that did not read the row first
+const AnyVersion = 0
+
+// ErrVersionMismatch is returned by a write that was given a version the row no longer has
+var ErrVersionMismatch = fmt.Errorf("it was changed since the given version was read")
+
+// checkVersion returns ErrVersionMismatch when the caller expected another version than the one read
+func checkVersion(read int, expected int) error {
+	if expected != AnyVersion && read != expected {
+		return ErrVersionMismatch
+	}
+
+	return nil
+}
+
+// swapVersion moves the row on from the version read earlier in tx. Another transaction that wrote the row
+// since makes it fail with ErrVersionMismatch, so a write is never based on what was read before someone else's.
+func swapVersion(tx *gorm.DB, model interface{}, id int, read int) error {
+	result := tx.Unscoped().Model(model).Where("id = ? AND version = ?", id, read).UpdateColumn("version", read+1)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionMismatch
+	}
+
+	return nil
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"github.com/jinzhu/gorm"
 	"movie-rating-api/models"
+	"strconv"
 	"time"
 )
 
@@ -15,21 +16,50 @@ type DB interface {
 	CreateMovieRating(rating models.MovieRatings) error
 }
 
+// LookupDB reads a single movie by id, for callers that need one rather than the whole catalogue
+type LookupDB interface {
+	// GetMovie returns the movie with the id without its ratings, ok is false when there is none or it is in the trash
+	GetMovie(id int) (models.Movies, bool, error)
+	// GetMovieRatingsOf returns the movie ratings of the movie with the id and their ratings,
+	// ok is false when there is no such movie or it has no movie ratings
+	GetMovieRatingsOf(movieID int) (models.MovieRatings, bool, error)
+}
+
 type Client interface {
 	DB
+	LookupDB
+	RateLimitDB
+	VersionDB
+	RecommendationDB
+	ListDB
+	HistoryDB
+	WatchDB
+	WebhookDB
+	EventDB
+	ReplicaDB
+	ChangeDB
+	RevisionDB
+	TrashDB
+	TxDB
+	BulkDB
+	IdempotencyDB
+	MediaDB
 }
 
 type dbClient struct {
-	Gorm *gorm.DB
+	Gorm      *gorm.DB
+	listeners *listeners
+	// origin tells this replica's notifications from the others
+	origin string
+	// unit is the unit of work the client belongs to, nil outside WithTx
+	unit *unitOfWork
 }
 
 func NewDBCLient(gormDB *gorm.DB) Client {
-	if gormDB == nil {
-		gormDB = db
-	}
-
 	return &dbClient{
-		Gorm: gormDB,
+		Gorm:      gormDB,
+		listeners: &listeners{},
+		origin:    newOrigin(),
 	}
 }
 
@@ -61,10 +91,140 @@ func (d dbClient) GetMovieRatings() ([]models.MovieRatings, error) {
 	return result, nil
 }
 
+func (d dbClient) GetMovie(id int) (models.Movies, bool, error) {
+	var movie models.Movies
+	err := d.Gorm.Where("id = ?", id).First(&movie).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return models.Movies{}, false, nil
+	}
+	if err != nil {
+		return models.Movies{}, false, err
+	}
+
+	return movie, true, nil
+}
+
+func (d dbClient) GetMovieRatingsOf(movieID int) (models.MovieRatings, bool, error) {
+	movie, ok, err := d.GetMovie(movieID)
+	if err != nil || !ok {
+		return models.MovieRatings{}, false, err
+	}
+
+	var movieRatings models.MovieRatings
+	err = d.Gorm.Preload("Ratings").Where("title = ?", movie.Title).First(&movieRatings).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return models.MovieRatings{}, false, nil
+	}
+	if err != nil {
+		return models.MovieRatings{}, false, err
+	}
+
+	return movieRatings, true, nil
+}
+
 func (d dbClient) CreateMovie(movie models.Movies) error {
-	return d.Gorm.Create(&movie).Error
+	var event Event
+	err := d.transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&movie).Error
+		if err != nil {
+			return err
+		}
+
+		event, err = d.recordChange(tx, Change{
+			Entity:    EntityMovie,
+			EntityID:  strconv.Itoa(movie.ID),
+			Operation: OperationCreate,
+			After:     movie,
+			EventType: EventMovieCreated,
+			EventData: MovieEvent{
+				ID:    movie.ID,
+				Title: movie.Title,
+				Year:  movie.Year,
+				Genre: movie.Genre,
+			},
+		}, movie.CreatedAt)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	d.committed(event)
+	return nil
 }
 
 func (d dbClient) CreateMovieRating(rating models.MovieRatings) error {
-	return d.Gorm.Create(&rating).Error
+	var events []Event
+	err := d.transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&rating).Error
+		if err != nil {
+			return err
+		}
+
+		movieID, err := movieIDByTitle(tx, rating.Title)
+		if err != nil {
+			return err
+		}
+
+		// the ratings are logged as changes of their own
+		after := rating
+		after.Ratings = nil
+		_, err = d.recordChange(tx, Change{
+			Entity:    EntityMovieRatings,
+			EntityID:  strconv.Itoa(rating.ID),
+			Operation: OperationCreate,
+			After:     after,
+		}, rating.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range rating.Ratings {
+			err = tx.Create(&models.RatingObservations{
+				MovieRatingsID: rating.ID,
+				Source:         r.Source,
+				Value:          r.Value,
+				ObservedAt:     rating.CreatedAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+
+			r.MovieRatingsID = rating.ID
+			event, err := d.recordChange(tx, Change{
+				Entity:    EntityRating,
+				EntityID:  ratingID(rating.ID, r.Source),
+				Operation: OperationCreate,
+				After:     r,
+				EventType: EventRatingCreated,
+				EventData: RatingEvent{
+					MovieRatingsID: rating.ID,
+					MovieID:        movieID,
+					Title:          rating.Title,
+					Source:         r.Source,
+					Value:          r.Value,
+				},
+			}, rating.CreatedAt)
+			if err != nil {
+				return err
+			}
+			events = append(events, event)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	d.committed(events...)
+	return nil
+}
+
+func (d dbClient) OnEvent(fn func(Event)) {
+	d.listeners.add(fn)
+}
+
+func (d dbClient) OnInvalidate(fn func()) {
+	d.listeners.addInvalidate(fn)
 }
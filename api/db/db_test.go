@@ -0,0 +1,274 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"movie-rating-api/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLiteCreateMovie(t *testing.T) {
+	client, _ := dbtest.NewSQLite(t)
+	var events []db.Event
+	client.OnEvent(func(event db.Event) { events = append(events, event) })
+
+	err := client.CreateMovie(models.Movies{Title: "Brazil", Year: "1985", Genre: "Sci-Fi"})
+	if err != nil {
+		t.Fatalf("failed to create movie: %s", err.Error())
+	}
+	err = client.CreateMovieRating(models.MovieRatings{Title: "Brazil", Ratings: []models.Ratings{{Source: "Metacritic", Value: 84}}})
+	if err != nil {
+		t.Fatalf("failed to create movie rating: %s", err.Error())
+	}
+
+	movie, ok, err := client.GetMovie(1)
+	if err != nil || !ok {
+		t.Fatalf("expected the movie to be found: %v", err)
+	}
+	if movie.Title != "Brazil" || movie.Version != 1 {
+		t.Fatalf("expected Brazil at version 1, got %s at %d", movie.Title, movie.Version)
+	}
+	ratings, ok, err := client.GetMovieRatingsOf(1)
+	if err != nil || !ok || len(ratings.Ratings) != 1 || ratings.Ratings[0].Value != 84 {
+		t.Fatalf("expected the rating of the movie, got %v %v", ratings, err)
+	}
+	if len(events) != 2 || events[0].Type != db.EventMovieCreated || events[1].Type != db.EventRatingCreated {
+		t.Fatalf("expected the movie and rating to be published, got %v", events)
+	}
+
+	err = client.CreateMovie(models.Movies{Title: "Brazil"})
+	if err == nil {
+		t.Fatalf("expected a second movie with the same title to be refused")
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected nothing to be published for the refused movie")
+	}
+}
+
+func TestSQLiteUpdateMovieBumpsTheVersion(t *testing.T) {
+	client, _ := dbtest.NewSeededSQLite(t)
+
+	movie, _, err := client.GetMovie(1)
+	if err != nil {
+		t.Fatalf("failed to get movie: %s", err.Error())
+	}
+	movie.Plot = "A new plot"
+	revision, ok, err := client.UpdateMovie(movie, movie.Version, "alice", time.Now())
+	if err != nil || !ok {
+		t.Fatalf("failed to update movie: %v", err)
+	}
+	if revision.Author != "alice" {
+		t.Fatalf("expected a revision by alice, got %s", revision.Author)
+	}
+
+	updated, _, err := client.GetMovie(1)
+	if err != nil {
+		t.Fatalf("failed to get movie: %s", err.Error())
+	}
+	if updated.Plot != "A new plot" || updated.Version != movie.Version+1 {
+		t.Fatalf("expected the new plot at version %d, got %q at %d", movie.Version+1, updated.Plot, updated.Version)
+	}
+
+	movie.Plot = "A stale plot"
+	_, _, err = client.UpdateMovie(movie, movie.Version, "bob", time.Now())
+	if err != db.ErrVersionMismatch {
+		t.Fatalf("expected the stale version to be refused, got %v", err)
+	}
+	_, ok, err = client.UpdateMovie(models.Movies{ID: 1000, Title: "Missing"}, db.AnyVersion, "bob", time.Now())
+	if err != nil || ok {
+		t.Fatalf("expected no movie to update, got %t %v", ok, err)
+	}
+}
+
+func TestSQLiteTrashAndRestoreMovie(t *testing.T) {
+	client, _ := dbtest.NewSeededSQLite(t)
+
+	movie, _, err := client.GetMovie(1)
+	if err != nil {
+		t.Fatalf("failed to get movie: %s", err.Error())
+	}
+	ok, err := client.DeleteMovie(1, movie.Version, time.Now())
+	if err != nil || !ok {
+		t.Fatalf("failed to delete movie: %v", err)
+	}
+
+	if _, ok, _ := client.GetMovie(1); ok {
+		t.Fatalf("expected the deleted movie to be left out")
+	}
+	if _, ok, _ := client.GetMovieRatingsOf(1); ok {
+		t.Fatalf("expected the ratings of the deleted movie to be left out")
+	}
+	trash, err := client.GetTrash()
+	if err != nil {
+		t.Fatalf("failed to get trash: %s", err.Error())
+	}
+	if len(trash) == 0 {
+		t.Fatalf("expected the movie in the trash")
+	}
+
+	ok, err = client.RestoreMovie(1, time.Now())
+	if err != nil || !ok {
+		t.Fatalf("failed to restore movie: %v", err)
+	}
+	restored, ok, err := client.GetMovie(1)
+	if err != nil || !ok || restored.Title != movie.Title {
+		t.Fatalf("expected the movie back, got %v %v", restored, err)
+	}
+	ratings, ok, err := client.GetMovieRatingsOf(1)
+	if err != nil || !ok || len(ratings.Ratings) == 0 {
+		t.Fatalf("expected its ratings back, got %v %v", ratings, err)
+	}
+
+	ok, err = client.RestoreMovie(1, time.Now())
+	if err != nil || ok {
+		t.Fatalf("expected nothing left to restore, got %t %v", ok, err)
+	}
+}
+
+func TestSQLiteWithTxRollsBack(t *testing.T) {
+	client, _ := dbtest.NewSQLite(t)
+	var events []db.Event
+	client.OnEvent(func(event db.Event) { events = append(events, event) })
+
+	err := client.WithTx(func(tx db.Client) error {
+		err := tx.CreateMovie(models.Movies{Title: "Brazil"})
+		if err != nil {
+			return err
+		}
+
+		// what the unit wrote is visible inside it
+		if _, ok, err := tx.GetMovie(1); err != nil || !ok {
+			return fmt.Errorf("expected the movie inside the unit: %v", err)
+		}
+		return fmt.Errorf("rolled back")
+	})
+	if err == nil || err.Error() != "rolled back" {
+		t.Fatalf("expected the unit's error, got %v", err)
+	}
+
+	if _, ok, err := client.GetMovie(1); err != nil || ok {
+		t.Fatalf("expected the movie to be rolled back: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected nothing to be published for the rolled back unit, got %v", events)
+	}
+
+	err = client.WithTx(func(tx db.Client) error {
+		return tx.CreateMovie(models.Movies{Title: "Brazil"})
+	})
+	if err != nil {
+		t.Fatalf("failed to commit unit: %s", err.Error())
+	}
+	if _, ok, err := client.GetMovie(1); err != nil || !ok {
+		t.Fatalf("expected the committed movie: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected the committed movie to be published, got %v", events)
+	}
+}
+
+func TestSQLitePollsForTheChangesOfOtherReplicas(t *testing.T) {
+	writer, gormDB := dbtest.NewSeededSQLite(t)
+	// another replica on the same db
+	reader := db.NewDBCLient(gormDB)
+	events := make(chan db.Event, 16)
+	reader.OnEvent(func(event db.Event) { events <- event })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- reader.WatchReplicas(ctx, "", 10*time.Millisecond) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("failed to watch replicas: %s", err.Error())
+		}
+	}()
+
+	// changes from before the watch started are not passed on
+	select {
+	case event := <-events:
+		t.Fatalf("expected no events before a write, got %s", event.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	err := writer.CreateMovie(models.Movies{Title: "Brazil"})
+	if err != nil {
+		t.Fatalf("failed to create movie: %s", err.Error())
+	}
+	select {
+	case event := <-events:
+		if event.Type != db.EventMovieCreated || event.Data.(db.MovieEvent).Title != "Brazil" {
+			t.Fatalf("expected the created movie, got %v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the other replica's change")
+	}
+
+	// the reader's own changes are published when it commits them, not again by the poll
+	err = reader.CreateMovie(models.Movies{Title: "Delicatessen"})
+	if err != nil {
+		t.Fatalf("failed to create movie: %s", err.Error())
+	}
+	if event := <-events; event.Data.(db.MovieEvent).Title != "Delicatessen" {
+		t.Fatalf("expected the reader's own movie, got %v", event)
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("expected the reader's own change not to be polled, got %v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSQLiteGetChanges(t *testing.T) {
+	client, _ := dbtest.NewSQLite(t)
+	for _, title := range []string{"Brazil", "Delicatessen", "Alien"} {
+		err := client.CreateMovie(models.Movies{Title: title})
+		if err != nil {
+			t.Fatalf("failed to create movie: %s", err.Error())
+		}
+	}
+	movie, _, err := client.GetMovie(1)
+	if err != nil {
+		t.Fatalf("failed to get movie: %s", err.Error())
+	}
+	movie.Plot = "A new plot"
+	_, _, err = client.UpdateMovie(movie, movie.Version, "alice", time.Now())
+	if err != nil {
+		t.Fatalf("failed to update movie: %s", err.Error())
+	}
+
+	changes, err := client.GetChanges(1, 2)
+	if err != nil {
+		t.Fatalf("failed to get changes: %s", err.Error())
+	}
+	if len(changes) != 2 || changes[0].ID != 2 || changes[1].ID != 3 {
+		t.Fatalf("expected the two changes after the first, got %v", changes)
+	}
+
+	changes, err = client.GetChanges(3, 10)
+	if err != nil {
+		t.Fatalf("failed to get changes: %s", err.Error())
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected the update, got %d changes", len(changes))
+	}
+	update := changes[0]
+	if update.Entity != db.EntityMovie || update.EntityID != "1" || update.Operation != db.OperationUpdate || update.Type != db.EventMovieUpdated {
+		t.Fatalf("expected the update of movie 1, got %+v", update)
+	}
+	if !strings.Contains(update.Before, `"Plot":""`) || !strings.Contains(update.After, `"Plot":"A new plot"`) {
+		t.Fatalf("expected the movie before and after, got %s and %s", update.Before, update.After)
+	}
+	if event, ok := db.ChangeEvent(update); !ok || event.ID != update.EventID || event.MovieID() != 1 {
+		t.Fatalf("expected the event of the change, got %v", event)
+	}
+
+	changes, err = client.GetChanges(4, 10)
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("expected no changes after the last, got %v %v", changes, err)
+	}
+}
@@ -0,0 +1,98 @@
+// Package dbtest creates the db clients tests run against
+package dbtest
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"movie-rating-api/db"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// PostgresURLEnv names the postgres connection string the postgres tests run against, they are skipped without it
+const PostgresURLEnv = "TEST_POSTGRES_URL"
+
+// NewFake returns a fake client, seeded with the same movies as InitializeMovies
+func NewFake(t testing.TB, config db.FakeConfig) db.Client {
+	t.Helper()
+
+	client, err := db.NewFakeClient(config)
+	if err != nil {
+		t.Fatalf("failed to create fake client: %s", err.Error())
+	}
+	return client
+}
+
+// NewSQLite returns the real client on an empty, migrated sqlite db that is removed when the test ends,
+// along with its gorm db for looking at the tables directly
+func NewSQLite(t testing.TB) (db.Client, *gorm.DB) {
+	t.Helper()
+
+	// writers wait for each other rather than failing with database is locked
+	gormDB, err := db.Connect("sqlite3", filepath.Join(t.TempDir(), "movies.db")+"?_busy_timeout=5000", true)
+	if err != nil {
+		t.Fatalf("failed to open sqlite db: %s", err.Error())
+	}
+	t.Cleanup(func() { gormDB.Close() })
+
+	return db.NewDBCLient(gormDB), gormDB
+}
+
+// NewSeededSQLite is NewSQLite with the movies and ratings of InitializeMovies loaded
+func NewSeededSQLite(t testing.TB) (db.Client, *gorm.DB) {
+	t.Helper()
+
+	client, gormDB := NewSQLite(t)
+	err := db.InitializeMovies(client)
+	if err != nil {
+		t.Fatalf("failed to seed sqlite db: %s", err.Error())
+	}
+	return client, gormDB
+}
+
+// NewPostgres returns the real client on a migrated schema of its own in the postgres db at TEST_POSTGRES_URL,
+// dropped when the test ends. The test is skipped when TEST_POSTGRES_URL is not set.
+func NewPostgres(t testing.TB) (db.Client, *gorm.DB) {
+	t.Helper()
+
+	url := os.Getenv(PostgresURLEnv)
+	if url == "" {
+		t.Skipf("%s is not set", PostgresURLEnv)
+	}
+
+	admin, err := gorm.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("failed to open postgres db: %s", err.Error())
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	err = admin.Exec("CREATE SCHEMA " + schema).Error
+	if err != nil {
+		admin.Close()
+		t.Fatalf("failed to create schema: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	// every connection of the client starts in the schema
+	if strings.Contains(url, "://") {
+		separator := "?"
+		if strings.Contains(url, "?") {
+			separator = "&"
+		}
+		url += separator + "search_path=" + schema
+	} else {
+		url += " search_path=" + schema
+	}
+	gormDB, err := db.Connect("postgres", url, true)
+	if err != nil {
+		t.Fatalf("failed to open postgres db: %s", err.Error())
+	}
+	t.Cleanup(func() { gormDB.Close() })
+
+	return db.NewDBCLient(gormDB), gormDB
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// The types of change events
+const (
+	EventMovieCreated  = "movie.created"
+	EventMovieUpdated  = "movie.updated"
+	EventMovieDeleted  = "movie.deleted"
+	EventRatingCreated = "rating.created"
+	EventRatingUpdated = "rating.updated"
+	EventRatingDeleted = "rating.deleted"
+)
+
+// Events lists every event type
+var Events = []string{EventMovieCreated, EventMovieUpdated, EventMovieDeleted, EventRatingCreated, EventRatingUpdated, EventRatingDeleted}
+
+// Event is a committed change to the movies or ratings.
+// It is the body posted to webhook subscriptions and what is streamed to clients.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type MovieEvent struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	Year  string `json:"year"`
+	Genre string `json:"genre"`
+}
+
+type RatingEvent struct {
+	MovieRatingsID int `json:"movie_ratings_id"`
+	// MovieID is the movie with the same title, 0 when there is none yet
+	MovieID int    `json:"movie_id,omitempty"`
+	Title   string `json:"title"`
+	Source  string `json:"source"`
+	// Value is the value that was removed on rating.deleted
+	Value int `json:"value"`
+	// PreviousValue is only set on rating.updated
+	PreviousValue *int `json:"previous_value,omitempty"`
+}
+
+// UnmarshalJSON decodes Data into the MovieEvent or RatingEvent of the type, so events read back keep working with MovieID
+func (e *Event) UnmarshalJSON(bytes []byte) error {
+	var raw struct {
+		ID        string          `json:"id"`
+		Type      string          `json:"type"`
+		CreatedAt time.Time       `json:"created_at"`
+		Data      json.RawMessage `json:"data"`
+	}
+	err := json.Unmarshal(bytes, &raw)
+	if err != nil {
+		return err
+	}
+
+	data, err := eventData(raw.Type, raw.Data)
+	*e = Event{ID: raw.ID, Type: raw.Type, CreatedAt: raw.CreatedAt, Data: data}
+	return err
+}
+
+// eventData decodes the data of an event of the type
+func eventData(eventType string, raw json.RawMessage) (interface{}, error) {
+	switch eventType {
+	case EventMovieCreated, EventMovieUpdated, EventMovieDeleted:
+		var data MovieEvent
+		err := json.Unmarshal(raw, &data)
+		return data, err
+	case EventRatingCreated, EventRatingUpdated, EventRatingDeleted:
+		var data RatingEvent
+		err := json.Unmarshal(raw, &data)
+		return data, err
+	default:
+		var data interface{}
+		err := json.Unmarshal(raw, &data)
+		return data, err
+	}
+}
+
+// MovieID returns the movie the event is about, 0 when it is not known
+func (e Event) MovieID() int {
+	switch data := e.Data.(type) {
+	case MovieEvent:
+		return data.ID
+	case RatingEvent:
+		return data.MovieID
+	}
+
+	return 0
+}
+
+type EventDB interface {
+	// OnEvent calls fn with every event once the change it reports is committed, through this client
+	// or by another replica when WatchReplicas runs. fn is called on the writer's goroutine so it must not block.
+	OnEvent(fn func(Event))
+	// OnInvalidate calls fn when changes may have been missed, everything derived from the db should be reloaded.
+	// fn must not block either.
+	OnInvalidate(fn func())
+}
+
+func newEvent(eventType string, data interface{}, now time.Time) (Event, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{ID: hex.EncodeToString(id), Type: eventType, CreatedAt: now, Data: data}, nil
+}
+
+// listeners are the functions registered with OnEvent and OnInvalidate
+type listeners struct {
+	mu          sync.RWMutex
+	fns         []func(Event)
+	invalidates []func()
+}
+
+func (l *listeners) add(fn func(Event)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.fns = append(l.fns, fn)
+}
+
+func (l *listeners) addInvalidate(fn func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.invalidates = append(l.invalidates, fn)
+}
+
+// publish passes on committed events, of this process or another replica
+func (l *listeners) publish(events ...Event) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, event := range events {
+		for _, fn := range l.fns {
+			fn(event)
+		}
+	}
+}
+
+func (l *listeners) invalidate() {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, fn := range l.invalidates {
+		fn()
+	}
+}
@@ -0,0 +1,2582 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"movie-rating-api/models"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// method names used to configure a fakeClient
+const (
+	MethodGetMovies              = "GetMovies"
+	MethodGetMovieRatings        = "GetMovieRatings"
+	MethodGetMovie               = "GetMovie"
+	MethodGetMovieRatingsOf      = "GetMovieRatingsOf"
+	MethodCreateMovie            = "CreateMovie"
+	MethodCreateMovieRating      = "CreateMovieRating"
+	MethodTakeRateLimitToken     = "TakeRateLimitToken"
+	MethodSweepRateLimitBuckets  = "SweepRateLimitBuckets"
+	MethodGetUserRatings         = "GetUserRatings"
+	MethodSaveUserRating         = "SaveUserRating"
+	MethodGetRecommendations     = "GetRecommendations"
+	MethodReplaceRecommendations = "ReplaceRecommendations"
+	MethodRecordMovieView        = "RecordMovieView"
+	MethodGetMovieViews          = "GetMovieViews"
+	MethodGetListOverrides       = "GetListOverrides"
+	MethodSaveListOverride       = "SaveListOverride"
+	MethodDeleteListOverride     = "DeleteListOverride"
+	MethodGetRatingObservations  = "GetRatingObservations"
+	MethodObserveRating          = "ObserveRating"
+	MethodBackfillObservations   = "BackfillRatingObservations"
+	MethodGetWatchlist           = "GetWatchlist"
+	MethodSaveWatchlistEntry     = "SaveWatchlistEntry"
+	MethodDeleteWatchlistEntry   = "DeleteWatchlistEntry"
+	MethodGetDiary               = "GetDiary"
+	MethodCreateDiaryEntry       = "CreateDiaryEntry"
+	MethodDeleteDiaryEntry       = "DeleteDiaryEntry"
+	MethodCreateWebhook          = "CreateWebhookSubscription"
+	MethodGetWebhooks            = "GetWebhookSubscriptions"
+	MethodGetWebhook             = "GetWebhookSubscription"
+	MethodDeleteWebhook          = "DeleteWebhookSubscription"
+	MethodClaimWebhookDeliveries = "ClaimWebhookDeliveries"
+	MethodSaveWebhookDelivery    = "SaveWebhookDelivery"
+	MethodGetWebhookDeliveries   = "GetWebhookDeliveries"
+	MethodRetryWebhookDelivery   = "RetryWebhookDelivery"
+	MethodEnqueueWebhookEvent    = "EnqueueWebhookEvent"
+	MethodGetChanges             = "GetChanges"
+	MethodRelayChanges           = "RelayChanges"
+	MethodCatalogueVersion       = "CatalogueVersion"
+	MethodGetMovieRevisions      = "GetMovieRevisions"
+	MethodUpdateMovie            = "UpdateMovie"
+	MethodRestoreMovieRevision   = "RestoreMovieRevision"
+	MethodGetTrash               = "GetTrash"
+	MethodDeleteMovie            = "DeleteMovie"
+	MethodRestoreMovie           = "RestoreMovie"
+	MethodDeleteMovieRatings     = "DeleteMovieRatings"
+	MethodRestoreMovieRatings    = "RestoreMovieRatings"
+	MethodDeleteRating           = "DeleteRating"
+	MethodRestoreRating          = "RestoreRating"
+	MethodPurgeTrash             = "PurgeTrash"
+	MethodWithTx                 = "WithTx"
+	MethodBulkLoad               = "BulkLoad"
+	MethodClaimIdempotencyKey    = "ClaimIdempotencyKey"
+	MethodCompleteIdempotencyKey = "CompleteIdempotencyKey"
+	MethodReleaseIdempotencyKey  = "ReleaseIdempotencyKey"
+	MethodPurgeIdempotencyKeys   = "PurgeIdempotencyKeys"
+	MethodGetMediaAssets         = "GetMediaAssets"
+	MethodSaveMediaAsset         = "SaveMediaAsset"
+	MethodAddMovieImage          = "AddMovieImage"
+	MethodGetMovieImages         = "GetMovieImages"
+	MethodGetPosters             = "GetPosters"
+)
+
+const (
+	LatencyFixed       = "fixed"
+	LatencyUniform     = "uniform"
+	LatencyNormal      = "normal"
+	LatencyExponential = "exponential"
+)
+
+type FakeConfig struct {
+	// Seed makes latencies and random errors repeatable
+	Seed int64 `json:"seed"`
+	// Latency maps a method name to how long each call to it takes
+	Latency map[string]Latency `json:"latency"`
+	// ErrorRate maps a method name to the chance, between 0 and 1, that a call to it fails
+	ErrorRate map[string]float64 `json:"error_rate"`
+	// Script maps a method name to the outcomes of its next calls in order, an empty string succeeds
+	// and anything else fails with that message. Once the script runs out ErrorRate applies again.
+	Script map[string][]string `json:"script"`
+}
+
+type Latency struct {
+	// Distribution is one of LatencyFixed, LatencyUniform, LatencyNormal or LatencyExponential
+	Distribution string `json:"distribution"`
+	// Mean is the latency of fixed, the average of normal and exponential
+	Mean Duration `json:"mean"`
+	// StdDev is the standard deviation of normal
+	StdDev Duration `json:"std_dev"`
+	// Min and Max bound uniform, and clamp normal and exponential when Max is set
+	Min Duration `json:"min"`
+	Max Duration `json:"max"`
+}
+
+// Duration is a time.Duration that is written as a time.ParseDuration string in json
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(bytes []byte) error {
+	var s string
+	err := json.Unmarshal(bytes, &s)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadFakeConfig reads a FakeConfig from a json file
+func LoadFakeConfig(path string) (FakeConfig, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return FakeConfig{}, fmt.Errorf("failed to read fake db config: %s", err.Error())
+	}
+
+	var config FakeConfig
+	err = json.Unmarshal(bytes, &config)
+	if err != nil {
+		return FakeConfig{}, fmt.Errorf("failed to parse fake db config: %s", err.Error())
+	}
+
+	return config, nil
+}
+
+// fakeClient is an in memory Client seeded with the same movies and ratings as InitializeMovies.
+// It can be slowed down and made to fail per method to exercise the app and http layers without postgres.
+type fakeClient struct {
+	// mu guards the fake. A unit of work holds it until it is done, so the clients it is given have a lock
+	// that does nothing and every other caller waits for the unit, as if it were a serializable transaction.
+	mu sync.Locker
+	*fakeState
+}
+
+// fakeState is what the fake and the clients of its units of work share
+type fakeState struct {
+	lock   sync.Mutex
+	config FakeConfig
+	random *rand.Rand
+	calls  map[string]int
+	// relaying holds the sinks a RelayChanges call is publishing to
+	relaying  map[string]bool
+	listeners *listeners
+	// unpublished holds the events of the write in progress, they are published once the lock is released
+	unpublished []Event
+	// unit is the unit of work running, it holds the lock
+	unit *fakeUnit
+	fakeTables
+}
+
+// fakeTables are the rows the fake holds. A unit of work that fails puts back a clone of them,
+// so a table added here is rolled back without further changes.
+type fakeTables struct {
+	Movies          []models.Movies
+	MovieRatings    []models.MovieRatings
+	Buckets         map[string]models.RateLimitBuckets
+	UserRatings     []models.UserRatings
+	Recommendations map[string][]models.Recommendations
+	Views           []models.MovieViews
+	ListOverrides   []models.ListOverrides
+	Observations    []models.RatingObservations
+	Watchlist       []models.WatchlistEntries
+	Diary           []models.DiaryEntries
+	NextDiaryID     int
+	Webhooks        []models.WebhookSubscriptions
+	NextWebhookID   int
+	Deliveries      []models.WebhookDeliveries
+	NextDeliveryID  int
+	Changes         []models.ChangeEvents
+	OutboxCursors   map[string]int64
+	Revisions       []models.MovieRevisions
+	// the trash holds what was soft deleted, so every other lookup leaves it out
+	TrashedMovies       []models.Movies
+	TrashedMovieRatings []models.MovieRatings
+	TrashedRatings      []models.Ratings
+	IdempotencyKeys     map[string]models.IdempotencyKeys
+	MediaAssets         map[string]models.MediaAssets
+	MovieImages         []models.MovieImages
+}
+
+// NewFakeClient returns an in memory Client, the zero FakeConfig has no latency and never fails
+func NewFakeClient(config FakeConfig) (Client, error) {
+	// the script is consumed as calls are made, copy it so the caller's config is left alone
+	script := map[string][]string{}
+	for method, outcomes := range config.Script {
+		script[method] = append([]string{}, outcomes...)
+	}
+	config.Script = script
+
+	state := &fakeState{
+		config: config,
+		random: rand.New(rand.NewSource(config.Seed)),
+		calls:  map[string]int{},
+
+		listeners: &listeners{},
+		relaying:  map[string]bool{},
+		fakeTables: fakeTables{
+			Buckets:         map[string]models.RateLimitBuckets{},
+			OutboxCursors:   map[string]int64{},
+			Recommendations: map[string][]models.Recommendations{},
+			IdempotencyKeys: map[string]models.IdempotencyKeys{},
+			MediaAssets:     map[string]models.MediaAssets{},
+		},
+	}
+	f := &fakeClient{mu: &state.lock, fakeState: state}
+
+	err := json.Unmarshal([]byte(moviesJsonString), &f.Movies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse seed movies: %s", err.Error())
+	}
+
+	err = json.Unmarshal([]byte(ratingsJsonString), &f.MovieRatings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse seed ratings: %s", err.Error())
+	}
+
+	now := time.Now()
+	for i := range f.Movies {
+		f.Movies[i].Version = 1
+		f.Movies[i].CreatedAt = now
+		f.Movies[i].UpdatedAt = now
+	}
+	for i := range f.MovieRatings {
+		f.MovieRatings[i].Version = 1
+		f.MovieRatings[i].CreatedAt = now
+		f.MovieRatings[i].UpdatedAt = now
+		for j := range f.MovieRatings[i].Ratings {
+			f.MovieRatings[i].Ratings[j].MovieRatingsID = f.MovieRatings[i].ID
+			f.MovieRatings[i].Ratings[j].CreatedAt = now
+			f.MovieRatings[i].Ratings[j].UpdatedAt = now
+		}
+		f.observe(f.MovieRatings[i], now)
+	}
+
+	return f, nil
+}
+
+func (f *fakeClient) GetMovies() ([]models.Movies, error) {
+	if err := f.call(MethodGetMovies); err != nil {
+		return []models.Movies{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]models.Movies{}, f.Movies...), nil
+}
+
+func (f *fakeClient) GetMovieRatings() ([]models.MovieRatings, error) {
+	if err := f.call(MethodGetMovieRatings); err != nil {
+		return []models.MovieRatings{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := make([]models.MovieRatings, len(f.MovieRatings))
+	for i, movieRating := range f.MovieRatings {
+		result[i] = movieRating
+		result[i].Ratings = append([]models.Ratings{}, movieRating.Ratings...)
+	}
+
+	return result, nil
+}
+
+func (f *fakeClient) GetMovie(id int) (models.Movies, bool, error) {
+	if err := f.call(MethodGetMovie); err != nil {
+		return models.Movies{}, false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	index := f.movieIndex(id)
+	if index == -1 {
+		return models.Movies{}, false, nil
+	}
+	return f.Movies[index], true, nil
+}
+
+func (f *fakeClient) GetMovieRatingsOf(movieID int) (models.MovieRatings, bool, error) {
+	if err := f.call(MethodGetMovieRatingsOf); err != nil {
+		return models.MovieRatings{}, false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	movieIndex := f.movieIndex(movieID)
+	if movieIndex == -1 {
+		return models.MovieRatings{}, false, nil
+	}
+	index := f.movieRatingsIndex(f.Movies[movieIndex].Title)
+	if index == -1 {
+		return models.MovieRatings{}, false, nil
+	}
+
+	result := f.MovieRatings[index]
+	result.Ratings = append([]models.Ratings{}, result.Ratings...)
+	return result, true, nil
+}
+
+func (f *fakeClient) CreateMovie(movie models.Movies) error {
+	if err := f.call(MethodCreateMovie); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.unlock()
+
+	now := time.Now()
+	created, err := f.createMovie(movie, now)
+	if err != nil {
+		return err
+	}
+	if !created {
+		// same message as postgres so callers that check for duplicates behave the same
+		return fmt.Errorf("pq: duplicate key value violates unique constraint \"movies_title_key\"")
+	}
+
+	return nil
+}
+
+// createMovie adds the movie unless its title or id is taken, the caller holds the lock
+func (f *fakeClient) createMovie(movie models.Movies, now time.Time) (bool, error) {
+	// the unique constraints of the db cover the trash too
+	for _, existing := range append(append([]models.Movies{}, f.Movies...), f.TrashedMovies...) {
+		if existing.Title == movie.Title || (movie.ID != 0 && existing.ID == movie.ID) {
+			return false, nil
+		}
+	}
+
+	if movie.ID == 0 {
+		movie.ID = f.nextMovieID()
+	}
+	movie.Version = 1
+	movie.CreatedAt = now
+	movie.UpdatedAt = now
+	f.Movies = append(f.Movies, movie)
+
+	err := f.record(Change{
+		Entity:    EntityMovie,
+		EntityID:  strconv.Itoa(movie.ID),
+		Operation: OperationCreate,
+		After:     movie,
+		EventType: EventMovieCreated,
+		EventData: MovieEvent{ID: movie.ID, Title: movie.Title, Year: movie.Year, Genre: movie.Genre},
+	}, now)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (f *fakeClient) CreateMovieRating(rating models.MovieRatings) error {
+	if err := f.call(MethodCreateMovieRating); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.unlock()
+
+	now := time.Now()
+	created, err := f.createMovieRating(rating, now)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return fmt.Errorf("pq: duplicate key value violates unique constraint \"movie_ratings_title_key\"")
+	}
+
+	return nil
+}
+
+// createMovieRating adds the movie ratings and their ratings unless the title or id is taken, the caller holds the lock
+func (f *fakeClient) createMovieRating(rating models.MovieRatings, now time.Time) (bool, error) {
+	for _, existing := range append(append([]models.MovieRatings{}, f.MovieRatings...), f.TrashedMovieRatings...) {
+		if existing.Title == rating.Title || (rating.ID != 0 && existing.ID == rating.ID) {
+			return false, nil
+		}
+	}
+
+	if rating.ID == 0 {
+		rating.ID = f.nextMovieRatingID()
+	}
+	rating.Version = 1
+	rating.CreatedAt = now
+	rating.UpdatedAt = now
+	rating.Ratings = append([]models.Ratings{}, rating.Ratings...)
+	for i := range rating.Ratings {
+		rating.Ratings[i].MovieRatingsID = rating.ID
+		rating.Ratings[i].CreatedAt = now
+		rating.Ratings[i].UpdatedAt = now
+	}
+	f.MovieRatings = append(f.MovieRatings, rating)
+	f.observe(rating, now)
+	after := rating
+	after.Ratings = nil
+	err := f.record(Change{Entity: EntityMovieRatings, EntityID: strconv.Itoa(rating.ID), Operation: OperationCreate, After: after}, now)
+	if err != nil {
+		return false, err
+	}
+
+	movieID := f.movieIDByTitle(rating.Title)
+	for _, r := range rating.Ratings {
+		err = f.record(Change{
+			Entity:    EntityRating,
+			EntityID:  ratingID(rating.ID, r.Source),
+			Operation: OperationCreate,
+			After:     r,
+			EventType: EventRatingCreated,
+			EventData: RatingEvent{MovieRatingsID: rating.ID, MovieID: movieID, Title: rating.Title, Source: r.Source, Value: r.Value},
+		}, now)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// BulkLoad creates the rows one at a time like CreateMovie and CreateMovieRating, progress is reported once they are all written
+func (f *fakeClient) BulkLoad(movies []models.Movies, movieRatings []models.MovieRatings, progress func(BulkProgress)) (BulkResult, error) {
+	if err := f.call(MethodBulkLoad); err != nil {
+		return BulkResult{}, err
+	}
+
+	result, err := f.bulkLoad(movies, movieRatings)
+	if err != nil {
+		return BulkResult{}, err
+	}
+
+	if progress != nil {
+		progress(BulkProgress{Table: "movies", Written: result.Movies, Total: result.Movies})
+		progress(BulkProgress{Table: "movie_ratings", Written: result.MovieRatings, Total: result.MovieRatings})
+		progress(BulkProgress{Table: "ratings", Written: result.Ratings, Total: result.Ratings})
+	}
+	return result, nil
+}
+
+func (f *fakeClient) bulkLoad(movies []models.Movies, movieRatings []models.MovieRatings) (BulkResult, error) {
+	f.mu.Lock()
+	defer f.unlock()
+
+	var result BulkResult
+	now := time.Now()
+	for _, movie := range movies {
+		created, err := f.createMovie(movie, now)
+		if err != nil {
+			return BulkResult{}, err
+		}
+		if !created {
+			result.Skipped++
+			continue
+		}
+		result.Movies++
+	}
+
+	for _, rating := range movieRatings {
+		created, err := f.createMovieRating(rating, now)
+		if err != nil {
+			return BulkResult{}, err
+		}
+		if !created {
+			result.Skipped++
+			continue
+		}
+		result.MovieRatings++
+		result.Ratings += len(rating.Ratings)
+	}
+
+	return result, nil
+}
+
+func (f *fakeClient) TakeRateLimitToken(key string, capacity float64, refillPerSecond float64, now time.Time) (float64, bool, error) {
+	if err := f.call(MethodTakeRateLimitToken); err != nil {
+		return 0, false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, ok := f.Buckets[key]
+	if !ok {
+		bucket = models.RateLimitBuckets{Key: key, Tokens: capacity, RefilledAt: now}
+	}
+
+	elapsed := now.Sub(bucket.RefilledAt).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	bucket.Tokens = math.Min(capacity, bucket.Tokens+elapsed*refillPerSecond)
+	bucket.RefilledAt = now
+
+	allowed := bucket.Tokens >= 1
+	if allowed {
+		bucket.Tokens--
+	}
+	full := fullAt(capacity, bucket.Tokens, refillPerSecond, now)
+	bucket.FullAt = &full
+	f.Buckets[key] = bucket
+
+	return bucket.Tokens, allowed, nil
+}
+
+func (f *fakeClient) SweepRateLimitBuckets(now time.Time) (int, error) {
+	if err := f.call(MethodSweepRateLimitBuckets); err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	swept := 0
+	for key, bucket := range f.Buckets {
+		if bucket.FullAt != nil && !now.Before(*bucket.FullAt) {
+			delete(f.Buckets, key)
+			swept++
+		}
+	}
+
+	return swept, nil
+}
+
+func (f *fakeClient) GetUserRatings(userID string) ([]models.UserRatings, error) {
+	if err := f.call(MethodGetUserRatings); err != nil {
+		return []models.UserRatings{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := []models.UserRatings{}
+	for _, rating := range f.UserRatings {
+		if (userID == "" || rating.UserID == userID) && f.movieIndex(rating.MovieID) != -1 {
+			result = append(result, rating)
+		}
+	}
+
+	return result, nil
+}
+
+func (f *fakeClient) SaveUserRating(rating models.UserRatings) error {
+	if err := f.call(MethodSaveUserRating); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	for i, existing := range f.UserRatings {
+		if existing.UserID == rating.UserID && existing.MovieID == rating.MovieID {
+			f.UserRatings[i].Score = rating.Score
+			f.UserRatings[i].UpdatedAt = now
+			return nil
+		}
+	}
+
+	rating.CreatedAt = now
+	rating.UpdatedAt = now
+	f.UserRatings = append(f.UserRatings, rating)
+
+	return nil
+}
+
+func (f *fakeClient) GetRecommendations(userID string) ([]models.Recommendations, error) {
+	if err := f.call(MethodGetRecommendations); err != nil {
+		return []models.Recommendations{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := []models.Recommendations{}
+	for _, recommendation := range f.Recommendations[userID] {
+		if f.movieIndex(recommendation.MovieID) != -1 {
+			result = append(result, recommendation)
+		}
+	}
+
+	return result, nil
+}
+
+func (f *fakeClient) ReplaceRecommendations(userID string, recommendations []models.Recommendations) error {
+	if err := f.call(MethodReplaceRecommendations); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	replaced := make([]models.Recommendations, len(recommendations))
+	for i, recommendation := range recommendations {
+		recommendation.UserID = userID
+		replaced[i] = recommendation
+	}
+	f.Recommendations[userID] = replaced
+
+	return nil
+}
+
+func (f *fakeClient) RecordMovieView(movieID int, at time.Time) error {
+	if err := f.call(MethodRecordMovieView); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	day := ViewDay(at)
+	for i, views := range f.Views {
+		if views.MovieID == movieID && views.Day.Equal(day) {
+			f.Views[i].Views++
+			return nil
+		}
+	}
+
+	f.Views = append(f.Views, models.MovieViews{MovieID: movieID, Day: day, Views: 1})
+	return nil
+}
+
+func (f *fakeClient) GetMovieViews(since time.Time) ([]models.MovieViews, error) {
+	if err := f.call(MethodGetMovieViews); err != nil {
+		return []models.MovieViews{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := []models.MovieViews{}
+	for _, views := range f.Views {
+		if !views.Day.Before(ViewDay(since)) {
+			result = append(result, views)
+		}
+	}
+
+	return result, nil
+}
+
+func (f *fakeClient) GetListOverrides(list string) ([]models.ListOverrides, error) {
+	if err := f.call(MethodGetListOverrides); err != nil {
+		return []models.ListOverrides{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := []models.ListOverrides{}
+	for _, override := range f.ListOverrides {
+		if override.List == list {
+			result = append(result, override)
+		}
+	}
+
+	return result, nil
+}
+
+func (f *fakeClient) SaveListOverride(override models.ListOverrides) error {
+	if err := f.call(MethodSaveListOverride); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.deleteListOverride(override.List, override.MovieID)
+	f.ListOverrides = append(f.ListOverrides, override)
+	return nil
+}
+
+func (f *fakeClient) DeleteListOverride(list string, movieID int) (bool, error) {
+	if err := f.call(MethodDeleteListOverride); err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.deleteListOverride(list, movieID), nil
+}
+
+func (f *fakeClient) deleteListOverride(list string, movieID int) bool {
+	for i, override := range f.ListOverrides {
+		if override.List == list && override.MovieID == movieID {
+			f.ListOverrides = append(f.ListOverrides[:i], f.ListOverrides[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *fakeClient) GetRatingObservations(movieRatingsID int, until time.Time) ([]models.RatingObservations, error) {
+	if err := f.call(MethodGetRatingObservations); err != nil {
+		return []models.RatingObservations{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := []models.RatingObservations{}
+	for _, observation := range f.Observations {
+		if observation.MovieRatingsID == movieRatingsID && !observation.ObservedAt.After(until) {
+			result = append(result, observation)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ObservedAt.Before(result[j].ObservedAt)
+	})
+
+	return result, nil
+}
+
+func (f *fakeClient) ObserveRating(movieRatingsID int, source string, value int, version int, author string, at time.Time) (bool, error) {
+	if err := f.call(MethodObserveRating); err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.unlock()
+
+	index := -1
+	for i, movieRating := range f.MovieRatings {
+		if movieRating.ID == movieRatingsID {
+			index = i
+		}
+	}
+	if index == -1 {
+		// same message as postgres when the foreign key of the rating is missing
+		return false, fmt.Errorf("pq: insert or update on table \"ratings\" violates foreign key constraint")
+	}
+	err := checkVersion(f.MovieRatings[index].Version, version)
+	if err != nil {
+		return false, err
+	}
+
+	movieIndex := f.movieIndex(f.movieIDByTitle(f.MovieRatings[index].Title))
+	if movieIndex != -1 {
+		f.ensureBaselineRevision(f.Movies[movieIndex], at)
+	}
+
+	changed, err := f.setRating(index, source, &value, at)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	if movieIndex != -1 {
+		f.recordRevision(f.Movies[movieIndex], author, 0, at)
+	}
+
+	return true, nil
+}
+
+// setRating sets the source's rating of the movie ratings at index, a nil value removes it. The caller holds the lock.
+func (f *fakeClient) setRating(index int, source string, value *int, at time.Time) (bool, error) {
+	movieRating := f.MovieRatings[index]
+	event := RatingEvent{
+		MovieRatingsID: movieRating.ID,
+		MovieID:        f.movieIDByTitle(movieRating.Title),
+		Title:          movieRating.Title,
+		Source:         source,
+	}
+	change := Change{
+		Entity:    EntityRating,
+		EntityID:  ratingID(movieRating.ID, source),
+		Operation: OperationUpdate,
+		EventType: EventRatingUpdated,
+	}
+
+	found := -1
+	for j, rating := range movieRating.Ratings {
+		if rating.Source == source {
+			found = j
+		}
+	}
+
+	switch {
+	case value == nil && found == -1:
+		return false, nil
+	case value == nil:
+		existing := movieRating.Ratings[found]
+		event.Value = existing.Value
+		change.Operation = OperationDelete
+		change.EventType = EventRatingDeleted
+		change.Before = models.Ratings{MovieRatingsID: movieRating.ID, Source: source, Value: existing.Value}
+		ratings := append([]models.Ratings{}, movieRating.Ratings[:found]...)
+		f.MovieRatings[index].Ratings = append(ratings, movieRating.Ratings[found+1:]...)
+		deletedAt := trashTime(at)
+		existing.DeletedAt = &deletedAt
+		f.TrashedRatings = append(f.TrashedRatings, existing)
+	case found == -1:
+		event.Value = *value
+		change.Operation = OperationCreate
+		change.EventType = EventRatingCreated
+		change.After = models.Ratings{MovieRatingsID: movieRating.ID, Source: source, Value: *value}
+		f.MovieRatings[index].Ratings = append(f.MovieRatings[index].Ratings, models.Ratings{
+			MovieRatingsID: movieRating.ID,
+			Source:         source,
+			Value:          *value,
+			CreatedAt:      at,
+			UpdatedAt:      at,
+		})
+	case movieRating.Ratings[found].Value == *value:
+		return false, nil
+	default:
+		previous := movieRating.Ratings[found].Value
+		event.Value = *value
+		event.PreviousValue = &previous
+		change.Before = models.Ratings{MovieRatingsID: movieRating.ID, Source: source, Value: previous}
+		change.After = models.Ratings{MovieRatingsID: movieRating.ID, Source: source, Value: *value}
+		f.MovieRatings[index].Ratings[found].Value = *value
+		f.MovieRatings[index].Ratings[found].UpdatedAt = at
+	}
+
+	f.Observations = append(f.Observations, models.RatingObservations{
+		ID:             len(f.Observations) + 1,
+		MovieRatingsID: movieRating.ID,
+		Source:         source,
+		Value:          event.Value,
+		ObservedAt:     at,
+		Removed:        value == nil,
+	})
+
+	f.MovieRatings[index].Version++
+	change.EventData = event
+	return true, f.record(change, at)
+}
+
+// BackfillRatingObservations has nothing to do, the fake observes every rating it creates
+func (f *fakeClient) BackfillRatingObservations() error {
+	return f.call(MethodBackfillObservations)
+}
+
+// observe records the current values of the movie ratings, the caller holds the lock
+func (f *fakeClient) observe(movieRating models.MovieRatings, at time.Time) {
+	for _, rating := range movieRating.Ratings {
+		f.Observations = append(f.Observations, models.RatingObservations{
+			ID:             len(f.Observations) + 1,
+			MovieRatingsID: movieRating.ID,
+			Source:         rating.Source,
+			Value:          rating.Value,
+			ObservedAt:     at,
+		})
+	}
+}
+
+func (f *fakeClient) GetWatchlist(userID string) ([]models.WatchlistEntries, error) {
+	if err := f.call(MethodGetWatchlist); err != nil {
+		return []models.WatchlistEntries{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := []models.WatchlistEntries{}
+	for _, entry := range f.Watchlist {
+		if entry.UserID == userID && f.movieIndex(entry.MovieID) != -1 {
+			result = append(result, entry)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Priority != result[j].Priority {
+			return result[i].Priority < result[j].Priority
+		}
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+func (f *fakeClient) SaveWatchlistEntry(entry models.WatchlistEntries) error {
+	if err := f.call(MethodSaveWatchlistEntry); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, existing := range f.Watchlist {
+		if existing.UserID == entry.UserID && existing.MovieID == entry.MovieID {
+			f.Watchlist[i].Priority = entry.Priority
+			f.Watchlist[i].Notes = entry.Notes
+			f.Watchlist[i].UpdatedAt = entry.UpdatedAt
+			return nil
+		}
+	}
+
+	f.Watchlist = append(f.Watchlist, entry)
+	return nil
+}
+
+func (f *fakeClient) DeleteWatchlistEntry(userID string, movieID int) (bool, error) {
+	if err := f.call(MethodDeleteWatchlistEntry); err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, entry := range f.Watchlist {
+		if entry.UserID == userID && entry.MovieID == movieID {
+			f.Watchlist = append(f.Watchlist[:i], f.Watchlist[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (f *fakeClient) GetDiary(userID string) ([]models.DiaryEntries, error) {
+	if err := f.call(MethodGetDiary); err != nil {
+		return []models.DiaryEntries{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := []models.DiaryEntries{}
+	for _, entry := range f.Diary {
+		if entry.UserID == userID && f.movieIndex(entry.MovieID) != -1 {
+			result = append(result, entry)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].WatchedOn.Before(result[j].WatchedOn)
+	})
+
+	return result, nil
+}
+
+func (f *fakeClient) CreateDiaryEntry(entry models.DiaryEntries) (models.DiaryEntries, error) {
+	if err := f.call(MethodCreateDiaryEntry); err != nil {
+		return models.DiaryEntries{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.NextDiaryID++
+	entry.ID = f.NextDiaryID
+	f.Diary = append(f.Diary, entry)
+	return entry, nil
+}
+
+func (f *fakeClient) DeleteDiaryEntry(userID string, id int) (bool, error) {
+	if err := f.call(MethodDeleteDiaryEntry); err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, entry := range f.Diary {
+		if entry.UserID == userID && entry.ID == id {
+			f.Diary = append(f.Diary[:i], f.Diary[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (f *fakeClient) EnqueueWebhookEvent(event Event) (int, error) {
+	if err := f.call(MethodEnqueueWebhookEvent); err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	deliveries, err := newWebhookDeliveries(f.Webhooks, event)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, delivery := range deliveries {
+		exists := false
+		for _, existing := range f.Deliveries {
+			if existing.SubscriptionID == delivery.SubscriptionID && existing.EventID == delivery.EventID {
+				exists = true
+				break
+			}
+		}
+		if exists {
+			continue
+		}
+
+		f.NextDeliveryID++
+		delivery.ID = f.NextDeliveryID
+		f.Deliveries = append(f.Deliveries, delivery)
+		queued++
+	}
+
+	return queued, nil
+}
+
+func (f *fakeClient) CreateWebhookSubscription(subscription models.WebhookSubscriptions) (models.WebhookSubscriptions, error) {
+	if err := f.call(MethodCreateWebhook); err != nil {
+		return models.WebhookSubscriptions{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.NextWebhookID++
+	subscription.ID = f.NextWebhookID
+	f.Webhooks = append(f.Webhooks, subscription)
+	return subscription, nil
+}
+
+func (f *fakeClient) GetWebhookSubscriptions() ([]models.WebhookSubscriptions, error) {
+	if err := f.call(MethodGetWebhooks); err != nil {
+		return []models.WebhookSubscriptions{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]models.WebhookSubscriptions{}, f.Webhooks...), nil
+}
+
+func (f *fakeClient) GetWebhookSubscription(id int) (models.WebhookSubscriptions, bool, error) {
+	if err := f.call(MethodGetWebhook); err != nil {
+		return models.WebhookSubscriptions{}, false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, subscription := range f.Webhooks {
+		if subscription.ID == id {
+			return subscription, true, nil
+		}
+	}
+
+	return models.WebhookSubscriptions{}, false, nil
+}
+
+func (f *fakeClient) DeleteWebhookSubscription(id int) (bool, error) {
+	if err := f.call(MethodDeleteWebhook); err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var kept []models.WebhookDeliveries
+	for _, delivery := range f.Deliveries {
+		if delivery.SubscriptionID != id || delivery.Status != DeliveryPending {
+			kept = append(kept, delivery)
+		}
+	}
+	f.Deliveries = kept
+
+	for i, subscription := range f.Webhooks {
+		if subscription.ID == id {
+			f.Webhooks = append(f.Webhooks[:i], f.Webhooks[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (f *fakeClient) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDeliveries, error) {
+	if err := f.call(MethodClaimWebhookDeliveries); err != nil {
+		return []models.WebhookDeliveries{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := []models.WebhookDeliveries{}
+	for i, delivery := range f.Deliveries {
+		if len(result) == limit {
+			break
+		}
+		if delivery.Status != DeliveryPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+
+		f.Deliveries[i].NextAttemptAt = now.Add(lease)
+		result = append(result, f.Deliveries[i])
+	}
+
+	return result, nil
+}
+
+func (f *fakeClient) SaveWebhookDelivery(delivery models.WebhookDeliveries) error {
+	if err := f.call(MethodSaveWebhookDelivery); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, existing := range f.Deliveries {
+		if existing.ID == delivery.ID {
+			f.Deliveries[i] = delivery
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeClient) GetWebhookDeliveries(subscriptionID int, status string, limit int) ([]models.WebhookDeliveries, error) {
+	if err := f.call(MethodGetWebhookDeliveries); err != nil {
+		return []models.WebhookDeliveries{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := []models.WebhookDeliveries{}
+	for i := len(f.Deliveries) - 1; i >= 0 && len(result) < limit; i-- {
+		delivery := f.Deliveries[i]
+		if delivery.SubscriptionID == subscriptionID && (status == "" || delivery.Status == status) {
+			result = append(result, delivery)
+		}
+	}
+
+	return result, nil
+}
+
+func (f *fakeClient) RetryWebhookDelivery(subscriptionID int, id int, now time.Time) (bool, error) {
+	if err := f.call(MethodRetryWebhookDelivery); err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, delivery := range f.Deliveries {
+		if delivery.SubscriptionID == subscriptionID && delivery.ID == id {
+			f.Deliveries[i].Status = DeliveryPending
+			f.Deliveries[i].Attempts = 0
+			f.Deliveries[i].NextAttemptAt = now
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (f *fakeClient) GetMovieRevisions(movieID int) ([]models.MovieRevisions, error) {
+	if err := f.call(MethodGetMovieRevisions); err != nil {
+		return []models.MovieRevisions{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := []models.MovieRevisions{}
+	for _, revision := range f.Revisions {
+		if revision.MovieID == movieID {
+			result = append(result, revision)
+		}
+	}
+
+	return result, nil
+}
+
+func (f *fakeClient) UpdateMovie(movie models.Movies, version int, author string, at time.Time) (models.MovieRevisions, bool, error) {
+	if err := f.call(MethodUpdateMovie); err != nil {
+		return models.MovieRevisions{}, false, err
+	}
+
+	f.mu.Lock()
+	defer f.unlock()
+
+	index := f.movieIndex(movie.ID)
+	if index == -1 {
+		return models.MovieRevisions{}, false, nil
+	}
+	err := checkVersion(f.Movies[index].Version, version)
+	if err != nil {
+		return models.MovieRevisions{}, true, err
+	}
+
+	f.ensureBaselineRevision(f.Movies[index], at)
+	changed, err := f.updateMovie(index, movie, at)
+	if err != nil {
+		return models.MovieRevisions{}, true, err
+	}
+	if !changed {
+		return f.latestRevision(movie.ID), true, nil
+	}
+
+	return f.recordRevision(f.Movies[index], author, 0, at), true, nil
+}
+
+func (f *fakeClient) RestoreMovieRevision(movieID int, revision int, author string, at time.Time) (models.MovieRevisions, bool, error) {
+	if err := f.call(MethodRestoreMovieRevision); err != nil {
+		return models.MovieRevisions{}, false, err
+	}
+
+	f.mu.Lock()
+	defer f.unlock()
+
+	index := f.movieIndex(movieID)
+	if index == -1 {
+		return models.MovieRevisions{}, false, nil
+	}
+	f.ensureBaselineRevision(f.Movies[index], at)
+
+	var target *models.MovieRevisions
+	for i := range f.Revisions {
+		if f.Revisions[i].MovieID == movieID && f.Revisions[i].Revision == revision {
+			target = &f.Revisions[i]
+		}
+	}
+	if target == nil {
+		return models.MovieRevisions{}, false, nil
+	}
+
+	snapshot, err := ParseMovieSnapshot(*target)
+	if err != nil {
+		return models.MovieRevisions{}, true, err
+	}
+
+	movie := f.Movies[index]
+	movie.Title = snapshot.Title
+	movie.Plot = snapshot.Plot
+	movie.Genre = snapshot.Genre
+	movie.Year = snapshot.Year
+	movie.Rated = snapshot.Rated
+	movie.Director = snapshot.Director
+	movie.Actors = snapshot.Actors
+	movie.Released = snapshot.Released
+
+	changed, err := f.updateMovie(index, movie, at)
+	if err != nil {
+		return models.MovieRevisions{}, true, err
+	}
+
+	ratingsIndex := -1
+	for i, movieRating := range f.MovieRatings {
+		if movieRating.Title == movie.Title {
+			ratingsIndex = i
+		}
+	}
+	if ratingsIndex == -1 && len(snapshot.Ratings) != 0 {
+		movieRating := models.MovieRatings{ID: f.nextMovieRatingID(), Title: movie.Title, Version: 1, CreatedAt: at, UpdatedAt: at}
+		f.MovieRatings = append(f.MovieRatings, movieRating)
+		ratingsIndex = len(f.MovieRatings) - 1
+		err = f.record(Change{Entity: EntityMovieRatings, EntityID: strconv.Itoa(movieRating.ID), Operation: OperationCreate, After: movieRating}, at)
+		if err != nil {
+			return models.MovieRevisions{}, true, err
+		}
+	}
+
+	if ratingsIndex != -1 {
+		for _, rating := range append([]models.Ratings{}, f.MovieRatings[ratingsIndex].Ratings...) {
+			if _, ok := snapshot.Ratings[rating.Source]; ok {
+				continue
+			}
+
+			removed, err := f.setRating(ratingsIndex, rating.Source, nil, at)
+			if err != nil {
+				return models.MovieRevisions{}, true, err
+			}
+			changed = changed || removed
+		}
+
+		sources := make([]string, 0, len(snapshot.Ratings))
+		for source := range snapshot.Ratings {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+
+		for _, source := range sources {
+			value := snapshot.Ratings[source]
+			set, err := f.setRating(ratingsIndex, source, &value, at)
+			if err != nil {
+				return models.MovieRevisions{}, true, err
+			}
+			changed = changed || set
+		}
+	}
+
+	if !changed {
+		return f.latestRevision(movieID), true, nil
+	}
+
+	return f.recordRevision(f.Movies[index], author, revision, at), true, nil
+}
+
+// updateMovie writes the fields of movie over the movie at index and renames its movie ratings, the caller holds the lock
+func (f *fakeClient) updateMovie(index int, movie models.Movies, at time.Time) (bool, error) {
+	existing := f.Movies[index]
+	movie.ID = existing.ID
+	movie.Version = existing.Version
+	movie.CreatedAt = existing.CreatedAt
+	movie.UpdatedAt = existing.UpdatedAt
+	if movie == existing {
+		return false, nil
+	}
+
+	for _, other := range append(append([]models.Movies{}, f.Movies...), f.TrashedMovies...) {
+		if other.ID != movie.ID && other.Title == movie.Title {
+			return false, fmt.Errorf("pq: duplicate key value violates unique constraint \"movies_title_key\"")
+		}
+	}
+
+	movie.Version++
+	movie.UpdatedAt = at
+	f.Movies[index] = movie
+
+	if movie.Title != existing.Title {
+		for i, movieRating := range f.MovieRatings {
+			if movieRating.Title != existing.Title {
+				continue
+			}
+
+			before := movieRating
+			before.Ratings = nil
+			after := before
+			after.Title = movie.Title
+			after.Version++
+			after.UpdatedAt = at
+			f.MovieRatings[i].Title = movie.Title
+			f.MovieRatings[i].Version++
+			f.MovieRatings[i].UpdatedAt = at
+			err := f.record(Change{
+				Entity:    EntityMovieRatings,
+				EntityID:  strconv.Itoa(movieRating.ID),
+				Operation: OperationUpdate,
+				Before:    before,
+				After:     after,
+			}, at)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	err := f.record(Change{
+		Entity:    EntityMovie,
+		EntityID:  strconv.Itoa(movie.ID),
+		Operation: OperationUpdate,
+		Before:    existing,
+		After:     movie,
+		EventType: EventMovieUpdated,
+		EventData: MovieEvent{ID: movie.ID, Title: movie.Title, Year: movie.Year, Genre: movie.Genre},
+	}, at)
+	return err == nil, err
+}
+
+// snapshotMovie returns the current state of the movie, the caller holds the lock
+func (f *fakeClient) snapshotMovie(movie models.Movies) MovieSnapshot {
+	snapshot := MovieSnapshot{
+		Title:    movie.Title,
+		Plot:     movie.Plot,
+		Genre:    movie.Genre,
+		Year:     movie.Year,
+		Rated:    movie.Rated,
+		Director: movie.Director,
+		Actors:   movie.Actors,
+		Released: movie.Released,
+		Ratings:  map[string]int{},
+	}
+	for _, movieRating := range f.MovieRatings {
+		if movieRating.Title != movie.Title {
+			continue
+		}
+		for _, rating := range movieRating.Ratings {
+			snapshot.Ratings[rating.Source] = rating.Value
+		}
+	}
+
+	return snapshot
+}
+
+// ensureBaselineRevision keeps the movie as it is now as revision 1 before the first edit, the caller holds the lock
+func (f *fakeClient) ensureBaselineRevision(movie models.Movies, at time.Time) {
+	if f.latestRevision(movie.ID).Revision == 0 {
+		f.recordRevision(movie, SystemAuthor, 0, at)
+	}
+}
+
+// recordRevision keeps the current state of the movie as its next revision, the caller holds the lock
+func (f *fakeClient) recordRevision(movie models.Movies, author string, restoredFrom int, at time.Time) models.MovieRevisions {
+	// a snapshot of strings and ints always marshals
+	bytes, _ := json.Marshal(f.snapshotMovie(movie))
+	revision := models.MovieRevisions{
+		ID:           len(f.Revisions) + 1,
+		MovieID:      movie.ID,
+		Revision:     f.latestRevision(movie.ID).Revision + 1,
+		Author:       author,
+		Snapshot:     string(bytes),
+		RestoredFrom: restoredFrom,
+		CreatedAt:    at,
+	}
+	f.Revisions = append(f.Revisions, revision)
+
+	return revision
+}
+
+// latestRevision is the movie's last revision, the zero MovieRevisions when it has none. The caller holds the lock.
+func (f *fakeClient) latestRevision(movieID int) models.MovieRevisions {
+	var latest models.MovieRevisions
+	for _, revision := range f.Revisions {
+		if revision.MovieID == movieID && revision.Revision > latest.Revision {
+			latest = revision
+		}
+	}
+
+	return latest
+}
+
+// movieIndex returns the index of the movie with the id in f.Movies, -1 when there is none. The caller holds the lock.
+func (f *fakeClient) movieIndex(id int) int {
+	for i, movie := range f.Movies {
+		if id != 0 && movie.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (f *fakeClient) GetTrash() ([]TrashItem, error) {
+	if err := f.call(MethodGetTrash); err != nil {
+		return []TrashItem{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	titles := map[int]string{}
+	for _, movieRating := range append(append([]models.MovieRatings{}, f.MovieRatings...), f.TrashedMovieRatings...) {
+		titles[movieRating.ID] = movieRating.Title
+	}
+
+	result := []TrashItem{}
+	for _, movie := range f.TrashedMovies {
+		result = append(result, TrashItem{
+			Entity:    EntityMovie,
+			EntityID:  strconv.Itoa(movie.ID),
+			MovieID:   movie.ID,
+			Title:     movie.Title,
+			DeletedAt: *movie.DeletedAt,
+		})
+	}
+	for _, movieRating := range f.TrashedMovieRatings {
+		result = append(result, TrashItem{
+			Entity:    EntityMovieRatings,
+			EntityID:  strconv.Itoa(movieRating.ID),
+			MovieID:   f.anyMovieIDByTitle(movieRating.Title),
+			Title:     movieRating.Title,
+			DeletedAt: *movieRating.DeletedAt,
+		})
+	}
+	for _, rating := range f.TrashedRatings {
+		title := titles[rating.MovieRatingsID]
+		result = append(result, TrashItem{
+			Entity:    EntityRating,
+			EntityID:  ratingID(rating.MovieRatingsID, rating.Source),
+			MovieID:   f.anyMovieIDByTitle(title),
+			Title:     title,
+			Source:    rating.Source,
+			Value:     rating.Value,
+			DeletedAt: *rating.DeletedAt,
+		})
+	}
+
+	SortTrash(result)
+	return result, nil
+}
+
+func (f *fakeClient) DeleteMovie(id int, version int, at time.Time) (bool, error) {
+	if err := f.call(MethodDeleteMovie); err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.unlock()
+
+	index := f.movieIndex(id)
+	if index == -1 {
+		return false, nil
+	}
+	movie := f.Movies[index]
+	err := checkVersion(movie.Version, version)
+	if err != nil {
+		return false, err
+	}
+	at = trashTime(at)
+
+	if ratingsIndex := f.movieRatingsIndex(movie.Title); ratingsIndex != -1 {
+		err := f.trashMovieRatings(ratingsIndex, at)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	f.Movies = append(f.Movies[:index:index], f.Movies[index+1:]...)
+	deleted := movie
+	deleted.Version++
+	deleted.DeletedAt = &at
+	f.TrashedMovies = append(f.TrashedMovies, deleted)
+
+	err = f.record(Change{
+		Entity:    EntityMovie,
+		EntityID:  strconv.Itoa(movie.ID),
+		Operation: OperationDelete,
+		Before:    movie,
+		EventType: EventMovieDeleted,
+		EventData: MovieEvent{ID: movie.ID, Title: movie.Title, Year: movie.Year, Genre: movie.Genre},
+	}, at)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (f *fakeClient) RestoreMovie(id int, at time.Time) (bool, error) {
+	if err := f.call(MethodRestoreMovie); err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.unlock()
+
+	index := -1
+	for i, movie := range f.TrashedMovies {
+		if movie.ID == id {
+			index = i
+		}
+	}
+	if index == -1 {
+		return false, nil
+	}
+	at = trashTime(at)
+
+	movie := f.TrashedMovies[index]
+	deletedAt := *movie.DeletedAt
+	f.TrashedMovies = append(f.TrashedMovies[:index:index], f.TrashedMovies[index+1:]...)
+	movie.Version++
+	movie.DeletedAt = nil
+	movie.UpdatedAt = at
+	f.Movies = append(f.Movies, movie)
+	sort.SliceStable(f.Movies, func(i, j int) bool { return f.Movies[i].ID < f.Movies[j].ID })
+
+	err := f.record(Change{
+		Entity:    EntityMovie,
+		EntityID:  strconv.Itoa(movie.ID),
+		Operation: OperationCreate,
+		After:     movie,
+		EventType: EventMovieCreated,
+		EventData: MovieEvent{ID: movie.ID, Title: movie.Title, Year: movie.Year, Genre: movie.Genre},
+	}, at)
+	if err != nil {
+		return false, err
+	}
+
+	// the movie ratings deleted along with the movie, earlier deletes stay in the trash
+	trashIndex := f.trashedMovieRatingsIndex(movie.Title)
+	if trashIndex != -1 && !f.TrashedMovieRatings[trashIndex].DeletedAt.Before(deletedAt) {
+		err = f.restoreMovieRatings(trashIndex, at)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (f *fakeClient) DeleteMovieRatings(movieID int, version int, author string, at time.Time) (bool, error) {
+	if err := f.call(MethodDeleteMovieRatings); err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.unlock()
+
+	index := f.movieIndex(movieID)
+	if index == -1 {
+		return false, nil
+	}
+	movie := f.Movies[index]
+	ratingsIndex := f.movieRatingsIndex(movie.Title)
+	if ratingsIndex == -1 {
+		return false, nil
+	}
+	err := checkVersion(f.MovieRatings[ratingsIndex].Version, version)
+	if err != nil {
+		return false, err
+	}
+	at = trashTime(at)
+
+	f.ensureBaselineRevision(movie, at)
+	err = f.trashMovieRatings(ratingsIndex, at)
+	if err != nil {
+		return false, err
+	}
+	f.recordRevision(movie, author, 0, at)
+
+	return true, nil
+}
+
+func (f *fakeClient) RestoreMovieRatings(movieID int, author string, at time.Time) (bool, error) {
+	if err := f.call(MethodRestoreMovieRatings); err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.unlock()
+
+	index, err := f.liveMovieIndex(movieID)
+	if err != nil || index == -1 {
+		return false, err
+	}
+	movie := f.Movies[index]
+	trashIndex := f.trashedMovieRatingsIndex(movie.Title)
+	if trashIndex == -1 {
+		return false, nil
+	}
+	at = trashTime(at)
+
+	f.ensureBaselineRevision(movie, at)
+	err = f.restoreMovieRatings(trashIndex, at)
+	if err != nil {
+		return false, err
+	}
+	f.recordRevision(movie, author, 0, at)
+
+	return true, nil
+}
+
+func (f *fakeClient) DeleteRating(movieID int, source string, version int, author string, at time.Time) (bool, error) {
+	if err := f.call(MethodDeleteRating); err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.unlock()
+
+	index := f.movieIndex(movieID)
+	if index == -1 {
+		return false, nil
+	}
+	movie := f.Movies[index]
+	ratingsIndex := f.movieRatingsIndex(movie.Title)
+	if ratingsIndex == -1 {
+		return false, nil
+	}
+	err := checkVersion(f.MovieRatings[ratingsIndex].Version, version)
+	if err != nil {
+		return false, err
+	}
+	at = trashTime(at)
+
+	f.ensureBaselineRevision(movie, at)
+	changed, err := f.setRating(ratingsIndex, source, nil, at)
+	if err != nil || !changed {
+		return false, err
+	}
+	f.recordRevision(movie, author, 0, at)
+
+	return true, nil
+}
+
+func (f *fakeClient) RestoreRating(movieID int, source string, author string, at time.Time) (bool, error) {
+	if err := f.call(MethodRestoreRating); err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.unlock()
+
+	index, err := f.liveMovieIndex(movieID)
+	if err != nil || index == -1 {
+		return false, err
+	}
+	movie := f.Movies[index]
+	ratingsIndex := f.movieRatingsIndex(movie.Title)
+	if ratingsIndex == -1 {
+		if f.trashedMovieRatingsIndex(movie.Title) != -1 {
+			return false, ErrParentDeleted
+		}
+		return false, nil
+	}
+
+	// the last time the source's rating was deleted
+	var rating *models.Ratings
+	for i, trashed := range f.TrashedRatings {
+		if trashed.MovieRatingsID == f.MovieRatings[ratingsIndex].ID && trashed.Source == source &&
+			(rating == nil || !trashed.DeletedAt.Before(*rating.DeletedAt)) {
+			rating = &f.TrashedRatings[i]
+		}
+	}
+	if rating == nil {
+		return false, nil
+	}
+	at = trashTime(at)
+
+	f.ensureBaselineRevision(movie, at)
+	err = f.restoreRating(ratingsIndex, *rating, at)
+	if err != nil {
+		return false, err
+	}
+	f.recordRevision(movie, author, 0, at)
+
+	return true, nil
+}
+
+func (f *fakeClient) PurgeTrash(before time.Time) (int, error) {
+	if err := f.call(MethodPurgeTrash); err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var purged int
+	ratings := []models.Ratings{}
+	for _, rating := range f.TrashedRatings {
+		if rating.DeletedAt.Before(before) {
+			purged++
+			continue
+		}
+		ratings = append(ratings, rating)
+	}
+	f.TrashedRatings = ratings
+
+	// movie ratings wait for every rating that still refers to them
+	referenced := map[int]bool{}
+	for _, rating := range f.TrashedRatings {
+		referenced[rating.MovieRatingsID] = true
+	}
+	purgedRatings := map[int]bool{}
+	movieRatings := []models.MovieRatings{}
+	for _, movieRating := range f.TrashedMovieRatings {
+		if movieRating.DeletedAt.Before(before) && !referenced[movieRating.ID] {
+			purgedRatings[movieRating.ID] = true
+			purged++
+			continue
+		}
+		movieRatings = append(movieRatings, movieRating)
+	}
+	f.TrashedMovieRatings = movieRatings
+
+	observations := []models.RatingObservations{}
+	for _, observation := range f.Observations {
+		if !purgedRatings[observation.MovieRatingsID] {
+			observations = append(observations, observation)
+		}
+	}
+	f.Observations = observations
+
+	// movies wait for their movie ratings in the trash
+	purgedMovies := map[int]bool{}
+	movies := []models.Movies{}
+	for _, movie := range f.TrashedMovies {
+		if movie.DeletedAt.Before(before) && f.trashedMovieRatingsIndex(movie.Title) == -1 {
+			purgedMovies[movie.ID] = true
+			purged++
+			continue
+		}
+		movies = append(movies, movie)
+	}
+	f.TrashedMovies = movies
+
+	// user ratings and diary entries are the users' own and stay
+	revisions := []models.MovieRevisions{}
+	for _, revision := range f.Revisions {
+		if !purgedMovies[revision.MovieID] {
+			revisions = append(revisions, revision)
+		}
+	}
+	f.Revisions = revisions
+
+	overrides := []models.ListOverrides{}
+	for _, override := range f.ListOverrides {
+		if !purgedMovies[override.MovieID] {
+			overrides = append(overrides, override)
+		}
+	}
+	f.ListOverrides = overrides
+
+	watchlist := []models.WatchlistEntries{}
+	for _, entry := range f.Watchlist {
+		if !purgedMovies[entry.MovieID] {
+			watchlist = append(watchlist, entry)
+		}
+	}
+	f.Watchlist = watchlist
+
+	for userID, recommendations := range f.Recommendations {
+		kept := []models.Recommendations{}
+		for _, recommendation := range recommendations {
+			if !purgedMovies[recommendation.MovieID] {
+				kept = append(kept, recommendation)
+			}
+		}
+		f.Recommendations[userID] = kept
+	}
+
+	views := []models.MovieViews{}
+	for _, view := range f.Views {
+		if !purgedMovies[view.MovieID] {
+			views = append(views, view)
+		}
+	}
+	f.Views = views
+
+	images := []models.MovieImages{}
+	for _, image := range f.MovieImages {
+		if !purgedMovies[image.MovieID] {
+			images = append(images, image)
+		}
+	}
+	f.MovieImages = images
+
+	return purged, nil
+}
+
+func (f *fakeClient) ClaimIdempotencyKey(claim models.IdempotencyKeys) (models.IdempotencyKeys, bool, error) {
+	if err := f.call(MethodClaimIdempotencyKey); err != nil {
+		return models.IdempotencyKeys{}, false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := idempotencyID(claim.Key, claim.Caller)
+	stored, ok := f.IdempotencyKeys[id]
+	if ok && !stored.ExpiresAt.Before(claim.CreatedAt) {
+		return stored, false, nil
+	}
+
+	claim.Status = 0
+	claim.Headers = ""
+	claim.Body = nil
+	f.IdempotencyKeys[id] = claim
+	return claim, true, nil
+}
+
+func (f *fakeClient) CompleteIdempotencyKey(key models.IdempotencyKeys) error {
+	if err := f.call(MethodCompleteIdempotencyKey); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := idempotencyID(key.Key, key.Caller)
+	stored, ok := f.IdempotencyKeys[id]
+	if !ok {
+		return nil
+	}
+	stored.Status = key.Status
+	stored.Headers = key.Headers
+	stored.Body = append([]byte{}, key.Body...)
+	f.IdempotencyKeys[id] = stored
+	return nil
+}
+
+func (f *fakeClient) ReleaseIdempotencyKey(key string, caller string) error {
+	if err := f.call(MethodReleaseIdempotencyKey); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := idempotencyID(key, caller)
+	if f.IdempotencyKeys[id].Status == 0 {
+		delete(f.IdempotencyKeys, id)
+	}
+	return nil
+}
+
+func (f *fakeClient) PurgeIdempotencyKeys(before time.Time) (int, error) {
+	if err := f.call(MethodPurgeIdempotencyKeys); err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var purged int
+	for id, key := range f.IdempotencyKeys {
+		if key.ExpiresAt.Before(before) {
+			delete(f.IdempotencyKeys, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// idempotencyID is the map key of a caller's idempotency key
+func idempotencyID(key string, caller string) string {
+	return caller + "\x00" + key
+}
+
+func (f *fakeClient) GetMediaAssets(hashes []string) (map[string]models.MediaAssets, error) {
+	if err := f.call(MethodGetMediaAssets); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	assets := map[string]models.MediaAssets{}
+	for _, hash := range hashes {
+		if asset, ok := f.MediaAssets[hash]; ok {
+			assets[hash] = asset
+		}
+	}
+	return assets, nil
+}
+
+func (f *fakeClient) SaveMediaAsset(asset models.MediaAssets) error {
+	if err := f.call(MethodSaveMediaAsset); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.MediaAssets[asset.Hash]; !ok {
+		f.MediaAssets[asset.Hash] = asset
+	}
+	return nil
+}
+
+func (f *fakeClient) AddMovieImage(image models.MovieImages, at time.Time) (bool, bool, error) {
+	if err := f.call(MethodAddMovieImage); err != nil {
+		return false, false, err
+	}
+
+	f.mu.Lock()
+	defer f.unlock()
+
+	index := f.movieIndex(image.MovieID)
+	if index == -1 {
+		return false, false, nil
+	}
+	movie := f.Movies[index]
+
+	existing := -1
+	for i, movieImage := range f.MovieImages {
+		if movieImage.MovieID == movie.ID && movieImage.AssetHash == image.AssetHash {
+			existing = i
+		}
+	}
+	if existing != -1 && f.MovieImages[existing].Kind == image.Kind {
+		return false, true, nil
+	}
+
+	// the movie's poster is dropped rather than kept as a still
+	images := []models.MovieImages{}
+	for _, movieImage := range f.MovieImages {
+		replaced := image.Kind == ImagePoster && movieImage.MovieID == movie.ID &&
+			movieImage.Kind == ImagePoster && movieImage.AssetHash != image.AssetHash
+		if !replaced {
+			images = append(images, movieImage)
+			continue
+		}
+
+		err := f.record(Change{
+			Entity:    EntityMovieImage,
+			EntityID:  movieImageID(movie.ID, movieImage.AssetHash),
+			Operation: OperationDelete,
+			Before:    movieImage,
+		}, at)
+		if err != nil {
+			return false, true, err
+		}
+	}
+	f.MovieImages = images
+
+	change := Change{
+		Entity:    EntityMovieImage,
+		EntityID:  movieImageID(movie.ID, image.AssetHash),
+		EventType: EventMovieUpdated,
+		EventData: MovieEvent{ID: movie.ID, Title: movie.Title, Year: movie.Year, Genre: movie.Genre},
+	}
+	existing = -1
+	for i, movieImage := range f.MovieImages {
+		if movieImage.MovieID == movie.ID && movieImage.AssetHash == image.AssetHash {
+			existing = i
+		}
+	}
+	if existing != -1 {
+		change.Operation, change.Before = OperationUpdate, f.MovieImages[existing]
+		image.CreatedAt = f.MovieImages[existing].CreatedAt
+		f.MovieImages[existing] = image
+	} else {
+		change.Operation = OperationCreate
+		image.CreatedAt = at
+		f.MovieImages = append(f.MovieImages, image)
+	}
+	change.After = image
+
+	err := f.record(change, at)
+	if err != nil {
+		return false, true, err
+	}
+
+	return true, true, nil
+}
+
+func (f *fakeClient) GetMovieImages(movieID int) ([]models.MovieImages, error) {
+	if err := f.call(MethodGetMovieImages); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var images []models.MovieImages
+	for _, image := range f.MovieImages {
+		if image.MovieID == movieID {
+			images = append(images, image)
+		}
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		if (images[i].Kind == ImagePoster) != (images[j].Kind == ImagePoster) {
+			return images[i].Kind == ImagePoster
+		}
+		if !images[i].CreatedAt.Equal(images[j].CreatedAt) {
+			return images[i].CreatedAt.Before(images[j].CreatedAt)
+		}
+		return images[i].AssetHash < images[j].AssetHash
+	})
+
+	return images, nil
+}
+
+func (f *fakeClient) GetPosters() (map[int]models.MediaAssets, error) {
+	if err := f.call(MethodGetPosters); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	posters := map[int]models.MediaAssets{}
+	for _, image := range f.MovieImages {
+		if image.Kind == ImagePoster {
+			posters[image.MovieID] = f.MediaAssets[image.AssetHash]
+		}
+	}
+	return posters, nil
+}
+
+// trashMovieRatings moves the ratings and then the movie ratings at index to the trash, the caller holds the lock
+func (f *fakeClient) trashMovieRatings(index int, at time.Time) error {
+	for _, rating := range append([]models.Ratings{}, f.MovieRatings[index].Ratings...) {
+		_, err := f.setRating(index, rating.Source, nil, at)
+		if err != nil {
+			return err
+		}
+	}
+
+	movieRating := f.MovieRatings[index]
+	f.MovieRatings = append(f.MovieRatings[:index:index], f.MovieRatings[index+1:]...)
+	before := movieRating
+	before.Ratings = nil
+	deleted := before
+	deleted.Version++
+	deleted.DeletedAt = &at
+	f.TrashedMovieRatings = append(f.TrashedMovieRatings, deleted)
+
+	return f.record(Change{Entity: EntityMovieRatings, EntityID: strconv.Itoa(movieRating.ID), Operation: OperationDelete, Before: before}, at)
+}
+
+// restoreMovieRatings brings back the movie ratings at trashIndex with the ratings deleted along with them, the caller holds the lock
+func (f *fakeClient) restoreMovieRatings(trashIndex int, at time.Time) error {
+	movieRating := f.TrashedMovieRatings[trashIndex]
+	deletedAt := *movieRating.DeletedAt
+	f.TrashedMovieRatings = append(f.TrashedMovieRatings[:trashIndex:trashIndex], f.TrashedMovieRatings[trashIndex+1:]...)
+	movieRating.Version++
+	movieRating.DeletedAt = nil
+	movieRating.UpdatedAt = at
+	f.MovieRatings = append(f.MovieRatings, movieRating)
+	sort.SliceStable(f.MovieRatings, func(i, j int) bool { return f.MovieRatings[i].ID < f.MovieRatings[j].ID })
+
+	err := f.record(Change{Entity: EntityMovieRatings, EntityID: strconv.Itoa(movieRating.ID), Operation: OperationCreate, After: movieRating}, at)
+	if err != nil {
+		return err
+	}
+
+	var ratings []models.Ratings
+	for _, rating := range f.TrashedRatings {
+		if rating.MovieRatingsID == movieRating.ID && !rating.DeletedAt.Before(deletedAt) {
+			ratings = append(ratings, rating)
+		}
+	}
+	sort.SliceStable(ratings, func(i, j int) bool { return ratings[i].Source < ratings[j].Source })
+
+	index := f.movieRatingsIndex(movieRating.Title)
+	for _, rating := range ratings {
+		err = f.restoreRating(index, rating, at)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreRating brings the trashed rating back to the movie ratings at index, unless the source has rated the movie again since.
+// The caller holds the lock.
+func (f *fakeClient) restoreRating(index int, rating models.Ratings, at time.Time) error {
+	movieRating := f.MovieRatings[index]
+	for _, live := range movieRating.Ratings {
+		if live.Source == rating.Source {
+			return ErrRestoreConflict
+		}
+	}
+
+	for i, trashed := range f.TrashedRatings {
+		if trashed.MovieRatingsID == rating.MovieRatingsID && trashed.Source == rating.Source && trashed.DeletedAt.Equal(*rating.DeletedAt) {
+			f.TrashedRatings = append(f.TrashedRatings[:i:i], f.TrashedRatings[i+1:]...)
+			break
+		}
+	}
+
+	rating.DeletedAt = nil
+	rating.UpdatedAt = at
+	f.MovieRatings[index].Ratings = append(f.MovieRatings[index].Ratings, rating)
+	f.MovieRatings[index].Version++
+	f.Observations = append(f.Observations, models.RatingObservations{
+		ID:             len(f.Observations) + 1,
+		MovieRatingsID: movieRating.ID,
+		Source:         rating.Source,
+		Value:          rating.Value,
+		ObservedAt:     at,
+	})
+
+	return f.record(Change{
+		Entity:    EntityRating,
+		EntityID:  ratingID(movieRating.ID, rating.Source),
+		Operation: OperationCreate,
+		After:     models.Ratings{MovieRatingsID: movieRating.ID, Source: rating.Source, Value: rating.Value},
+		EventType: EventRatingCreated,
+		EventData: RatingEvent{
+			MovieRatingsID: movieRating.ID,
+			MovieID:        f.movieIDByTitle(movieRating.Title),
+			Title:          movieRating.Title,
+			Source:         rating.Source,
+			Value:          rating.Value,
+		},
+	}, at)
+}
+
+// liveMovieIndex is movieIndex, it returns ErrParentDeleted when the movie is in the trash. The caller holds the lock.
+func (f *fakeClient) liveMovieIndex(id int) (int, error) {
+	index := f.movieIndex(id)
+	if index != -1 {
+		return index, nil
+	}
+
+	for _, movie := range f.TrashedMovies {
+		if movie.ID == id {
+			return -1, ErrParentDeleted
+		}
+	}
+
+	return -1, nil
+}
+
+// movieRatingsIndex returns the index of the movie ratings with the title, -1 when there are none. The caller holds the lock.
+func (f *fakeClient) movieRatingsIndex(title string) int {
+	for i, movieRating := range f.MovieRatings {
+		if movieRating.Title == title {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// trashedMovieRatingsIndex is movieRatingsIndex for the trash
+func (f *fakeClient) trashedMovieRatingsIndex(title string) int {
+	for i, movieRating := range f.TrashedMovieRatings {
+		if movieRating.Title == title {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// anyMovieIDByTitle is movieIDByTitle including the trash
+func (f *fakeClient) anyMovieIDByTitle(title string) int {
+	if id := f.movieIDByTitle(title); id != 0 {
+		return id
+	}
+	for _, movie := range f.TrashedMovies {
+		if movie.Title == title {
+			return movie.ID
+		}
+	}
+
+	return 0
+}
+
+// record appends the change to the change log and publishes its event once the lock is released, the caller holds the lock
+func (f *fakeClient) record(change Change, now time.Time) error {
+	var event Event
+	if change.EventType != "" {
+		var err error
+		event, err = newEvent(change.EventType, change.EventData, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	row, err := newChangeEvent(change, event, now)
+	if err != nil {
+		return err
+	}
+	row.ID = int64(len(f.Changes) + 1)
+	f.Changes = append(f.Changes, row)
+
+	if event.ID != "" {
+		f.unpublished = append(f.unpublished, event)
+	}
+	return nil
+}
+
+func (f *fakeClient) GetChanges(since int64, limit int) ([]models.ChangeEvents, error) {
+	if err := f.call(MethodGetChanges); err != nil {
+		return []models.ChangeEvents{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.changesAfter(since, limit), nil
+}
+
+// RelayChanges publishes without holding the lock, so sinks can call the client
+func (f *fakeClient) RelayChanges(sink string, limit int, publish func([]models.ChangeEvents) error) (int, bool, error) {
+	if err := f.call(MethodRelayChanges); err != nil {
+		return 0, true, err
+	}
+
+	f.mu.Lock()
+	if f.relaying[sink] {
+		f.mu.Unlock()
+		return 0, false, nil
+	}
+	f.relaying[sink] = true
+	changes := f.changesAfter(f.OutboxCursors[sink], limit)
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.relaying, sink)
+	}()
+
+	if len(changes) == 0 {
+		return 0, true, nil
+	}
+
+	err := publish(changes)
+	if err != nil {
+		return 0, true, err
+	}
+
+	f.mu.Lock()
+	f.OutboxCursors[sink] = changes[len(changes)-1].ID
+	f.mu.Unlock()
+
+	return len(changes), true, nil
+}
+
+// changesAfter returns up to limit changes with an id above since, the caller holds the lock
+func (f *fakeClient) changesAfter(since int64, limit int) []models.ChangeEvents {
+	result := []models.ChangeEvents{}
+	for _, change := range f.Changes {
+		if change.ID > since && len(result) < limit {
+			result = append(result, change)
+		}
+	}
+
+	return result
+}
+
+// unlock releases the lock and then publishes the events of the write, so listeners can call the client
+func (f *fakeClient) unlock() {
+	events := f.unpublished
+	f.unpublished = nil
+	if f.unit != nil {
+		f.unit.events = append(f.unit.events, events...)
+		events = nil
+	}
+	f.mu.Unlock()
+
+	f.listeners.publish(events...)
+}
+
+// fakeUnit is the unit of work the fake is running, what it publishes waits for it to commit
+type fakeUnit struct {
+	events []Event
+}
+
+// heldLock is the lock of the clients of a unit of work, the unit already holds the fake's
+type heldLock struct{}
+
+func (heldLock) Lock()   {}
+func (heldLock) Unlock() {}
+
+// fakeTx is the Client a unit of work of the fake is given, WithTx on it nests a unit
+type fakeTx struct {
+	*fakeClient
+}
+
+func (t fakeTx) WithTx(fn func(Client) error) error {
+	if err := t.call(MethodWithTx); err != nil {
+		return err
+	}
+
+	return t.savepoint(func() error {
+		return fn(t)
+	})
+}
+
+// WithTx holds the fake's lock while the unit runs, so it neither sees nor undoes the writes of other callers.
+// One that fails puts back what the fake held when it began. Using the outer client inside the unit blocks.
+func (f *fakeClient) WithTx(fn func(Client) error) error {
+	if err := f.call(MethodWithTx); err != nil {
+		return err
+	}
+
+	unit := &fakeUnit{}
+	err := func() error {
+		f.mu.Lock()
+		f.unit = unit
+		defer func() {
+			f.unit = nil
+			f.mu.Unlock()
+		}()
+
+		return f.savepoint(func() error {
+			return fn(fakeTx{&fakeClient{mu: heldLock{}, fakeState: f.fakeState}})
+		})
+	}()
+	if err != nil {
+		return err
+	}
+
+	f.listeners.publish(unit.events...)
+	return nil
+}
+
+// savepoint runs fn in the running unit of work, putting back what the fake held before it
+// when fn returns an error or panics. The unit holds the lock.
+func (f *fakeClient) savepoint(fn func() error) (err error) {
+	tables := f.fakeTables.clone()
+	events := len(f.unit.events)
+
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			f.fakeTables = tables
+			f.unit.events = f.unit.events[:events]
+		}
+	}()
+
+	err = fn()
+	panicked = false
+	return err
+}
+
+// clone copies the tables deep enough that writes to the copy leave them alone.
+// Pointers are shared, the fake points them at new values rather than changing what they point to.
+func (t fakeTables) clone() fakeTables {
+	var c fakeTables
+	reflect.ValueOf(&c).Elem().Set(cloneValue(reflect.ValueOf(t)))
+	return c
+}
+
+func cloneValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(cloneValue(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), cloneValue(iter.Value()))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		// unexported fields, such as those of time.Time, are copied as they are
+		for i := 0; i < c.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(cloneValue(v.Field(i)))
+			}
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// movieIDByTitle returns the id of the movie with the title, 0 when there is none. The caller holds the lock.
+func (f *fakeClient) movieIDByTitle(title string) int {
+	for _, movie := range f.Movies {
+		if movie.Title == title {
+			return movie.ID
+		}
+	}
+
+	return 0
+}
+
+func (f *fakeClient) OnEvent(fn func(Event)) {
+	f.listeners.add(fn)
+}
+
+func (f *fakeClient) OnInvalidate(fn func()) {
+	f.listeners.addInvalidate(fn)
+}
+
+// WatchReplicas returns straight away, the fake lives in a single process
+func (f *fakeClient) WatchReplicas(ctx context.Context, connString string, pollInterval time.Duration) error {
+	return nil
+}
+
+func (f *fakeClient) CatalogueVersion() (string, time.Time, error) {
+	if err := f.call(MethodCatalogueVersion); err != nil {
+		return "", time.Time{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var last models.ChangeEvents
+	if len(f.Changes) != 0 {
+		last = f.Changes[len(f.Changes)-1]
+	}
+	version, modifiedAt := catalogueVersion(last)
+	return version, modifiedAt, nil
+}
+
+// call waits out the method's latency and returns the error the method should fail with, if any
+func (f *fakeClient) call(method string) error {
+	f.mu.Lock()
+	f.calls[method]++
+	latency := f.latency(method)
+	err := f.outcome(method)
+	f.mu.Unlock()
+
+	time.Sleep(latency)
+
+	return err
+}
+
+func (f *fakeClient) latency(method string) time.Duration {
+	l, ok := f.config.Latency[method]
+	if !ok {
+		return 0
+	}
+
+	var d float64
+	switch l.Distribution {
+	case LatencyUniform:
+		d = float64(l.Min) + f.random.Float64()*float64(l.Max-l.Min)
+	case LatencyNormal:
+		d = float64(l.Mean) + f.random.NormFloat64()*float64(l.StdDev)
+	case LatencyExponential:
+		d = f.random.ExpFloat64() * float64(l.Mean)
+	default:
+		d = float64(l.Mean)
+	}
+
+	if d < float64(l.Min) {
+		d = float64(l.Min)
+	}
+	if l.Max > 0 && d > float64(l.Max) {
+		d = float64(l.Max)
+	}
+
+	return time.Duration(d)
+}
+
+func (f *fakeClient) outcome(method string) error {
+	if script := f.config.Script[method]; len(script) != 0 {
+		f.config.Script[method] = script[1:]
+		if script[0] == "" {
+			return nil
+		}
+
+		return fmt.Errorf("%s", script[0])
+	}
+
+	if rate := f.config.ErrorRate[method]; rate > 0 && f.random.Float64() < rate {
+		return fmt.Errorf("fake %s failure", method)
+	}
+
+	return nil
+}
+
+func (f *fakeClient) nextMovieID() int {
+	var max int
+	for _, movie := range append(append([]models.Movies{}, f.Movies...), f.TrashedMovies...) {
+		if movie.ID > max {
+			max = movie.ID
+		}
+	}
+
+	return max + 1
+}
+
+func (f *fakeClient) nextMovieRatingID() int {
+	var max int
+	for _, rating := range append(append([]models.MovieRatings{}, f.MovieRatings...), f.TrashedMovieRatings...) {
+		if rating.ID > max {
+			max = rating.ID
+		}
+	}
+
+	return max + 1
+}
+
+// FakeCallCount returns how many times the method of a client from NewFakeClient was called
+func FakeCallCount(client Client, method string) int {
+	f, ok := client.(*fakeClient)
+	if !ok {
+		return 0
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[method]
+}
@@ -0,0 +1,290 @@
+package db_test
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	movieHttp "movie-rating-api/http"
+	"movie-rating-api/models"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFakeIsSeeded(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+
+	movies, err := client.GetMovies()
+	if err != nil {
+		t.Fatalf("failed to get movies: %s", err.Error())
+	}
+	if len(movies) == 0 {
+		t.Fatalf("expected the seed movies")
+	}
+
+	ratings, err := client.GetMovieRatings()
+	if err != nil {
+		t.Fatalf("failed to get movie ratings: %s", err.Error())
+	}
+	if len(ratings) == 0 {
+		t.Fatalf("expected the seed ratings")
+	}
+}
+
+func TestFakeFixedLatency(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{
+		Latency: map[string]db.Latency{
+			db.MethodGetMovies: {Distribution: db.LatencyFixed, Mean: db.Duration(30 * time.Millisecond)},
+		},
+	})
+
+	start := time.Now()
+	if _, err := client.GetMovies(); err != nil {
+		t.Fatalf("failed to get movies: %s", err.Error())
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("expected GetMovies to take at least 30ms, took %s", elapsed)
+	}
+
+	// other methods are left alone
+	start = time.Now()
+	if _, err := client.GetMovieRatings(); err != nil {
+		t.Fatalf("failed to get movie ratings: %s", err.Error())
+	}
+	if elapsed := time.Since(start); elapsed >= 30*time.Millisecond {
+		t.Fatalf("expected GetMovieRatings to be fast, took %s", elapsed)
+	}
+}
+
+func TestFakeUniformLatencyStaysAboveMin(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{
+		Seed: 1,
+		Latency: map[string]db.Latency{
+			db.MethodGetMovies: {Distribution: db.LatencyUniform, Min: db.Duration(10 * time.Millisecond), Max: db.Duration(20 * time.Millisecond)},
+		},
+	})
+
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		if _, err := client.GetMovies(); err != nil {
+			t.Fatalf("failed to get movies: %s", err.Error())
+		}
+		if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+			t.Fatalf("expected GetMovies to take at least 10ms, took %s", elapsed)
+		}
+	}
+}
+
+func TestFakeErrorRate(t *testing.T) {
+	always := dbtest.NewFake(t, db.FakeConfig{ErrorRate: map[string]float64{db.MethodGetMovies: 1}})
+	for i := 0; i < 10; i++ {
+		_, err := always.GetMovies()
+		if err == nil || err.Error() != "fake GetMovies failure" {
+			t.Fatalf("expected the fake GetMovies failure, got %v", err)
+		}
+	}
+
+	never := dbtest.NewFake(t, db.FakeConfig{ErrorRate: map[string]float64{db.MethodGetMovies: 0}})
+	for i := 0; i < 10; i++ {
+		if _, err := never.GetMovies(); err != nil {
+			t.Fatalf("expected GetMovies to succeed, got %s", err.Error())
+		}
+	}
+}
+
+func TestFakeErrorRateIsRepeatableWithASeed(t *testing.T) {
+	config := db.FakeConfig{Seed: 42, ErrorRate: map[string]float64{db.MethodGetMovies: 0.5}}
+
+	outcomes := func() []bool {
+		client := dbtest.NewFake(t, config)
+		failed := []bool{}
+		for i := 0; i < 50; i++ {
+			_, err := client.GetMovies()
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	first, second := outcomes(), outcomes()
+	failures := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expected the same outcomes for the same seed, call %d differs", i)
+		}
+		if first[i] {
+			failures++
+		}
+	}
+	if failures == 0 || failures == len(first) {
+		t.Fatalf("expected some but not all calls to fail at a rate of 0.5, got %d of %d", failures, len(first))
+	}
+}
+
+func TestFakeScriptRunsInOrderThenFallsBack(t *testing.T) {
+	config := db.FakeConfig{Script: map[string][]string{db.MethodGetMovies: {"", "connection reset", ""}}}
+	client := dbtest.NewFake(t, config)
+
+	if _, err := client.GetMovies(); err != nil {
+		t.Fatalf("expected the first call to succeed, got %s", err.Error())
+	}
+	if _, err := client.GetMovies(); err == nil || err.Error() != "connection reset" {
+		t.Fatalf("expected the second call to fail with the scripted error, got %v", err)
+	}
+	if _, err := client.GetMovies(); err != nil {
+		t.Fatalf("expected the third call to succeed, got %s", err.Error())
+	}
+	// the script has run out and there is no error rate
+	if _, err := client.GetMovies(); err != nil {
+		t.Fatalf("expected calls past the script to succeed, got %s", err.Error())
+	}
+
+	// consuming the script leaves the caller's config alone
+	if len(config.Script[db.MethodGetMovies]) != 3 {
+		t.Fatalf("expected the config script to be untouched, got %v", config.Script[db.MethodGetMovies])
+	}
+}
+
+func TestLoadFakeConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fake.json")
+	err := os.WriteFile(path, []byte(`{
+		"seed": 7,
+		"latency": {"GetMovies": {"distribution": "normal", "mean": "50ms", "std_dev": "5ms", "max": "1s"}},
+		"error_rate": {"GetMovies": 0.25},
+		"script": {"GetMovies": ["", "boom"]}
+	}`), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write config: %s", err.Error())
+	}
+
+	config, err := db.LoadFakeConfig(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err.Error())
+	}
+
+	latency := config.Latency[db.MethodGetMovies]
+	if config.Seed != 7 || latency.Distribution != db.LatencyNormal || latency.Mean != db.Duration(50*time.Millisecond) ||
+		latency.StdDev != db.Duration(5*time.Millisecond) || latency.Max != db.Duration(time.Second) {
+		t.Fatalf("unexpected config %+v", config)
+	}
+	if config.ErrorRate[db.MethodGetMovies] != 0.25 || len(config.Script[db.MethodGetMovies]) != 2 {
+		t.Fatalf("unexpected config %+v", config)
+	}
+}
+
+func TestScriptedFailureReachesTheHTTPLayer(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{Script: map[string][]string{db.MethodGetMovies: {"database is down"}}})
+
+	r := mux.NewRouter()
+	movieHttp.ConfigureRouter(r, movieHttp.NewHandlers(app.New(client), client, nil, nil, nil, nil, "token", movieHttp.DefaultConfig()))
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	get := func() int {
+		resp, err := http.Get(server.URL + "/api/movies")
+		if err != nil {
+			t.Fatalf("failed to get movies: %s", err.Error())
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := get(); status != http.StatusInternalServerError {
+		t.Fatalf("expected 500 while the db fails, got %d", status)
+	}
+	if status := get(); status != http.StatusOK {
+		t.Fatalf("expected 200 once the script has run out, got %d", status)
+	}
+}
+
+func TestFakeRollbackKeepsWritesOutsideTheUnit(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	failed := fmt.Errorf("failed")
+
+	outside := make(chan error)
+	err := client.WithTx(func(tx db.Client) error {
+		err := tx.SaveUserRating(models.UserRatings{UserID: "inside", MovieID: 1, Score: 10})
+		if err != nil {
+			return err
+		}
+
+		// a caller outside the unit waits for it rather than being rolled back with it
+		go func() {
+			outside <- client.SaveUserRating(models.UserRatings{UserID: "outside", MovieID: 1, Score: 20})
+		}()
+		time.Sleep(20 * time.Millisecond)
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("expected the unit's error, got %v", err)
+	}
+	if err := <-outside; err != nil {
+		t.Fatalf("failed to save rating outside the unit: %s", err.Error())
+	}
+
+	ratings, err := client.GetUserRatings("")
+	if err != nil {
+		t.Fatalf("failed to get user ratings: %s", err.Error())
+	}
+	if len(ratings) != 1 || ratings[0].UserID != "outside" {
+		t.Fatalf("expected only the rating saved outside the unit, got %+v", ratings)
+	}
+}
+
+func TestFakeNestedUnitOnlyUndoesItself(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+
+	var events []db.Event
+	client.OnEvent(func(event db.Event) {
+		events = append(events, event)
+	})
+
+	err := client.WithTx(func(tx db.Client) error {
+		_, err := tx.ObserveRating(1, "Metacritic", 11, db.AnyVersion, "test", time.Now())
+		if err != nil {
+			return err
+		}
+
+		err = tx.WithTx(func(nested db.Client) error {
+			_, err := nested.ObserveRating(2, "Metacritic", 22, db.AnyVersion, "test", time.Now())
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("failed")
+		})
+		if err == nil {
+			t.Fatalf("expected the nested unit to fail")
+		}
+
+		if len(events) != 0 {
+			t.Fatalf("expected no events before the unit commits, got %d", len(events))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to run unit: %s", err.Error())
+	}
+
+	values := map[int]int{}
+	movieRatings, err := client.GetMovieRatings()
+	if err != nil {
+		t.Fatalf("failed to get movie ratings: %s", err.Error())
+	}
+	for _, movieRating := range movieRatings {
+		for _, rating := range movieRating.Ratings {
+			if rating.Source == "Metacritic" {
+				values[movieRating.ID] = rating.Value
+			}
+		}
+	}
+	if values[1] != 11 || values[2] == 22 {
+		t.Fatalf("expected only the outer unit's rating to be kept, got %v", values)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected the outer unit's event once it committed, got %d", len(events))
+	}
+}
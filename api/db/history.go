@@ -0,0 +1,190 @@
+package db
+
+import (
+	"github.com/jinzhu/gorm"
+	"movie-rating-api/models"
+	"time"
+)
+
+type HistoryDB interface {
+	// GetRatingObservations returns every value the sources gave the movie ratings and every removal of one up to until, oldest first
+	GetRatingObservations(movieRatingsID int, until time.Time) ([]models.RatingObservations, error)
+	// ObserveRating sets the source's rating and keeps the value it replaced, nothing changes when the value is the same.
+	// The movie with the same title gets a revision by the author. It returns whether the value changed.
+	// It fails with ErrVersionMismatch when the movie ratings are no longer at version, unless version is AnyVersion.
+	ObserveRating(movieRatingsID int, source string, value int, version int, author string, at time.Time) (bool, error)
+	// BackfillRatingObservations records the current value of every rating that has no observation yet,
+	// and the removal of every soft deleted rating that has none
+	BackfillRatingObservations() error
+}
+
+func (d dbClient) GetRatingObservations(movieRatingsID int, until time.Time) ([]models.RatingObservations, error) {
+	var result []models.RatingObservations
+	err := d.Gorm.Where("movie_ratings_id = ? AND observed_at <= ?", movieRatingsID, until).
+		Order("observed_at, id").Find(&result).Error
+	if err != nil {
+		return []models.RatingObservations{}, err
+	}
+
+	return result, nil
+}
+
+func (d dbClient) ObserveRating(movieRatingsID int, source string, value int, version int, author string, at time.Time) (bool, error) {
+	var event Event
+	var changed bool
+	err := d.transaction(func(tx *gorm.DB) error {
+		var movieRatings models.MovieRatings
+		err := tx.Where("id = ?", movieRatingsID).First(&movieRatings).Error
+		if err != nil {
+			return err
+		}
+
+		event, changed, err = d.editRating(tx, movieRatings, source, &value, version, author, at)
+		return err
+	})
+	if err != nil || !changed {
+		return false, err
+	}
+
+	d.committed(event)
+	return true, nil
+}
+
+// editRating is setRating followed by the next version of the movie ratings and a revision by the author
+// of the movie with the title of the movie ratings. The version is checked once the movie is locked.
+func (d dbClient) editRating(tx *gorm.DB, movieRatings models.MovieRatings, source string, value *int, version int, author string, at time.Time) (Event, bool, error) {
+	movie, hasMovie, err := lockMovieByTitle(tx, movieRatings.Title)
+	if err != nil {
+		return Event{}, false, err
+	}
+
+	// read again so a write that was waiting for the lock sees the version it left
+	err = tx.Where("id = ?", movieRatings.ID).First(&movieRatings).Error
+	if err != nil {
+		return Event{}, false, err
+	}
+	err = checkVersion(movieRatings.Version, version)
+	if err != nil {
+		return Event{}, false, err
+	}
+
+	if hasMovie {
+		err = ensureBaselineRevision(tx, movie, at)
+		if err != nil {
+			return Event{}, false, err
+		}
+	}
+
+	event, changed, err := d.setRating(tx, movieRatings, movie.ID, source, value, at)
+	if err != nil || !changed {
+		return event, changed, err
+	}
+
+	err = swapVersion(tx, &models.MovieRatings{}, movieRatings.ID, movieRatings.Version)
+	if err != nil {
+		return Event{}, false, err
+	}
+	if !hasMovie {
+		return event, true, nil
+	}
+
+	_, err = recordRevision(tx, movie, author, 0, at)
+	if err != nil {
+		return Event{}, false, err
+	}
+
+	return event, true, nil
+}
+
+// setRating sets the source's rating of the movie ratings, a nil value moves it to the trash. Every value and removal is kept as an observation.
+// It returns the event of the change, changed is false when the rating already had the value.
+func (d dbClient) setRating(tx *gorm.DB, movieRatings models.MovieRatings, movieID int, source string, value *int, at time.Time) (Event, bool, error) {
+	data := RatingEvent{MovieRatingsID: movieRatings.ID, MovieID: movieID, Title: movieRatings.Title, Source: source}
+	change := Change{
+		Entity:    EntityRating,
+		EntityID:  ratingID(movieRatings.ID, source),
+		Operation: OperationUpdate,
+		EventType: EventRatingUpdated,
+	}
+
+	// Ratings has no primary key, so every statement is scoped by movie and source
+	scope := tx.Model(&models.Ratings{}).Where("movie_ratings_id = ? AND source = ?", movieRatings.ID, source)
+
+	var existing models.Ratings
+	err := tx.Where("movie_ratings_id = ? AND source = ?", movieRatings.ID, source).First(&existing).Error
+	found := err == nil
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return Event{}, false, err
+	}
+
+	switch {
+	case value == nil && !found:
+		return Event{}, false, nil
+	case value == nil:
+		data.Value = existing.Value
+		change.Operation = OperationDelete
+		change.EventType = EventRatingDeleted
+		change.Before = existing
+		err = scope.Update("deleted_at", trashTime(at)).Error
+	case !found:
+		data.Value = *value
+		after := models.Ratings{MovieRatingsID: movieRatings.ID, Source: source, Value: *value}
+		change.Operation = OperationCreate
+		change.EventType = EventRatingCreated
+		change.After = after
+		err = tx.Create(&after).Error
+	case existing.Value == *value:
+		return Event{}, false, nil
+	default:
+		data.Value = *value
+		data.PreviousValue = &existing.Value
+		change.Before = existing
+		change.After = models.Ratings{MovieRatingsID: movieRatings.ID, Source: source, Value: *value}
+		err = scope.Updates(map[string]interface{}{"value": *value, "updated_at": at}).Error
+	}
+	if err != nil {
+		return Event{}, false, err
+	}
+
+	// a rating moved to the trash is observed as removed, so as of queries stop showing it from then on
+	err = tx.Create(&models.RatingObservations{
+		MovieRatingsID: movieRatings.ID,
+		Source:         source,
+		Value:          data.Value,
+		ObservedAt:     at,
+		Removed:        value == nil,
+	}).Error
+	if err != nil {
+		return Event{}, false, err
+	}
+
+	change.EventData = data
+	event, err := d.recordChange(tx, change, at)
+	if err != nil {
+		return Event{}, false, err
+	}
+
+	return event, true, nil
+}
+
+func (d dbClient) BackfillRatingObservations() error {
+	return d.transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(
+			"INSERT INTO rating_observations (movie_ratings_id, source, value, observed_at, removed) " +
+				"SELECT r.movie_ratings_id, r.source, r.value, r.updated_at, false FROM ratings r " +
+				"WHERE NOT EXISTS (SELECT 1 FROM rating_observations o " +
+				"WHERE o.movie_ratings_id = r.movie_ratings_id AND o.source = r.source)",
+		).Error
+		if err != nil {
+			return err
+		}
+
+		// without the removal an as of query would still show the deleted value
+		return tx.Exec(
+			"INSERT INTO rating_observations (movie_ratings_id, source, value, observed_at, removed) " +
+				"SELECT r.movie_ratings_id, r.source, r.value, r.deleted_at, true FROM ratings r " +
+				"WHERE r.deleted_at IS NOT NULL AND NOT EXISTS (SELECT 1 FROM rating_observations o " +
+				"WHERE o.movie_ratings_id = r.movie_ratings_id AND o.source = r.source AND o.removed AND o.observed_at = r.deleted_at)",
+		).Error
+	})
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"github.com/jinzhu/gorm"
+	"movie-rating-api/models"
+	"time"
+)
+
+type IdempotencyDB interface {
+	// ClaimIdempotencyKey records that the caller's request with the key is in progress.
+	// When the caller already sent the key and it has not expired, nothing is written and the record kept for it
+	// is returned with claimed false. An expired record is replaced by the claim.
+	ClaimIdempotencyKey(claim models.IdempotencyKeys) (stored models.IdempotencyKeys, claimed bool, err error)
+	// CompleteIdempotencyKey stores the status, headers and body of the response to a claimed key
+	CompleteIdempotencyKey(key models.IdempotencyKeys) error
+	// ReleaseIdempotencyKey forgets a claim whose request did not complete, so a retry runs it again
+	ReleaseIdempotencyKey(key string, caller string) error
+	// PurgeIdempotencyKeys deletes the keys that expired before the time and returns how many were deleted
+	PurgeIdempotencyKeys(before time.Time) (int, error)
+}
+
+func (d dbClient) ClaimIdempotencyKey(claim models.IdempotencyKeys) (models.IdempotencyKeys, bool, error) {
+	claim.Status = 0
+	claim.CreatedAt = claim.CreatedAt.UTC()
+	claim.ExpiresAt = claim.ExpiresAt.UTC()
+
+	var stored models.IdempotencyKeys
+	var claimed bool
+	err := d.transaction(func(tx *gorm.DB) error {
+		// gorm would add a RETURNING to a Create that postgres skips on conflict, so the insert is written out
+		result := tx.Exec("INSERT INTO idempotency_keys (key, caller, fingerprint, status, headers, body, created_at, expires_at) "+
+			"VALUES (?, ?, ?, 0, '', ?, ?, ?) ON CONFLICT DO NOTHING",
+			claim.Key, claim.Caller, claim.Fingerprint, []byte{}, claim.CreatedAt, claim.ExpiresAt)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			stored, claimed = claim, true
+			return nil
+		}
+
+		query := tx
+		if tx.Dialect().GetName() == "postgres" {
+			query = tx.Set("gorm:query_option", "FOR UPDATE")
+		}
+		err := query.Where("key = ? AND caller = ?", claim.Key, claim.Caller).First(&stored).Error
+		if err != nil {
+			return err
+		}
+		if !stored.ExpiresAt.Before(claim.CreatedAt) {
+			return nil
+		}
+
+		stored, claimed = claim, true
+		return tx.Model(&models.IdempotencyKeys{}).Where("key = ? AND caller = ?", claim.Key, claim.Caller).
+			Updates(map[string]interface{}{
+				"fingerprint": claim.Fingerprint,
+				"status":      0,
+				"headers":     "",
+				"body":        []byte{},
+				"created_at":  claim.CreatedAt,
+				"expires_at":  claim.ExpiresAt,
+			}).Error
+	})
+	if err != nil {
+		return models.IdempotencyKeys{}, false, err
+	}
+
+	return stored, claimed, nil
+}
+
+func (d dbClient) CompleteIdempotencyKey(key models.IdempotencyKeys) error {
+	return d.Gorm.Model(&models.IdempotencyKeys{}).Where("key = ? AND caller = ?", key.Key, key.Caller).
+		Updates(map[string]interface{}{
+			"status":  key.Status,
+			"headers": key.Headers,
+			"body":    key.Body,
+		}).Error
+}
+
+func (d dbClient) ReleaseIdempotencyKey(key string, caller string) error {
+	return d.Gorm.Where("key = ? AND caller = ? AND status = 0", key, caller).Delete(&models.IdempotencyKeys{}).Error
+}
+
+func (d dbClient) PurgeIdempotencyKeys(before time.Time) (int, error) {
+	result := d.Gorm.Where("expires_at < ?", before.UTC()).Delete(&models.IdempotencyKeys{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	return int(result.RowsAffected), nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"github.com/jinzhu/gorm"
+	"movie-rating-api/models"
+	"time"
+)
+
+type ListDB interface {
+	// RecordMovieView adds a view of the movie to the day of at
+	RecordMovieView(movieID int, at time.Time) error
+	// GetMovieViews returns the daily views from the day of since onwards
+	GetMovieViews(since time.Time) ([]models.MovieViews, error)
+	// GetListOverrides returns the pins and exclusions of the list, oldest first
+	GetListOverrides(list string) ([]models.ListOverrides, error)
+	// SaveListOverride creates the override of the movie in the list or replaces it
+	SaveListOverride(override models.ListOverrides) error
+	// DeleteListOverride removes the override of the movie in the list, ok is false when there was none
+	DeleteListOverride(list string, movieID int) (bool, error)
+}
+
+// ViewDay is the day a view at the time is counted on
+func ViewDay(at time.Time) time.Time {
+	return at.UTC().Truncate(24 * time.Hour)
+}
+
+func (d dbClient) RecordMovieView(movieID int, at time.Time) error {
+	return d.Gorm.Exec(
+		"INSERT INTO movie_views (movie_id, day, views) VALUES (?, ?, 1) "+
+			"ON CONFLICT (movie_id, day) DO UPDATE SET views = movie_views.views + 1",
+		movieID, ViewDay(at),
+	).Error
+}
+
+func (d dbClient) GetMovieViews(since time.Time) ([]models.MovieViews, error) {
+	var result []models.MovieViews
+	err := d.Gorm.Where("day >= ?", ViewDay(since)).Order("movie_id, day").Find(&result).Error
+	if err != nil {
+		return []models.MovieViews{}, err
+	}
+
+	return result, nil
+}
+
+func (d dbClient) GetListOverrides(list string) ([]models.ListOverrides, error) {
+	var result []models.ListOverrides
+	err := d.Gorm.Where("list = ?", list).Order("created_at, movie_id").Find(&result).Error
+	if err != nil {
+		return []models.ListOverrides{}, err
+	}
+
+	return result, nil
+}
+
+func (d dbClient) SaveListOverride(override models.ListOverrides) error {
+	return d.transaction(func(tx *gorm.DB) error {
+		err := tx.Where("list = ? AND movie_id = ?", override.List, override.MovieID).Delete(&models.ListOverrides{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&override).Error
+	})
+}
+
+func (d dbClient) DeleteListOverride(list string, movieID int) (bool, error) {
+	result := d.Gorm.Where("list = ? AND movie_id = ?", list, movieID).Delete(&models.ListOverrides{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected != 0, nil
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"github.com/jinzhu/gorm"
+	"movie-rating-api/models"
+	"strconv"
+	"time"
+)
+
+// The kinds of movie images
+const (
+	ImagePoster = "poster"
+	ImageStill  = "still"
+)
+
+type MediaDB interface {
+	// GetMediaAssets returns the stored assets among the hashes, by hash
+	GetMediaAssets(hashes []string) (map[string]models.MediaAssets, error)
+	// SaveMediaAsset records an uploaded image, nothing is written when an asset with the hash is already stored
+	SaveMediaAsset(asset models.MediaAssets) error
+	// AddMovieImage links an asset to a movie as a poster or a still and publishes movie.updated.
+	// A poster takes the place of the movie's poster, an image the movie already has changes kind.
+	// created is false when the movie already had the image as that kind, ok is false when there is no movie with the id.
+	AddMovieImage(image models.MovieImages, at time.Time) (created bool, ok bool, err error)
+	// GetMovieImages returns the images of the movie, its poster first and then its stills, oldest first
+	GetMovieImages(movieID int) ([]models.MovieImages, error)
+	// GetPosters returns the poster of every movie that has one, by movie id
+	GetPosters() (map[int]models.MediaAssets, error)
+}
+
+// movieImageID is the entity id of a movie image, images have no id of their own
+func movieImageID(movieID int, hash string) string {
+	return strconv.Itoa(movieID) + "/" + hash
+}
+
+func (d dbClient) GetMediaAssets(hashes []string) (map[string]models.MediaAssets, error) {
+	assets := map[string]models.MediaAssets{}
+	if len(hashes) == 0 {
+		return assets, nil
+	}
+
+	var rows []models.MediaAssets
+	err := d.Gorm.Where("hash IN (?)", hashes).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, asset := range rows {
+		assets[asset.Hash] = asset
+	}
+	return assets, nil
+}
+
+func (d dbClient) SaveMediaAsset(asset models.MediaAssets) error {
+	// gorm would add a RETURNING to a Create that postgres skips on conflict, so the insert is written out
+	return d.Gorm.Exec("INSERT INTO media_assets (hash, content_type, width, height, size, thumbnails, created_at) "+
+		"VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING",
+		asset.Hash, asset.ContentType, asset.Width, asset.Height, asset.Size, asset.Thumbnails, asset.CreatedAt.UTC()).Error
+}
+
+func (d dbClient) AddMovieImage(image models.MovieImages, at time.Time) (bool, bool, error) {
+	var events []Event
+	created := false
+	ok := true
+	err := d.transaction(func(tx *gorm.DB) error {
+		movie, found, err := lockMovie(tx, "id = ?", image.MovieID)
+		if err != nil || !found {
+			ok = found
+			return err
+		}
+
+		var images []models.MovieImages
+		err = tx.Where("movie_id = ?", movie.ID).Find(&images).Error
+		if err != nil {
+			return err
+		}
+
+		var existing *models.MovieImages
+		for i := range images {
+			if images[i].AssetHash == image.AssetHash {
+				existing = &images[i]
+			}
+		}
+		if existing != nil && existing.Kind == image.Kind {
+			return nil
+		}
+		created = true
+
+		// the movie's poster is dropped rather than kept as a still
+		if image.Kind == ImagePoster {
+			for _, replaced := range images {
+				if replaced.Kind != ImagePoster || replaced.AssetHash == image.AssetHash {
+					continue
+				}
+
+				err = tx.Where("movie_id = ? AND asset_hash = ?", movie.ID, replaced.AssetHash).Delete(&models.MovieImages{}).Error
+				if err != nil {
+					return err
+				}
+				_, err = d.recordChange(tx, Change{
+					Entity:    EntityMovieImage,
+					EntityID:  movieImageID(movie.ID, replaced.AssetHash),
+					Operation: OperationDelete,
+					Before:    replaced,
+				}, at)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		change := Change{
+			Entity:    EntityMovieImage,
+			EntityID:  movieImageID(movie.ID, image.AssetHash),
+			EventType: EventMovieUpdated,
+			EventData: MovieEvent{ID: movie.ID, Title: movie.Title, Year: movie.Year, Genre: movie.Genre},
+		}
+		if existing != nil {
+			image.CreatedAt = existing.CreatedAt
+			err = tx.Model(&models.MovieImages{}).Where("movie_id = ? AND asset_hash = ?", movie.ID, image.AssetHash).
+				Update("kind", image.Kind).Error
+			change.Operation, change.Before = OperationUpdate, *existing
+		} else {
+			image.CreatedAt = at
+			err = tx.Create(&image).Error
+			change.Operation = OperationCreate
+		}
+		if err != nil {
+			return err
+		}
+		change.After = image
+
+		event, err := d.recordChange(tx, change, at)
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+		return nil
+	})
+	if err != nil || !ok {
+		return false, ok, err
+	}
+
+	if len(events) != 0 {
+		d.committed(events...)
+	}
+	return created, true, nil
+}
+
+func (d dbClient) GetMovieImages(movieID int) ([]models.MovieImages, error) {
+	var images []models.MovieImages
+	err := d.Gorm.Where("movie_id = ?", movieID).
+		Order("CASE WHEN kind = 'poster' THEN 0 ELSE 1 END, created_at, asset_hash").
+		Find(&images).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+func (d dbClient) GetPosters() (map[int]models.MediaAssets, error) {
+	rows, err := d.Gorm.Table("movie_images").
+		Select("movie_images.movie_id, media_assets.hash, media_assets.content_type, media_assets.width, "+
+			"media_assets.height, media_assets.size, media_assets.thumbnails, media_assets.created_at").
+		Joins("JOIN media_assets ON media_assets.hash = movie_images.asset_hash").
+		Where("movie_images.kind = ?", ImagePoster).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posters := map[int]models.MediaAssets{}
+	for rows.Next() {
+		var movieID int
+		var asset models.MediaAssets
+		err = rows.Scan(&movieID, &asset.Hash, &asset.ContentType, &asset.Width, &asset.Height, &asset.Size, &asset.Thumbnails, &asset.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		posters[movieID] = asset
+	}
+
+	return posters, rows.Err()
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"github.com/jinzhu/gorm"
+	"math"
+	"movie-rating-api/models"
+	"time"
+)
+
+type RateLimitDB interface {
+	TakeRateLimitToken(key string, capacity float64, refillPerSecond float64, now time.Time) (float64, bool, error)
+	// SweepRateLimitBuckets deletes the buckets that have refilled completely by now and returns how many it deleted.
+	// A bucket starts full, so deleting them changes no limit.
+	SweepRateLimitBuckets(now time.Time) (int, error)
+}
+
+// TakeRateLimitToken refills the key's token bucket up to now and takes one token from it when there is one.
+// It returns the tokens left in the bucket and whether a token was taken.
+// The bucket row is locked for the duration so replicas sharing the database can not take the same token.
+func (d dbClient) TakeRateLimitToken(key string, capacity float64, refillPerSecond float64, now time.Time) (float64, bool, error) {
+	var tokens float64
+	var allowed bool
+
+	err := d.transaction(func(tx *gorm.DB) error {
+		query := tx
+		if tx.Dialect().GetName() == "postgres" {
+			query = tx.Set("gorm:query_option", "FOR UPDATE")
+		}
+
+		var bucket models.RateLimitBuckets
+		// a sweep can delete the bucket between the insert and the select, it is inserted again then
+		for attempt := 0; ; attempt++ {
+			err := tx.Set("gorm:insert_option", "ON CONFLICT DO NOTHING").
+				Create(&models.RateLimitBuckets{Key: key, Tokens: capacity, RefilledAt: now}).Error
+			if err != nil {
+				return err
+			}
+
+			err = query.Where("key = ?", key).First(&bucket).Error
+			if gorm.IsRecordNotFoundError(err) && attempt == 0 {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			break
+		}
+
+		elapsed := now.Sub(bucket.RefilledAt).Seconds()
+		if elapsed < 0 {
+			elapsed = 0
+		}
+
+		tokens = math.Min(capacity, bucket.Tokens+elapsed*refillPerSecond)
+		if tokens >= 1 {
+			tokens--
+			allowed = true
+		}
+
+		return tx.Model(&bucket).Updates(map[string]interface{}{
+			"tokens":      tokens,
+			"refilled_at": now,
+			"full_at":     fullAt(capacity, tokens, refillPerSecond, now),
+		}).Error
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	return tokens, allowed, nil
+}
+
+func (d dbClient) SweepRateLimitBuckets(now time.Time) (int, error) {
+	result := d.Gorm.Where("full_at <= ?", now).Delete(&models.RateLimitBuckets{})
+	return int(result.RowsAffected), result.Error
+}
+
+// fullAt is when a bucket left with tokens will have refilled to capacity
+func fullAt(capacity float64, tokens float64, refillPerSecond float64, now time.Time) time.Time {
+	return now.Add(time.Duration((capacity - tokens) / refillPerSecond * float64(time.Second)))
+}
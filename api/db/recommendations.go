@@ -0,0 +1,80 @@
+package db
+
+import (
+	"github.com/jinzhu/gorm"
+	"movie-rating-api/models"
+	"time"
+)
+
+type RecommendationDB interface {
+	// GetUserRatings returns the ratings of the user, or of every user when userID is empty. Movies in the trash are left out.
+	GetUserRatings(userID string) ([]models.UserRatings, error)
+	// SaveUserRating creates the user's rating of the movie or replaces its score
+	SaveUserRating(rating models.UserRatings) error
+	// GetRecommendations returns the user's recommendations by rank, leaving out movies in the trash
+	GetRecommendations(userID string) ([]models.Recommendations, error)
+	// ReplaceRecommendations swaps all of the user's recommendations for new ones
+	ReplaceRecommendations(userID string, recommendations []models.Recommendations) error
+}
+
+func (d dbClient) GetUserRatings(userID string) ([]models.UserRatings, error) {
+	query := liveMovies(d.Gorm)
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var result []models.UserRatings
+	err := query.Order("user_id, movie_id").Find(&result).Error
+	if err != nil {
+		return []models.UserRatings{}, err
+	}
+
+	return result, nil
+}
+
+func (d dbClient) SaveUserRating(rating models.UserRatings) error {
+	return d.transaction(func(tx *gorm.DB) error {
+		var existing models.UserRatings
+		err := tx.Where("user_id = ? AND movie_id = ?", rating.UserID, rating.MovieID).First(&existing).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return tx.Create(&rating).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&existing).Updates(map[string]interface{}{
+			"score":      rating.Score,
+			"updated_at": time.Now(),
+		}).Error
+	})
+}
+
+func (d dbClient) GetRecommendations(userID string) ([]models.Recommendations, error) {
+	var result []models.Recommendations
+	err := liveMovies(d.Gorm).Where("user_id = ?", userID).Order("rank").Find(&result).Error
+	if err != nil {
+		return []models.Recommendations{}, err
+	}
+
+	return result, nil
+}
+
+func (d dbClient) ReplaceRecommendations(userID string, recommendations []models.Recommendations) error {
+	return d.transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ?", userID).Delete(&models.Recommendations{}).Error
+		if err != nil {
+			return err
+		}
+
+		for _, recommendation := range recommendations {
+			recommendation.UserID = userID
+			err = tx.Create(&recommendation).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
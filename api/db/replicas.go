@@ -0,0 +1,197 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"log"
+	"movie-rating-api/models"
+	"time"
+)
+
+// NotifyChannel is the postgres channel every committed event is announced on
+const NotifyChannel = "movie_rating_events"
+
+const (
+	// the listener waits minReconnect after losing its connection, doubling up to maxReconnect
+	minReconnect = 10 * time.Second
+	maxReconnect = time.Minute
+	// listenerPing is how often an idle listener checks its connection is still alive
+	listenerPing = 90 * time.Second
+	// maxNotifyPayload stays below the 8000 bytes postgres allows, larger events are announced without their data
+	maxNotifyPayload = 7000
+)
+
+type ReplicaDB interface {
+	// WatchReplicas passes the changes other replicas commit on to the OnEvent listeners until ctx is done.
+	// Postgres announces every event with NOTIFY, other databases poll the change log every pollInterval.
+	WatchReplicas(ctx context.Context, connString string, pollInterval time.Duration) error
+}
+
+// notification is the payload of a NOTIFY on NotifyChannel
+type notification struct {
+	// Origin is the replica that committed the change, it published the event itself
+	Origin string `json:"origin"`
+	// Event is nil when it did not fit in a notification
+	Event *Event `json:"event,omitempty"`
+}
+
+func newOrigin() string {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		// only used to skip our own notifications, a clash costs an event
+		return time.Now().Format(time.RFC3339Nano)
+	}
+
+	return hex.EncodeToString(id)
+}
+
+// notifyReplicas announces the event when the transaction commits, postgres drops the notification on rollback
+func (d dbClient) notifyReplicas(tx *gorm.DB, event Event) error {
+	if tx.Dialect().GetName() != "postgres" {
+		return nil
+	}
+
+	payload, err := json.Marshal(notification{Origin: d.origin, Event: &event})
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		payload, err = json.Marshal(notification{Origin: d.origin})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Exec("SELECT pg_notify(?, ?)", NotifyChannel, string(payload)).Error
+}
+
+// invalidateReplicas announces a write with too many events to send, replicas reload instead when the transaction commits
+func (d dbClient) invalidateReplicas(tx *gorm.DB) error {
+	if tx.Dialect().GetName() != "postgres" {
+		return nil
+	}
+
+	payload, err := json.Marshal(notification{Origin: d.origin})
+	if err != nil {
+		return err
+	}
+
+	return tx.Exec("SELECT pg_notify(?, ?)", NotifyChannel, string(payload)).Error
+}
+
+func (d dbClient) WatchReplicas(ctx context.Context, connString string, pollInterval time.Duration) error {
+	if d.Gorm.Dialect().GetName() == "postgres" {
+		return d.listen(ctx, connString)
+	}
+
+	return d.poll(ctx, pollInterval)
+}
+
+func (d dbClient) listen(ctx context.Context, connString string) error {
+	listener := pq.NewListener(connString, minReconnect, maxReconnect, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			log.Printf("lost the connection for replica notifications: %v\n", err)
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("failed to reconnect for replica notifications: %v\n", err)
+		case pq.ListenerEventReconnected:
+			log.Println("reconnected for replica notifications")
+		}
+	})
+	defer listener.Close()
+
+	err := listener.Listen(NotifyChannel)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			if n == nil {
+				// the listener reconnected, whatever was announced while it was away is lost
+				d.listeners.invalidate()
+				continue
+			}
+			d.applyNotification(n.Extra)
+		case <-time.After(listenerPing):
+			go func() {
+				err := listener.Ping()
+				if err != nil {
+					log.Printf("failed to ping the replica notifications connection: %s\n", err.Error())
+				}
+			}()
+		}
+	}
+}
+
+func (d dbClient) applyNotification(payload string) {
+	var n notification
+	err := json.Unmarshal([]byte(payload), &n)
+	if err != nil {
+		log.Printf("failed to parse replica notification: %s\n", err.Error())
+		return
+	}
+	if n.Origin == d.origin {
+		return
+	}
+
+	if n.Event == nil {
+		d.listeners.invalidate()
+		return
+	}
+	d.listeners.publish(*n.Event)
+}
+
+// poll reads the change log rows other replicas appended since the last poll and passes their events on.
+func (d dbClient) poll(ctx context.Context, interval time.Duration) error {
+	var last models.ChangeEvents
+	err := d.Gorm.Select("id").Order("id desc").Limit(1).Find(&last).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		var changes []models.ChangeEvents
+		err := d.Gorm.Where("id > ?", last.ID).Order("id").Find(&changes).Error
+		if err != nil {
+			log.Printf("failed to poll for replica changes: %s\n", err.Error())
+			continue
+		}
+
+		var events []Event
+		remote := false
+		for _, change := range changes {
+			last = change
+			if change.Origin == d.origin {
+				continue
+			}
+
+			remote = true
+			if event, ok := ChangeEvent(change); ok {
+				events = append(events, event)
+			}
+		}
+		if !remote {
+			continue
+		}
+
+		d.listeners.publish(events...)
+	}
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestNotificationsOfOtherReplicas checks what the postgres listener does with the notifications it is sent
+func TestNotificationsOfOtherReplicas(t *testing.T) {
+	d := NewDBCLient(nil).(*dbClient)
+	var events []Event
+	invalidations := 0
+	d.OnEvent(func(event Event) { events = append(events, event) })
+	d.OnInvalidate(func() { invalidations++ })
+
+	notify := func(n notification) {
+		payload, err := json.Marshal(n)
+		if err != nil {
+			t.Fatalf("failed to marshal notification: %s", err.Error())
+		}
+		d.applyNotification(string(payload))
+	}
+
+	event := Event{ID: "1", Type: EventMovieUpdated, Data: MovieEvent{ID: 1, Title: "Life of Brian"}}
+	notify(notification{Origin: "other", Event: &event})
+	if len(events) != 1 || events[0].Type != EventMovieUpdated || events[0].MovieID() != 1 {
+		t.Fatalf("expected the event of the other replica to be published, got %v", events)
+	}
+
+	notify(notification{Origin: d.origin, Event: &event})
+	if len(events) != 1 {
+		t.Fatalf("expected the replica's own event not to be published twice")
+	}
+
+	// too large to send, or a bulk load
+	notify(notification{Origin: "other"})
+	if invalidations != 1 || len(events) != 1 {
+		t.Fatalf("expected a notification without an event to invalidate, got %d invalidations", invalidations)
+	}
+
+	d.applyNotification("not json")
+	if invalidations != 1 || len(events) != 1 {
+		t.Fatalf("expected a notification that cannot be parsed to be skipped")
+	}
+}
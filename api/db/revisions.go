@@ -0,0 +1,450 @@
+package db
+
+import (
+	"encoding/json"
+	"github.com/jinzhu/gorm"
+	"movie-rating-api/models"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SystemAuthor is the author of the revision that keeps how a movie looked before its first edit
+const SystemAuthor = "system"
+
+// MovieSnapshot is the state of a movie kept by a revision
+type MovieSnapshot struct {
+	Title    string `json:"title"`
+	Plot     string `json:"plot"`
+	Genre    string `json:"genre"`
+	Year     string `json:"year"`
+	Rated    string `json:"rated"`
+	Director string `json:"director"`
+	Actors   string `json:"actors"`
+	Released string `json:"released"`
+	// Ratings are the sources' ratings by source
+	Ratings map[string]int `json:"ratings"`
+}
+
+// ParseMovieSnapshot reads the snapshot of a revision
+func ParseMovieSnapshot(revision models.MovieRevisions) (MovieSnapshot, error) {
+	var snapshot MovieSnapshot
+	err := json.Unmarshal([]byte(revision.Snapshot), &snapshot)
+	if err != nil {
+		return MovieSnapshot{}, err
+	}
+	if snapshot.Ratings == nil {
+		snapshot.Ratings = map[string]int{}
+	}
+
+	return snapshot, nil
+}
+
+type RevisionDB interface {
+	// GetMovieRevisions returns the revisions of the movie, oldest first
+	GetMovieRevisions(movieID int) ([]models.MovieRevisions, error)
+	// UpdateMovie sets the fields of the movie with movie.ID and records a revision by the author.
+	// When nothing changes no revision is recorded and the latest one is returned, ok is false when there is no movie with the id.
+	// It fails with ErrVersionMismatch when the movie is no longer at version, unless version is AnyVersion.
+	UpdateMovie(movie models.Movies, version int, author string, at time.Time) (models.MovieRevisions, bool, error)
+	// RestoreMovieRevision brings back the fields and ratings the movie had at the revision and records it as a new revision by the author.
+	// When nothing changes no revision is recorded and the latest one is returned, ok is false when there is no such movie or revision.
+	RestoreMovieRevision(movieID int, revision int, author string, at time.Time) (models.MovieRevisions, bool, error)
+}
+
+func (d dbClient) GetMovieRevisions(movieID int) ([]models.MovieRevisions, error) {
+	var result []models.MovieRevisions
+	err := d.Gorm.Where("movie_id = ?", movieID).Order("revision").Find(&result).Error
+	if err != nil {
+		return []models.MovieRevisions{}, err
+	}
+
+	return result, nil
+}
+
+func (d dbClient) UpdateMovie(movie models.Movies, version int, author string, at time.Time) (models.MovieRevisions, bool, error) {
+	var revision models.MovieRevisions
+	var events []Event
+	ok := true
+	err := d.transaction(func(tx *gorm.DB) error {
+		existing, found, err := lockMovie(tx, "id = ?", movie.ID)
+		if err != nil || !found {
+			ok = found
+			return err
+		}
+
+		err = checkVersion(existing.Version, version)
+		if err != nil {
+			return err
+		}
+
+		err = ensureBaselineRevision(tx, existing, at)
+		if err != nil {
+			return err
+		}
+
+		event, changed, err := d.updateMovie(tx, existing, movie, at)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			revision, err = latestRevision(tx, existing.ID)
+			return err
+		}
+		events = append(events, event)
+
+		revision, err = recordRevision(tx, movie, author, 0, at)
+		return err
+	})
+	if err != nil || !ok {
+		return models.MovieRevisions{}, ok, err
+	}
+
+	if len(events) != 0 {
+		d.committed(events...)
+	}
+	return revision, true, nil
+}
+
+func (d dbClient) RestoreMovieRevision(movieID int, revision int, author string, at time.Time) (models.MovieRevisions, bool, error) {
+	var restored models.MovieRevisions
+	var events []Event
+	ok := true
+	err := d.transaction(func(tx *gorm.DB) error {
+		existing, found, err := lockMovie(tx, "id = ?", movieID)
+		if err != nil || !found {
+			ok = found
+			return err
+		}
+
+		err = ensureBaselineRevision(tx, existing, at)
+		if err != nil {
+			return err
+		}
+
+		var target models.MovieRevisions
+		err = tx.Where("movie_id = ? AND revision = ?", movieID, revision).First(&target).Error
+		if gorm.IsRecordNotFoundError(err) {
+			ok = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		snapshot, err := ParseMovieSnapshot(target)
+		if err != nil {
+			return err
+		}
+
+		movie := existing
+		movie.Title = snapshot.Title
+		movie.Plot = snapshot.Plot
+		movie.Genre = snapshot.Genre
+		movie.Year = snapshot.Year
+		movie.Rated = snapshot.Rated
+		movie.Director = snapshot.Director
+		movie.Actors = snapshot.Actors
+		movie.Released = snapshot.Released
+
+		event, changed, err := d.updateMovie(tx, existing, movie, at)
+		if err != nil {
+			return err
+		}
+		if changed {
+			events = append(events, event)
+		}
+
+		ratingEvents, err := d.restoreRatings(tx, movie, snapshot.Ratings, at)
+		if err != nil {
+			return err
+		}
+		events = append(events, ratingEvents...)
+
+		if len(events) == 0 {
+			restored, err = latestRevision(tx, movieID)
+			return err
+		}
+
+		restored, err = recordRevision(tx, movie, author, revision, at)
+		return err
+	})
+	if err != nil || !ok {
+		return models.MovieRevisions{}, ok, err
+	}
+
+	if len(events) != 0 {
+		d.committed(events...)
+	}
+	return restored, true, nil
+}
+
+// updateMovie writes the fields of movie over existing, the movie ratings follow a new title as they are joined by title.
+// changed is false when every field already had its value.
+func (d dbClient) updateMovie(tx *gorm.DB, existing models.Movies, movie models.Movies, at time.Time) (Event, bool, error) {
+	movie.Version = existing.Version
+	movie.CreatedAt = existing.CreatedAt
+	movie.UpdatedAt = existing.UpdatedAt
+	if movie == existing {
+		return Event{}, false, nil
+	}
+	movie.Version++
+	movie.UpdatedAt = at
+
+	err := tx.Model(&models.Movies{}).Where("id = ?", existing.ID).Updates(map[string]interface{}{
+		"title":      movie.Title,
+		"plot":       movie.Plot,
+		"genre":      movie.Genre,
+		"year":       movie.Year,
+		"rated":      movie.Rated,
+		"director":   movie.Director,
+		"actors":     movie.Actors,
+		"released":   movie.Released,
+		"updated_at": at,
+	}).Error
+	if err != nil {
+		return Event{}, false, err
+	}
+
+	err = swapVersion(tx, &models.Movies{}, existing.ID, existing.Version)
+	if err != nil {
+		return Event{}, false, err
+	}
+
+	if movie.Title != existing.Title {
+		var movieRatings models.MovieRatings
+		err = tx.Where("title = ?", existing.Title).First(&movieRatings).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return Event{}, false, err
+		}
+
+		if err == nil {
+			before := movieRatings
+			after := movieRatings
+			after.Title = movie.Title
+			after.Version++
+			after.UpdatedAt = at
+			err = tx.Model(&models.MovieRatings{}).Where("id = ?", movieRatings.ID).
+				Updates(map[string]interface{}{"title": movie.Title, "updated_at": at}).Error
+			if err != nil {
+				return Event{}, false, err
+			}
+
+			err = swapVersion(tx, &models.MovieRatings{}, movieRatings.ID, movieRatings.Version)
+			if err != nil {
+				return Event{}, false, err
+			}
+
+			_, err = d.recordChange(tx, Change{
+				Entity:    EntityMovieRatings,
+				EntityID:  strconv.Itoa(movieRatings.ID),
+				Operation: OperationUpdate,
+				Before:    before,
+				After:     after,
+			}, at)
+			if err != nil {
+				return Event{}, false, err
+			}
+		}
+	}
+
+	event, err := d.recordChange(tx, Change{
+		Entity:    EntityMovie,
+		EntityID:  strconv.Itoa(existing.ID),
+		Operation: OperationUpdate,
+		Before:    existing,
+		After:     movie,
+		EventType: EventMovieUpdated,
+		EventData: MovieEvent{
+			ID:    movie.ID,
+			Title: movie.Title,
+			Year:  movie.Year,
+			Genre: movie.Genre,
+		},
+	}, at)
+	if err != nil {
+		return Event{}, false, err
+	}
+
+	return event, true, nil
+}
+
+// restoreRatings sets the movie's ratings to ratings and removes the sources ratings leaves out
+func (d dbClient) restoreRatings(tx *gorm.DB, movie models.Movies, ratings map[string]int, at time.Time) ([]Event, error) {
+	var movieRatings models.MovieRatings
+	err := tx.Preload("Ratings").Where("title = ?", movie.Title).First(&movieRatings).Error
+	if gorm.IsRecordNotFoundError(err) {
+		if len(ratings) == 0 {
+			return nil, nil
+		}
+
+		movieRatings = models.MovieRatings{Title: movie.Title, CreatedAt: at, UpdatedAt: at}
+		err = tx.Create(&movieRatings).Error
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = d.recordChange(tx, Change{
+			Entity:    EntityMovieRatings,
+			EntityID:  strconv.Itoa(movieRatings.ID),
+			Operation: OperationCreate,
+			After:     movieRatings,
+		}, at)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for _, rating := range movieRatings.Ratings {
+		if _, ok := ratings[rating.Source]; ok {
+			continue
+		}
+
+		event, changed, err := d.setRating(tx, movieRatings, movie.ID, rating.Source, nil, at)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			events = append(events, event)
+		}
+	}
+
+	// sorted so the events come out in the same order every time
+	sources := make([]string, 0, len(ratings))
+	for source := range ratings {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		value := ratings[source]
+		event, changed, err := d.setRating(tx, movieRatings, movie.ID, source, &value, at)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			events = append(events, event)
+		}
+	}
+
+	if len(events) != 0 {
+		err = swapVersion(tx, &models.MovieRatings{}, movieRatings.ID, movieRatings.Version)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+// lockMovie reads the movie matching the query, on postgres the row stays locked until tx ends
+// so edits of the same movie get consecutive revisions
+func lockMovie(tx *gorm.DB, query string, args ...interface{}) (models.Movies, bool, error) {
+	if tx.Dialect().GetName() == "postgres" {
+		tx = tx.Set("gorm:query_option", "FOR UPDATE")
+	}
+
+	var movie models.Movies
+	err := tx.Where(query, args...).First(&movie).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return models.Movies{}, false, nil
+	}
+	if err != nil {
+		return models.Movies{}, false, err
+	}
+
+	return movie, true, nil
+}
+
+// lockMovieByTitle is lockMovie for the movie the movie ratings with the title belong to
+func lockMovieByTitle(tx *gorm.DB, title string) (models.Movies, bool, error) {
+	return lockMovie(tx, "title = ?", title)
+}
+
+// snapshotMovie reads the current state of the movie in tx
+func snapshotMovie(tx *gorm.DB, movie models.Movies) (MovieSnapshot, error) {
+	snapshot := MovieSnapshot{
+		Title:    movie.Title,
+		Plot:     movie.Plot,
+		Genre:    movie.Genre,
+		Year:     movie.Year,
+		Rated:    movie.Rated,
+		Director: movie.Director,
+		Actors:   movie.Actors,
+		Released: movie.Released,
+		Ratings:  map[string]int{},
+	}
+
+	var movieRatings models.MovieRatings
+	err := tx.Preload("Ratings").Where("title = ?", movie.Title).First(&movieRatings).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return snapshot, nil
+	}
+	if err != nil {
+		return MovieSnapshot{}, err
+	}
+
+	for _, rating := range movieRatings.Ratings {
+		snapshot.Ratings[rating.Source] = rating.Value
+	}
+
+	return snapshot, nil
+}
+
+// ensureBaselineRevision keeps the movie as it is now as revision 1 before the first edit,
+// movies are created without a revision
+func ensureBaselineRevision(tx *gorm.DB, movie models.Movies, at time.Time) error {
+	var count int
+	err := tx.Model(&models.MovieRevisions{}).Where("movie_id = ?", movie.ID).Count(&count).Error
+	if err != nil || count != 0 {
+		return err
+	}
+
+	_, err = recordRevision(tx, movie, SystemAuthor, 0, at)
+	return err
+}
+
+// recordRevision keeps the current state of the movie as its next revision
+func recordRevision(tx *gorm.DB, movie models.Movies, author string, restoredFrom int, at time.Time) (models.MovieRevisions, error) {
+	snapshot, err := snapshotMovie(tx, movie)
+	if err != nil {
+		return models.MovieRevisions{}, err
+	}
+
+	bytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return models.MovieRevisions{}, err
+	}
+
+	latest, err := latestRevision(tx, movie.ID)
+	if err != nil {
+		return models.MovieRevisions{}, err
+	}
+
+	revision := models.MovieRevisions{
+		MovieID:      movie.ID,
+		Revision:     latest.Revision + 1,
+		Author:       author,
+		Snapshot:     string(bytes),
+		RestoredFrom: restoredFrom,
+		CreatedAt:    at,
+	}
+	err = tx.Create(&revision).Error
+	if err != nil {
+		return models.MovieRevisions{}, err
+	}
+
+	return revision, nil
+}
+
+// latestRevision is the movie's last revision, the zero MovieRevisions when it has none
+func latestRevision(tx *gorm.DB, movieID int) (models.MovieRevisions, error) {
+	var revision models.MovieRevisions
+	err := tx.Where("movie_id = ?", movieID).Order("revision desc").First(&revision).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return models.MovieRevisions{}, nil
+	}
+
+	return revision, err
+}
@@ -0,0 +1,184 @@
+package db_test
+
+import (
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"movie-rating-api/models"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func updateMovie(t *testing.T, client db.Client, id int, author string, edit func(movie *models.Movies)) {
+	movie, _, err := client.GetMovie(id)
+	if err != nil {
+		t.Fatalf("failed to get movie: %s", err.Error())
+	}
+	edit(&movie)
+	_, ok, err := client.UpdateMovie(movie, movie.Version, author, time.Now())
+	if err != nil || !ok {
+		t.Fatalf("failed to update movie: %v", err)
+	}
+}
+
+func observeRating(t *testing.T, client db.Client, movieID int, source string, value int) {
+	ratings, _, err := client.GetMovieRatingsOf(movieID)
+	if err != nil {
+		t.Fatalf("failed to get ratings: %s", err.Error())
+	}
+	_, err = client.ObserveRating(ratings.ID, source, value, db.AnyVersion, "alice", time.Now())
+	if err != nil {
+		t.Fatalf("failed to observe rating: %s", err.Error())
+	}
+}
+
+// changedFields are the fields a revision changed
+func changedFields(revision app.Revision) []string {
+	fields := []string{}
+	for _, change := range revision.Changes {
+		fields = append(fields, change.Field)
+	}
+	return fields
+}
+
+func TestSQLiteRevisionsDiffAndRollBack(t *testing.T) {
+	client, _ := dbtest.NewSeededSQLite(t)
+	original, _, err := client.GetMovie(1)
+	if err != nil {
+		t.Fatalf("failed to get movie: %s", err.Error())
+	}
+	originalRatings, _, err := client.GetMovieRatingsOf(1)
+	if err != nil || len(originalRatings.Ratings) == 0 {
+		t.Fatalf("expected the seeded movie to have ratings: %v", err)
+	}
+	source := originalRatings.Ratings[0].Source
+
+	updateMovie(t, client, 1, "alice", func(movie *models.Movies) { movie.Plot = "A new plot" })
+	observeRating(t, client, 1, source, 1)
+	updateMovie(t, client, 1, "bob", func(movie *models.Movies) { movie.Title, movie.Genre = "Renamed", "Drama" })
+	observeRating(t, client, 1, "Local", 10)
+
+	revisions, ok, err := app.New(client).GetMovieRevisions(1)
+	if err != nil || !ok {
+		t.Fatalf("failed to get revisions: %v", err)
+	}
+	expected := [][]string{{}, {"plot"}, {"ratings." + source}, {"title", "genre"}, {"ratings.Local"}}
+	if len(revisions) != len(expected) {
+		t.Fatalf("expected the baseline and a revision per edit, got %d revisions", len(revisions))
+	}
+	for i, revision := range revisions {
+		if revision.Revision != i+1 || !reflect.DeepEqual(changedFields(revision), expected[i]) {
+			t.Fatalf("expected revision %d to change %v, got %d changing %v", i+1, expected[i], revision.Revision, changedFields(revision))
+		}
+	}
+	if revisions[0].Author != db.SystemAuthor || revisions[1].Author != "alice" || revisions[3].Author != "bob" {
+		t.Fatalf("expected the authors of the edits, got %s, %s and %s", revisions[0].Author, revisions[1].Author, revisions[3].Author)
+	}
+	if change := revisions[1].Changes[0]; change.Before != original.Plot || change.After != "A new plot" {
+		t.Fatalf("expected the plot before and after, got %+v", change)
+	}
+	if change := revisions[4].Changes[0]; change.Before != nil || change.After != 10 {
+		t.Fatalf("expected the added rating to have nothing before, got %+v", change)
+	}
+
+	before, _, _ := client.GetMovie(1)
+	beforeRatings, _, _ := client.GetMovieRatingsOf(1)
+	restored, ok, err := client.RestoreMovieRevision(1, 1, "carol", time.Now())
+	if err != nil || !ok {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+	if restored.Revision != 6 || restored.RestoredFrom != 1 || restored.Author != "carol" {
+		t.Fatalf("expected the rollback as revision 6 from 1, got %+v", restored)
+	}
+
+	movie, _, err := client.GetMovie(1)
+	if err != nil {
+		t.Fatalf("failed to get movie: %s", err.Error())
+	}
+	if movie.Title != original.Title || movie.Plot != original.Plot || movie.Genre != original.Genre {
+		t.Fatalf("expected the movie as it was, got %+v", movie)
+	}
+	if movie.Version != before.Version+1 {
+		t.Fatalf("expected the rollback to bump the version from %d, got %d", before.Version, movie.Version)
+	}
+	// the ratings follow the title back and lose the source added since
+	ratings, ok, err := client.GetMovieRatingsOf(1)
+	if err != nil || !ok || ratings.Version <= beforeRatings.Version {
+		t.Fatalf("expected the ratings at a new version, got %+v %v", ratings, err)
+	}
+	if len(ratings.Ratings) != len(originalRatings.Ratings) {
+		t.Fatalf("expected the original ratings back, got %+v", ratings.Ratings)
+	}
+	for _, rating := range ratings.Ratings {
+		if rating.Source == source && rating.Value != originalRatings.Ratings[0].Value {
+			t.Fatalf("expected %s back at %d, got %d", source, originalRatings.Ratings[0].Value, rating.Value)
+		}
+	}
+
+	revisions, _, err = app.New(client).GetMovieRevisions(1)
+	if err != nil {
+		t.Fatalf("failed to get revisions: %s", err.Error())
+	}
+	undone := []string{"ratings.Local", "ratings." + source}
+	sort.Strings(undone)
+	if fields := changedFields(revisions[5]); !reflect.DeepEqual(fields, append([]string{"title", "plot", "genre"}, undone...)) {
+		t.Fatalf("expected the rollback to undo every edit, got %v", fields)
+	}
+
+	// rolling back to what the movie already is records nothing
+	again, ok, err := client.RestoreMovieRevision(1, 1, "carol", time.Now())
+	if err != nil || !ok || again.Revision != 6 {
+		t.Fatalf("expected the latest revision back, got %+v %v", again, err)
+	}
+	if unchanged, _, _ := client.GetMovie(1); unchanged.Version != movie.Version {
+		t.Fatalf("expected the version to stay at %d, got %d", movie.Version, unchanged.Version)
+	}
+
+	if _, ok, err := client.RestoreMovieRevision(1, 99, "carol", time.Now()); err != nil || ok {
+		t.Fatalf("expected no revision 99, got %t %v", ok, err)
+	}
+}
+
+func TestSQLiteRollbackOfADeletedMovie(t *testing.T) {
+	client, _ := dbtest.NewSeededSQLite(t)
+	original, _, err := client.GetMovie(1)
+	if err != nil {
+		t.Fatalf("failed to get movie: %s", err.Error())
+	}
+	updateMovie(t, client, 1, "alice", func(movie *models.Movies) { movie.Plot = "A new plot" })
+
+	_, err = client.DeleteMovie(1, db.AnyVersion, time.Now())
+	if err != nil {
+		t.Fatalf("failed to delete movie: %s", err.Error())
+	}
+	revisions, err := client.GetMovieRevisions(1)
+	if err != nil {
+		t.Fatalf("failed to get revisions: %s", err.Error())
+	}
+
+	// a trashed movie has to be restored before it is rolled back
+	_, ok, err := client.RestoreMovieRevision(1, 1, "bob", time.Now())
+	if err != nil || ok {
+		t.Fatalf("expected no movie to roll back, got %t %v", ok, err)
+	}
+	if after, _ := client.GetMovieRevisions(1); len(after) != len(revisions) {
+		t.Fatalf("expected no revision for the refused rollback, got %d more", len(after)-len(revisions))
+	}
+	if _, ok, _ := client.GetMovie(1); ok {
+		t.Fatalf("expected the movie to stay in the trash")
+	}
+
+	_, err = client.RestoreMovie(1, time.Now())
+	if err != nil {
+		t.Fatalf("failed to restore movie: %s", err.Error())
+	}
+	_, ok, err = client.RestoreMovieRevision(1, 1, "bob", time.Now())
+	if err != nil || !ok {
+		t.Fatalf("failed to roll back the restored movie: %v", err)
+	}
+	if movie, _, _ := client.GetMovie(1); movie.Plot != original.Plot {
+		t.Fatalf("expected the original plot, got %q", movie.Plot)
+	}
+}
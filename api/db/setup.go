@@ -8,7 +8,6 @@ import (
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"log"
 	"movie-rating-api/models"
-	"strings"
 	"time"
 )
 
@@ -86,17 +85,13 @@ func getPostgresConfig() PostgresConfig {
 	}
 }
 
-var db *gorm.DB
-
-func InitializeDB() error {
+func InitializeDB() (*gorm.DB, error) {
 	driver, connString, err := ConnectionInfoFromEnvironment()
 	if err != nil {
-		return fmt.Errorf("error getting the db driver and connection string: %s", err.Error())
+		return nil, fmt.Errorf("error getting the db driver and connection string: %s", err.Error())
 	}
 
-	db = setupDB(driver, connString, true)
-
-	return nil
+	return setupDB(driver, connString, true), nil
 }
 
 func setupDB(driver string, connString string, autoMigrate bool) *gorm.DB {
@@ -138,11 +133,43 @@ func Connect(driver string, connection interface{}, autoMigrate bool) (*gorm.DB,
 		dbConnect.CreateTable(&models.Movies{})
 		dbConnect.CreateTable(&models.MovieRatings{})
 		dbConnect.CreateTable(&models.Ratings{})
+		dbConnect.CreateTable(&models.RateLimitBuckets{})
+		dbConnect.CreateTable(&models.UserRatings{})
+		dbConnect.CreateTable(&models.Recommendations{})
+		dbConnect.CreateTable(&models.MovieViews{})
+		dbConnect.CreateTable(&models.ListOverrides{})
+		dbConnect.CreateTable(&models.RatingObservations{})
+		dbConnect.CreateTable(&models.WatchlistEntries{})
+		dbConnect.CreateTable(&models.DiaryEntries{})
+		dbConnect.CreateTable(&models.WebhookSubscriptions{})
+		dbConnect.CreateTable(&models.WebhookDeliveries{})
+		dbConnect.CreateTable(&models.ChangeEvents{})
+		dbConnect.CreateTable(&models.OutboxCursors{})
+		dbConnect.CreateTable(&models.MovieRevisions{})
+		dbConnect.CreateTable(&models.IdempotencyKeys{})
+		dbConnect.CreateTable(&models.MediaAssets{})
+		dbConnect.CreateTable(&models.MovieImages{})
 
 		dbConnect.AutoMigrate(
 			&models.Movies{},
 			&models.MovieRatings{},
 			&models.Ratings{},
+			&models.RateLimitBuckets{},
+			&models.UserRatings{},
+			&models.Recommendations{},
+			&models.MovieViews{},
+			&models.ListOverrides{},
+			&models.RatingObservations{},
+			&models.WatchlistEntries{},
+			&models.DiaryEntries{},
+			&models.WebhookSubscriptions{},
+			&models.WebhookDeliveries{},
+			&models.ChangeEvents{},
+			&models.OutboxCursors{},
+			&models.MovieRevisions{},
+			&models.IdempotencyKeys{},
+			&models.MediaAssets{},
+			&models.MovieImages{},
 		)
 
 		dbConnect.Model(&models.Ratings{}).AddForeignKey("movie_ratings_id", "movie_ratings(id)", "RESTRICT", "RESTRICT")
@@ -160,6 +187,8 @@ func Connect(driver string, connection interface{}, autoMigrate bool) (*gorm.DB,
 	return dbConnect, err
 }
 
+// InitializeMovies seeds the movies and ratings in one unit of work, so a failure leaves none of them behind.
+// Rows that are already there are skipped.
 func InitializeMovies(dbClient Client) error {
 	var moviesToCreate []models.Movies
 	err := json.Unmarshal([]byte(moviesJsonString), &moviesToCreate)
@@ -167,35 +196,21 @@ func InitializeMovies(dbClient Client) error {
 		return err
 	}
 
-	for _, movie := range moviesToCreate {
-		err = dbClient.CreateMovie(movie)
-		if err != nil {
-			if !strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
-				return err
-			}
-		}
-	}
-
 	var ratingsToCreate []models.MovieRatings
 	err = json.Unmarshal([]byte(ratingsJsonString), &ratingsToCreate)
 	if err != nil {
 		return err
 	}
 
-	for _, rating := range ratingsToCreate {
-		for i, _ := range rating.Ratings {
-			rating.Ratings[i].MovieRatingsID = rating.ID
-		}
-
-		err = dbClient.CreateMovieRating(rating)
+	return dbClient.WithTx(func(tx Client) error {
+		_, err := tx.BulkLoad(moviesToCreate, ratingsToCreate, nil)
 		if err != nil {
-			if !strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
-				return err
-			}
+			return err
 		}
-	}
 
-	return nil
+		// ratings seeded before observations were kept have no history yet
+		return tx.BackfillRatingObservations()
+	})
 }
 
 const moviesJsonString = `[
@@ -0,0 +1,685 @@
+package db
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"movie-rating-api/models"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrParentDeleted   = fmt.Errorf("it belongs to a movie or movie ratings in the trash, restore that first")
+	ErrRestoreConflict = fmt.Errorf("the source rated the movie again since it was deleted")
+)
+
+// TrashItem is a movie, movie ratings or rating in the trash
+type TrashItem struct {
+	Entity   string
+	EntityID string
+	// MovieID is the movie the item belongs to, 0 when there is no movie with its title
+	MovieID int
+	Title   string
+	// Source and Value are only set on ratings
+	Source    string
+	Value     int
+	DeletedAt time.Time
+}
+
+type TrashDB interface {
+	// GetTrash returns the soft deleted movies, movie ratings and ratings, the most recently deleted first
+	GetTrash() ([]TrashItem, error)
+	// DeleteMovie moves the movie to the trash together with its movie ratings and their ratings.
+	// ok is false when there is no movie with the id, version is checked as by UpdateMovie.
+	DeleteMovie(id int, version int, at time.Time) (bool, error)
+	// RestoreMovie brings the movie back from the trash with what was deleted along with it.
+	// ok is false when the trash has no movie with the id.
+	RestoreMovie(id int, at time.Time) (bool, error)
+	// DeleteMovieRatings moves the movie ratings of the movie and their ratings to the trash and records a revision by the author.
+	// ok is false when the movie has no movie ratings, version is the movie ratings' version as by ObserveRating.
+	DeleteMovieRatings(movieID int, version int, author string, at time.Time) (bool, error)
+	// RestoreMovieRatings brings the movie ratings of the movie back with the ratings deleted along with them.
+	// ok is false when the trash has no movie ratings of the movie.
+	RestoreMovieRatings(movieID int, author string, at time.Time) (bool, error)
+	// DeleteRating moves the source's rating of the movie to the trash and records a revision by the author.
+	// ok is false when the source has not rated the movie, version is the movie ratings' version as by ObserveRating.
+	DeleteRating(movieID int, source string, version int, author string, at time.Time) (bool, error)
+	// RestoreRating brings back the source's last deleted rating of the movie. ok is false when the trash has none.
+	RestoreRating(movieID int, source string, author string, at time.Time) (bool, error)
+	// PurgeTrash deletes for good what was moved to the trash before the time, ratings before their movie ratings
+	// so the foreign key is never broken. It returns how many movies, movie ratings and ratings were purged.
+	PurgeTrash(before time.Time) (int, error)
+}
+
+// trashTime is the deleted_at written for a delete at the time, it reads back the same from postgres and sqlite
+// so what was deleted along with a movie can be found by its deleted_at
+func trashTime(at time.Time) time.Time {
+	return at.UTC().Truncate(time.Microsecond)
+}
+
+// liveMovies limits a query of rows with a movie_id to the movies that are not in the trash
+func liveMovies(query *gorm.DB) *gorm.DB {
+	return query.Where("movie_id IN (SELECT id FROM movies WHERE deleted_at IS NULL)")
+}
+
+func (d dbClient) GetTrash() ([]TrashItem, error) {
+	var titles []models.Movies
+	err := d.Gorm.Unscoped().Select("id, title").Find(&titles).Error
+	if err != nil {
+		return []TrashItem{}, err
+	}
+	movieIDs := map[string]int{}
+	for _, movie := range titles {
+		movieIDs[movie.Title] = movie.ID
+	}
+
+	var movies []models.Movies
+	err = d.Gorm.Unscoped().Where("deleted_at IS NOT NULL").Find(&movies).Error
+	if err != nil {
+		return []TrashItem{}, err
+	}
+
+	var movieRatings []models.MovieRatings
+	err = d.Gorm.Unscoped().Find(&movieRatings).Error
+	if err != nil {
+		return []TrashItem{}, err
+	}
+	titlesByRatingsID := map[int]string{}
+	for _, movieRating := range movieRatings {
+		titlesByRatingsID[movieRating.ID] = movieRating.Title
+	}
+
+	var ratings []models.Ratings
+	err = d.Gorm.Unscoped().Where("deleted_at IS NOT NULL").Find(&ratings).Error
+	if err != nil {
+		return []TrashItem{}, err
+	}
+
+	result := []TrashItem{}
+	for _, movie := range movies {
+		result = append(result, TrashItem{
+			Entity:    EntityMovie,
+			EntityID:  strconv.Itoa(movie.ID),
+			MovieID:   movie.ID,
+			Title:     movie.Title,
+			DeletedAt: *movie.DeletedAt,
+		})
+	}
+	for _, movieRating := range movieRatings {
+		if movieRating.DeletedAt == nil {
+			continue
+		}
+		result = append(result, TrashItem{
+			Entity:    EntityMovieRatings,
+			EntityID:  strconv.Itoa(movieRating.ID),
+			MovieID:   movieIDs[movieRating.Title],
+			Title:     movieRating.Title,
+			DeletedAt: *movieRating.DeletedAt,
+		})
+	}
+	for _, rating := range ratings {
+		title := titlesByRatingsID[rating.MovieRatingsID]
+		result = append(result, TrashItem{
+			Entity:    EntityRating,
+			EntityID:  ratingID(rating.MovieRatingsID, rating.Source),
+			MovieID:   movieIDs[title],
+			Title:     title,
+			Source:    rating.Source,
+			Value:     rating.Value,
+			DeletedAt: *rating.DeletedAt,
+		})
+	}
+
+	SortTrash(result)
+	return result, nil
+}
+
+// SortTrash orders the items the most recently deleted first, a movie before its movie ratings and ratings
+func SortTrash(items []TrashItem) {
+	order := map[string]int{EntityMovie: 0, EntityMovieRatings: 1, EntityRating: 2}
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].DeletedAt.Equal(items[j].DeletedAt) {
+			return items[i].DeletedAt.After(items[j].DeletedAt)
+		}
+		if items[i].Entity != items[j].Entity {
+			return order[items[i].Entity] < order[items[j].Entity]
+		}
+
+		return items[i].EntityID < items[j].EntityID
+	})
+}
+
+func (d dbClient) DeleteMovie(id int, version int, at time.Time) (bool, error) {
+	at = trashTime(at)
+	var events []Event
+	ok := true
+	err := d.transaction(func(tx *gorm.DB) error {
+		movie, found, err := lockMovie(tx, "id = ?", id)
+		if err != nil || !found {
+			ok = found
+			return err
+		}
+
+		err = checkVersion(movie.Version, version)
+		if err != nil {
+			return err
+		}
+
+		var movieRatings models.MovieRatings
+		err = tx.Preload("Ratings").Where("title = ?", movie.Title).First(&movieRatings).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+		if err == nil {
+			events, err = d.trashMovieRatings(tx, movieRatings, movie.ID, at)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tx.Model(&models.Movies{}).Where("id = ?", id).Update("deleted_at", at).Error
+		if err != nil {
+			return err
+		}
+
+		err = swapVersion(tx, &models.Movies{}, id, movie.Version)
+		if err != nil {
+			return err
+		}
+
+		event, err := d.recordChange(tx, Change{
+			Entity:    EntityMovie,
+			EntityID:  strconv.Itoa(id),
+			Operation: OperationDelete,
+			Before:    movie,
+			EventType: EventMovieDeleted,
+			EventData: MovieEvent{ID: movie.ID, Title: movie.Title, Year: movie.Year, Genre: movie.Genre},
+		}, at)
+		events = append(events, event)
+		return err
+	})
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	d.committed(events...)
+	return true, nil
+}
+
+func (d dbClient) RestoreMovie(id int, at time.Time) (bool, error) {
+	at = trashTime(at)
+	var events []Event
+	ok := true
+	err := d.transaction(func(tx *gorm.DB) error {
+		var movie models.Movies
+		err := tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&movie).Error
+		if gorm.IsRecordNotFoundError(err) {
+			ok = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		deletedAt := *movie.DeletedAt
+		err = tx.Unscoped().Model(&models.Movies{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"deleted_at": nil, "updated_at": at}).Error
+		if err != nil {
+			return err
+		}
+
+		err = swapVersion(tx, &models.Movies{}, id, movie.Version)
+		if err != nil {
+			return err
+		}
+
+		restored := movie
+		restored.Version++
+		restored.DeletedAt = nil
+		restored.UpdatedAt = at
+		event, err := d.recordChange(tx, Change{
+			Entity:    EntityMovie,
+			EntityID:  strconv.Itoa(id),
+			Operation: OperationCreate,
+			After:     restored,
+			EventType: EventMovieCreated,
+			EventData: MovieEvent{ID: movie.ID, Title: movie.Title, Year: movie.Year, Genre: movie.Genre},
+		}, at)
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+
+		// the movie ratings deleted along with the movie, earlier deletes stay in the trash
+		var movieRatings models.MovieRatings
+		err = tx.Unscoped().Where("title = ? AND deleted_at >= ?", movie.Title, deletedAt).First(&movieRatings).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ratingEvents, err := d.restoreMovieRatings(tx, movieRatings, id, at)
+		events = append(events, ratingEvents...)
+		return err
+	})
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	d.committed(events...)
+	return true, nil
+}
+
+func (d dbClient) DeleteMovieRatings(movieID int, version int, author string, at time.Time) (bool, error) {
+	at = trashTime(at)
+	var events []Event
+	ok := true
+	err := d.transaction(func(tx *gorm.DB) error {
+		movie, found, err := lockMovie(tx, "id = ?", movieID)
+		if err != nil || !found {
+			ok = found
+			return err
+		}
+
+		var movieRatings models.MovieRatings
+		err = tx.Preload("Ratings").Where("title = ?", movie.Title).First(&movieRatings).Error
+		if gorm.IsRecordNotFoundError(err) {
+			ok = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = checkVersion(movieRatings.Version, version)
+		if err != nil {
+			return err
+		}
+
+		err = ensureBaselineRevision(tx, movie, at)
+		if err != nil {
+			return err
+		}
+
+		events, err = d.trashMovieRatings(tx, movieRatings, movieID, at)
+		if err != nil {
+			return err
+		}
+
+		_, err = recordRevision(tx, movie, author, 0, at)
+		return err
+	})
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	d.committed(events...)
+	return true, nil
+}
+
+func (d dbClient) RestoreMovieRatings(movieID int, author string, at time.Time) (bool, error) {
+	at = trashTime(at)
+	var events []Event
+	ok := true
+	err := d.transaction(func(tx *gorm.DB) error {
+		movie, found, err := lockLiveMovie(tx, movieID)
+		if err != nil || !found {
+			ok = found
+			return err
+		}
+
+		var movieRatings models.MovieRatings
+		err = tx.Unscoped().Where("title = ? AND deleted_at IS NOT NULL", movie.Title).First(&movieRatings).Error
+		if gorm.IsRecordNotFoundError(err) {
+			ok = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = ensureBaselineRevision(tx, movie, at)
+		if err != nil {
+			return err
+		}
+
+		events, err = d.restoreMovieRatings(tx, movieRatings, movieID, at)
+		if err != nil {
+			return err
+		}
+
+		_, err = recordRevision(tx, movie, author, 0, at)
+		return err
+	})
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	d.committed(events...)
+	return true, nil
+}
+
+func (d dbClient) DeleteRating(movieID int, source string, version int, author string, at time.Time) (bool, error) {
+	at = trashTime(at)
+	var event Event
+	var changed bool
+	err := d.transaction(func(tx *gorm.DB) error {
+		movie, found, err := lockMovie(tx, "id = ?", movieID)
+		if err != nil || !found {
+			return err
+		}
+
+		var movieRatings models.MovieRatings
+		err = tx.Where("title = ?", movie.Title).First(&movieRatings).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		event, changed, err = d.editRating(tx, movieRatings, source, nil, version, author, at)
+		return err
+	})
+	if err != nil || !changed {
+		return false, err
+	}
+
+	d.committed(event)
+	return true, nil
+}
+
+func (d dbClient) RestoreRating(movieID int, source string, author string, at time.Time) (bool, error) {
+	at = trashTime(at)
+	var event Event
+	ok := true
+	err := d.transaction(func(tx *gorm.DB) error {
+		movie, found, err := lockLiveMovie(tx, movieID)
+		if err != nil || !found {
+			ok = found
+			return err
+		}
+
+		var movieRatings models.MovieRatings
+		err = tx.Unscoped().Where("title = ?", movie.Title).First(&movieRatings).Error
+		if gorm.IsRecordNotFoundError(err) {
+			ok = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if movieRatings.DeletedAt != nil {
+			return ErrParentDeleted
+		}
+
+		var rating models.Ratings
+		err = tx.Unscoped().Where("movie_ratings_id = ? AND source = ? AND deleted_at IS NOT NULL", movieRatings.ID, source).
+			Order("deleted_at desc").First(&rating).Error
+		if gorm.IsRecordNotFoundError(err) {
+			ok = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = ensureBaselineRevision(tx, movie, at)
+		if err != nil {
+			return err
+		}
+
+		event, err = d.restoreRating(tx, movieRatings, movieID, rating, at)
+		if err != nil {
+			return err
+		}
+
+		err = swapVersion(tx, &models.MovieRatings{}, movieRatings.ID, movieRatings.Version)
+		if err != nil {
+			return err
+		}
+
+		_, err = recordRevision(tx, movie, author, 0, at)
+		return err
+	})
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	d.committed(event)
+	return true, nil
+}
+
+func (d dbClient) PurgeTrash(before time.Time) (int, error) {
+	before = before.UTC()
+	var purged int
+	err := d.transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("deleted_at < ?", before).Delete(&models.Ratings{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged += int(result.RowsAffected)
+
+		// movie ratings wait for every rating that still refers to them
+		var movieRatings []models.MovieRatings
+		err := tx.Unscoped().Select("id").
+			Where("deleted_at < ? AND NOT EXISTS (SELECT 1 FROM ratings WHERE ratings.movie_ratings_id = movie_ratings.id)", before).
+			Find(&movieRatings).Error
+		if err != nil {
+			return err
+		}
+
+		if len(movieRatings) != 0 {
+			var ids []int
+			for _, movieRating := range movieRatings {
+				ids = append(ids, movieRating.ID)
+			}
+
+			err = tx.Where("movie_ratings_id IN (?)", ids).Delete(&models.RatingObservations{}).Error
+			if err != nil {
+				return err
+			}
+
+			result = tx.Unscoped().Where("id IN (?)", ids).Delete(&models.MovieRatings{})
+			if result.Error != nil {
+				return result.Error
+			}
+			purged += int(result.RowsAffected)
+		}
+
+		// movies wait for their movie ratings in the trash, so they are purged together or the movie last
+		var movies []models.Movies
+		err = tx.Unscoped().Select("id").
+			Where("deleted_at < ? AND NOT EXISTS (SELECT 1 FROM movie_ratings WHERE movie_ratings.title = movies.title "+
+				"AND movie_ratings.deleted_at IS NOT NULL)", before).
+			Find(&movies).Error
+		if err != nil || len(movies) == 0 {
+			return err
+		}
+
+		var ids []int
+		for _, movie := range movies {
+			ids = append(ids, movie.ID)
+		}
+
+		// user ratings and diary entries are the users' own and stay
+		for _, model := range []interface{}{
+			&models.MovieRevisions{},
+			&models.ListOverrides{},
+			&models.WatchlistEntries{},
+			&models.Recommendations{},
+			&models.MovieViews{},
+			&models.MovieImages{},
+		} {
+			err = tx.Where("movie_id IN (?)", ids).Delete(model).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		result = tx.Unscoped().Where("id IN (?)", ids).Delete(&models.Movies{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged += int(result.RowsAffected)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// trashMovieRatings moves the ratings and then the movie ratings to the trash
+func (d dbClient) trashMovieRatings(tx *gorm.DB, movieRatings models.MovieRatings, movieID int, at time.Time) ([]Event, error) {
+	var events []Event
+	for _, rating := range movieRatings.Ratings {
+		event, changed, err := d.setRating(tx, movieRatings, movieID, rating.Source, nil, at)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			events = append(events, event)
+		}
+	}
+
+	err := tx.Model(&models.MovieRatings{}).Where("id = ?", movieRatings.ID).Update("deleted_at", at).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = swapVersion(tx, &models.MovieRatings{}, movieRatings.ID, movieRatings.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	before := movieRatings
+	before.Ratings = nil
+	_, err = d.recordChange(tx, Change{
+		Entity:    EntityMovieRatings,
+		EntityID:  strconv.Itoa(movieRatings.ID),
+		Operation: OperationDelete,
+		Before:    before,
+	}, at)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// restoreMovieRatings brings back the movie ratings and the ratings deleted along with them
+func (d dbClient) restoreMovieRatings(tx *gorm.DB, movieRatings models.MovieRatings, movieID int, at time.Time) ([]Event, error) {
+	deletedAt := *movieRatings.DeletedAt
+	err := tx.Unscoped().Model(&models.MovieRatings{}).Where("id = ?", movieRatings.ID).
+		Updates(map[string]interface{}{"deleted_at": nil, "updated_at": at}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = swapVersion(tx, &models.MovieRatings{}, movieRatings.ID, movieRatings.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	after := movieRatings
+	after.Ratings = nil
+	after.Version++
+	after.DeletedAt = nil
+	after.UpdatedAt = at
+	_, err = d.recordChange(tx, Change{
+		Entity:    EntityMovieRatings,
+		EntityID:  strconv.Itoa(movieRatings.ID),
+		Operation: OperationCreate,
+		After:     after,
+	}, at)
+	if err != nil {
+		return nil, err
+	}
+
+	var ratings []models.Ratings
+	err = tx.Unscoped().Where("movie_ratings_id = ? AND deleted_at >= ?", movieRatings.ID, deletedAt).
+		Order("source").Find(&ratings).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for _, rating := range ratings {
+		event, err := d.restoreRating(tx, movieRatings, movieID, rating, at)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// restoreRating brings back a rating from the trash, unless the source has rated the movie again since
+func (d dbClient) restoreRating(tx *gorm.DB, movieRatings models.MovieRatings, movieID int, rating models.Ratings, at time.Time) (Event, error) {
+	var live int
+	err := tx.Model(&models.Ratings{}).Where("movie_ratings_id = ? AND source = ?", movieRatings.ID, rating.Source).Count(&live).Error
+	if err != nil {
+		return Event{}, err
+	}
+	if live != 0 {
+		return Event{}, ErrRestoreConflict
+	}
+
+	// ratings have no id, a source deleted twice is told apart by when
+	err = tx.Unscoped().Model(&models.Ratings{}).
+		Where("movie_ratings_id = ? AND source = ? AND deleted_at >= ?", movieRatings.ID, rating.Source, *rating.DeletedAt).
+		Updates(map[string]interface{}{"deleted_at": nil, "updated_at": at}).Error
+	if err != nil {
+		return Event{}, err
+	}
+
+	err = tx.Create(&models.RatingObservations{
+		MovieRatingsID: movieRatings.ID,
+		Source:         rating.Source,
+		Value:          rating.Value,
+		ObservedAt:     at,
+	}).Error
+	if err != nil {
+		return Event{}, err
+	}
+
+	return d.recordChange(tx, Change{
+		Entity:    EntityRating,
+		EntityID:  ratingID(movieRatings.ID, rating.Source),
+		Operation: OperationCreate,
+		After:     models.Ratings{MovieRatingsID: movieRatings.ID, Source: rating.Source, Value: rating.Value},
+		EventType: EventRatingCreated,
+		EventData: RatingEvent{
+			MovieRatingsID: movieRatings.ID,
+			MovieID:        movieID,
+			Title:          movieRatings.Title,
+			Source:         rating.Source,
+			Value:          rating.Value,
+		},
+	}, at)
+}
+
+// lockLiveMovie is lockMovie by id, it returns ErrParentDeleted when the movie is in the trash
+func lockLiveMovie(tx *gorm.DB, id int) (models.Movies, bool, error) {
+	movie, found, err := lockMovie(tx, "id = ?", id)
+	if err != nil || found {
+		return movie, found, err
+	}
+
+	var trashed int
+	err = tx.Unscoped().Model(&models.Movies{}).Where("id = ? AND deleted_at IS NOT NULL", id).Count(&trashed).Error
+	if err != nil {
+		return models.Movies{}, false, err
+	}
+	if trashed != 0 {
+		return models.Movies{}, false, ErrParentDeleted
+	}
+
+	return models.Movies{}, false, nil
+}
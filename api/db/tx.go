@@ -0,0 +1,109 @@
+package db
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+)
+
+type TxDB interface {
+	// WithTx runs fn as one unit of work: every read and write of the Client it is given happens in a single
+	// transaction, which commits when fn returns nil and rolls back when it returns an error or panics.
+	// A panic is passed on once the transaction is rolled back.
+	// WithTx on that Client starts a nested unit in a savepoint, so a failing nested unit only undoes its own writes.
+	// The events of the writes are only published once the outermost unit commits.
+	// The Client must not be used after fn returns or from more than one goroutine.
+	WithTx(fn func(Client) error) error
+}
+
+// unitOfWork is the state a dbClient shares with the clients of its nested units
+type unitOfWork struct {
+	savepoints int
+	// committed holds what to do once the outermost transaction commits, in the order the writes happened
+	committed []func()
+}
+
+func (d dbClient) WithTx(fn func(Client) error) error {
+	if d.unit != nil {
+		return d.unit.savepoint(d.Gorm, func(*gorm.DB) error {
+			return fn(d)
+		})
+	}
+
+	unit := &unitOfWork{}
+	// gorm rolls back and passes the panic on when fn panics
+	err := d.Gorm.Transaction(func(tx *gorm.DB) error {
+		client := d
+		client.Gorm = tx
+		client.unit = unit
+		return fn(client)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, committed := range unit.committed {
+		committed()
+	}
+	return nil
+}
+
+// transaction runs fn in a transaction of its own, or in a savepoint when d is the client of a unit of work,
+// so each write stays all or nothing either way
+func (d dbClient) transaction(fn func(tx *gorm.DB) error) error {
+	if d.unit == nil {
+		return d.Gorm.Transaction(fn)
+	}
+
+	return d.unit.savepoint(d.Gorm, fn)
+}
+
+// committed publishes the events of a write once it is committed,
+// which inside a unit of work is when the outermost transaction commits
+func (d dbClient) committed(events ...Event) {
+	publish := func() {
+		d.listeners.publish(events...)
+	}
+
+	if d.unit == nil {
+		publish()
+		return
+	}
+	d.unit.committed = append(d.unit.committed, publish)
+}
+
+// savepoint runs fn in a savepoint of tx, rolling back to it and dropping what was to happen on commit
+// since when fn returns an error or panics
+func (u *unitOfWork) savepoint(tx *gorm.DB, fn func(tx *gorm.DB) error) (err error) {
+	u.savepoints++
+	name := fmt.Sprintf("unit_%d", u.savepoints)
+	committed := len(u.committed)
+
+	err = tx.Exec("SAVEPOINT " + name).Error
+	if err != nil {
+		return err
+	}
+
+	rollback := func() error {
+		u.committed = u.committed[:committed]
+		return tx.Exec("ROLLBACK TO SAVEPOINT " + name).Error
+	}
+
+	panicked := true
+	defer func() {
+		if panicked {
+			// the panic is passed on either way, whatever the rollback returns
+			_ = rollback()
+		}
+	}()
+
+	err = fn(tx)
+	panicked = false
+	if err != nil {
+		if rollbackErr := rollback(); rollbackErr != nil {
+			return fmt.Errorf("%s, and failed to roll back: %s", err.Error(), rollbackErr.Error())
+		}
+		return err
+	}
+
+	return tx.Exec("RELEASE SAVEPOINT " + name).Error
+}
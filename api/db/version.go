@@ -0,0 +1,31 @@
+package db
+
+import (
+	"github.com/jinzhu/gorm"
+	"movie-rating-api/models"
+	"strconv"
+	"time"
+)
+
+type VersionDB interface {
+	// CatalogueVersion returns an opaque version of the movies and ratings and when they last changed.
+	// It is the id of the latest change in the change log, so it is the same on every replica and survives a restart.
+	// The time is zero while the change log is empty.
+	CatalogueVersion() (string, time.Time, error)
+}
+
+// catalogueVersion is the version of a change log whose latest change is last
+func catalogueVersion(last models.ChangeEvents) (string, time.Time) {
+	return strconv.FormatInt(last.ID, 10), last.CreatedAt
+}
+
+func (d dbClient) CatalogueVersion() (string, time.Time, error) {
+	var last models.ChangeEvents
+	err := d.Gorm.Select("id, created_at").Order("id desc").Limit(1).Find(&last).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return "", time.Time{}, err
+	}
+
+	version, modifiedAt := catalogueVersion(last)
+	return version, modifiedAt, nil
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"github.com/jinzhu/gorm"
+	"movie-rating-api/models"
+)
+
+type WatchDB interface {
+	// GetWatchlist returns the user's watchlist by priority, then oldest first. Movies in the trash are left out.
+	GetWatchlist(userID string) ([]models.WatchlistEntries, error)
+	// SaveWatchlistEntry adds the movie to the user's watchlist or replaces its priority and notes
+	SaveWatchlistEntry(entry models.WatchlistEntries) error
+	// DeleteWatchlistEntry removes the movie from the user's watchlist, ok is false when it was not on it
+	DeleteWatchlistEntry(userID string, movieID int) (bool, error)
+	// GetDiary returns the user's diary, oldest watch first. Movies in the trash are left out.
+	GetDiary(userID string) ([]models.DiaryEntries, error)
+	// CreateDiaryEntry adds the entry to the user's diary and returns it with its id
+	CreateDiaryEntry(entry models.DiaryEntries) (models.DiaryEntries, error)
+	// DeleteDiaryEntry removes the entry from the user's diary, ok is false when the user has no entry with the id
+	DeleteDiaryEntry(userID string, id int) (bool, error)
+}
+
+func (d dbClient) GetWatchlist(userID string) ([]models.WatchlistEntries, error) {
+	var result []models.WatchlistEntries
+	err := liveMovies(d.Gorm).Where("user_id = ?", userID).Order("priority, created_at, movie_id").Find(&result).Error
+	if err != nil {
+		return []models.WatchlistEntries{}, err
+	}
+
+	return result, nil
+}
+
+func (d dbClient) SaveWatchlistEntry(entry models.WatchlistEntries) error {
+	return d.transaction(func(tx *gorm.DB) error {
+		var existing models.WatchlistEntries
+		err := tx.Where("user_id = ? AND movie_id = ?", entry.UserID, entry.MovieID).First(&existing).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return tx.Create(&entry).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&existing).Updates(map[string]interface{}{
+			"priority":   entry.Priority,
+			"notes":      entry.Notes,
+			"updated_at": entry.UpdatedAt,
+		}).Error
+	})
+}
+
+func (d dbClient) DeleteWatchlistEntry(userID string, movieID int) (bool, error) {
+	result := d.Gorm.Where("user_id = ? AND movie_id = ?", userID, movieID).Delete(&models.WatchlistEntries{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected != 0, nil
+}
+
+func (d dbClient) GetDiary(userID string) ([]models.DiaryEntries, error) {
+	var result []models.DiaryEntries
+	err := liveMovies(d.Gorm).Where("user_id = ?", userID).Order("watched_on, id").Find(&result).Error
+	if err != nil {
+		return []models.DiaryEntries{}, err
+	}
+
+	return result, nil
+}
+
+func (d dbClient) CreateDiaryEntry(entry models.DiaryEntries) (models.DiaryEntries, error) {
+	err := d.Gorm.Create(&entry).Error
+	if err != nil {
+		return models.DiaryEntries{}, err
+	}
+
+	return entry, nil
+}
+
+func (d dbClient) DeleteDiaryEntry(userID string, id int) (bool, error) {
+	result := d.Gorm.Where("user_id = ? AND id = ?", userID, id).Delete(&models.DiaryEntries{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected != 0, nil
+}
@@ -0,0 +1,241 @@
+package db
+
+import (
+	"encoding/json"
+	"github.com/jinzhu/gorm"
+	"movie-rating-api/models"
+	"strings"
+	"time"
+)
+
+// The statuses of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+type WebhookDB interface {
+	// EnqueueWebhookEvent queues the event for every subscription to it that does not have it queued already,
+	// so publishing an event twice delivers it once. It returns how many deliveries were queued.
+	EnqueueWebhookEvent(event Event) (int, error)
+	CreateWebhookSubscription(subscription models.WebhookSubscriptions) (models.WebhookSubscriptions, error)
+	GetWebhookSubscriptions() ([]models.WebhookSubscriptions, error)
+	// GetWebhookSubscription returns the subscription with the id, ok is false when there is none
+	GetWebhookSubscription(id int) (models.WebhookSubscriptions, bool, error)
+	// DeleteWebhookSubscription removes the subscription and its queued deliveries, ok is false when there was none
+	DeleteWebhookSubscription(id int) (bool, error)
+	// ClaimWebhookDeliveries returns up to limit pending deliveries that are due and pushes their next attempt back by lease,
+	// so other replicas do not claim them while they are being delivered
+	ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDeliveries, error)
+	// SaveWebhookDelivery stores the outcome of a delivery attempt
+	SaveWebhookDelivery(delivery models.WebhookDeliveries) error
+	// GetWebhookDeliveries returns up to limit of the subscription's deliveries with the status, newest first.
+	// An empty status returns every delivery.
+	GetWebhookDeliveries(subscriptionID int, status string, limit int) ([]models.WebhookDeliveries, error)
+	// RetryWebhookDelivery queues a delivered or dead delivery again, ok is false when there is no delivery with the id
+	RetryWebhookDelivery(subscriptionID int, id int, now time.Time) (bool, error)
+}
+
+// Subscribed is whether the subscription receives the event
+func Subscribed(subscription models.WebhookSubscriptions, event string) bool {
+	for _, e := range strings.Split(subscription.Events, ",") {
+		if e = strings.TrimSpace(e); e == event || e == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newWebhookDeliveries builds a pending delivery of the event for every subscription to it
+func newWebhookDeliveries(subscriptions []models.WebhookSubscriptions, event Event) ([]models.WebhookDeliveries, error) {
+	var deliveries []models.WebhookDeliveries
+	var payload []byte
+	for _, subscription := range subscriptions {
+		if !Subscribed(subscription, event.Type) {
+			continue
+		}
+
+		if payload == nil {
+			var err error
+			payload, err = json.Marshal(event)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		deliveries = append(deliveries, models.WebhookDeliveries{
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			Event:          event.Type,
+			Payload:        string(payload),
+			Status:         DeliveryPending,
+			NextAttemptAt:  event.CreatedAt,
+			CreatedAt:      event.CreatedAt,
+		})
+	}
+
+	return deliveries, nil
+}
+
+func (d dbClient) EnqueueWebhookEvent(event Event) (int, error) {
+	queued := 0
+	err := d.transaction(func(tx *gorm.DB) error {
+		var subscriptions []models.WebhookSubscriptions
+		err := tx.Find(&subscriptions).Error
+		if err != nil {
+			return err
+		}
+
+		deliveries, err := newWebhookDeliveries(subscriptions, event)
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range deliveries {
+			// the unique subscription and event id makes enqueueing twice a no op, even when two replicas relay the event at once.
+			// gorm would add a RETURNING to a Create that postgres skips on conflict, so the insert is written out.
+			result := tx.Exec("INSERT INTO webhook_deliveries "+
+				"(subscription_id, event_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at) "+
+				"VALUES (?, ?, ?, ?, ?, 0, ?, 0, '', ?) ON CONFLICT DO NOTHING",
+				delivery.SubscriptionID, delivery.EventID, delivery.Event, delivery.Payload, delivery.Status,
+				delivery.NextAttemptAt, delivery.CreatedAt)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			queued++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return queued, nil
+}
+
+// movieIDByTitle returns the id of the movie with the title, 0 when there is none
+func movieIDByTitle(tx *gorm.DB, title string) (int, error) {
+	var movie models.Movies
+	err := tx.Select("id").Where("title = ?", title).First(&movie).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return 0, nil
+	}
+
+	return movie.ID, err
+}
+
+func (d dbClient) CreateWebhookSubscription(subscription models.WebhookSubscriptions) (models.WebhookSubscriptions, error) {
+	err := d.Gorm.Create(&subscription).Error
+	if err != nil {
+		return models.WebhookSubscriptions{}, err
+	}
+
+	return subscription, nil
+}
+
+func (d dbClient) GetWebhookSubscriptions() ([]models.WebhookSubscriptions, error) {
+	var result []models.WebhookSubscriptions
+	err := d.Gorm.Order("id").Find(&result).Error
+	if err != nil {
+		return []models.WebhookSubscriptions{}, err
+	}
+
+	return result, nil
+}
+
+func (d dbClient) GetWebhookSubscription(id int) (models.WebhookSubscriptions, bool, error) {
+	var result models.WebhookSubscriptions
+	err := d.Gorm.Where("id = ?", id).First(&result).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return models.WebhookSubscriptions{}, false, nil
+	}
+	if err != nil {
+		return models.WebhookSubscriptions{}, false, err
+	}
+
+	return result, true, nil
+}
+
+func (d dbClient) DeleteWebhookSubscription(id int) (bool, error) {
+	var deleted bool
+	err := d.transaction(func(tx *gorm.DB) error {
+		err := tx.Where("subscription_id = ? AND status = ?", id, DeliveryPending).Delete(&models.WebhookDeliveries{}).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Where("id = ?", id).Delete(&models.WebhookSubscriptions{})
+		deleted = result.RowsAffected != 0
+		return result.Error
+	})
+
+	return deleted, err
+}
+
+func (d dbClient) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDeliveries, error) {
+	var result []models.WebhookDeliveries
+	err := d.transaction(func(tx *gorm.DB) error {
+		query := tx
+		if tx.Dialect().GetName() == "postgres" {
+			query = tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED")
+		}
+
+		err := query.Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+			Order("next_attempt_at, id").Limit(limit).Find(&result).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range result {
+			result[i].NextAttemptAt = now.Add(lease)
+			err = tx.Model(&models.WebhookDeliveries{}).Where("id = ?", result[i].ID).
+				Update("next_attempt_at", result[i].NextAttemptAt).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return []models.WebhookDeliveries{}, err
+	}
+
+	return result, nil
+}
+
+func (d dbClient) SaveWebhookDelivery(delivery models.WebhookDeliveries) error {
+	return d.Gorm.Save(&delivery).Error
+}
+
+func (d dbClient) GetWebhookDeliveries(subscriptionID int, status string, limit int) ([]models.WebhookDeliveries, error) {
+	query := d.Gorm.Where("subscription_id = ?", subscriptionID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var result []models.WebhookDeliveries
+	err := query.Order("id desc").Limit(limit).Find(&result).Error
+	if err != nil {
+		return []models.WebhookDeliveries{}, err
+	}
+
+	return result, nil
+}
+
+func (d dbClient) RetryWebhookDelivery(subscriptionID int, id int, now time.Time) (bool, error) {
+	result := d.Gorm.Model(&models.WebhookDeliveries{}).
+		Where("subscription_id = ? AND id = ?", subscriptionID, id).
+		Updates(map[string]interface{}{"status": DeliveryPending, "attempts": 0, "next_attempt_at": now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected != 0, nil
+}
@@ -0,0 +1,140 @@
+package dto
+
+import (
+	"movie-rating-api/batch"
+	"movie-rating-api/models"
+)
+
+// BatchV2 is the response of the batch routes, with an item per item of the request in the same order
+type BatchV2 struct {
+	Mode   string        `json:"mode"`
+	Data   []BatchItemV2 `json:"data"`
+	Count  int           `json:"count"`
+	Failed int           `json:"failed"`
+}
+
+// BatchItemV2 is the outcome of one item, its status is the one the item would have got as a request of its own
+type BatchItemV2 struct {
+	Index  int      `json:"index"`
+	Status int      `json:"status"`
+	Movie  *MovieV2 `json:"movie,omitempty"`
+	// Changed is false when a rating already had the value
+	Changed *bool  `json:"changed,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BatchCreateRequestV2 is the body of POST /api/movies:batchCreate
+type BatchCreateRequestV2 struct {
+	Movies []BatchMovieV2 `json:"movies"`
+}
+
+type BatchMovieV2 struct {
+	Title    string                  `json:"title"`
+	Plot     string                  `json:"plot"`
+	Genre    string                  `json:"genre"`
+	Year     string                  `json:"year"`
+	Rated    string                  `json:"rated"`
+	Director string                  `json:"director"`
+	Actors   string                  `json:"actors"`
+	Released string                  `json:"released"`
+	Ratings  []SourceRatingRequestV2 `json:"ratings"`
+}
+
+// BatchUpsertRequestV2 is the body of POST /api/ratings:batchUpsert
+type BatchUpsertRequestV2 struct {
+	Ratings []BatchRatingV2 `json:"ratings"`
+}
+
+type BatchRatingV2 struct {
+	MovieID int    `json:"movie_id"`
+	Source  string `json:"source"`
+	Value   *int   `json:"value"`
+	// Version is the version in the ETag of the movie's ratings, the rating is set whatever the version without it
+	Version int `json:"version"`
+}
+
+// Batch returns the movies to create, ok is false when a rating has no value
+func (r BatchCreateRequestV2) Batch() ([]batch.Movie, bool) {
+	movies := []batch.Movie{}
+	for _, movie := range r.Movies {
+		var ratings []models.Ratings
+		for _, rating := range movie.Ratings {
+			if rating.Value == nil {
+				return nil, false
+			}
+			ratings = append(ratings, models.Ratings{Source: rating.Source, Value: *rating.Value})
+		}
+
+		movies = append(movies, batch.Movie{
+			Title:    movie.Title,
+			Plot:     movie.Plot,
+			Genre:    movie.Genre,
+			Year:     movie.Year,
+			Rated:    movie.Rated,
+			Director: movie.Director,
+			Actors:   movie.Actors,
+			Released: movie.Released,
+			Ratings:  ratings,
+		})
+	}
+
+	return movies, true
+}
+
+// Batch returns the ratings to set, ok is false when a rating has no value
+func (r BatchUpsertRequestV2) Batch() ([]batch.Rating, bool) {
+	ratings := []batch.Rating{}
+	for _, rating := range r.Ratings {
+		if rating.Value == nil {
+			return nil, false
+		}
+		ratings = append(ratings, batch.Rating{
+			MovieID: rating.MovieID,
+			Source:  rating.Source,
+			Value:   *rating.Value,
+			Version: rating.Version,
+		})
+	}
+
+	return ratings, true
+}
+
+// NewMovieBatchItemV2 is the item of a movie result, statuses at or above 400 carry the error
+func NewMovieBatchItemV2(index int, status int, result batch.MovieResult) BatchItemV2 {
+	item := BatchItemV2{Index: index, Status: status}
+	if result.Err != nil {
+		item.Error = result.Err.Error()
+		return item
+	}
+
+	movie := NewMovieV2(result.Detail)
+	item.Movie = &movie
+	return item
+}
+
+func NewRatingBatchItemV2(index int, status int, result batch.RatingResult) BatchItemV2 {
+	item := BatchItemV2{Index: index, Status: status}
+	if result.Err != nil {
+		item.Error = result.Err.Error()
+		return item
+	}
+
+	changed := result.Changed
+	item.Changed = &changed
+	return item
+}
+
+func NewBatchV2(mode string, items []BatchItemV2) BatchV2 {
+	result := BatchV2{
+		Mode:  mode,
+		Data:  items,
+		Count: len(items),
+	}
+	for _, item := range items {
+		if item.Error != "" {
+			result.Failed++
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,62 @@
+package dto
+
+import (
+	"encoding/json"
+	"movie-rating-api/models"
+	"time"
+)
+
+// ChangeV2 is an entry of the change log, it is also what the outbox sinks publish
+type ChangeV2 struct {
+	ID        int64  `json:"id"`
+	EventID   string `json:"event_id,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Entity    string `json:"entity"`
+	EntityID  string `json:"entity_id"`
+	Operation string `json:"operation"`
+	// Before is null on create and After on delete
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type ChangeListV2 struct {
+	Data  []ChangeV2 `json:"data"`
+	Count int        `json:"count"`
+	// Next is the since param that returns the changes after these
+	Next int64 `json:"next"`
+}
+
+func NewChangeV2(change models.ChangeEvents) ChangeV2 {
+	return ChangeV2{
+		ID:        change.ID,
+		EventID:   change.EventID,
+		Type:      change.Type,
+		Entity:    change.Entity,
+		EntityID:  change.EntityID,
+		Operation: change.Operation,
+		Before:    rawJSON(change.Before),
+		After:     rawJSON(change.After),
+		CreatedAt: change.CreatedAt,
+	}
+}
+
+func NewChangeListV2(changes []models.ChangeEvents, since int64) ChangeListV2 {
+	list := ChangeListV2{Data: []ChangeV2{}, Next: since}
+	for _, change := range changes {
+		list.Data = append(list.Data, NewChangeV2(change))
+		list.Next = change.ID
+	}
+	list.Count = len(list.Data)
+
+	return list
+}
+
+// rawJSON keeps stored json as is, empty becomes null
+func rawJSON(value string) json.RawMessage {
+	if value == "" {
+		return json.RawMessage("null")
+	}
+
+	return json.RawMessage(value)
+}
@@ -0,0 +1,70 @@
+package dto
+
+import (
+	"movie-rating-api/lists"
+	"movie-rating-api/models"
+	"time"
+)
+
+// The curated lists use the v2 response schema
+
+type ListEntryV2 struct {
+	Rank    int      `json:"rank"`
+	Movie   MovieV2  `json:"movie"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+	Pinned  bool     `json:"pinned"`
+}
+
+type ListOverrideV2 struct {
+	MovieID   int       `json:"movie_id"`
+	Action    string    `json:"action"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListOverrideRequestV2 is the body of PUT /api/admin/lists/{list}/overrides/{id}
+type ListOverrideRequestV2 struct {
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+func NewListEntriesV2(entries []lists.Entry) ListV2 {
+	result := []ListEntryV2{}
+	for i, entry := range entries {
+		reasons := entry.Reasons
+		if reasons == nil {
+			reasons = []string{}
+		}
+
+		result = append(result, ListEntryV2{
+			Rank:    i + 1,
+			Movie:   NewMovieV2(entry.Details),
+			Score:   entry.Score,
+			Reasons: reasons,
+			Pinned:  entry.Pinned,
+		})
+	}
+
+	return ListV2{
+		Data:  result,
+		Count: len(result),
+	}
+}
+
+func NewListOverridesV2(overrides []models.ListOverrides) ListV2 {
+	result := []ListOverrideV2{}
+	for _, override := range overrides {
+		result = append(result, ListOverrideV2{
+			MovieID:   override.MovieID,
+			Action:    override.Action,
+			Reason:    override.Reason,
+			CreatedAt: override.CreatedAt,
+		})
+	}
+
+	return ListV2{
+		Data:  result,
+		Count: len(result),
+	}
+}
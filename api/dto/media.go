@@ -0,0 +1,60 @@
+package dto
+
+import (
+	"movie-rating-api/media"
+	"movie-rating-api/models"
+)
+
+// ImageV2 is an uploaded image, its urls are relative to the api
+type ImageV2 struct {
+	Hash string `json:"hash"`
+	// Kind is poster or still, it is left out of a movie's poster
+	Kind        string        `json:"kind,omitempty"`
+	ContentType string        `json:"content_type"`
+	Width       int           `json:"width"`
+	Height      int           `json:"height"`
+	Size        int64         `json:"size"`
+	URL         string        `json:"url"`
+	Thumbnails  []ThumbnailV2 `json:"thumbnails"`
+}
+
+type ThumbnailV2 struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+func NewImageV2(asset models.MediaAssets, kind string) ImageV2 {
+	image := ImageV2{
+		Hash:        asset.Hash,
+		Kind:        kind,
+		ContentType: asset.ContentType,
+		Width:       asset.Width,
+		Height:      asset.Height,
+		Size:        asset.Size,
+		URL:         media.Path(asset.Hash, media.VariantOriginal),
+		Thumbnails:  []ThumbnailV2{},
+	}
+
+	for _, width := range media.Thumbnails(asset) {
+		image.Thumbnails = append(image.Thumbnails, ThumbnailV2{
+			Width:  width,
+			Height: media.ThumbnailHeight(asset, width),
+			URL:    media.Path(asset.Hash, media.ThumbnailVariant(width)),
+		})
+	}
+
+	return image
+}
+
+func NewImagesV2(images []media.Image) ListV2 {
+	result := []ImageV2{}
+	for _, image := range images {
+		result = append(result, NewImageV2(image.Asset, image.Kind))
+	}
+
+	return ListV2{
+		Data:  result,
+		Count: len(result),
+	}
+}
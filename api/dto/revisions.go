@@ -0,0 +1,109 @@
+package dto
+
+import (
+	"movie-rating-api/app"
+	"time"
+)
+
+type RevisionV2 struct {
+	Revision int    `json:"revision"`
+	MovieID  int    `json:"movie_id"`
+	Author   string `json:"author"`
+	// RestoredFrom is the revision a rollback brought back, null otherwise
+	RestoredFrom *int            `json:"restored_from"`
+	Movie        MovieSnapshotV2 `json:"movie"`
+	Changes      []FieldChangeV2 `json:"changes"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// MovieSnapshotV2 is the movie as a revision left it
+type MovieSnapshotV2 struct {
+	Title    string         `json:"title"`
+	Plot     string         `json:"plot"`
+	Genres   []string       `json:"genres"`
+	Year     string         `json:"year"`
+	Rated    string         `json:"rated"`
+	Director string         `json:"director"`
+	Actors   string         `json:"actors"`
+	Released string         `json:"released"`
+	Ratings  map[string]int `json:"ratings"`
+}
+
+// FieldChangeV2 is a field a revision changed, before is null for an added rating and after for a removed one
+type FieldChangeV2 struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// MoviePatchV2 is the body of PATCH /api/admin/movies/{id}, fields that are left out keep their value
+type MoviePatchV2 struct {
+	Title    *string `json:"title"`
+	Plot     *string `json:"plot"`
+	Genre    *string `json:"genre"`
+	Year     *string `json:"year"`
+	Rated    *string `json:"rated"`
+	Director *string `json:"director"`
+	Actors   *string `json:"actors"`
+	Released *string `json:"released"`
+}
+
+func (p MoviePatchV2) Patch() app.MoviePatch {
+	return app.MoviePatch{
+		Title:    p.Title,
+		Plot:     p.Plot,
+		Genre:    p.Genre,
+		Year:     p.Year,
+		Rated:    p.Rated,
+		Director: p.Director,
+		Actors:   p.Actors,
+		Released: p.Released,
+	}
+}
+
+func NewRevisionV2(revision app.Revision) RevisionV2 {
+	result := RevisionV2{
+		Revision: revision.Revision,
+		MovieID:  revision.MovieID,
+		Author:   revision.Author,
+		Movie: MovieSnapshotV2{
+			Title:    revision.Movie.Title,
+			Plot:     revision.Movie.Plot,
+			Genres:   SplitGenres(revision.Movie.Genre),
+			Year:     revision.Movie.Year,
+			Rated:    revision.Movie.Rated,
+			Director: revision.Movie.Director,
+			Actors:   revision.Movie.Actors,
+			Released: revision.Movie.Released,
+			Ratings:  revision.Movie.Ratings,
+		},
+		Changes:   []FieldChangeV2{},
+		CreatedAt: revision.CreatedAt,
+	}
+	if revision.RestoredFrom != 0 {
+		restoredFrom := revision.RestoredFrom
+		result.RestoredFrom = &restoredFrom
+	}
+
+	for _, change := range revision.Changes {
+		result.Changes = append(result.Changes, FieldChangeV2{
+			Field:  change.Field,
+			Before: change.Before,
+			After:  change.After,
+		})
+	}
+
+	return result
+}
+
+func NewRevisionsV2(revisions []app.Revision) ListV2 {
+	result := []RevisionV2{}
+	for _, revision := range revisions {
+		result = append(result, NewRevisionV2(revision))
+	}
+
+	return ListV2{
+		Data:  result,
+		Count: len(result),
+	}
+}
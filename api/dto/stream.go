@@ -0,0 +1,26 @@
+package dto
+
+import "movie-rating-api/db"
+
+// The types of websocket stream messages
+const (
+	StreamEvent     = "event"
+	StreamHeartbeat = "heartbeat"
+	// StreamReset tells the client events may have been missed, because its last event id could not be resumed
+	// or the server lost track of changes, it should reload what it shows
+	StreamReset = "reset"
+)
+
+// StreamMessageV2 is sent over the websocket stream, the server-sent events stream sends the event alone
+type StreamMessageV2 struct {
+	Type string `json:"type"`
+	// ID is the position of the event in the stream, sent back as last_event_id to resume after it
+	ID    string    `json:"id,omitempty"`
+	Event *db.Event `json:"event,omitempty"`
+}
+
+// StreamRequestV2 is sent by websocket clients to change what they are subscribed to
+type StreamRequestV2 struct {
+	MovieIDs    []int  `json:"movie_ids"`
+	LastEventID string `json:"last_event_id"`
+}
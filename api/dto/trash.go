@@ -0,0 +1,42 @@
+package dto
+
+import (
+	"movie-rating-api/db"
+	"time"
+)
+
+type TrashItemV2 struct {
+	// Entity is movie, movie_ratings or rating
+	Entity   string `json:"entity"`
+	EntityID string `json:"entity_id"`
+	MovieID  int    `json:"movie_id"`
+	Title    string `json:"title"`
+	// Source and Value are left out for movies and movie ratings
+	Source    string    `json:"source,omitempty"`
+	Value     *int      `json:"value,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+func NewTrashV2(items []db.TrashItem) ListV2 {
+	result := []TrashItemV2{}
+	for _, item := range items {
+		trashItem := TrashItemV2{
+			Entity:    item.Entity,
+			EntityID:  item.EntityID,
+			MovieID:   item.MovieID,
+			Title:     item.Title,
+			DeletedAt: item.DeletedAt,
+		}
+		if item.Entity == db.EntityRating {
+			value := item.Value
+			trashItem.Source = item.Source
+			trashItem.Value = &value
+		}
+		result = append(result, trashItem)
+	}
+
+	return ListV2{
+		Data:  result,
+		Count: len(result),
+	}
+}
@@ -0,0 +1,413 @@
+package dto
+
+import (
+	"movie-rating-api/app"
+	"movie-rating-api/models"
+	"strings"
+	"time"
+)
+
+// The v2 response schema. Every key is snake_case, every resource has an id and timestamps,
+// and none of these types are gorm models so the database can change without changing the api.
+
+type MovieV2 struct {
+	ID            int        `json:"id"`
+	Title         string     `json:"title"`
+	Plot          string     `json:"plot"`
+	Genres        []string   `json:"genres"`
+	Year          string     `json:"year"`
+	Rated         string     `json:"rated"`
+	AverageRating int        `json:"average_rating"`
+	Ratings       []RatingV2 `json:"ratings"`
+	// Poster is null when the movie has none
+	Poster    *ImageV2  `json:"poster"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type RatingV2 struct {
+	Source    string    `json:"source"`
+	Value     int       `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ListV2 wraps every v2 list so metadata can be added without breaking clients
+type ListV2 struct {
+	Data  interface{} `json:"data"`
+	Count int         `json:"count"`
+}
+
+type ErrorV2 struct {
+	Error ErrorBodyV2 `json:"error"`
+}
+
+type ErrorBodyV2 struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func NewMovieV2(details app.MovieDetails) MovieV2 {
+	movie := MovieV2{
+		ID:            details.Movie.ID,
+		Title:         details.Movie.Title,
+		Plot:          details.Movie.Plot,
+		Genres:        SplitGenres(details.Movie.Genre),
+		Year:          details.Movie.Year,
+		Rated:         details.Movie.Rated,
+		AverageRating: details.AverageRating,
+		Ratings:       []RatingV2{},
+		CreatedAt:     details.Movie.CreatedAt,
+		UpdatedAt:     details.Movie.UpdatedAt,
+	}
+
+	for _, rating := range details.MovieRatings.Ratings {
+		movie.Ratings = append(movie.Ratings, RatingV2{
+			Source:    rating.Source,
+			Value:     rating.Value,
+			CreatedAt: rating.CreatedAt,
+			UpdatedAt: rating.UpdatedAt,
+		})
+	}
+
+	if details.Poster != nil {
+		poster := NewImageV2(*details.Poster, "")
+		movie.Poster = &poster
+	}
+
+	return movie
+}
+
+func NewMoviesV2(details []app.MovieDetails) ListV2 {
+	movies := []MovieV2{}
+	for _, detail := range details {
+		movies = append(movies, NewMovieV2(detail))
+	}
+
+	return ListV2{
+		Data:  movies,
+		Count: len(movies),
+	}
+}
+
+func NewRatingsV2(ratings []models.Ratings) ListV2 {
+	result := []RatingV2{}
+	for _, rating := range ratings {
+		result = append(result, RatingV2{
+			Source:    rating.Source,
+			Value:     rating.Value,
+			CreatedAt: rating.CreatedAt,
+			UpdatedAt: rating.UpdatedAt,
+		})
+	}
+
+	return ListV2{
+		Data:  result,
+		Count: len(result),
+	}
+}
+
+func NewErrorV2(status int, message string) ErrorV2 {
+	return ErrorV2{
+		Error: ErrorBodyV2{
+			Status:  status,
+			Message: message,
+		},
+	}
+}
+
+// SplitGenres turns the comma separated genre column into a list
+func SplitGenres(genre string) []string {
+	genres := []string{}
+	for _, g := range strings.Split(genre, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			genres = append(genres, g)
+		}
+	}
+
+	return genres
+}
+
+type SimilarMovieV2 struct {
+	Movie       MovieV2  `json:"movie"`
+	Score       float64  `json:"score"`
+	Explanation []string `json:"explanation"`
+}
+
+func NewSimilarMoviesV2(similar []app.SimilarMovie) ListV2 {
+	movies := []SimilarMovieV2{}
+	for _, s := range similar {
+		explanation := s.Explanation
+		if explanation == nil {
+			explanation = []string{}
+		}
+
+		movies = append(movies, SimilarMovieV2{
+			Movie:       NewMovieV2(s.Details),
+			Score:       s.Score,
+			Explanation: explanation,
+		})
+	}
+
+	return ListV2{
+		Data:  movies,
+		Count: len(movies),
+	}
+}
+
+type UserRatingV2 struct {
+	MovieID   int       `json:"movie_id"`
+	Score     int       `json:"score"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UserRatingRequestV2 is the body of PUT /api/v2/me/ratings/{id}
+type UserRatingRequestV2 struct {
+	Score *int `json:"score"`
+}
+
+func NewUserRatingsV2(ratings []models.UserRatings) ListV2 {
+	userRatings := []UserRatingV2{}
+	for _, rating := range ratings {
+		userRatings = append(userRatings, UserRatingV2{
+			MovieID:   rating.MovieID,
+			Score:     rating.Score,
+			CreatedAt: rating.CreatedAt,
+			UpdatedAt: rating.UpdatedAt,
+		})
+	}
+
+	return ListV2{
+		Data:  userRatings,
+		Count: len(userRatings),
+	}
+}
+
+type RecommendationV2 struct {
+	MovieID    int       `json:"movie_id"`
+	Title      string    `json:"title"`
+	Rank       int       `json:"rank"`
+	Score      float64   `json:"score"`
+	Reason     string    `json:"reason"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+func NewRecommendationsV2(recommendations []models.Recommendations) ListV2 {
+	result := []RecommendationV2{}
+	for _, recommendation := range recommendations {
+		result = append(result, RecommendationV2{
+			MovieID:    recommendation.MovieID,
+			Title:      recommendation.Title,
+			Rank:       recommendation.Rank,
+			Score:      recommendation.Score,
+			Reason:     recommendation.Reason,
+			ComputedAt: recommendation.ComputedAt,
+		})
+	}
+
+	return ListV2{
+		Data:  result,
+		Count: len(result),
+	}
+}
+
+type RatingHistoryV2 struct {
+	MovieID int              `json:"movie_id"`
+	Bucket  string           `json:"bucket"`
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Sources []RatingSeriesV2 `json:"sources"`
+	Average []AveragePointV2 `json:"average"`
+}
+
+type RatingSeriesV2 struct {
+	Source string          `json:"source"`
+	Points []RatingPointV2 `json:"points"`
+}
+
+type RatingPointV2 struct {
+	Start        time.Time `json:"start"`
+	Value        int       `json:"value"`
+	Min          int       `json:"min"`
+	Max          int       `json:"max"`
+	Observations int       `json:"observations"`
+}
+
+type AveragePointV2 struct {
+	Start time.Time `json:"start"`
+	Value int       `json:"value"`
+}
+
+// SourceRatingRequestV2 is the body of PUT /api/admin/movies/{id}/ratings
+type SourceRatingRequestV2 struct {
+	Source string `json:"source"`
+	Value  *int   `json:"value"`
+}
+
+func NewRatingHistoryV2(history app.RatingHistory) RatingHistoryV2 {
+	result := RatingHistoryV2{
+		MovieID: history.MovieID,
+		Bucket:  history.Bucket,
+		From:    history.From,
+		To:      history.To,
+		Sources: []RatingSeriesV2{},
+		Average: []AveragePointV2{},
+	}
+
+	for _, series := range history.Sources {
+		points := []RatingPointV2{}
+		for _, point := range series.Points {
+			points = append(points, RatingPointV2{
+				Start:        point.Start,
+				Value:        point.Value,
+				Min:          point.Min,
+				Max:          point.Max,
+				Observations: point.Observations,
+			})
+		}
+		result.Sources = append(result.Sources, RatingSeriesV2{Source: series.Source, Points: points})
+	}
+
+	for _, point := range history.Average {
+		result.Average = append(result.Average, AveragePointV2{Start: point.Start, Value: point.Value})
+	}
+
+	return result
+}
+
+type WatchlistEntryV2 struct {
+	MovieID   int       `json:"movie_id"`
+	Priority  int       `json:"priority"`
+	Notes     string    `json:"notes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WatchlistRequestV2 is the body of PUT /api/v2/me/watchlist/{id}, every field is optional
+type WatchlistRequestV2 struct {
+	Priority int    `json:"priority"`
+	Notes    string `json:"notes"`
+}
+
+func NewWatchlistV2(entries []models.WatchlistEntries) ListV2 {
+	result := []WatchlistEntryV2{}
+	for _, entry := range entries {
+		result = append(result, WatchlistEntryV2{
+			MovieID:   entry.MovieID,
+			Priority:  entry.Priority,
+			Notes:     entry.Notes,
+			CreatedAt: entry.CreatedAt,
+			UpdatedAt: entry.UpdatedAt,
+		})
+	}
+
+	return ListV2{
+		Data:  result,
+		Count: len(result),
+	}
+}
+
+// DateLayout is how dates without a time are written
+const DateLayout = "2006-01-02"
+
+type DiaryEntryV2 struct {
+	ID        int       `json:"id"`
+	MovieID   int       `json:"movie_id"`
+	WatchedOn string    `json:"watched_on"`
+	Rewatch   bool      `json:"rewatch"`
+	Score     *int      `json:"score"`
+	Notes     string    `json:"notes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DiaryRequestV2 is the body of POST /api/v2/me/diary, watched_on defaults to today
+// and rewatch to whether the diary already has the movie
+type DiaryRequestV2 struct {
+	MovieID   int    `json:"movie_id"`
+	WatchedOn string `json:"watched_on"`
+	Rewatch   *bool  `json:"rewatch"`
+	Score     *int   `json:"score"`
+	Notes     string `json:"notes"`
+}
+
+func NewDiaryEntryV2(entry models.DiaryEntries) DiaryEntryV2 {
+	return DiaryEntryV2{
+		ID:        entry.ID,
+		MovieID:   entry.MovieID,
+		WatchedOn: entry.WatchedOn.UTC().Format(DateLayout),
+		Rewatch:   entry.Rewatch,
+		Score:     entry.Score,
+		Notes:     entry.Notes,
+		CreatedAt: entry.CreatedAt,
+	}
+}
+
+func NewDiaryV2(entries []models.DiaryEntries) ListV2 {
+	result := []DiaryEntryV2{}
+	for _, entry := range entries {
+		result = append(result, NewDiaryEntryV2(entry))
+	}
+
+	return ListV2{
+		Data:  result,
+		Count: len(result),
+	}
+}
+
+type DiaryStatsV2 struct {
+	Watched      int            `json:"watched"`
+	Rewatches    int            `json:"rewatches"`
+	Scored       int            `json:"scored"`
+	AverageScore float64        `json:"average_score"`
+	ByMonth      []DiaryMonthV2 `json:"by_month"`
+	ByGenre      []DiaryGenreV2 `json:"by_genre"`
+}
+
+type DiaryMonthV2 struct {
+	Month        string  `json:"month"`
+	Watched      int     `json:"watched"`
+	Rewatches    int     `json:"rewatches"`
+	Scored       int     `json:"scored"`
+	AverageScore float64 `json:"average_score"`
+}
+
+type DiaryGenreV2 struct {
+	Genre        string  `json:"genre"`
+	Watched      int     `json:"watched"`
+	Rewatches    int     `json:"rewatches"`
+	Scored       int     `json:"scored"`
+	AverageScore float64 `json:"average_score"`
+}
+
+func NewDiaryStatsV2(stats app.DiaryStats) DiaryStatsV2 {
+	result := DiaryStatsV2{
+		Watched:      stats.Watched,
+		Rewatches:    stats.Rewatches,
+		Scored:       stats.Scored,
+		AverageScore: stats.AverageScore,
+		ByMonth:      []DiaryMonthV2{},
+		ByGenre:      []DiaryGenreV2{},
+	}
+
+	for _, month := range stats.Months {
+		result.ByMonth = append(result.ByMonth, DiaryMonthV2{
+			Month:        month.Key,
+			Watched:      month.Watched,
+			Rewatches:    month.Rewatches,
+			Scored:       month.Scored,
+			AverageScore: month.AverageScore,
+		})
+	}
+	for _, genre := range stats.Genres {
+		result.ByGenre = append(result.ByGenre, DiaryGenreV2{
+			Genre:        genre.Key,
+			Watched:      genre.Watched,
+			Rewatches:    genre.Rewatches,
+			Scored:       genre.Scored,
+			AverageScore: genre.AverageScore,
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,99 @@
+package dto
+
+import (
+	"encoding/json"
+	"movie-rating-api/db"
+	"movie-rating-api/models"
+	"strings"
+	"time"
+)
+
+// The webhook admin routes use the v2 response schema
+
+type WebhookV2 struct {
+	ID     int      `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret is only returned when the subscription is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookRequestV2 is the body of POST /api/admin/webhooks, a secret is made up when it is empty
+type WebhookRequestV2 struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+type WebhookDeliveryV2 struct {
+	ID       int    `json:"id"`
+	EventID  string `json:"event_id"`
+	Event    string `json:"event"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// NextAttemptAt is only set while the delivery is pending
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	LastStatusCode int             `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+func NewWebhookV2(subscription models.WebhookSubscriptions, withSecret bool) WebhookV2 {
+	webhook := WebhookV2{
+		ID:        subscription.ID,
+		URL:       subscription.URL,
+		Events:    strings.Split(subscription.Events, ","),
+		CreatedAt: subscription.CreatedAt,
+	}
+	if withSecret {
+		webhook.Secret = subscription.Secret
+	}
+
+	return webhook
+}
+
+func NewWebhooksV2(subscriptions []models.WebhookSubscriptions) ListV2 {
+	result := []WebhookV2{}
+	for _, subscription := range subscriptions {
+		result = append(result, NewWebhookV2(subscription, false))
+	}
+
+	return ListV2{
+		Data:  result,
+		Count: len(result),
+	}
+}
+
+func NewWebhookDeliveriesV2(deliveries []models.WebhookDeliveries) ListV2 {
+	result := []WebhookDeliveryV2{}
+	for _, delivery := range deliveries {
+		d := WebhookDeliveryV2{
+			ID:             delivery.ID,
+			EventID:        delivery.EventID,
+			Event:          delivery.Event,
+			Status:         delivery.Status,
+			Attempts:       delivery.Attempts,
+			LastAttemptAt:  delivery.LastAttemptAt,
+			LastStatusCode: delivery.LastStatusCode,
+			LastError:      delivery.LastError,
+			DeliveredAt:    delivery.DeliveredAt,
+			CreatedAt:      delivery.CreatedAt,
+			Payload:        json.RawMessage(delivery.Payload),
+		}
+		if delivery.Status == db.DeliveryPending {
+			next := delivery.NextAttemptAt
+			d.NextAttemptAt = &next
+		}
+
+		result = append(result, d)
+	}
+
+	return ListV2{
+		Data:  result,
+		Count: len(result),
+	}
+}
@@ -0,0 +1,142 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"movie-rating-api/db"
+	"strings"
+)
+
+const (
+	// MaxDepth is the deepest selection set a query may nest
+	MaxDepth = 6
+	// MaxComplexity is the highest score a query may have, see complexity
+	MaxComplexity = 1000
+	// listMultiplier is the assumed number of items a list field returns
+	listMultiplier = 10
+)
+
+// listFields are the fields that return lists, their selections are counted listMultiplier times
+var listFields = map[string]bool{
+	"movies":  true,
+	"ratings": true,
+	"sources": true,
+	"genres":  true,
+}
+
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Execute runs the request against the schema, loading data through the client
+func Execute(ctx context.Context, client db.Client, request Request) *graphql.Result {
+	doc, err := parser.Parse(parser.ParseParams{Source: request.Query})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	if err = checkComplexity(doc); err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	return graphql.Do(graphql.Params{
+		Schema:         Schema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        withLoader(ctx, newLoader(client)),
+	})
+}
+
+// checkComplexity rejects queries that nest deeper than MaxDepth or score higher than MaxComplexity.
+// Every field scores 1 plus the score of its selections, multiplied by listMultiplier for list fields.
+// Introspection fields are not counted so GraphiQL can always load the schema. Fragments that spread
+// themselves are rejected here too.
+func checkComplexity(doc *ast.Document) error {
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	for _, definition := range doc.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		score, err := complexity(operation.SelectionSet, fragments, 1, map[string]bool{})
+		if err != nil {
+			return err
+		}
+
+		if score > MaxComplexity {
+			return fmt.Errorf("query complexity %d exceeds the maximum of %d", score, MaxComplexity)
+		}
+	}
+
+	return nil
+}
+
+func complexity(set *ast.SelectionSet, fragments map[string]*ast.FragmentDefinition, depth int, visiting map[string]bool) (int, error) {
+	if set == nil {
+		return 0, nil
+	}
+
+	if depth > MaxDepth {
+		return 0, fmt.Errorf("query depth exceeds the maximum of %d", MaxDepth)
+	}
+
+	var total int
+	for _, selection := range set.Selections {
+		switch s := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name.Value, "__") {
+				continue
+			}
+
+			children, err := complexity(s.SelectionSet, fragments, depth+1, visiting)
+			if err != nil {
+				return 0, err
+			}
+
+			if listFields[s.Name.Value] {
+				children *= listMultiplier
+			}
+			total += 1 + children
+		case *ast.InlineFragment:
+			children, err := complexity(s.SelectionSet, fragments, depth, visiting)
+			if err != nil {
+				return 0, err
+			}
+			total += children
+		case *ast.FragmentSpread:
+			fragment, ok := fragments[s.Name.Value]
+			if !ok {
+				// unknown fragments are reported by validation
+				continue
+			}
+			if visiting[s.Name.Value] {
+				// graphql-go's validation recurses through cycles until the stack overflows, so they never reach it
+				return 0, fmt.Errorf("fragment %s spreads itself", s.Name.Value)
+			}
+
+			visiting[s.Name.Value] = true
+			children, err := complexity(fragment.SelectionSet, fragments, depth, visiting)
+			delete(visiting, s.Name.Value)
+			if err != nil {
+				return 0, err
+			}
+			total += children
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,76 @@
+package graph
+
+import (
+	"context"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"strings"
+	"testing"
+)
+
+func TestExecuteLimitsQueries(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+
+	for _, test := range []struct {
+		name  string
+		query string
+		// err is part of the error the query fails with, empty when it succeeds
+		err string
+	}{
+		{"simple", `{ movies { title } }`, ""},
+		{"as deep as allowed", `{ movie(id: 1) { ratings { movie { ratings { movie { title } } } } } }`, ""},
+		{"too deep", `{ movie(id: 1) { ratings { movie { ratings { movie { ratings { source } } } } } } }`, "depth exceeds"},
+		{
+			name:  "too deep through a fragment",
+			query: `{ movie(id: 1) { ...deep } } fragment deep on Movie { ratings { movie { ratings { movie { ratings { source } } } } } }`,
+			err:   "depth exceeds",
+		},
+		// every list multiplies what it selects by ten, 2211 in all
+		{"too complex", `{ movies { ratings { movie { ratings { source value } } } } }`, "complexity 2211 exceeds"},
+		{"cyclic fragments", `{ movie(id: 1) { ...a } } fragment a on Movie { ...b } fragment b on Movie { ...a }`, "fragment a spreads itself"},
+		// introspection is never limited, GraphiQL loads the schema with a deep query
+		{
+			name:  "introspection",
+			query: `{ __schema { types { name fields { name type { name ofType { name ofType { name ofType { name } } } } } } } }`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			result := Execute(context.Background(), client, Request{Query: test.query})
+			if test.err == "" {
+				if len(result.Errors) != 0 {
+					t.Fatalf("expected the query to succeed, got %v", result.Errors)
+				}
+				return
+			}
+			if len(result.Errors) == 0 || !strings.Contains(result.Errors[0].Message, test.err) {
+				t.Fatalf("expected an error with %q, got %v", test.err, result.Errors)
+			}
+			if result.Data != nil {
+				t.Fatalf("expected nothing to be resolved, got %v", result.Data)
+			}
+		})
+	}
+}
+
+func TestExecuteLoadsEachTableOncePerRequest(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	movies := db.FakeCallCount(client, db.MethodGetMovies)
+	ratings := db.FakeCallCount(client, db.MethodGetMovieRatings)
+
+	// every movie's ratings and every rating's movie, which would be a call per item without the loader
+	query := `{ movies { title ratings { source movie { title } } } sources { name } aggregates { movieCount averageRating } }`
+	for request := 1; request <= 2; request++ {
+		result := Execute(context.Background(), client, Request{Query: query})
+		if len(result.Errors) != 0 {
+			t.Fatalf("failed to execute query: %v", result.Errors)
+		}
+
+		// each request has a loader of its own, so it sees what changed since the last one
+		if calls := db.FakeCallCount(client, db.MethodGetMovies) - movies; calls != request {
+			t.Fatalf("expected the movies to be loaded once per request, got %d calls in %d requests", calls, request)
+		}
+		if calls := db.FakeCallCount(client, db.MethodGetMovieRatings) - ratings; calls != request {
+			t.Fatalf("expected the ratings to be loaded once per request, got %d calls in %d requests", calls, request)
+		}
+	}
+}
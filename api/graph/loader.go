@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"context"
+	"movie-rating-api/db"
+	"movie-rating-api/models"
+	"sync"
+)
+
+type loaderKey struct{}
+
+// loader batches the db calls made while resolving a single request. Each db.Client call
+// returns every row, so no matter how many movie or rating fields a query selects
+// the movies and ratings are each fetched at most once per request.
+type loader struct {
+	client db.Client
+
+	moviesOnce sync.Once
+	movies     []models.Movies
+	moviesErr  error
+
+	ratingsOnce sync.Once
+	ratings     map[string][]models.Ratings
+	ratingsErr  error
+}
+
+func newLoader(client db.Client) *loader {
+	return &loader{
+		client: client,
+	}
+}
+
+func withLoader(ctx context.Context, l *loader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, l)
+}
+
+func loaderFrom(ctx context.Context) *loader {
+	return ctx.Value(loaderKey{}).(*loader)
+}
+
+func (l *loader) Movies() ([]models.Movies, error) {
+	l.moviesOnce.Do(func() {
+		l.movies, l.moviesErr = l.client.GetMovies()
+	})
+
+	return l.movies, l.moviesErr
+}
+
+// RatingsByTitle returns the ratings of every movie keyed by movie title
+func (l *loader) RatingsByTitle() (map[string][]models.Ratings, error) {
+	l.ratingsOnce.Do(func() {
+		movieRatings, err := l.client.GetMovieRatings()
+		if err != nil {
+			l.ratingsErr = err
+			return
+		}
+
+		l.ratings = map[string][]models.Ratings{}
+		for _, movieRating := range movieRatings {
+			l.ratings[movieRating.Title] = append(l.ratings[movieRating.Title], movieRating.Ratings...)
+		}
+	})
+
+	return l.ratings, l.ratingsErr
+}
+
+func (l *loader) MovieByTitle(title string) (*models.Movies, error) {
+	movies, err := l.Movies()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range movies {
+		if movies[i].Title == title {
+			return &movies[i], nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,414 @@
+package graph
+
+import (
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"movie-rating-api/app"
+	"movie-rating-api/models"
+	"sort"
+	"strings"
+)
+
+// rating is a models.Ratings that remembers which movie it belongs to
+type rating struct {
+	Title  string
+	Source string
+	Value  int
+}
+
+type source struct {
+	Name string
+}
+
+type aggregates struct{}
+
+var ratingType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Rating",
+	Description: "A score out of 100 given to a movie by a review source",
+	Fields: graphql.Fields{
+		"source": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"value":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+	},
+})
+
+var movieType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Movie",
+	Fields: graphql.Fields{
+		"id":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: movieField(func(m models.Movies) interface{} { return m.ID })},
+		"title": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: movieField(func(m models.Movies) interface{} { return m.Title })},
+		"plot":  &graphql.Field{Type: graphql.String, Resolve: movieField(func(m models.Movies) interface{} { return m.Plot })},
+		"genre": &graphql.Field{Type: graphql.String, Resolve: movieField(func(m models.Movies) interface{} { return m.Genre })},
+		"genres": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+			Resolve: movieField(func(m models.Movies) interface{} { return splitGenres(m.Genre) }),
+		},
+		"year":  &graphql.Field{Type: graphql.String, Resolve: movieField(func(m models.Movies) interface{} { return m.Year })},
+		"rated": &graphql.Field{Type: graphql.String, Resolve: movieField(func(m models.Movies) interface{} { return m.Rated })},
+		"ratings": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(ratingType))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return movieRatings(p)
+			},
+		},
+		"rating": &graphql.Field{
+			Type: ratingType,
+			Args: graphql.FieldConfigArgument{
+				"source": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				ratings, err := movieRatings(p)
+				if err != nil {
+					return nil, err
+				}
+
+				for _, r := range ratings {
+					if r.Source == p.Args["source"].(string) {
+						return r, nil
+					}
+				}
+
+				return nil, nil
+			},
+		},
+		"averageRating": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Int),
+			Description: "integer average of all rating values",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				ratings, err := loaderFrom(p.Context).RatingsByTitle()
+				if err != nil {
+					return nil, err
+				}
+
+				return app.AverageRating(ratings[p.Source.(models.Movies).Title]), nil
+			},
+		},
+	},
+})
+
+var sourceType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Source",
+	Description: "A review site that rates movies",
+	Fields: graphql.Fields{
+		"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"ratings": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(ratingType))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return sourceRatings(p)
+			},
+		},
+		"ratingCount": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Int),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				ratings, err := sourceRatings(p)
+				if err != nil {
+					return nil, err
+				}
+
+				return len(ratings), nil
+			},
+		},
+		"averageValue": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Int),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				ratings, err := sourceRatings(p)
+				if err != nil {
+					return nil, err
+				}
+
+				return averageValue(ratings), nil
+			},
+		},
+	},
+})
+
+var aggregatesType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Aggregates",
+	Description: "Statistics over the whole catalogue",
+	Fields: graphql.Fields{
+		"movieCount": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Int),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				movies, err := loaderFrom(p.Context).Movies()
+				if err != nil {
+					return nil, err
+				}
+
+				return len(movies), nil
+			},
+		},
+		"ratingCount": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Int),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				ratings, err := allRatings(p)
+				if err != nil {
+					return nil, err
+				}
+
+				return len(ratings), nil
+			},
+		},
+		"averageRating": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Int),
+			Description: "integer average of every rating value",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				ratings, err := allRatings(p)
+				if err != nil {
+					return nil, err
+				}
+
+				return averageValue(ratings), nil
+			},
+		},
+		"highestRated": &graphql.Field{
+			Type: movieType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return rankedMovie(p, func(avg int, best int) bool { return avg > best })
+			},
+		},
+		"lowestRated": &graphql.Field{
+			Type: movieType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return rankedMovie(p, func(avg int, best int) bool { return avg < best })
+			},
+		},
+	},
+})
+
+var queryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Query",
+	Fields: graphql.Fields{
+		"movies": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(movieType))),
+			Args: graphql.FieldConfigArgument{
+				"genre": &graphql.ArgumentConfig{Type: graphql.String, Description: "only return movies with this genre"},
+				"first": &graphql.ArgumentConfig{Type: graphql.Int, Description: "maximum number of movies to return"},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				movies, err := loaderFrom(p.Context).Movies()
+				if err != nil {
+					return nil, err
+				}
+
+				genre, _ := p.Args["genre"].(string)
+
+				var result []models.Movies
+				for _, movie := range movies {
+					if genre != "" && !hasGenre(movie, genre) {
+						continue
+					}
+					result = append(result, movie)
+				}
+
+				if first, ok := p.Args["first"].(int); ok && first >= 0 && first < len(result) {
+					result = result[:first]
+				}
+
+				return result, nil
+			},
+		},
+		"movie": &graphql.Field{
+			Type: movieType,
+			Args: graphql.FieldConfigArgument{
+				"id":    &graphql.ArgumentConfig{Type: graphql.Int},
+				"title": &graphql.ArgumentConfig{Type: graphql.String},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, hasID := p.Args["id"].(int)
+				title, hasTitle := p.Args["title"].(string)
+				if !hasID && !hasTitle {
+					return nil, fmt.Errorf("movie requires an id or a title")
+				}
+
+				movies, err := loaderFrom(p.Context).Movies()
+				if err != nil {
+					return nil, err
+				}
+
+				for _, movie := range movies {
+					if (hasID && movie.ID == id) || (hasTitle && movie.Title == title) {
+						return movie, nil
+					}
+				}
+
+				return nil, nil
+			},
+		},
+		"sources": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(sourceType))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				ratings, err := allRatings(p)
+				if err != nil {
+					return nil, err
+				}
+
+				seen := map[string]bool{}
+				var sources []source
+				for _, r := range ratings {
+					if !seen[r.Source] {
+						seen[r.Source] = true
+						sources = append(sources, source{Name: r.Source})
+					}
+				}
+				sort.Slice(sources, func(i, j int) bool { return sources[i].Name < sources[j].Name })
+
+				return sources, nil
+			},
+		},
+		"aggregates": &graphql.Field{
+			Type: graphql.NewNonNull(aggregatesType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return aggregates{}, nil
+			},
+		},
+	},
+})
+
+var Schema graphql.Schema
+
+func init() {
+	// added here since movieType and ratingType refer to each other
+	ratingType.AddFieldConfig("movie", &graphql.Field{
+		Type: movieType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			movie, err := loaderFrom(p.Context).MovieByTitle(p.Source.(rating).Title)
+			if err != nil || movie == nil {
+				return nil, err
+			}
+
+			return *movie, nil
+		},
+	})
+
+	var err error
+	Schema, err = graphql.NewSchema(graphql.SchemaConfig{
+		Query: queryType,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("invalid graphql schema: %s", err.Error()))
+	}
+}
+
+func movieField(field func(m models.Movies) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return field(p.Source.(models.Movies)), nil
+	}
+}
+
+func movieRatings(p graphql.ResolveParams) ([]rating, error) {
+	ratingsByTitle, err := loaderFrom(p.Context).RatingsByTitle()
+	if err != nil {
+		return nil, err
+	}
+
+	title := p.Source.(models.Movies).Title
+
+	var result []rating
+	for _, r := range ratingsByTitle[title] {
+		result = append(result, rating{Title: title, Source: r.Source, Value: r.Value})
+	}
+
+	return result, nil
+}
+
+func allRatings(p graphql.ResolveParams) ([]rating, error) {
+	ratingsByTitle, err := loaderFrom(p.Context).RatingsByTitle()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []rating
+	for title, ratings := range ratingsByTitle {
+		for _, r := range ratings {
+			result = append(result, rating{Title: title, Source: r.Source, Value: r.Value})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Title < result[j].Title })
+
+	return result, nil
+}
+
+func sourceRatings(p graphql.ResolveParams) ([]rating, error) {
+	ratings, err := allRatings(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []rating
+	for _, r := range ratings {
+		if r.Source == p.Source.(source).Name {
+			result = append(result, r)
+		}
+	}
+
+	return result, nil
+}
+
+// rankedMovie returns the movie whose average rating wins the comparison against every other movie
+func rankedMovie(p graphql.ResolveParams, better func(avg int, best int) bool) (interface{}, error) {
+	l := loaderFrom(p.Context)
+
+	movies, err := l.Movies()
+	if err != nil {
+		return nil, err
+	}
+
+	ratingsByTitle, err := l.RatingsByTitle()
+	if err != nil {
+		return nil, err
+	}
+
+	var best *models.Movies
+	var bestAvg int
+	for i, movie := range movies {
+		ratings, ok := ratingsByTitle[movie.Title]
+		if !ok {
+			continue
+		}
+
+		avg := app.AverageRating(ratings)
+		if best == nil || better(avg, bestAvg) {
+			best = &movies[i]
+			bestAvg = avg
+		}
+	}
+
+	if best == nil {
+		return nil, nil
+	}
+
+	return *best, nil
+}
+
+func averageValue(ratings []rating) int {
+	var total int
+	for _, r := range ratings {
+		total += r.Value
+	}
+
+	if len(ratings) == 0 {
+		return 0
+	}
+
+	return total / len(ratings)
+}
+
+func splitGenres(genre string) []string {
+	var genres []string
+	for _, g := range strings.Split(genre, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			genres = append(genres, g)
+		}
+	}
+
+	return genres
+}
+
+func hasGenre(movie models.Movies, genre string) bool {
+	for _, g := range splitGenres(movie.Genre) {
+		if strings.EqualFold(g, genre) {
+			return true
+		}
+	}
+
+	return false
+}
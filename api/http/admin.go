@@ -0,0 +1,31 @@
+package http
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// AdminTokenHeader carries the admin token on /api/admin routes
+const AdminTokenHeader = "X-Admin-Token"
+
+// AdminOnly lets through the requests carrying the token, every request is refused when the token is empty
+func AdminOnly(token string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				writeErrorV2(w, http.StatusForbidden, "admin routes are disabled, set ADMIN_TOKEN to enable them")
+				return
+			}
+
+			given := r.Header.Get(AdminTokenHeader)
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				writeErrorV2(w, http.StatusUnauthorized, fmt.Sprintf("a valid %s header is required", AdminTokenHeader))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
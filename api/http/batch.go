@@ -0,0 +1,172 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"movie-rating-api/app"
+	"movie-rating-api/batch"
+	"movie-rating-api/db"
+	"movie-rating-api/dto"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PostMoviesBatchCreate creates movies with their ratings, in the mode of the mode query param
+func (h *Handlers) PostMoviesBatchCreate(w http.ResponseWriter, r *http.Request) {
+	var body dto.BatchCreateRequestV2
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "body must be a json object with a list of movies")
+		return
+	}
+	movies, ok := body.Batch()
+	if !ok {
+		writeErrorV2(w, http.StatusBadRequest, "every rating needs an integer value")
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	results, err := h.batch.CreateMovies(movies, mode)
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+
+	items := make([]dto.BatchItemV2, len(results))
+	created := 0
+	for i, result := range results {
+		items[i] = dto.NewMovieBatchItemV2(i, itemStatus(result.Err, http.StatusCreated), result)
+		if result.Err == nil {
+			created++
+		}
+	}
+	log.Printf("%s created %d of a batch of %d movies\n", adminAuthor(r), created, len(movies))
+
+	writeBatch(w, mode, items)
+}
+
+// PostRatingsBatchUpsert sets the ratings review sources gave movies, in the mode of the mode query param
+func (h *Handlers) PostRatingsBatchUpsert(w http.ResponseWriter, r *http.Request) {
+	var body dto.BatchUpsertRequestV2
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "body must be a json object with a list of ratings")
+		return
+	}
+	ratings, ok := body.Batch()
+	if !ok {
+		writeErrorV2(w, http.StatusBadRequest, "every rating needs an integer value")
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	author := adminAuthor(r)
+	results, err := h.batch.UpsertRatings(ratings, mode, author)
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+
+	items := make([]dto.BatchItemV2, len(results))
+	set := 0
+	for i, result := range results {
+		items[i] = dto.NewRatingBatchItemV2(i, itemStatus(result.Err, http.StatusOK), result)
+		if result.Err == nil {
+			set++
+		}
+	}
+	log.Printf("%s set %d of a batch of %d ratings\n", author, set, len(ratings))
+
+	writeBatch(w, mode, items)
+}
+
+// GetMoviesBatchGet gets the movies of the ids query param, given comma separated or repeated
+func (h *Handlers) GetMoviesBatchGet(w http.ResponseWriter, r *http.Request) {
+	ids := []int{}
+	for _, param := range r.URL.Query()["ids"] {
+		for _, value := range strings.Split(param, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				writeErrorV2(w, http.StatusBadRequest, fmt.Sprintf("ids must be integers, got %q", value))
+				return
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	mode := r.URL.Query().Get("mode")
+	results, err := h.batch.GetMovies(ids, mode)
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+
+	items := make([]dto.BatchItemV2, len(results))
+	for i, result := range results {
+		items[i] = dto.NewMovieBatchItemV2(i, itemStatus(result.Err, http.StatusOK), result)
+	}
+
+	writeBatch(w, mode, items)
+}
+
+// itemStatus is the status an item would have got as a request of its own
+func itemStatus(err error, success int) int {
+	switch {
+	case err == nil:
+		return success
+	case errors.Is(err, batch.ErrAborted):
+		return http.StatusFailedDependency
+	case errors.Is(err, batch.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, app.ErrEmptyTitle), errors.Is(err, app.ErrInvalidRating),
+		errors.Is(err, batch.ErrEmptySource), errors.Is(err, batch.ErrDuplicateSource):
+		return http.StatusBadRequest
+	case errors.Is(err, app.ErrDuplicateTitle):
+		return http.StatusConflict
+	case errors.Is(err, db.ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeBatch writes 200 when every item succeeded, 207 when only some did in per item mode,
+// and the status of the item that failed when an atomic batch did not go through
+func writeBatch(w http.ResponseWriter, mode string, items []dto.BatchItemV2) {
+	if mode == "" {
+		mode = batch.ModeAtomic
+	}
+	result := dto.NewBatchV2(mode, items)
+
+	status := http.StatusOK
+	if result.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	if result.Failed > 0 && mode == batch.ModeAtomic {
+		for _, item := range items {
+			if item.Status >= 400 && item.Status != http.StatusFailedDependency {
+				status = item.Status
+				break
+			}
+		}
+	}
+
+	err := writeJSONResponse(w, result, status)
+	if err != nil {
+		fmt.Println("failed to write batch body:", err.Error())
+	}
+}
+
+func writeBatchError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, batch.ErrTooLarge):
+		writeErrorV2(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, batch.ErrUnknownMode), errors.Is(err, batch.ErrEmpty):
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+	default:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to run batch: %s", err.Error()))
+	}
+}
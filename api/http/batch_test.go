@@ -0,0 +1,160 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"movie-rating-api/app"
+	"movie-rating-api/batch"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"movie-rating-api/dto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newBatchRouter(t *testing.T) *mux.Router {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	config := batch.DefaultConfig()
+	config.MaxSize = 3
+	processor := batch.NewProcessor(client, app.New(client), config)
+
+	r := mux.NewRouter()
+	ConfigureRouter(r, NewHandlers(app.New(client), client, nil, nil, processor, nil, "token", DefaultConfig()))
+	return r
+}
+
+func TestBatchRoutes(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		token  string
+		status int
+		// items are the statuses of the items, nil when the batch did not run
+		items []int
+	}{
+		{
+			name: "create without the admin token", method: http.MethodPost, url: "/api/movies:batchCreate",
+			body: `{"movies": [{"title": "Brazil"}]}`, status: http.StatusUnauthorized,
+		},
+		{
+			name: "create", method: http.MethodPost, url: "/api/movies:batchCreate", token: "token",
+			body:   `{"movies": [{"title": "Brazil", "ratings": [{"source": "Metacritic", "value": 84}]}, {"title": "Alien"}]}`,
+			status: http.StatusOK, items: []int{http.StatusCreated, http.StatusCreated},
+		},
+		{
+			name: "atomic create with a taken title", method: http.MethodPost, url: "/api/movies:batchCreate", token: "token",
+			body:   `{"movies": [{"title": "Brazil"}, {"title": "Life of Brian"}]}`,
+			status: http.StatusConflict, items: []int{http.StatusFailedDependency, http.StatusConflict},
+		},
+		{
+			name: "per item create", method: http.MethodPost, url: "/api/movies:batchCreate?mode=per_item", token: "token",
+			body:   `{"movies": [{"title": "Brazil"}, {"title": ""}, {"title": "Life of Brian"}]}`,
+			status: http.StatusMultiStatus, items: []int{http.StatusCreated, http.StatusBadRequest, http.StatusConflict},
+		},
+		{
+			name: "too large a create", method: http.MethodPost, url: "/api/movies:batchCreate", token: "token",
+			body:   `{"movies": [{"title": "A"}, {"title": "B"}, {"title": "C"}, {"title": "D"}]}`,
+			status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "empty create", method: http.MethodPost, url: "/api/movies:batchCreate", token: "token",
+			body: `{"movies": []}`, status: http.StatusBadRequest,
+		},
+		{
+			name: "create in an unknown mode", method: http.MethodPost, url: "/api/movies:batchCreate?mode=some", token: "token",
+			body: `{"movies": [{"title": "Brazil"}]}`, status: http.StatusBadRequest,
+		},
+		{
+			name: "create with a rating without a value", method: http.MethodPost, url: "/api/movies:batchCreate", token: "token",
+			body: `{"movies": [{"title": "Brazil", "ratings": [{"source": "Metacritic"}]}]}`, status: http.StatusBadRequest,
+		},
+		{
+			name: "create with a body that is not json", method: http.MethodPost, url: "/api/movies:batchCreate", token: "token",
+			body: `movies`, status: http.StatusBadRequest,
+		},
+		{
+			name: "upsert", method: http.MethodPost, url: "/api/ratings:batchUpsert", token: "token",
+			body:   `{"ratings": [{"movie_id": 1, "source": "Batch", "value": 10}, {"movie_id": 2, "source": "Batch", "value": 20}]}`,
+			status: http.StatusOK, items: []int{http.StatusOK, http.StatusOK},
+		},
+		{
+			name: "per item upsert", method: http.MethodPost, url: "/api/ratings:batchUpsert?mode=per_item", token: "token",
+			body: `{"ratings": [
+				{"movie_id": 1, "source": "Batch", "value": 10},
+				{"movie_id": 999, "source": "Batch", "value": 10},
+				{"movie_id": 2, "source": "Batch", "value": 10, "version": 999}
+			]}`,
+			status: http.StatusMultiStatus, items: []int{http.StatusOK, http.StatusNotFound, http.StatusPreconditionFailed},
+		},
+		{
+			name: "atomic upsert with a stale version", method: http.MethodPost, url: "/api/ratings:batchUpsert", token: "token",
+			body:   `{"ratings": [{"movie_id": 1, "source": "Batch", "value": 10}, {"movie_id": 2, "source": "Batch", "value": 10, "version": 999}]}`,
+			status: http.StatusPreconditionFailed, items: []int{http.StatusFailedDependency, http.StatusPreconditionFailed},
+		},
+		{
+			name: "get", method: http.MethodGet, url: "/api/movies:batchGet?ids=1,2&ids=3",
+			status: http.StatusOK, items: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+		{
+			name: "atomic get with an unknown id", method: http.MethodGet, url: "/api/movies:batchGet?ids=1,999",
+			status: http.StatusNotFound, items: []int{http.StatusFailedDependency, http.StatusNotFound},
+		},
+		{
+			name: "per item get with an unknown id", method: http.MethodGet, url: "/api/movies:batchGet?ids=1,999&mode=per_item",
+			status: http.StatusMultiStatus, items: []int{http.StatusOK, http.StatusNotFound},
+		},
+		{
+			name: "get with an id that is not a number", method: http.MethodGet, url: "/api/movies:batchGet?ids=1,one",
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "too large a get", method: http.MethodGet, url: "/api/movies:batchGet?ids=1,2,3,4",
+			status: http.StatusRequestEntityTooLarge,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := newBatchRouter(t)
+			req := httptest.NewRequest(test.method, test.url, strings.NewReader(test.body))
+			if test.token != "" {
+				req.Header.Set(AdminTokenHeader, test.token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != test.status {
+				t.Fatalf("expected %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+			if test.items == nil {
+				return
+			}
+
+			var body dto.BatchV2
+			err := json.Unmarshal(w.Body.Bytes(), &body)
+			if err != nil {
+				t.Fatalf("failed to decode body: %s", err.Error())
+			}
+			if len(body.Data) != len(test.items) || body.Count != len(test.items) {
+				t.Fatalf("expected %d items, got %s", len(test.items), w.Body.String())
+			}
+			failed := 0
+			for i, item := range body.Data {
+				if item.Index != i || item.Status != test.items[i] {
+					t.Errorf("expected item %d to have status %d, got %+v", i, test.items[i], item)
+				}
+				if item.Status >= 400 {
+					failed++
+					if item.Error == "" || item.Movie != nil {
+						t.Errorf("expected failed item %d to carry its error alone, got %+v", i, item)
+					}
+				}
+			}
+			if body.Failed != failed {
+				t.Fatalf("expected %d failed items, got %d", failed, body.Failed)
+			}
+		})
+	}
+}
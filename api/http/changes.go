@@ -0,0 +1,48 @@
+package http
+
+import (
+	"fmt"
+	"movie-rating-api/dto"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultChanges = 100
+	maxChanges     = 1000
+)
+
+// GetChanges returns the change log after the since param, consumers pass the next field back as since to catch up
+func (h *Handlers) GetChanges(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var since int64
+	var err error
+	if query.Get("since") != "" {
+		since, err = strconv.ParseInt(query.Get("since"), 10, 64)
+		if err != nil || since < 0 {
+			writeErrorV2(w, http.StatusBadRequest, "since must be a change id")
+			return
+		}
+	}
+
+	limit := defaultChanges
+	if query.Get("limit") != "" {
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit < 1 || limit > maxChanges {
+			writeErrorV2(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxChanges))
+			return
+		}
+	}
+
+	changes, err := h.client.GetChanges(since, limit)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get changes: %s", err.Error()))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewChangeListV2(changes, since), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write changes body:", err.Error())
+	}
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/dto"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The entity tags of what admins edit, a movie's fields and its ratings change independently
+const (
+	movieTag   = "movie"
+	ratingsTag = "ratings"
+)
+
+func entityTag(kind string, version int) string {
+	return fmt.Sprintf(`"%s-%d"`, kind, version)
+}
+
+// ifMatch reads the version of kind the If-Match header asks for and writes the error response when it can not hold.
+// The header is required so no write overwrites another by accident, * asks for db.AnyVersion.
+func ifMatch(w http.ResponseWriter, r *http.Request, kind string) (int, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		writeErrorV2(w, http.StatusPreconditionRequired, "If-Match is required, send the ETag of a GET or * to write whatever the version")
+		return 0, false
+	}
+	if header == "*" {
+		return db.AnyVersion, true
+	}
+	if strings.Contains(header, ",") {
+		writeErrorV2(w, http.StatusBadRequest, "If-Match takes a single entity tag or *")
+		return 0, false
+	}
+
+	// weak tags never match, If-Match compares strongly
+	version, err := strconv.Atoi(strings.TrimPrefix(strings.Trim(header, `"`), kind+"-"))
+	if err != nil || version <= 0 || header != entityTag(kind, version) {
+		writePreconditionFailed(w)
+		return 0, false
+	}
+
+	return version, true
+}
+
+func writePreconditionFailed(w http.ResponseWriter) {
+	writeErrorV2(w, http.StatusPreconditionFailed, "If-Match does not match the current ETag, get it again and retry")
+}
+
+// tagged runs write and reads the version of kind the movie is at after it in one unit of work, so the ETag sent back
+// is the one the write left even when another write follows straight away. The ETag is empty when the write
+// moved what it tags to the trash, ok is false when write was.
+func (h *Handlers) tagged(movieID int, kind string, write func(tx db.Client) (bool, error)) (etag string, ok bool, err error) {
+	err = h.client.WithTx(func(tx db.Client) error {
+		ok, err = write(tx)
+		if err != nil || !ok {
+			return err
+		}
+
+		if kind == movieTag {
+			movie, found, err := tx.GetMovie(movieID)
+			if found {
+				etag = entityTag(movieTag, movie.Version)
+			}
+			return err
+		}
+		movieRatings, found, err := tx.GetMovieRatingsOf(movieID)
+		if found {
+			etag = entityTag(ratingsTag, movieRatings.Version)
+		}
+		return err
+	})
+
+	return etag, ok, err
+}
+
+func setETag(w http.ResponseWriter, etag string) {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+}
+
+// GetAdminMovie returns a movie with the ETag to send as If-Match when editing or deleting it
+func (h *Handlers) GetAdminMovie(w http.ResponseWriter, r *http.Request) {
+	detail, ok := h.adminMovie(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("ETag", entityTag(movieTag, detail.Movie.Version))
+	err := writeJSONResponse(w, dto.NewMovieV2(detail), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write movie body:", err.Error())
+	}
+}
+
+// GetAdminMovieRatings returns the sources' ratings of a movie with the ETag to send as If-Match when changing them
+func (h *Handlers) GetAdminMovieRatings(w http.ResponseWriter, r *http.Request) {
+	detail, ok := h.adminMovie(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("ETag", entityTag(ratingsTag, detail.MovieRatings.Version))
+	err := writeJSONResponse(w, dto.NewRatingsV2(detail.MovieRatings.Ratings), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write ratings body:", err.Error())
+	}
+}
+
+func (h *Handlers) adminMovie(w http.ResponseWriter, r *http.Request) (app.MovieDetails, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return app.MovieDetails{}, false
+	}
+
+	detail, ok, err := h.app.GetMovieDetail(id)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get movies: %s", err.Error()))
+		return app.MovieDetails{}, false
+	}
+	if !ok {
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("movie %d not found", id))
+		return app.MovieDetails{}, false
+	}
+
+	return detail, true
+}
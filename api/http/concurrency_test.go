@@ -0,0 +1,107 @@
+package http
+
+import (
+	"github.com/gorilla/mux"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func adminRequest(t *testing.T, r http.Handler, method string, path string, ifMatch string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-Admin-Token", "token")
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminWritesNeedACurrentIfMatch(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	r := mux.NewRouter()
+	ConfigureRouter(r, NewHandlers(app.New(client), client, nil, nil, nil, nil, "token", DefaultConfig()))
+
+	for _, test := range []struct {
+		method string
+		path   string
+		body   string
+		get    string
+	}{
+		{method: http.MethodPatch, path: "/api/admin/movies/1", body: `{"plot": "changed"}`, get: "/api/admin/movies/1"},
+		{method: http.MethodPut, path: "/api/admin/movies/1/ratings", body: `{"source": "Metacritic", "value": 50}`, get: "/api/admin/movies/1/ratings"},
+	} {
+		if w := adminRequest(t, r, test.method, test.path, "", test.body); w.Code != http.StatusPreconditionRequired {
+			t.Fatalf("expected 428 for %s %s without If-Match, got %d", test.method, test.path, w.Code)
+		}
+
+		etag := adminRequest(t, r, http.MethodGet, test.get, "", "").Header().Get("ETag")
+		w := adminRequest(t, r, test.method, test.path, etag, test.body)
+		if w.Code != http.StatusOK && w.Code != http.StatusNoContent {
+			t.Fatalf("expected %s %s with the current ETag to succeed, got %d: %s", test.method, test.path, w.Code, w.Body.String())
+		}
+
+		// the write sends back the ETag it left, which the next write can use without getting it again
+		next := w.Header().Get("ETag")
+		if next == "" || next == etag {
+			t.Fatalf("expected a new ETag after %s %s, got %q after %q", test.method, test.path, next, etag)
+		}
+		if current := adminRequest(t, r, http.MethodGet, test.get, "", "").Header().Get("ETag"); current != next {
+			t.Fatalf("expected the ETag of the write to be the current one %s, got %s", current, next)
+		}
+
+		if w := adminRequest(t, r, test.method, test.path, etag, test.body); w.Code != http.StatusPreconditionFailed {
+			t.Fatalf("expected 412 for %s %s with a stale ETag, got %d", test.method, test.path, w.Code)
+		}
+		if w := adminRequest(t, r, test.method, test.path, next, test.body); w.Code != http.StatusOK && w.Code != http.StatusNoContent {
+			t.Fatalf("expected %s %s with the ETag of the last write to succeed, got %d", test.method, test.path, w.Code)
+		}
+	}
+}
+
+func TestTrashWritesSendTheETagOfWhatIsLeft(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	r := mux.NewRouter()
+	ConfigureRouter(r, NewHandlers(app.New(client), client, nil, nil, nil, nil, "token", DefaultConfig()))
+
+	ratings := adminRequest(t, r, http.MethodGet, "/api/admin/movies/1/ratings", "", "")
+	if ratings.Code != http.StatusOK {
+		t.Fatalf("expected 200 getting the ratings, got %d", ratings.Code)
+	}
+	etag := ratings.Header().Get("ETag")
+
+	if w := adminRequest(t, r, http.MethodDelete, "/api/admin/movies/1/ratings/Metacritic", "", ""); w.Code != http.StatusPreconditionRequired {
+		t.Fatalf("expected 428 deleting a rating without If-Match, got %d", w.Code)
+	}
+	w := adminRequest(t, r, http.MethodDelete, "/api/admin/movies/1/ratings/Metacritic", etag, "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting a rating, got %d: %s", w.Code, w.Body.String())
+	}
+	etag = w.Header().Get("ETag")
+	if etag != `"ratings-2"` {
+		t.Fatalf("expected the ratings' next ETag, got %q", etag)
+	}
+
+	w = adminRequest(t, r, http.MethodPost, "/api/admin/movies/1/ratings/Metacritic/restore", "", "")
+	if w.Code != http.StatusNoContent || w.Header().Get("ETag") != `"ratings-3"` {
+		t.Fatalf("expected 204 with the ratings' next ETag restoring a rating, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+
+	// a movie in the trash has no ETag to send, restoring it does
+	movie := adminRequest(t, r, http.MethodGet, "/api/admin/movies/1", "", "").Header().Get("ETag")
+	w = adminRequest(t, r, http.MethodDelete, "/api/admin/movies/1", movie, "")
+	if w.Code != http.StatusNoContent || w.Header().Get("ETag") != "" {
+		t.Fatalf("expected 204 without an ETag deleting the movie, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+	w = adminRequest(t, r, http.MethodPost, "/api/admin/movies/1/restore", "", "")
+	if w.Code != http.StatusNoContent || w.Header().Get("ETag") == "" || w.Header().Get("ETag") == movie {
+		t.Fatalf("expected 204 with a new ETag restoring the movie, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+}
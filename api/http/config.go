@@ -0,0 +1,117 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/rs/cors"
+	"movie-rating-api/idempotency"
+	"movie-rating-api/ratelimit"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ConfigPath is where the playground docker-compose mounts its config directory
+const ConfigPath = "/config/http.json"
+
+// dateLayout is how the dates of the config are written
+const dateLayout = "2006-01-02"
+
+type Config struct {
+	// AllowedOrigins are the origins browsers may call the api from, such as https://movies.example.com, * allows any
+	AllowedOrigins []string `json:"allowed_origins"`
+	// V1Deprecated is the day v1 was deprecated, as 2006-01-02. No Deprecation header is sent while it is empty.
+	V1Deprecated string `json:"v1_deprecated"`
+	// V1Sunset is the day v1 stops responding, as 2006-01-02. No Sunset header is sent while it is empty.
+	V1Sunset string `json:"v1_sunset"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		AllowedOrigins: []string{"*"},
+		V1Deprecated:   "2026-10-19",
+	}
+}
+
+// LoadConfig reads the config file at path, DefaultConfig is returned when the file does not exist
+func LoadConfig(path string) (Config, error) {
+	bytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read http config: %s", err.Error())
+	}
+
+	config := DefaultConfig()
+	err = json.Unmarshal(bytes, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse http config: %s", err.Error())
+	}
+
+	_, err = config.V1Deprecation()
+	if err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// V1Deprecation is what every v1 response announces, v1 is frozen for the existing react app
+func (c Config) V1Deprecation() (Deprecation, error) {
+	deprecation := Deprecation{Successor: "/api/v2/movies"}
+	for _, date := range []struct {
+		name  string
+		value string
+		into  *time.Time
+	}{
+		{"v1_deprecated", c.V1Deprecated, &deprecation.Deprecated},
+		{"v1_sunset", c.V1Sunset, &deprecation.Sunset},
+	} {
+		if date.value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(dateLayout, date.value)
+		if err != nil {
+			return Deprecation{}, fmt.Errorf("http %s must be a date like %s, got %q", date.name, dateLayout, date.value)
+		}
+		*date.into = parsed
+	}
+
+	if !deprecation.Sunset.IsZero() && deprecation.Sunset.Before(deprecation.Deprecated) {
+		return Deprecation{}, fmt.Errorf("http v1_sunset can not be before v1_deprecated")
+	}
+	return deprecation, nil
+}
+
+// CORS lets browsers on the allowed origins call the api, send the headers it reads and read the headers it answers with.
+// Callers are told apart by headers rather than cookies, so credentials are not allowed, which * would not work with anyway.
+func CORS(config Config) func(http.Handler) http.Handler {
+	return cors.New(cors.Options{
+		AllowedOrigins: config.AllowedOrigins,
+		AllowedMethods: []string{http.MethodGet, http.MethodDelete, http.MethodPost, http.MethodPut, http.MethodPatch},
+		AllowedHeaders: []string{
+			"Content-Type",
+			AdminTokenHeader,
+			ratelimit.APIKeyHeader,
+			ratelimit.UserHeader,
+			"If-Match",
+			"If-None-Match",
+			"If-Modified-Since",
+			idempotency.Header,
+			"Last-Event-ID",
+		},
+		ExposedHeaders: []string{
+			"ETag",
+			"Last-Modified",
+			"RateLimit-Limit",
+			"RateLimit-Remaining",
+			"RateLimit-Reset",
+			"Retry-After",
+			idempotency.ReplayedHeader,
+			"Deprecation",
+			"Sunset",
+			"Link",
+		},
+	}).Handler
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORSLetsBrowsersUseTheAPIHeaders(t *testing.T) {
+	config := DefaultConfig()
+	config.AllowedOrigins = []string{"https://movies.example.com"}
+	handler := CORS(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"movie-2"`)
+		w.Header().Set("RateLimit-Remaining", "9")
+	}))
+
+	preflight := httptest.NewRequest(http.MethodOptions, "/api/admin/movies/1", nil)
+	preflight.Header.Set("Origin", "https://movies.example.com")
+	preflight.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+	preflight.Header.Set("Access-Control-Request-Headers", "if-match, idempotency-key, x-admin-token, x-user-id, content-type")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, preflight)
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://movies.example.com" {
+		t.Fatalf("expected the preflight to be allowed, got headers %v", w.Header())
+	}
+	if allowed := strings.ToLower(w.Header().Get("Access-Control-Allow-Headers")); !strings.Contains(allowed, "if-match") || !strings.Contains(allowed, "idempotency-key") {
+		t.Fatalf("expected If-Match and Idempotency-Key to be allowed, got %q", allowed)
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("expected credentials not to be allowed")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/movies", nil)
+	req.Header.Set("Origin", "https://movies.example.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	exposed := w.Header().Get("Access-Control-Expose-Headers")
+	for _, header := range []string{"Etag", "Ratelimit-Remaining", "Retry-After"} {
+		if !strings.Contains(exposed, header) {
+			t.Fatalf("expected %s to be exposed, got %q", header, exposed)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v2/movies", nil)
+	req.Header.Set("Origin", "https://elsewhere.example.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected another origin not to be allowed")
+	}
+}
@@ -0,0 +1,54 @@
+package http
+
+import (
+	"fmt"
+	"movie-rating-api/openapi"
+	"net/http"
+)
+
+func GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	err := writeJSONResponse(w, openapi.Spec(), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write openapi body:", err.Error())
+		return
+	}
+
+	return
+}
+
+// redocVersion is pinned so the docs page does not change under us when redoc releases
+const redocVersion = "2.1.3"
+
+// GetDocs serves a redoc page that renders /api/openapi.json
+func GetDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	_, err := w.Write([]byte(fmt.Sprintf(docsHTML, redocVersion)))
+	if err != nil {
+		fmt.Println("failed to write docs body:", err.Error())
+		return
+	}
+
+	return
+}
+
+const docsHTML = `<!DOCTYPE html>
+<html>
+  <head>
+    <title>Movie Rating API</title>
+    <meta charset="utf-8"/>
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <style>
+      body {
+        margin: 0;
+        padding: 0;
+      }
+    </style>
+  </head>
+  <body>
+    <redoc spec-url="/api/openapi.json"></redoc>
+    <script src="https://cdn.redoc.ly/redoc/v%s/bundles/redoc.standalone.js"></script>
+  </body>
+</html>
+`
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"movie-rating-api/graph"
+	"net/http"
+)
+
+func (h *Handlers) PostGraphQL(w http.ResponseWriter, r *http.Request) {
+	var request graph.Request
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		err = writeJSONResponse(w, map[string]string{"error": fmt.Sprintf("invalid graphql request body: %s", err.Error())}, http.StatusBadRequest)
+		if err != nil {
+			fmt.Println("failed to write err body:", err.Error())
+		}
+		return
+	}
+
+	h.executeGraphQL(w, r, request)
+}
+
+// GetGraphQL executes the query param when there is one, otherwise it serves GraphiQL
+func (h *Handlers) GetGraphQL(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("query") == "" {
+		w.Header().Add("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+
+		_, err := w.Write([]byte(graphiQLHTML))
+		if err != nil {
+			fmt.Println("failed to write graphiql body:", err.Error())
+		}
+		return
+	}
+
+	request := graph.Request{
+		Query:         query.Get("query"),
+		OperationName: query.Get("operationName"),
+	}
+
+	if variables := query.Get("variables"); variables != "" {
+		err := json.Unmarshal([]byte(variables), &request.Variables)
+		if err != nil {
+			err = writeJSONResponse(w, map[string]string{"error": fmt.Sprintf("invalid graphql variables: %s", err.Error())}, http.StatusBadRequest)
+			if err != nil {
+				fmt.Println("failed to write err body:", err.Error())
+			}
+			return
+		}
+	}
+
+	h.executeGraphQL(w, r, request)
+}
+
+func (h *Handlers) executeGraphQL(w http.ResponseWriter, r *http.Request, request graph.Request) {
+	result := graph.Execute(r.Context(), h.client, request)
+
+	// graphql errors are part of the response body so the status is always 200
+	err := writeJSONResponse(w, result, http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write graphql body:", err.Error())
+		return
+	}
+
+	return
+}
+
+// graphiQLHTML loads GraphiQL from unpkg. The assets are pinned to exact versions, react matching the frontend's,
+// so a new release can not change what the page runs.
+const graphiQLHTML = `<!DOCTYPE html>
+<html>
+  <head>
+    <title>Movie Rating GraphiQL</title>
+    <meta charset="utf-8"/>
+    <style>
+      body {
+        height: 100vh;
+        margin: 0;
+        overflow: hidden;
+      }
+      #graphiql {
+        height: 100vh;
+      }
+    </style>
+    <link rel="stylesheet" href="https://unpkg.com/graphiql@3.0.6/graphiql.min.css" crossorigin="anonymous"/>
+  </head>
+  <body>
+    <div id="graphiql">Loading...</div>
+    <script src="https://unpkg.com/react@18.2.0/umd/react.production.min.js" crossorigin="anonymous"></script>
+    <script src="https://unpkg.com/react-dom@18.2.0/umd/react-dom.production.min.js" crossorigin="anonymous"></script>
+    <script src="https://unpkg.com/graphiql@3.0.6/graphiql.min.js" crossorigin="anonymous"></script>
+    <script>
+      const fetcher = GraphiQL.createFetcher({ url: "/api/graphql" });
+      ReactDOM.createRoot(document.getElementById("graphiql")).render(
+        React.createElement(GraphiQL, { fetcher: fetcher, defaultEditorToolsVisibility: true })
+      );
+    </script>
+  </body>
+</html>
+`
@@ -0,0 +1,35 @@
+package http
+
+import (
+	"github.com/gorilla/mux"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestGraphiQLPinsItsAssets(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	r := mux.NewRouter()
+	ConfigureRouter(r, NewHandlers(app.New(client), client, nil, nil, nil, nil, "token", DefaultConfig()))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/graphql", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected GraphiQL, got %d", w.Code)
+	}
+
+	assets := regexp.MustCompile(`https://unpkg\.com/[^"]+`).FindAllString(w.Body.String(), -1)
+	if len(assets) != 4 {
+		t.Fatalf("expected the four GraphiQL assets, got %v", assets)
+	}
+	pinned := regexp.MustCompile(`^https://unpkg\.com/[a-z-]+@\d+\.\d+\.\d+/`)
+	for _, asset := range assets {
+		if !pinned.MatchString(asset) {
+			t.Errorf("expected %s to be pinned to an exact version", asset)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/dto"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// parseTime reads a query param written as RFC 3339 or as a date, the zero time is returned when it is missing.
+// A date is read as the start of the day, or as its last moment when endOfDay is true.
+func parseTime(r *http.Request, name string, endOfDay bool) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be a date such as 2006-01-02 or an RFC 3339 time", name)
+	}
+
+	if endOfDay {
+		return t.Add(24*time.Hour - time.Nanosecond), nil
+	}
+
+	return t, nil
+}
+
+func (h *Handlers) GetRatingHistoryV2(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return
+	}
+
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		bucket = app.BucketDay
+	}
+
+	from, err := parseTime(r, "from", false)
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	to, err := parseTime(r, "to", true)
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	history, ok, err := h.app.GetRatingHistory(id, bucket, from, to)
+	switch {
+	case errors.Is(err, app.ErrInvalidBucket), errors.Is(err, app.ErrInvalidRange), errors.Is(err, app.ErrTooManyBuckets):
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get rating history: %s", err.Error()))
+		return
+	case !ok:
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("movie %d not found", id))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewRatingHistoryV2(history), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write rating history body:", err.Error())
+	}
+}
+
+// PutSourceRating changes the rating a review source gave a movie
+func (h *Handlers) PutSourceRating(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return
+	}
+
+	version, ok := ifMatch(w, r, ratingsTag)
+	if !ok {
+		return
+	}
+
+	var body dto.SourceRatingRequestV2
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.Source == "" || body.Value == nil {
+		writeErrorV2(w, http.StatusBadRequest, "body must be a json object with a source and an integer value")
+		return
+	}
+
+	etag, ok, err := h.tagged(id, ratingsTag, func(tx db.Client) (bool, error) {
+		return app.New(tx).SetSourceRating(id, body.Source, *body.Value, version, adminAuthor(r))
+	})
+	switch {
+	case errors.Is(err, app.ErrInvalidRating):
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, db.ErrVersionMismatch):
+		writePreconditionFailed(w)
+	case err != nil:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to save rating: %s", err.Error()))
+	case !ok:
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("movie %d not found", id))
+	default:
+		log.Printf("admin set the %s rating of movie %d to %d\n", body.Source, id, *body.Value)
+		setETag(w, etag)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -4,16 +4,116 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/rs/cors"
 	"log"
 	"movie-rating-api/app"
+	"movie-rating-api/batch"
+	"movie-rating-api/db"
+	"movie-rating-api/lists"
+	"movie-rating-api/media"
+	"movie-rating-api/stream"
 	"net/http"
 )
 
-func ConfigureRouter(r *mux.Router) {
+// Handlers serve the routes that need the app or the db
+type Handlers struct {
+	app    app.App
+	client db.Client
+	lists  *lists.Curator
+	stream *stream.Broker
+	batch  *batch.Processor
+	media  *media.Library
+	// adminToken guards the /api/admin routes, they are disabled when it is empty
+	adminToken string
+	// origins are the browser origins allowed to open a websocket stream
+	origins *cors.Cors
+	// v1 is the deprecation announced on v1 responses
+	v1 Deprecation
+}
+
+func NewHandlers(a app.App, client db.Client, curator *lists.Curator, broker *stream.Broker, processor *batch.Processor, library *media.Library, adminToken string, config Config) *Handlers {
+	// LoadConfig has checked the dates
+	v1, _ := config.V1Deprecation()
+	return &Handlers{
+		app:        a,
+		client:     client,
+		lists:      curator,
+		stream:     broker,
+		batch:      processor,
+		media:      library,
+		adminToken: adminToken,
+		origins:    cors.New(cors.Options{AllowedOrigins: config.AllowedOrigins}),
+		v1:         v1,
+	}
+}
+
+func ConfigureRouter(r *mux.Router, h *Handlers) {
 	api := r.PathPrefix("/api").Subrouter()
 
 	api.HandleFunc("/health", Health).Methods("GET")
-	api.HandleFunc("/movies", GetMovies).Methods("GET")
+	// unversioned routes from before v1 existed, same as v1
+	api.Handle("/movies", h.v1.Middleware(http.HandlerFunc(h.GetMovies))).Methods("GET")
+
+	v1 := api.PathPrefix("/v1").Subrouter()
+	v1.Use(h.v1.Middleware)
+	v1.HandleFunc("/movies", h.GetMovies).Methods("GET")
+
+	v2 := api.PathPrefix("/v2").Subrouter()
+	v2.HandleFunc("/movies", h.GetMoviesV2).Methods("GET")
+	v2.HandleFunc("/movies/{id}", h.GetMovieV2).Methods("GET")
+	v2.HandleFunc("/movies/{id}/similar", h.GetSimilarMoviesV2).Methods("GET")
+	v2.HandleFunc("/movies/{id}/ratings/history", h.GetRatingHistoryV2).Methods("GET")
+	v2.HandleFunc("/movies/{id}/revisions", h.GetMovieRevisionsV2).Methods("GET")
+	v2.HandleFunc("/movies/{id}/images", h.GetMovieImagesV2).Methods("GET")
+	v2.HandleFunc("/me/ratings", h.GetMyRatingsV2).Methods("GET")
+	v2.HandleFunc("/me/ratings/{id}", h.PutMyRatingV2).Methods("PUT")
+	v2.HandleFunc("/me/recommendations", h.GetMyRecommendationsV2).Methods("GET")
+	v2.HandleFunc("/me/watchlist", h.GetMyWatchlistV2).Methods("GET")
+	v2.HandleFunc("/me/watchlist/{id}", h.PutMyWatchlistEntryV2).Methods("PUT")
+	v2.HandleFunc("/me/watchlist/{id}", h.DeleteMyWatchlistEntryV2).Methods("DELETE")
+	v2.HandleFunc("/me/diary", h.GetMyDiaryV2).Methods("GET")
+	v2.HandleFunc("/me/diary", h.PostMyDiaryEntryV2).Methods("POST")
+	v2.HandleFunc("/me/diary/stats", h.GetMyDiaryStatsV2).Methods("GET")
+	v2.HandleFunc("/me/diary/{entry}", h.DeleteMyDiaryEntryV2).Methods("DELETE")
+	api.HandleFunc("/lists/{list}", h.GetList).Methods("GET")
+	api.HandleFunc("/changes", h.GetChanges).Methods("GET")
+	api.HandleFunc("/stream", h.GetStream).Methods("GET")
+	api.HandleFunc("/stream/ws", h.GetStreamWebSocket).Methods("GET")
+	api.HandleFunc("/media/{hash}/{variant}", h.GetMedia).Methods("GET")
+
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.Use(AdminOnly(h.adminToken))
+	admin.HandleFunc("/movies/{id}", h.GetAdminMovie).Methods("GET")
+	admin.HandleFunc("/movies/{id}", h.PatchMovie).Methods("PATCH")
+	admin.HandleFunc("/movies/{id}", h.DeleteMovie).Methods("DELETE")
+	admin.HandleFunc("/movies/{id}/restore", h.PostMovieRestore).Methods("POST")
+	admin.HandleFunc("/movies/{id}/ratings", h.GetAdminMovieRatings).Methods("GET")
+	admin.HandleFunc("/movies/{id}/ratings", h.PutSourceRating).Methods("PUT")
+	admin.HandleFunc("/movies/{id}/ratings", h.DeleteMovieRatings).Methods("DELETE")
+	admin.HandleFunc("/movies/{id}/ratings/restore", h.PostMovieRatingsRestore).Methods("POST")
+	admin.HandleFunc("/movies/{id}/ratings/{source}", h.DeleteSourceRating).Methods("DELETE")
+	admin.HandleFunc("/movies/{id}/ratings/{source}/restore", h.PostSourceRatingRestore).Methods("POST")
+	admin.HandleFunc("/movies/{id}/images", h.PostMovieImage).Methods("POST")
+	admin.HandleFunc("/movies/{id}/revisions/{revision}/rollback", h.PostMovieRollback).Methods("POST")
+	admin.HandleFunc("/lists/{list}/overrides", h.GetListOverrides).Methods("GET")
+	admin.HandleFunc("/lists/{list}/overrides/{id}", h.PutListOverride).Methods("PUT")
+	admin.HandleFunc("/lists/{list}/overrides/{id}", h.DeleteListOverride).Methods("DELETE")
+	admin.HandleFunc("/webhooks", h.GetWebhooks).Methods("GET")
+	admin.HandleFunc("/webhooks", h.PostWebhook).Methods("POST")
+	admin.HandleFunc("/webhooks/{id}", h.GetWebhook).Methods("GET")
+	admin.HandleFunc("/webhooks/{id}", h.DeleteWebhook).Methods("DELETE")
+	admin.HandleFunc("/webhooks/{id}/deliveries", h.GetWebhookDeliveries).Methods("GET")
+	admin.HandleFunc("/webhooks/{id}/deliveries/{delivery}/retry", h.PostWebhookDeliveryRetry).Methods("POST")
+
+	api.Handle("/trash", AdminOnly(h.adminToken)(http.HandlerFunc(h.GetTrash))).Methods("GET")
+	api.Handle("/movies:batchCreate", AdminOnly(h.adminToken)(http.HandlerFunc(h.PostMoviesBatchCreate))).Methods("POST")
+	api.Handle("/ratings:batchUpsert", AdminOnly(h.adminToken)(http.HandlerFunc(h.PostRatingsBatchUpsert))).Methods("POST")
+	api.HandleFunc("/movies:batchGet", h.GetMoviesBatchGet).Methods("GET")
+
+	api.HandleFunc("/openapi.json", GetOpenAPI).Methods("GET")
+	api.HandleFunc("/docs", GetDocs).Methods("GET")
+	api.HandleFunc("/graphql", h.GetGraphQL).Methods("GET")
+	api.HandleFunc("/graphql", h.PostGraphQL).Methods("POST")
 
 }
 
@@ -27,8 +127,8 @@ func Health(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func GetMovies(w http.ResponseWriter, r *http.Request) {
-	movies, err := app.GetMovies(r.URL.Query())
+func (h *Handlers) GetMovies(w http.ResponseWriter, r *http.Request) {
+	movies, err := h.app.GetMovies(r.URL.Query())
 	if err != nil {
 		err = writeJSONResponse(w, err, http.StatusInternalServerError)
 		if err != nil {
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"movie-rating-api/dto"
+	"movie-rating-api/lists"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (h *Handlers) GetList(w http.ResponseWriter, r *http.Request) {
+	var limit int
+	if r.URL.Query().Get("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit < 1 {
+			writeErrorV2(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+	}
+
+	entries, err := h.lists.List(mux.Vars(r)["list"], limit, time.Now())
+	if errors.Is(err, lists.ErrUnknownList) {
+		writeErrorV2(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get list: %s", err.Error()))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewListEntriesV2(entries), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write list body:", err.Error())
+	}
+}
+
+func (h *Handlers) GetListOverrides(w http.ResponseWriter, r *http.Request) {
+	overrides, err := h.lists.Overrides(mux.Vars(r)["list"])
+	if errors.Is(err, lists.ErrUnknownList) {
+		writeErrorV2(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get list overrides: %s", err.Error()))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewListOverridesV2(overrides), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write list overrides body:", err.Error())
+	}
+}
+
+func (h *Handlers) PutListOverride(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return
+	}
+
+	var body dto.ListOverrideRequestV2
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "body must be a json object with an action")
+		return
+	}
+
+	ok, err := h.lists.SetOverride(mux.Vars(r)["list"], id, body.Action, body.Reason, time.Now())
+	switch {
+	case errors.Is(err, lists.ErrUnknownList):
+		writeErrorV2(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, lists.ErrUnknownAction):
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to save list override: %s", err.Error()))
+	case !ok:
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("movie %d not found", id))
+	default:
+		log.Printf("admin set %s of movie %d in %s\n", body.Action, id, mux.Vars(r)["list"])
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *Handlers) DeleteListOverride(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return
+	}
+
+	ok, err := h.lists.RemoveOverride(mux.Vars(r)["list"], id)
+	switch {
+	case errors.Is(err, lists.ErrUnknownList):
+		writeErrorV2(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to delete list override: %s", err.Error()))
+	case !ok:
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("movie %d has no override", id))
+	default:
+		log.Printf("admin removed the override of movie %d in %s\n", id, mux.Vars(r)["list"])
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
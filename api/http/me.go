@@ -0,0 +1,310 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"movie-rating-api/app"
+	"movie-rating-api/dto"
+	"movie-rating-api/ratelimit"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The /api/v2/me routes act on the user named by the X-User-ID header
+
+func currentUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := r.Header.Get(ratelimit.UserHeader)
+	if user == "" {
+		writeErrorV2(w, http.StatusUnauthorized, fmt.Sprintf("the %s header is required", ratelimit.UserHeader))
+		return "", false
+	}
+
+	return user, true
+}
+
+func (h *Handlers) PutMyRatingV2(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return
+	}
+
+	var body dto.UserRatingRequestV2
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.Score == nil {
+		writeErrorV2(w, http.StatusBadRequest, "body must be a json object with an integer score")
+		return
+	}
+
+	ok, err = h.app.RateMovie(user, id, *body.Score)
+	if errors.Is(err, app.ErrInvalidScore) {
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to save rating: %s", err.Error()))
+		return
+	}
+	if !ok {
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("movie %d not found", id))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) GetMyRatingsV2(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	ratings, err := h.app.GetUserRatings(user)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get ratings: %s", err.Error()))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewUserRatingsV2(ratings), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write ratings body:", err.Error())
+	}
+}
+
+func (h *Handlers) GetMyRecommendationsV2(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 10
+	if r.URL.Query().Get("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit < 1 {
+			writeErrorV2(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+	}
+
+	recommendations, err := h.app.GetRecommendations(user, limit)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get recommendations: %s", err.Error()))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewRecommendationsV2(recommendations), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write recommendations body:", err.Error())
+	}
+}
+
+func (h *Handlers) GetMyWatchlistV2(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := h.app.GetWatchlist(user)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get watchlist: %s", err.Error()))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewWatchlistV2(entries), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write watchlist body:", err.Error())
+	}
+}
+
+func (h *Handlers) PutMyWatchlistEntryV2(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return
+	}
+
+	var body dto.WatchlistRequestV2
+	if r.ContentLength != 0 {
+		err = json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			writeErrorV2(w, http.StatusBadRequest, "body must be a json object with an optional priority and notes")
+			return
+		}
+	}
+
+	ok, err = h.app.AddToWatchlist(user, id, body.Priority, body.Notes)
+	switch {
+	case errors.Is(err, app.ErrInvalidPriority):
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to save watchlist entry: %s", err.Error()))
+	case !ok:
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("movie %d not found", id))
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *Handlers) DeleteMyWatchlistEntryV2(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return
+	}
+
+	ok, err = h.app.RemoveFromWatchlist(user, id)
+	switch {
+	case err != nil:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to delete watchlist entry: %s", err.Error()))
+	case !ok:
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("movie %d is not on the watchlist", id))
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// diaryRange reads the from and to query params of the diary routes
+func diaryRange(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	from, err := parseTime(r, "from", false)
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+		return time.Time{}, time.Time{}, false
+	}
+
+	to, err := parseTime(r, "to", true)
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+		return time.Time{}, time.Time{}, false
+	}
+
+	return from, to, true
+}
+
+func (h *Handlers) GetMyDiaryV2(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	from, to, ok := diaryRange(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := h.app.GetDiary(user, from, to)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get diary: %s", err.Error()))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewDiaryV2(entries), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write diary body:", err.Error())
+	}
+}
+
+func (h *Handlers) PostMyDiaryEntryV2(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body dto.DiaryRequestV2
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.MovieID == 0 {
+		writeErrorV2(w, http.StatusBadRequest, "body must be a json object with a movie_id")
+		return
+	}
+
+	var watchedOn time.Time
+	if body.WatchedOn != "" {
+		watchedOn, err = time.Parse(dto.DateLayout, body.WatchedOn)
+		if err != nil {
+			writeErrorV2(w, http.StatusBadRequest, "watched_on must be a date such as 2006-01-02")
+			return
+		}
+	}
+
+	entry, ok, err := h.app.LogWatch(user, body.MovieID, watchedOn, body.Rewatch, body.Score, body.Notes)
+	switch {
+	case errors.Is(err, app.ErrInvalidScore), errors.Is(err, app.ErrFutureWatch):
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to save diary entry: %s", err.Error()))
+		return
+	case !ok:
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("movie %d not found", body.MovieID))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewDiaryEntryV2(entry), http.StatusCreated)
+	if err != nil {
+		fmt.Println("failed to write diary entry body:", err.Error())
+	}
+}
+
+func (h *Handlers) DeleteMyDiaryEntryV2(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["entry"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "diary entry id must be an integer")
+		return
+	}
+
+	ok, err = h.app.RemoveFromDiary(user, id)
+	switch {
+	case err != nil:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to delete diary entry: %s", err.Error()))
+	case !ok:
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("diary entry %d not found", id))
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *Handlers) GetMyDiaryStatsV2(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	from, to, ok := diaryRange(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := h.app.GetDiaryStats(user, from, to)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get diary stats: %s", err.Error()))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewDiaryStatsV2(stats), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write diary stats body:", err.Error())
+	}
+}
@@ -0,0 +1,187 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"movie-rating-api/db"
+	"movie-rating-api/dto"
+	"movie-rating-api/media"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// uploadField is the multipart field of an image sent as a form
+const uploadField = "file"
+
+// PostMovieImage uploads a poster or a still of a movie, sent as the raw image or as the file field of a multipart form.
+// It is 201 when the image was added and 200 when the movie already had it.
+func (h *Handlers) PostMovieImage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	if kind == "" {
+		kind = db.ImagePoster
+	}
+
+	data, err := readUpload(r, h.media.MaxUploadBytes())
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	image, created, ok, err := h.media.Upload(id, kind, data)
+	switch {
+	case err != nil:
+		writeUploadError(w, err)
+		return
+	case !ok:
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("movie %d not found", id))
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		log.Printf("%s added %s %s to movie %d\n", adminAuthor(r), image.Kind, image.Asset.Hash, id)
+	}
+
+	err = writeJSONResponse(w, dto.NewImageV2(image.Asset, image.Kind), status)
+	if err != nil {
+		fmt.Println("failed to write image body:", err.Error())
+	}
+}
+
+func (h *Handlers) GetMovieImagesV2(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return
+	}
+
+	_, ok, err := h.app.GetMovieDetail(id)
+	switch {
+	case err != nil:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get movie: %s", err.Error()))
+		return
+	case !ok:
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("movie %d not found", id))
+		return
+	}
+
+	images, err := h.media.Images(id)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get images: %s", err.Error()))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewImagesV2(images), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write images body:", err.Error())
+	}
+}
+
+// GetMedia serves an uploaded image or one of its thumbnails. An asset never changes once stored,
+// so clients and proxies may keep it for good.
+func (h *Handlers) GetMedia(w http.ResponseWriter, r *http.Request) {
+	hash, variant := mux.Vars(r)["hash"], mux.Vars(r)["variant"]
+
+	etag := fmt.Sprintf(`"%s-%s"`, hash, variant)
+	body, contentType, err := h.media.Open(hash, variant)
+	switch {
+	case errors.Is(err, media.ErrNotFound):
+		writeErrorV2(w, http.StatusNotFound, "image not found")
+		return
+	case err != nil:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get image: %s", err.Error()))
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	_, err = io.Copy(w, body)
+	if err != nil {
+		fmt.Println("failed to write image:", err.Error())
+	}
+}
+
+// readUpload returns the image in the body, the file field when the body is a multipart form.
+// At most one byte more than maxBytes is read, which is enough for the library to refuse it.
+func readUpload(r *http.Request, maxBytes int64) ([]byte, error) {
+	// a form needs some room for its boundaries and headers on top of the image
+	if r.ContentLength > maxBytes+64*1024 {
+		return nil, fmt.Errorf("%w, the most is %d bytes", media.ErrTooLarge, maxBytes)
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "multipart/form-data") {
+		return readImage(r.Body, maxBytes)
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, uploadError(err.Error())
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, uploadError(fmt.Sprintf("the form has no %s field", uploadField))
+		}
+		if err != nil {
+			return nil, uploadError(fmt.Sprintf("failed to read the form: %s", err.Error()))
+		}
+		if part.FormName() == uploadField {
+			return readImage(part, maxBytes)
+		}
+	}
+}
+
+func readImage(body io.Reader, maxBytes int64) ([]byte, error) {
+	// one byte more than allowed tells a body at the limit from a larger one
+	data, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return nil, uploadError(fmt.Sprintf("failed to read the image: %s", err.Error()))
+	}
+	if len(data) == 0 {
+		return nil, uploadError("the body has no image")
+	}
+
+	return data, nil
+}
+
+// uploadError is a request body that holds no image
+type uploadError string
+
+func (e uploadError) Error() string {
+	return string(e)
+}
+
+// writeUploadError answers a failed upload with 400, 413 when the image is too large and 415 when it is not an image
+func writeUploadError(w http.ResponseWriter, err error) {
+	var badUpload uploadError
+	switch {
+	case errors.As(err, &badUpload), errors.Is(err, media.ErrUnknownKind):
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, media.ErrTooLarge):
+		writeErrorV2(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, media.ErrUnsupportedImage):
+		writeErrorV2(w, http.StatusUnsupportedMediaType, err.Error())
+	default:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to upload image: %s", err.Error()))
+	}
+}
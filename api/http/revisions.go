@@ -0,0 +1,132 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/dto"
+	"movie-rating-api/ratelimit"
+	"net/http"
+	"strconv"
+)
+
+// adminAuthor names who made an admin edit, the X-User-ID header when given
+func adminAuthor(r *http.Request) string {
+	if user := r.Header.Get(ratelimit.UserHeader); user != "" {
+		return user
+	}
+
+	return "admin"
+}
+
+func (h *Handlers) GetMovieRevisionsV2(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return
+	}
+
+	revisions, ok, err := h.app.GetMovieRevisions(id)
+	switch {
+	case err != nil:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get revisions: %s", err.Error()))
+		return
+	case !ok:
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("movie %d not found", id))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewRevisionsV2(revisions), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write revisions body:", err.Error())
+	}
+}
+
+// PatchMovie changes the fields in the body and records a revision
+func (h *Handlers) PatchMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return
+	}
+
+	version, ok := ifMatch(w, r, movieTag)
+	if !ok {
+		return
+	}
+
+	var body dto.MoviePatchV2
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "body must be a json object of the movie fields to change")
+		return
+	}
+
+	author := adminAuthor(r)
+	var revision app.Revision
+	etag, ok, err := h.tagged(id, movieTag, func(tx db.Client) (ok bool, err error) {
+		revision, ok, err = app.New(tx).UpdateMovie(id, body.Patch(), version, author)
+		return ok, err
+	})
+	h.writeRevision(w, revision, etag, ok, err, fmt.Sprintf("movie %d not found", id))
+	if err == nil && ok {
+		log.Printf("%s edited movie %d, now at revision %d\n", author, id, revision.Revision)
+	}
+}
+
+// PostMovieRollback brings a movie back to an earlier revision
+func (h *Handlers) PostMovieRollback(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return
+	}
+
+	number, err := strconv.Atoi(mux.Vars(r)["revision"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "revision must be an integer")
+		return
+	}
+
+	author := adminAuthor(r)
+	var revision app.Revision
+	etag, ok, err := h.tagged(id, movieTag, func(tx db.Client) (ok bool, err error) {
+		revision, ok, err = app.New(tx).RollbackMovie(id, number, author)
+		return ok, err
+	})
+	h.writeRevision(w, revision, etag, ok, err, fmt.Sprintf("movie %d has no revision %d", id, number))
+	if err == nil && ok {
+		log.Printf("%s rolled movie %d back to revision %d\n", author, id, number)
+	}
+}
+
+// writeRevision answers an edit with its revision and the movie's new ETag
+func (h *Handlers) writeRevision(w http.ResponseWriter, revision app.Revision, etag string, ok bool, err error, notFound string) {
+	switch {
+	case errors.Is(err, app.ErrEmptyTitle):
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, app.ErrDuplicateTitle):
+		writeErrorV2(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, db.ErrVersionMismatch):
+		writePreconditionFailed(w)
+		return
+	case err != nil:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to save movie: %s", err.Error()))
+		return
+	case !ok:
+		writeErrorV2(w, http.StatusNotFound, notFound)
+		return
+	}
+
+	setETag(w, etag)
+	err = writeJSONResponse(w, dto.NewRevisionV2(revision), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write revision body:", err.Error())
+	}
+}
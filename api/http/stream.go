@@ -0,0 +1,217 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/websocket"
+	"movie-rating-api/app"
+	"movie-rating-api/dto"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// streamRetry is how long server-sent events clients wait before reconnecting
+const streamRetry = 3 * time.Second
+
+// GetStream sends the committed movie and rating changes as server-sent events.
+// movie_ids limits them to some movies and the Last-Event-ID header or last_event_id param resumes a stream.
+func (h *Handlers) GetStream(w http.ResponseWriter, r *http.Request) {
+	movieIDs, err := parseMovieIDs(r.URL.Query().Get("movie_ids"))
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErrorV2(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	subscription, resumed := h.stream.Subscribe(movieIDs, lastEventID)
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// keeps proxies such as nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+	if err == nil && !resumed {
+		_, err = fmt.Fprintf(w, "event: %s\ndata: {}\n\n", dto.StreamReset)
+	}
+	if err != nil {
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.stream.Heartbeat())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-subscription.Closed():
+			// the client fell behind, it reconnects with the last id it got and the rest is replayed
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case message := <-subscription.Messages():
+			if message.Reset {
+				_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: {}\n\n", message.ID, dto.StreamReset)
+				break
+			}
+			var body []byte
+			body, err = json.Marshal(message.Event)
+			if err == nil {
+				_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", message.ID, message.Event.Type, body)
+			}
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// GetStreamWebSocket sends the same events as GetStream as json messages over a websocket.
+// Clients change their subscription by sending a dto.StreamRequestV2.
+func (h *Handlers) GetStreamWebSocket(w http.ResponseWriter, r *http.Request) {
+	movieIDs, err := parseMovieIDs(r.URL.Query().Get("movie_ids"))
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	server := websocket.Server{
+		Handshake: func(_ *websocket.Config, r *http.Request) error {
+			if !h.originAllowed(r) {
+				return fmt.Errorf("origin %s is not allowed", r.Header.Get("Origin"))
+			}
+			return nil
+		},
+		Handler: func(conn *websocket.Conn) {
+			h.serveWebSocket(conn, movieIDs, r.URL.Query().Get("last_event_id"))
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// originAllowed checks the Origin browsers send with a websocket handshake, which is not subject to CORS.
+// Clients that are not browsers send none, and a page served by the api itself is always allowed.
+func (h *Handlers) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+
+	return h.origins.OriginAllowed(r)
+}
+
+func (h *Handlers) serveWebSocket(conn *websocket.Conn, movieIDs []int, lastEventID string) {
+	defer conn.Close()
+
+	requests := make(chan dto.StreamRequestV2)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// the reader ends when the client disconnects, which closes requests
+		defer close(requests)
+		for {
+			var request dto.StreamRequestV2
+			err := websocket.JSON.Receive(conn, &request)
+			if err != nil {
+				return
+			}
+
+			select {
+			case requests <- request:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(h.stream.Heartbeat())
+	defer heartbeat.Stop()
+
+	// a message that cannot be written within a heartbeat ends the connection
+	send := func(message dto.StreamMessageV2) error {
+		err := conn.SetWriteDeadline(time.Now().Add(h.stream.Heartbeat()))
+		if err != nil {
+			return err
+		}
+		return websocket.JSON.Send(conn, message)
+	}
+
+	for {
+		subscription, resumed := h.stream.Subscribe(movieIDs, lastEventID)
+		var err error
+		if !resumed {
+			err = send(dto.StreamMessageV2{Type: dto.StreamReset})
+		}
+
+		resubscribe := false
+		for err == nil && !resubscribe {
+			select {
+			case request, ok := <-requests:
+				if !ok {
+					subscription.Close()
+					return
+				}
+				// without a last_event_id the new subscription carries on after the last event sent
+				movieIDs = request.MovieIDs
+				if request.LastEventID != "" {
+					lastEventID = request.LastEventID
+				}
+				resubscribe = true
+			case <-subscription.Closed():
+				subscription.Close()
+				return
+			case <-heartbeat.C:
+				err = send(dto.StreamMessageV2{Type: dto.StreamHeartbeat})
+			case message := <-subscription.Messages():
+				lastEventID = message.ID
+				if message.Reset {
+					err = send(dto.StreamMessageV2{Type: dto.StreamReset, ID: message.ID})
+					break
+				}
+				event := message.Event
+				err = send(dto.StreamMessageV2{Type: dto.StreamEvent, ID: message.ID, Event: &event})
+			}
+		}
+
+		subscription.Close()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// parseMovieIDs parses a comma separated list of movie ids, an empty list means every movie
+func parseMovieIDs(list string) ([]int, error) {
+	var ids []int
+	for _, value := range app.SplitList(list) {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("movie_ids must be a comma separated list of integers")
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,192 @@
+package http
+
+import (
+	"bufio"
+	"github.com/gorilla/mux"
+	"golang.org/x/net/websocket"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"movie-rating-api/dto"
+	"movie-rating-api/models"
+	"movie-rating-api/stream"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newStreamServer(t *testing.T, config Config) (*httptest.Server, db.Client) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	streamConfig := stream.DefaultConfig()
+	streamConfig.Heartbeat = "50ms"
+	broker, err := stream.NewBroker(client, streamConfig)
+	if err != nil {
+		t.Fatalf("failed to create broker: %s", err.Error())
+	}
+
+	r := mux.NewRouter()
+	ConfigureRouter(r, NewHandlers(app.New(client), client, nil, broker, nil, nil, "token", config))
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server, client
+}
+
+// sseEvent is a server-sent event, or a comment when name and id are empty
+type sseEvent struct {
+	id      string
+	name    string
+	data    string
+	comment string
+}
+
+// readEvents sends the events of the stream until it ends
+func readEvents(t *testing.T, url string, lastEventID string) <-chan sseEvent {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %s", err.Error())
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open stream: %s", err.Error())
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	if res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %s", res.Header.Get("Content-Type"))
+	}
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(res.Body)
+		var event sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				events <- event
+				event = sseEvent{}
+			case strings.HasPrefix(line, ": "):
+				event.comment = strings.TrimPrefix(line, ": ")
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+
+	return events
+}
+
+// nextEvent returns the next event that is not a heartbeat or the retry
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("the stream ended")
+			}
+			if event.name != "" {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for an event")
+		}
+	}
+}
+
+func TestStreamResumesAfterTheLastEventID(t *testing.T) {
+	server, client := newStreamServer(t, DefaultConfig())
+	events := readEvents(t, server.URL+"/api/stream?movie_ids=1", "")
+
+	for _, plot := range []string{"first", "second"} {
+		_, _, err := client.UpdateMovie(models.Movies{ID: 1, Title: "Life of Brian", Plot: plot}, db.AnyVersion, "alice", time.Now())
+		if err != nil {
+			t.Fatalf("failed to update movie: %s", err.Error())
+		}
+	}
+	first := nextEvent(t, events)
+	if first.name != db.EventMovieUpdated || first.id == "" {
+		t.Fatalf("expected the update with an id, got %+v", first)
+	}
+	nextEvent(t, events)
+
+	resumed := readEvents(t, server.URL+"/api/stream?movie_ids=1", first.id)
+	if event := nextEvent(t, resumed); event.name != db.EventMovieUpdated || event.id == first.id {
+		t.Fatalf("expected the second update to be replayed, got %+v", event)
+	}
+
+	reset := readEvents(t, server.URL+"/api/stream", "unknown-1")
+	if event := nextEvent(t, reset); event.name != dto.StreamReset {
+		t.Fatalf("expected a reset for an unknown id, got %+v", event)
+	}
+}
+
+func TestStreamSendsHeartbeats(t *testing.T) {
+	server, _ := newStreamServer(t, DefaultConfig())
+	events := readEvents(t, server.URL+"/api/stream", "")
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.comment == "heartbeat" {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for a heartbeat")
+		}
+	}
+}
+
+func TestWebSocketStreamChecksTheOrigin(t *testing.T) {
+	config := DefaultConfig()
+	config.AllowedOrigins = []string{"https://movies.example.com"}
+	server, client := newStreamServer(t, config)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/stream/ws?movie_ids=1"
+
+	_, err := websocket.Dial(url, "", "https://elsewhere.example.com")
+	if err == nil {
+		t.Fatalf("expected another origin to be refused")
+	}
+	// a page served by the api itself may connect
+	same, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatalf("expected the api's own origin to be allowed: %s", err.Error())
+	}
+	same.Close()
+
+	conn, err := websocket.Dial(url, "", "https://movies.example.com")
+	if err != nil {
+		t.Fatalf("expected an allowed origin to connect: %s", err.Error())
+	}
+	defer conn.Close()
+
+	_, _, err = client.UpdateMovie(models.Movies{ID: 1, Title: "Life of Brian", Plot: "new"}, db.AnyVersion, "alice", time.Now())
+	if err != nil {
+		t.Fatalf("failed to update movie: %s", err.Error())
+	}
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var message dto.StreamMessageV2
+		err = websocket.JSON.Receive(conn, &message)
+		if err != nil {
+			t.Fatalf("failed to receive message: %s", err.Error())
+		}
+		if message.Type == dto.StreamHeartbeat {
+			continue
+		}
+		if message.Type != dto.StreamEvent || message.Event == nil || message.Event.Type != db.EventMovieUpdated {
+			t.Fatalf("expected the update, got %+v", message)
+		}
+		return
+	}
+}
@@ -0,0 +1,167 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"movie-rating-api/db"
+	"movie-rating-api/dto"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (h *Handlers) GetTrash(w http.ResponseWriter, r *http.Request) {
+	items, err := h.client.GetTrash()
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get trash: %s", err.Error()))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewTrashV2(items), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write trash body:", err.Error())
+	}
+}
+
+// DeleteMovie moves a movie to the trash with its ratings
+func (h *Handlers) DeleteMovie(w http.ResponseWriter, r *http.Request) {
+	id, ok := trashMovieID(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := ifMatch(w, r, movieTag)
+	if !ok {
+		return
+	}
+
+	etag, ok, err := h.tagged(id, movieTag, func(tx db.Client) (bool, error) {
+		return tx.DeleteMovie(id, version, time.Now())
+	})
+	writeTrashResult(w, etag, ok, err, fmt.Sprintf("movie %d not found", id))
+	if err == nil && ok {
+		log.Printf("%s moved movie %d to the trash\n", adminAuthor(r), id)
+	}
+}
+
+func (h *Handlers) PostMovieRestore(w http.ResponseWriter, r *http.Request) {
+	id, ok := trashMovieID(w, r)
+	if !ok {
+		return
+	}
+
+	etag, ok, err := h.tagged(id, movieTag, func(tx db.Client) (bool, error) {
+		return tx.RestoreMovie(id, time.Now())
+	})
+	writeTrashResult(w, etag, ok, err, fmt.Sprintf("movie %d is not in the trash", id))
+	if err == nil && ok {
+		log.Printf("%s restored movie %d\n", adminAuthor(r), id)
+	}
+}
+
+// DeleteMovieRatings moves the review of a movie, the ratings seeded together, to the trash
+func (h *Handlers) DeleteMovieRatings(w http.ResponseWriter, r *http.Request) {
+	id, ok := trashMovieID(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := ifMatch(w, r, ratingsTag)
+	if !ok {
+		return
+	}
+
+	author := adminAuthor(r)
+	etag, ok, err := h.tagged(id, ratingsTag, func(tx db.Client) (bool, error) {
+		return tx.DeleteMovieRatings(id, version, author, time.Now())
+	})
+	writeTrashResult(w, etag, ok, err, fmt.Sprintf("movie %d has no ratings", id))
+	if err == nil && ok {
+		log.Printf("%s moved the ratings of movie %d to the trash\n", author, id)
+	}
+}
+
+func (h *Handlers) PostMovieRatingsRestore(w http.ResponseWriter, r *http.Request) {
+	id, ok := trashMovieID(w, r)
+	if !ok {
+		return
+	}
+
+	author := adminAuthor(r)
+	etag, ok, err := h.tagged(id, ratingsTag, func(tx db.Client) (bool, error) {
+		return tx.RestoreMovieRatings(id, author, time.Now())
+	})
+	writeTrashResult(w, etag, ok, err, fmt.Sprintf("the trash has no ratings of movie %d", id))
+	if err == nil && ok {
+		log.Printf("%s restored the ratings of movie %d\n", author, id)
+	}
+}
+
+func (h *Handlers) DeleteSourceRating(w http.ResponseWriter, r *http.Request) {
+	id, ok := trashMovieID(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := ifMatch(w, r, ratingsTag)
+	if !ok {
+		return
+	}
+
+	source := mux.Vars(r)["source"]
+	author := adminAuthor(r)
+	etag, ok, err := h.tagged(id, ratingsTag, func(tx db.Client) (bool, error) {
+		return tx.DeleteRating(id, source, version, author, time.Now())
+	})
+	writeTrashResult(w, etag, ok, err, fmt.Sprintf("%s has not rated movie %d", source, id))
+	if err == nil && ok {
+		log.Printf("%s moved the %s rating of movie %d to the trash\n", author, source, id)
+	}
+}
+
+func (h *Handlers) PostSourceRatingRestore(w http.ResponseWriter, r *http.Request) {
+	id, ok := trashMovieID(w, r)
+	if !ok {
+		return
+	}
+
+	source := mux.Vars(r)["source"]
+	author := adminAuthor(r)
+	etag, ok, err := h.tagged(id, ratingsTag, func(tx db.Client) (bool, error) {
+		return tx.RestoreRating(id, source, author, time.Now())
+	})
+	writeTrashResult(w, etag, ok, err, fmt.Sprintf("the trash has no %s rating of movie %d", source, id))
+	if err == nil && ok {
+		log.Printf("%s restored the %s rating of movie %d\n", author, source, id)
+	}
+}
+
+func trashMovieID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return 0, false
+	}
+
+	return id, true
+}
+
+// writeTrashResult answers a delete or restore with 204 and the new ETag of what is still live, 409 when the parent
+// is in the trash or a restore would replace a newer rating and 412 when If-Match no longer holds
+func writeTrashResult(w http.ResponseWriter, etag string, ok bool, err error, notFound string) {
+	switch {
+	case errors.Is(err, db.ErrParentDeleted), errors.Is(err, db.ErrRestoreConflict):
+		writeErrorV2(w, http.StatusConflict, err.Error())
+	case errors.Is(err, db.ErrVersionMismatch):
+		writePreconditionFailed(w)
+	case err != nil:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to update the trash: %s", err.Error()))
+	case !ok:
+		writeErrorV2(w, http.StatusNotFound, notFound)
+	default:
+		setETag(w, etag)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,227 @@
+package http
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"math"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/dto"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GetMoviesV2 takes on_watchlist and seen query params to filter by the X-User-ID user's watchlist and diary
+func (h *Handlers) GetMoviesV2(w http.ResponseWriter, r *http.Request) {
+	onWatchlist, err := parseBool(r, "on_watchlist")
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	seen, err := parseBool(r, "seen")
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var user string
+	if onWatchlist != nil || seen != nil {
+		var ok bool
+		user, ok = currentUser(w, r)
+		if !ok {
+			return
+		}
+	}
+
+	details, err := h.app.GetMovieDetails(r.URL.Query())
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get movies: %s", err.Error()))
+		return
+	}
+
+	if user != "" {
+		details, err = h.app.FilterForUser(user, details, onWatchlist, seen)
+		if err != nil {
+			writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to filter movies: %s", err.Error()))
+			return
+		}
+	}
+
+	err = writeJSONResponse(w, dto.NewMoviesV2(details), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write movies body:", err.Error())
+		return
+	}
+
+	return
+}
+
+// movieRoute is the route whose reads count as views of the movie for the trending list
+const movieRoute = "/api/v2/movies/{id}"
+
+// RecordViews counts a view of a movie for every read of it that succeeds, those answered with a 304 included.
+// It has to run before the http cache, which answers revalidations without calling the handler.
+func RecordViews(client db.Client) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			if route == nil || r.Method != http.MethodGet {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if template, err := route.GetPathTemplate(); err != nil || template != movieRoute {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			if recorder.status != http.StatusOK && recorder.status != http.StatusNotModified {
+				return
+			}
+
+			id, err := strconv.Atoi(mux.Vars(r)["id"])
+			if err != nil {
+				return
+			}
+			err = client.RecordMovieView(id, time.Now())
+			if err != nil {
+				log.Printf("failed to record view of movie %d: %s\n", id, err.Error())
+			}
+		})
+	}
+}
+
+// statusRecorder keeps the status the handler answered with
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.wroteHeader = true
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// GetMovieV2 takes an as_of query param to return the ratings the movie had at a past time
+func (h *Handlers) GetMovieV2(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return
+	}
+
+	asOf, err := parseTime(r, "as_of", true)
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var detail app.MovieDetails
+	var ok bool
+	if asOf.IsZero() {
+		detail, ok, err = h.app.GetMovieDetail(id)
+	} else {
+		detail, ok, err = h.app.GetMovieDetailsAsOf(id, asOf)
+	}
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get movies: %s", err.Error()))
+		return
+	}
+	if !ok {
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("movie %d not found", id))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewMovieV2(detail), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write movie body:", err.Error())
+	}
+}
+
+// parseBool reads a true or false query param, nil is returned when it is missing
+func parseBool(r *http.Request, name string) (*bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", name)
+	}
+
+	return &b, nil
+}
+
+func writeErrorV2(w http.ResponseWriter, status int, message string) {
+	err := writeJSONResponse(w, dto.NewErrorV2(status, message), status)
+	if err != nil {
+		fmt.Println("failed to write err body:", err.Error())
+	}
+}
+
+// GetSimilarMoviesV2 takes a limit and a <signal>_weight query param per app.SimilarityWeights field
+func (h *Handlers) GetSimilarMoviesV2(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "movie id must be an integer")
+		return
+	}
+
+	query := r.URL.Query()
+
+	limit := 10
+	if query.Get("limit") != "" {
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit < 1 {
+			writeErrorV2(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+	}
+
+	weights := app.DefaultSimilarityWeights()
+	for name, weight := range map[string]*float64{
+		"genre_weight":    &weights.Genre,
+		"director_weight": &weights.Director,
+		"actors_weight":   &weights.Actors,
+		"era_weight":      &weights.Era,
+		"ratings_weight":  &weights.Ratings,
+	} {
+		if query.Get(name) == "" {
+			continue
+		}
+
+		*weight, err = strconv.ParseFloat(query.Get(name), 64)
+		// ParseFloat accepts NaN and Inf, which would poison every score they are multiplied into
+		if err != nil || math.IsNaN(*weight) || math.IsInf(*weight, 0) || *weight < 0 {
+			writeErrorV2(w, http.StatusBadRequest, fmt.Sprintf("%s must be a finite number of at least 0", name))
+			return
+		}
+	}
+
+	similar, ok, err := h.app.GetSimilarMovies(id, weights, limit)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get similar movies: %s", err.Error()))
+		return
+	}
+	if !ok {
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("movie %d not found", id))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewSimilarMoviesV2(similar), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write similar movies body:", err.Error())
+		return
+	}
+
+	return
+}
@@ -0,0 +1,34 @@
+package http
+
+import (
+	"github.com/gorilla/mux"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSimilarMoviesRejectsNonFiniteWeights(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	r := mux.NewRouter()
+	ConfigureRouter(r, NewHandlers(app.New(client), client, nil, nil, nil, nil, "token", DefaultConfig()))
+
+	for query, status := range map[string]int{
+		"genre_weight=2":       http.StatusOK,
+		"genre_weight=0":       http.StatusOK,
+		"genre_weight=-1":      http.StatusBadRequest,
+		"genre_weight=NaN":     http.StatusBadRequest,
+		"director_weight=Inf":  http.StatusBadRequest,
+		"actors_weight=%2BInf": http.StatusBadRequest,
+		"era_weight=-Inf":      http.StatusBadRequest,
+		"ratings_weight=1e400": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/movies/1/similar?"+query, nil))
+		if w.Code != status {
+			t.Errorf("expected %d for %s, got %d: %s", status, query, w.Code, w.Body.String())
+		}
+	}
+}
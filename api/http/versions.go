@@ -0,0 +1,33 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Deprecation announces that a version of the api is going away, see RFC 9745 and RFC 8594
+type Deprecation struct {
+	// Deprecated is when the version was deprecated, no headers are sent while it is zero
+	Deprecated time.Time
+	// Sunset is when the version stops responding, the Sunset header is left out while it is zero
+	Sunset time.Time
+	// Successor is the url of the version clients should move to
+	Successor string
+}
+
+func (d Deprecation) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !d.Deprecated.IsZero() {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", d.Deprecated.Unix()))
+		}
+		if !d.Sunset.IsZero() {
+			w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if d.Successor != "" {
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, d.Successor))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,125 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func newVersionsRouter(t *testing.T, config Config) *mux.Router {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	r := mux.NewRouter()
+	ConfigureRouter(r, NewHandlers(app.New(client), client, nil, nil, nil, nil, "token", config))
+	return r
+}
+
+func keys(object map[string]interface{}) []string {
+	var names []string
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestLoadConfigReadsTheV1Dates(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"dates", `{"v1_deprecated": "2026-10-19", "v1_sunset": "2027-04-01"}`, ""},
+		{"no dates", `{"v1_deprecated": ""}`, ""},
+		{"a sunset without a deprecation", `{"v1_deprecated": "", "v1_sunset": "2027-04-01"}`, ""},
+		{"a time rather than a date", `{"v1_sunset": "2027-04-01T00:00:00Z"}`, "v1_sunset must be a date"},
+		{"a sunset before the deprecation", `{"v1_deprecated": "2026-10-19", "v1_sunset": "2026-10-18"}`, "can not be before"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "http.json")
+			err := os.WriteFile(path, []byte(test.config), 0644)
+			if err != nil {
+				t.Fatalf("failed to write config: %s", err.Error())
+			}
+
+			_, err = LoadConfig(path)
+			if test.err == "" && err != nil {
+				t.Fatalf("failed to load config: %s", err.Error())
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("expected an error with %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestV1ResponsesAnnounceTheirDeprecation(t *testing.T) {
+	config := DefaultConfig()
+	config.V1Deprecated = "2026-10-19"
+	config.V1Sunset = "2027-04-01"
+	r := newVersionsRouter(t, config)
+
+	for _, url := range []string{"/api/movies", "/api/v1/movies"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected %s to answer, got %d", url, w.Code)
+		}
+		if deprecation := w.Header().Get("Deprecation"); deprecation != "@1792368000" {
+			t.Fatalf("expected %s to be deprecated on 2026-10-19, got %q", url, deprecation)
+		}
+		if sunset := w.Header().Get("Sunset"); sunset != "Thu, 01 Apr 2027 00:00:00 GMT" {
+			t.Fatalf("expected %s to sunset on 2027-04-01, got %q", url, sunset)
+		}
+		if link := w.Header().Get("Link"); link != `</api/v2/movies>; rel="successor-version"` {
+			t.Fatalf("expected %s to link to v2, got %q", url, link)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/movies", nil))
+	if w.Header().Get("Deprecation") != "" || w.Header().Get("Sunset") != "" {
+		t.Fatalf("expected v2 not to be deprecated, got %v", w.Header())
+	}
+
+	// without dates only the successor is announced
+	config.V1Deprecated, config.V1Sunset = "", ""
+	w = httptest.NewRecorder()
+	newVersionsRouter(t, config).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/movies", nil))
+	if w.Header().Get("Deprecation") != "" || w.Header().Get("Sunset") != "" || w.Header().Get("Link") == "" {
+		t.Fatalf("expected only the successor link, got %v", w.Header())
+	}
+}
+
+func TestV1ResponsesKeepTheirShape(t *testing.T) {
+	r := newVersionsRouter(t, DefaultConfig())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/movies", nil))
+
+	var movies []map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &movies)
+	if err != nil || len(movies) == 0 {
+		t.Fatalf("expected a list of movies, got %s", w.Body.String())
+	}
+
+	// the react app reads these keys, v1 is frozen so they can not change
+	if names := keys(movies[0]); !reflect.DeepEqual(names, []string{"Genre", "Plot", "average_rating", "ratings", "title"}) {
+		t.Fatalf("expected the frozen keys of a movie, got %v", names)
+	}
+	ratings, ok := movies[0]["ratings"].([]interface{})
+	if !ok || len(ratings) == 0 {
+		t.Fatalf("expected the ratings of the movie, got %v", movies[0]["ratings"])
+	}
+	if names := keys(ratings[0].(map[string]interface{})); !reflect.DeepEqual(names, []string{"movie_ratings_id", "source", "value"}) {
+		t.Fatalf("expected the frozen keys of a rating, got %v", names)
+	}
+}
@@ -0,0 +1,177 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"movie-rating-api/db"
+	"movie-rating-api/dto"
+	"movie-rating-api/webhook"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxDeliveries is the most deliveries the delivery log returns at once
+const maxDeliveries = 100
+
+func (h *Handlers) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := h.client.GetWebhookSubscriptions()
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get webhooks: %s", err.Error()))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewWebhooksV2(subscriptions), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write webhooks body:", err.Error())
+	}
+}
+
+func (h *Handlers) PostWebhook(w http.ResponseWriter, r *http.Request) {
+	var body dto.WebhookRequestV2
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "body must be a json object with a url and events")
+		return
+	}
+
+	subscription, err := webhook.NewSubscription(body.URL, body.Events, body.Secret, time.Now())
+	if errors.Is(err, webhook.ErrInvalidURL) || errors.Is(err, webhook.ErrNoEvents) || errors.Is(err, webhook.ErrUnknownEvent) {
+		writeErrorV2(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to create webhook: %s", err.Error()))
+		return
+	}
+
+	subscription, err = h.client.CreateWebhookSubscription(subscription)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to create webhook: %s", err.Error()))
+		return
+	}
+
+	log.Printf("admin subscribed %s to %s\n", subscription.URL, subscription.Events)
+	err = writeJSONResponse(w, dto.NewWebhookV2(subscription, true), http.StatusCreated)
+	if err != nil {
+		fmt.Println("failed to write webhook body:", err.Error())
+	}
+}
+
+// webhookID reads the id path param and writes the error response when it is not a webhook
+func (h *Handlers) webhookID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "webhook id must be an integer")
+		return 0, false
+	}
+
+	_, ok, err := h.client.GetWebhookSubscription(id)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get webhook: %s", err.Error()))
+		return 0, false
+	}
+	if !ok {
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("webhook %d not found", id))
+		return 0, false
+	}
+
+	return id, true
+}
+
+func (h *Handlers) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	subscription, _, err := h.client.GetWebhookSubscription(id)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get webhook: %s", err.Error()))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewWebhookV2(subscription, false), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write webhook body:", err.Error())
+	}
+}
+
+func (h *Handlers) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := h.client.DeleteWebhookSubscription(id)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to delete webhook: %s", err.Error()))
+		return
+	}
+
+	log.Printf("admin deleted webhook %d\n", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries is the delivery log of a webhook, newest first, filtered by the status query param
+func (h *Handlers) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && status != db.DeliveryPending && status != db.DeliveryDelivered && status != db.DeliveryDead {
+		writeErrorV2(w, http.StatusBadRequest, fmt.Sprintf("status must be %s, %s or %s", db.DeliveryPending, db.DeliveryDelivered, db.DeliveryDead))
+		return
+	}
+
+	limit := maxDeliveries
+	if r.URL.Query().Get("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit < 1 || limit > maxDeliveries {
+			writeErrorV2(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxDeliveries))
+			return
+		}
+	}
+
+	deliveries, err := h.client.GetWebhookDeliveries(id, status, limit)
+	if err != nil {
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to get deliveries: %s", err.Error()))
+		return
+	}
+
+	err = writeJSONResponse(w, dto.NewWebhookDeliveriesV2(deliveries), http.StatusOK)
+	if err != nil {
+		fmt.Println("failed to write deliveries body:", err.Error())
+	}
+}
+
+// PostWebhookDeliveryRetry queues a dead lettered or delivered delivery again
+func (h *Handlers) PostWebhookDeliveryRetry(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := strconv.Atoi(mux.Vars(r)["delivery"])
+	if err != nil {
+		writeErrorV2(w, http.StatusBadRequest, "delivery id must be an integer")
+		return
+	}
+
+	ok, err = h.client.RetryWebhookDelivery(id, deliveryID, time.Now())
+	switch {
+	case err != nil:
+		writeErrorV2(w, http.StatusInternalServerError, fmt.Sprintf("failed to retry delivery: %s", err.Error()))
+	case !ok:
+		writeErrorV2(w, http.StatusNotFound, fmt.Sprintf("delivery %d not found", deliveryID))
+	default:
+		log.Printf("admin retried webhook delivery %d\n", deliveryID)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
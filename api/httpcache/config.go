@@ -0,0 +1,58 @@
+package httpcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ConfigPath is where the playground docker-compose mounts its config directory
+const ConfigPath = "/config/httpcache.json"
+
+type Config struct {
+	// Routes maps a mux path template such as /api/movies to how its GET responses are cached.
+	// Routes that are not listed are not cached.
+	Routes map[string]Route `json:"routes"`
+}
+
+type Route struct {
+	// CacheControl is sent as the Cache-Control header
+	CacheControl string `json:"cache_control"`
+	// PrivateParams are query params that make the response depend on the user,
+	// requests with any of them are not cached since the user's data is not part of the version
+	PrivateParams []string `json:"private_params,omitempty"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Routes: map[string]Route{
+			// clients may keep the movies but have to revalidate them, which is cheap with an ETag
+			"/api/movies":                 {CacheControl: "public, no-cache"},
+			"/api/v1/movies":              {CacheControl: "public, no-cache"},
+			"/api/v2/movies":              {CacheControl: "public, no-cache", PrivateParams: []string{"on_watchlist", "seen"}},
+			"/api/v2/movies/{id}":         {CacheControl: "public, no-cache"},
+			"/api/v2/movies/{id}/similar": {CacheControl: "public, no-cache"},
+			"/api/graphql":                {CacheControl: "public, no-cache"},
+			"/api/openapi.json":           {CacheControl: "public, max-age=300"},
+		},
+	}
+}
+
+// LoadConfig reads the config file at path, DefaultConfig is returned when the file does not exist
+func LoadConfig(path string) (Config, error) {
+	bytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read http cache config: %s", err.Error())
+	}
+
+	var config Config
+	err = json.Unmarshal(bytes, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse http cache config: %s", err.Error())
+	}
+
+	return config, nil
+}
@@ -0,0 +1,155 @@
+package httpcache
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VersionFunc returns the current version of the data behind the cached routes and when it last changed,
+// the time is zero when it is not known
+type VersionFunc func() (string, time.Time, error)
+
+type Cache struct {
+	config  Config
+	version VersionFunc
+}
+
+func NewCache(config Config, version VersionFunc) *Cache {
+	return &Cache{
+		config:  config,
+		version: version,
+	}
+}
+
+// Middleware sets ETag, Last-Modified and Cache-Control on successful GET and HEAD requests to configured routes
+// and answers 304 Not Modified without calling the handler when the client's copy is still current.
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route, ok := c.routeFor(r)
+		if !ok || route.private(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// the version is read before the handler runs so a write during the request
+		// can only make the etag older than the body, never newer
+		version, modifiedAt, err := c.version()
+		if err != nil {
+			// the response is still served, it is just not cached
+			log.Printf("failed to get the version of %s: %s\n", r.URL.Path, err.Error())
+			next.ServeHTTP(w, r)
+			return
+		}
+		etag := strongETag(version, r)
+
+		w.Header().Set("ETag", etag)
+		if !modifiedAt.IsZero() {
+			w.Header().Set("Last-Modified", modifiedAt.UTC().Format(http.TimeFormat))
+		}
+		if route.CacheControl != "" {
+			w.Header().Set("Cache-Control", route.CacheControl)
+		}
+
+		if notModified(r, etag, modifiedAt) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		next.ServeHTTP(&successOnly{ResponseWriter: w}, r)
+	})
+}
+
+// successOnly drops the validators and Cache-Control from responses that are not a 2xx,
+// so an error is neither cached nor revalidated as if it were the resource
+type successOnly struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *successOnly) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status < 200 || status > 299 {
+			w.Header().Del("ETag")
+			w.Header().Del("Last-Modified")
+			w.Header().Del("Cache-Control")
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *successOnly) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (route Route) private(r *http.Request) bool {
+	for _, param := range route.PrivateParams {
+		if r.URL.Query().Get(param) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Cache) routeFor(r *http.Request) (Route, bool) {
+	current := mux.CurrentRoute(r)
+	if current == nil {
+		return Route{}, false
+	}
+
+	template, err := current.GetPathTemplate()
+	if err != nil {
+		return Route{}, false
+	}
+
+	route, ok := c.config.Routes[template]
+	return route, ok
+}
+
+// strongETag differs per version and per request url since the query can change the body
+func strongETag(version string, r *http.Request) string {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(r.URL.RequestURI()))
+
+	return fmt.Sprintf(`"%s-%x"`, version, hash.Sum64())
+}
+
+// notModified follows RFC 7232 section 6, If-Modified-Since is ignored when If-None-Match is sent
+func notModified(r *http.Request, etag string, modifiedAt time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" && !modifiedAt.IsZero() {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err != nil {
+			return false
+		}
+
+		// http dates only have second precision
+		return !modifiedAt.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
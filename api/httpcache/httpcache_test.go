@@ -0,0 +1,150 @@
+package httpcache_test
+
+import (
+	"github.com/gorilla/mux"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	movieHttp "movie-rating-api/http"
+	"movie-rating-api/httpcache"
+	"movie-rating-api/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newRouter puts the views and the cache in front of the api in the order main does
+func newRouter(t *testing.T) (*mux.Router, db.Client) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+
+	r := mux.NewRouter()
+	r.Use(movieHttp.RecordViews(client))
+	r.Use(httpcache.NewCache(httpcache.DefaultConfig(), client.CatalogueVersion).Middleware)
+	movieHttp.ConfigureRouter(r, movieHttp.NewHandlers(app.New(client), client, nil, nil, nil, nil, "", movieHttp.DefaultConfig()))
+
+	return r, client
+}
+
+func get(r http.Handler, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func views(t *testing.T, client db.Client, movieID int) int {
+	t.Helper()
+
+	rows, err := client.GetMovieViews(time.Now().AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatalf("failed to get views: %s", err.Error())
+	}
+
+	total := 0
+	for _, row := range rows {
+		if row.MovieID == movieID {
+			total += row.Views
+		}
+	}
+	return total
+}
+
+func TestRevalidatedReadsCountAsViews(t *testing.T) {
+	r, client := newRouter(t)
+
+	first := get(r, "/api/v2/movies/1", nil)
+	if first.Code != http.StatusOK {
+		t.Fatalf("got %d", first.Code)
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag on the movie")
+	}
+
+	revalidated := get(r, "/api/v2/movies/1", map[string]string{"If-None-Match": etag})
+	if revalidated.Code != http.StatusNotModified {
+		t.Fatalf("got %d revalidating", revalidated.Code)
+	}
+
+	if count := views(t, client, 1); count != 2 {
+		t.Errorf("counted %d views, the read and its revalidation are 2", count)
+	}
+}
+
+func TestErrorsHaveNoValidators(t *testing.T) {
+	r, client := newRouter(t)
+
+	missing := get(r, "/api/v2/movies/999", nil)
+	if missing.Code != http.StatusNotFound {
+		t.Fatalf("got %d", missing.Code)
+	}
+	for _, header := range []string{"ETag", "Last-Modified", "Cache-Control"} {
+		if value := missing.Header().Get(header); value != "" {
+			t.Errorf("the 404 has %s %s", header, value)
+		}
+	}
+
+	if count := views(t, client, 999); count != 0 {
+		t.Errorf("counted %d views of a movie that does not exist", count)
+	}
+}
+
+func TestETagsAreSharedByReplicas(t *testing.T) {
+	client, gormDB := dbtest.NewSQLite(t)
+	// a second client of the same db stands in for another replica, or this one after a restart
+	replica := db.NewDBCLient(gormDB)
+
+	newCachedRouter := func(client db.Client) *mux.Router {
+		r := mux.NewRouter()
+		r.Use(httpcache.NewCache(httpcache.DefaultConfig(), client.CatalogueVersion).Middleware)
+		movieHttp.ConfigureRouter(r, movieHttp.NewHandlers(app.New(client), client, nil, nil, nil, nil, "", movieHttp.DefaultConfig()))
+		return r
+	}
+	r, other := newCachedRouter(client), newCachedRouter(replica)
+
+	err := client.CreateMovie(models.Movies{Title: "Heat", Year: "1995"})
+	if err != nil {
+		t.Fatalf("failed to create movie: %s", err.Error())
+	}
+	// the spec is cached without reading the catalogue, the movie routes would wait out the slow GetMovies
+	first := get(r, "/api/openapi.json", nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Last-Modified") == "" {
+		t.Fatalf("expected the spec with validators, got %d %v", first.Code, first.Header())
+	}
+
+	if revalidated := get(other, "/api/openapi.json", map[string]string{"If-None-Match": etag}); revalidated.Code != http.StatusNotModified {
+		t.Fatalf("expected the other replica to accept the ETag, got %d", revalidated.Code)
+	}
+
+	err = replica.CreateMovie(models.Movies{Title: "Ronin", Year: "1998"})
+	if err != nil {
+		t.Fatalf("failed to create movie: %s", err.Error())
+	}
+	if changed := get(r, "/api/openapi.json", map[string]string{"If-None-Match": etag}); changed.Code != http.StatusOK || changed.Header().Get("ETag") == etag {
+		t.Fatalf("expected a write on the other replica to change the ETag, got %d %s", changed.Code, changed.Header().Get("ETag"))
+	}
+}
+
+func TestResponsesAreServedWithoutAVersion(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{Script: map[string][]string{db.MethodCatalogueVersion: {"connection refused"}}})
+
+	r := mux.NewRouter()
+	r.Use(httpcache.NewCache(httpcache.DefaultConfig(), client.CatalogueVersion).Middleware)
+	movieHttp.ConfigureRouter(r, movieHttp.NewHandlers(app.New(client), client, nil, nil, nil, nil, "", movieHttp.DefaultConfig()))
+
+	w := get(r, "/api/v2/movies/1", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the movie, got %d", w.Code)
+	}
+	for _, header := range []string{"ETag", "Last-Modified", "Cache-Control"} {
+		if value := w.Header().Get(header); value != "" {
+			t.Errorf("the uncached movie has %s %s", header, value)
+		}
+	}
+}
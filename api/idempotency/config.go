@@ -0,0 +1,79 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ConfigPath is where the playground docker-compose mounts its config directory
+const ConfigPath = "/config/idempotency.json"
+
+type Config struct {
+	// Enabled turns the middleware on, the Idempotency-Key header is ignored when false
+	Enabled bool `json:"enabled"`
+	// TTL is how long a response is replayed to retries with the same key, as a time.ParseDuration string
+	TTL string `json:"ttl"`
+	// PurgeInterval is how often expired keys are deleted, as a time.ParseDuration string
+	PurgeInterval string `json:"purge_interval"`
+	// MaxBodyBytes is the largest body of a request with a key, it is read whole to fingerprint the request
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+	// APIKeys are the X-API-Key values of known clients, whose keys are kept apart from each other's
+	// and, for requests with an X-User-ID, per user. Keys sent without an admin token or a known api key are kept per ip.
+	APIKeys []string `json:"api_keys"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled:       true,
+		TTL:           "24h",
+		PurgeInterval: "1h",
+		// room for an image of the default media max_upload_bytes in a multipart form
+		MaxBodyBytes: 11 << 20,
+	}
+}
+
+// LoadConfig reads the config file at path, DefaultConfig is returned when the file does not exist
+func LoadConfig(path string) (Config, error) {
+	bytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read idempotency config: %s", err.Error())
+	}
+
+	config := DefaultConfig()
+	err = json.Unmarshal(bytes, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse idempotency config: %s", err.Error())
+	}
+
+	_, _, err = config.settings()
+	return config, err
+}
+
+func (c Config) settings() (ttl time.Duration, interval time.Duration, err error) {
+	ttl, err = time.ParseDuration(c.TTL)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid idempotency ttl: %s", err.Error())
+	}
+	if ttl <= 0 {
+		return 0, 0, fmt.Errorf("idempotency ttl must be positive")
+	}
+
+	interval, err = time.ParseDuration(c.PurgeInterval)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid idempotency purge_interval: %s", err.Error())
+	}
+	if interval <= 0 {
+		return 0, 0, fmt.Errorf("idempotency purge_interval must be positive")
+	}
+
+	if c.MaxBodyBytes <= 0 {
+		return 0, 0, fmt.Errorf("idempotency max_body_bytes must be positive")
+	}
+
+	return ttl, interval, nil
+}
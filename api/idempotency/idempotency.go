@@ -0,0 +1,304 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"movie-rating-api/db"
+	"movie-rating-api/dto"
+	"movie-rating-api/models"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set to true on responses replayed from a previous request
+	ReplayedHeader = "Idempotent-Replayed"
+	// MaxKeyLength is the longest key accepted, a uuid is plenty
+	MaxKeyLength = 255
+
+	APIKeyHeader     = "X-API-Key"
+	UserHeader       = "X-User-ID"
+	AdminTokenHeader = "X-Admin-Token"
+)
+
+// Replayer makes POST and PATCH requests sent with an Idempotency-Key safe to retry
+type Replayer struct {
+	client   db.Client
+	enabled  bool
+	ttl      time.Duration
+	interval time.Duration
+	maxBody  int64
+	apiKeys  map[string]bool
+	now      func() time.Time
+
+	mu       sync.Mutex
+	purgedAt time.Time
+}
+
+func NewReplayer(client db.Client, config Config) (*Replayer, error) {
+	ttl, interval, err := config.settings()
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys := map[string]bool{}
+	for _, key := range config.APIKeys {
+		apiKeys[key] = true
+	}
+
+	return &Replayer{
+		client:   client,
+		enabled:  config.Enabled,
+		ttl:      ttl,
+		interval: interval,
+		maxBody:  config.MaxBodyBytes,
+		apiKeys:  apiKeys,
+		now:      time.Now,
+	}, nil
+}
+
+// Middleware runs the first POST or PATCH with an Idempotency-Key and stores its status, headers and body
+// for the key and caller, then replays them to retries until the key expires.
+// A retry with a different method, url or body is refused with a 422, one sent while the first is still
+// in progress with a 409. 5xx responses are not stored so the request can be retried, nor are 401, 403 and 429
+// so a request refused before it ran is not replayed once the caller may send it.
+func (p *Replayer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if !p.enabled || key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > MaxKeyLength {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("%s can be at most %d characters", Header, MaxKeyLength))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, p.maxBody))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("a request with an %s can be at most %d bytes", Header, p.maxBody))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "failed to read the request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := p.now()
+		p.purge(now)
+
+		claim := models.IdempotencyKeys{
+			Key:         key,
+			Caller:      p.caller(r),
+			Fingerprint: fingerprint(r, body),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(p.ttl),
+		}
+		stored, claimed, err := p.client.ClaimIdempotencyKey(claim)
+		if err != nil {
+			// running the request anyway could apply it twice, the client can retry once the store is back
+			log.Printf("failed to claim idempotency key %s: %s\n", key, err.Error())
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, "failed to check the idempotency key, retry later")
+			return
+		}
+
+		if !claimed {
+			switch {
+			case stored.Fingerprint != claim.Fingerprint:
+				writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("%s was already used for a different request", Header))
+			case stored.Status == 0:
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusConflict, fmt.Sprintf("a request with the %s is still in progress", Header))
+			default:
+				replay(w, stored)
+			}
+			return
+		}
+
+		recorder := newRecorder(w)
+		completed := false
+		defer func() {
+			// a panicking handler leaves nothing to replay
+			if !completed {
+				p.release(claim)
+			}
+		}()
+
+		next.ServeHTTP(recorder, r)
+
+		if !recorder.wroteHeader {
+			recorder.status = http.StatusOK
+		}
+		if !storable(recorder.status) {
+			return
+		}
+
+		headers, err := json.Marshal(recorder.header)
+		if err != nil {
+			log.Printf("failed to encode the headers of idempotency key %s: %s\n", key, err.Error())
+			return
+		}
+		completed = true
+
+		claim.Status = recorder.status
+		claim.Headers = string(headers)
+		claim.Body = recorder.body.Bytes()
+		err = p.client.CompleteIdempotencyKey(claim)
+		if err != nil {
+			// the claim stays in progress until it expires, retries get a 409 rather than a second write
+			log.Printf("failed to store the response of idempotency key %s: %s\n", key, err.Error())
+		}
+	})
+}
+
+// storable is whether a response is replayed to retries, those that say the request did not run yet are not
+func storable(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return false
+	}
+
+	return status < 500
+}
+
+func (p *Replayer) release(claim models.IdempotencyKeys) {
+	err := p.client.ReleaseIdempotencyKey(claim.Key, claim.Caller)
+	if err != nil {
+		log.Printf("failed to release idempotency key %s: %s\n", claim.Key, err.Error())
+	}
+}
+
+// purge deletes the expired keys in the background once every interval
+func (p *Replayer) purge(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if now.Sub(p.purgedAt) < p.interval {
+		return
+	}
+	p.purgedAt = now
+
+	go func() {
+		purged, err := p.client.PurgeIdempotencyKeys(now)
+		if err != nil {
+			log.Printf("failed to purge idempotency keys: %s\n", err.Error())
+		} else if purged != 0 {
+			log.Printf("purged %d expired idempotency keys\n", purged)
+		}
+	}()
+}
+
+// caller tells apart who sent a key so two clients can not replay each other's responses.
+// Anyone can send any header, so only an admin token, which is hashed so it is not stored, and the api keys
+// of the config are taken at their word, with the X-User-ID user of a request with a known api key.
+// Every other caller is told apart by ip.
+func (p *Replayer) caller(r *http.Request) string {
+	if token := r.Header.Get(AdminTokenHeader); token != "" {
+		hash := sha256.Sum256([]byte(token))
+		return "admin:" + hex.EncodeToString(hash[:])
+	}
+	if key := r.Header.Get(APIKeyHeader); key != "" && p.apiKeys[key] {
+		if user := r.Header.Get(UserHeader); user != "" {
+			return "key:" + key + "|user:" + user
+		}
+		return "key:" + key
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// fingerprint is a hash of what makes two requests the same one
+func fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	_, _ = hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	_, _ = hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, stored models.IdempotencyKeys) {
+	var header http.Header
+	err := json.Unmarshal([]byte(stored.Headers), &header)
+	if err != nil {
+		log.Printf("failed to decode the headers of idempotency key %s: %s\n", stored.Key, err.Error())
+	}
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(ReplayedHeader, "true")
+
+	w.WriteHeader(stored.Status)
+	_, err = w.Write(stored.Body)
+	if err != nil {
+		fmt.Println("failed to write replayed body:", err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(dto.NewErrorV2(status, message))
+	if err != nil {
+		fmt.Println("failed to write idempotency error body:", err.Error())
+	}
+}
+
+// recorder passes the response on while keeping a copy of it. The handler gets a header map of its own
+// so only the headers it set are stored, not those of the middlewares around it.
+type recorder struct {
+	w           http.ResponseWriter
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func newRecorder(w http.ResponseWriter) *recorder {
+	return &recorder{
+		w:      w,
+		header: http.Header{},
+	}
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.status = status
+
+	for name, values := range r.header {
+		r.w.Header()[name] = values
+	}
+	r.w.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+
+	r.body.Write(b)
+	return r.w.Write(b)
+}
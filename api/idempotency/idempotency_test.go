@@ -0,0 +1,175 @@
+package idempotency_test
+
+import (
+	"github.com/gorilla/mux"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	movieHttp "movie-rating-api/http"
+	"movie-rating-api/idempotency"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const webhook = `{"url": "https://example.com/hook", "events": ["*"]}`
+
+func newServer(t *testing.T, config idempotency.Config) (db.Client, *httptest.Server) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+
+	replayer, err := idempotency.NewReplayer(client, config)
+	if err != nil {
+		t.Fatalf("failed to create replayer: %s", err.Error())
+	}
+
+	r := mux.NewRouter()
+	r.Use(replayer.Middleware)
+	movieHttp.ConfigureRouter(r, movieHttp.NewHandlers(app.New(client), client, nil, nil, nil, nil, "token", movieHttp.DefaultConfig()))
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return client, server
+}
+
+func post(t *testing.T, server *httptest.Server, token string, key string, body string) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/admin/webhooks", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %s", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idempotency.Header, key)
+	if token != "" {
+		req.Header.Set(idempotency.AdminTokenHeader, token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to post: %s", err.Error())
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func subscriptions(t *testing.T, client db.Client) int {
+	subscriptions, err := client.GetWebhookSubscriptions()
+	if err != nil {
+		t.Fatalf("failed to get subscriptions: %s", err.Error())
+	}
+	return len(subscriptions)
+}
+
+func TestRefusedRequestsAreNotReplayed(t *testing.T) {
+	client, server := newServer(t, idempotency.DefaultConfig())
+
+	for _, token := range []string{"", "wrong"} {
+		resp := post(t, server, token, "key-1", webhook)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("expected 401 with token %q, got %d", token, resp.StatusCode)
+		}
+	}
+
+	// the admin gets the request run rather than someone else's 401
+	resp := post(t, server, "token", "key-1", webhook)
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get(idempotency.ReplayedHeader) != "" {
+		t.Fatalf("expected the request to run with a 201, got %d replayed %q", resp.StatusCode, resp.Header.Get(idempotency.ReplayedHeader))
+	}
+
+	resp = post(t, server, "token", "key-1", webhook)
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get(idempotency.ReplayedHeader) != "true" {
+		t.Fatalf("expected the 201 to be replayed, got %d replayed %q", resp.StatusCode, resp.Header.Get(idempotency.ReplayedHeader))
+	}
+	if count := subscriptions(t, client); count != 1 {
+		t.Fatalf("expected one subscription, got %d", count)
+	}
+
+	// a request refused once it was stored still gets its 401, not the admin's response
+	resp = post(t, server, "wrong", "key-1", webhook)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with the wrong token, got %d", resp.StatusCode)
+	}
+}
+
+func TestKeysAreKeptPerAdminToken(t *testing.T) {
+	client, server := newServer(t, idempotency.DefaultConfig())
+
+	resp := post(t, server, "token", "key-1", webhook)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+
+	// the same key from the same ip with another token is someone else's, and is refused before it runs
+	resp = post(t, server, "other", "key-1", webhook)
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get(idempotency.ReplayedHeader) != "" {
+		t.Fatalf("expected a 401 that was not replayed, got %d replayed %q", resp.StatusCode, resp.Header.Get(idempotency.ReplayedHeader))
+	}
+	if count := subscriptions(t, client); count != 1 {
+		t.Fatalf("expected one subscription, got %d", count)
+	}
+}
+
+func TestBodiesOverTheLimitAreRefused(t *testing.T) {
+	config := idempotency.DefaultConfig()
+	config.MaxBodyBytes = 64
+	client, server := newServer(t, config)
+
+	resp := post(t, server, "token", "key-1", webhook+strings.Repeat(" ", 64))
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", resp.StatusCode)
+	}
+	if count := subscriptions(t, client); count != 0 {
+		t.Fatalf("expected no subscription, got %d", count)
+	}
+
+	resp = post(t, server, "token", "key-2", webhook)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected a body within the limit to run, got %d", resp.StatusCode)
+	}
+}
+
+func logWatch(t *testing.T, server *httptest.Server, headers map[string]string, key string) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v2/me/diary", strings.NewReader(`{"movie_id": 1}`))
+	if err != nil {
+		t.Fatalf("failed to create request: %s", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idempotency.Header, key)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to post: %s", err.Error())
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestCallersCannotReplayEachOthersKeys(t *testing.T) {
+	config := idempotency.DefaultConfig()
+	config.APIKeys = []string{"frontend"}
+	_, server := newServer(t, config)
+
+	alice := map[string]string{idempotency.APIKeyHeader: "frontend", idempotency.UserHeader: "alice"}
+	resp := logWatch(t, server, alice, "key-1")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	resp = logWatch(t, server, alice, "key-1")
+	if resp.Header.Get(idempotency.ReplayedHeader) != "true" {
+		t.Fatalf("expected alice's retry to be replayed, got %d", resp.StatusCode)
+	}
+
+	for _, headers := range []map[string]string{
+		// another user of the same frontend
+		{idempotency.APIKeyHeader: "frontend", idempotency.UserHeader: "bob"},
+		// alice's user id with a made up api key is anyone's to send, so it is kept per ip
+		{idempotency.APIKeyHeader: "made-up", idempotency.UserHeader: "alice"},
+	} {
+		resp := logWatch(t, server, headers, "key-1")
+		if resp.Header.Get(idempotency.ReplayedHeader) != "" {
+			t.Fatalf("expected %v not to get alice's response replayed", headers)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package lists
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ConfigPath is where the playground docker-compose mounts its config directory
+const ConfigPath = "/config/lists.json"
+
+type Config struct {
+	Trending   Rule `json:"trending"`
+	Leaving    Rule `json:"leaving"`
+	ComingSoon Rule `json:"coming_soon"`
+}
+
+// Rule sets how the movies of a list are picked and ranked
+type Rule struct {
+	// Window is a time.ParseDuration string. Ratings and views are counted over the last Window,
+	// for coming soon it is how far ahead releases are listed.
+	Window string `json:"window"`
+	// Limit is how many movies the list returns when the request does not ask for fewer
+	Limit int `json:"limit"`
+	// RatingWeight is what each user rating in the window adds to the score, or takes away when leaving
+	RatingWeight float64 `json:"rating_weight"`
+	// ViewWeight is what each view in the window adds to the score, or takes away when leaving
+	ViewWeight float64 `json:"view_weight"`
+	// AverageRatingWeight is what an average critic rating of 100 adds to the score, or a rating of 0 when leaving
+	AverageRatingWeight float64 `json:"average_rating_weight"`
+	// MinAverageRating and MaxAverageRating leave out movies rated outside of them, a MaxAverageRating of 0 means no max
+	MinAverageRating int `json:"min_average_rating"`
+	MaxAverageRating int `json:"max_average_rating"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Trending: Rule{
+			Window:              "168h",
+			Limit:               10,
+			RatingWeight:        1,
+			ViewWeight:          0.1,
+			AverageRatingWeight: 1,
+		},
+		Leaving: Rule{
+			Window:              "720h",
+			Limit:               10,
+			RatingWeight:        1,
+			ViewWeight:          0.1,
+			AverageRatingWeight: 1,
+			MaxAverageRating:    70,
+		},
+		ComingSoon: Rule{
+			Window: "4320h",
+			Limit:  10,
+		},
+	}
+}
+
+// LoadConfig reads the config file at path, DefaultConfig is returned when the file does not exist
+func LoadConfig(path string) (Config, error) {
+	bytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read lists config: %s", err.Error())
+	}
+
+	config := DefaultConfig()
+	err = json.Unmarshal(bytes, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse lists config: %s", err.Error())
+	}
+
+	return config, config.Validate()
+}
+
+func (c Config) Validate() error {
+	for name, rule := range map[string]Rule{
+		Trending:   c.Trending,
+		Leaving:    c.Leaving,
+		ComingSoon: c.ComingSoon,
+	} {
+		if _, err := rule.window(); err != nil {
+			return fmt.Errorf("invalid %s window: %s", name, err.Error())
+		}
+		if rule.Limit <= 0 {
+			return fmt.Errorf("%s limit must be positive", name)
+		}
+	}
+
+	return nil
+}
+
+func (r Rule) window() (time.Duration, error) {
+	window, err := time.ParseDuration(r.Window)
+	if err != nil {
+		return 0, err
+	}
+	if window <= 0 {
+		return 0, fmt.Errorf("window must be positive")
+	}
+
+	return window, nil
+}
@@ -0,0 +1,282 @@
+package lists
+
+import (
+	"fmt"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/models"
+	"sort"
+	"time"
+)
+
+// The curated lists
+const (
+	Trending   = "trending"
+	Leaving    = "leaving"
+	ComingSoon = "coming-soon"
+)
+
+// The override actions
+const (
+	ActionPin     = "pin"
+	ActionExclude = "exclude"
+)
+
+// releasedLayout is how models.Movies.Released is written
+const releasedLayout = "02 Jan 2006"
+
+var (
+	ErrUnknownList   = fmt.Errorf("list must be one of %s, %s or %s", Trending, Leaving, ComingSoon)
+	ErrUnknownAction = fmt.Errorf("action must be %s or %s", ActionPin, ActionExclude)
+)
+
+type Entry struct {
+	Details app.MovieDetails
+	// Score orders the movies that are not pinned, higher first
+	Score float64
+	// Reasons say why the movie is in the list
+	Reasons []string
+	Pinned  bool
+}
+
+// Curator builds the curated lists from the catalogue, user activity and the overrides set by admins
+type Curator struct {
+	client db.Client
+	app    app.App
+	config Config
+}
+
+func NewCurator(client db.Client, a app.App, config Config) *Curator {
+	return &Curator{
+		client: client,
+		app:    a,
+		config: config,
+	}
+}
+
+func (c *Curator) rule(list string) (Rule, error) {
+	switch list {
+	case Trending:
+		return c.config.Trending, nil
+	case Leaving:
+		return c.config.Leaving, nil
+	case ComingSoon:
+		return c.config.ComingSoon, nil
+	default:
+		return Rule{}, ErrUnknownList
+	}
+}
+
+// List returns up to limit movies of the list, pinned movies first in the order they were pinned.
+// The rule's limit is used when limit is 0.
+func (c *Curator) List(list string, limit int, now time.Time) ([]Entry, error) {
+	rule, err := c.rule(list)
+	if err != nil {
+		return []Entry{}, err
+	}
+	window, err := rule.window()
+	if err != nil {
+		return []Entry{}, err
+	}
+	if limit <= 0 {
+		limit = rule.Limit
+	}
+
+	catalogue, err := c.app.GetMovieDetails(nil)
+	if err != nil {
+		return []Entry{}, err
+	}
+
+	overrides, err := c.client.GetListOverrides(list)
+	if err != nil {
+		return []Entry{}, err
+	}
+
+	var entries []Entry
+	switch list {
+	case ComingSoon:
+		entries = comingSoon(catalogue, window, now)
+	default:
+		ratings, views, err := c.activity(now.Add(-window))
+		if err != nil {
+			return []Entry{}, err
+		}
+		entries = ranked(list, rule, catalogue, ratings, views, window)
+	}
+
+	return applyOverrides(entries, catalogue, overrides, limit), nil
+}
+
+// activity counts the user ratings and views of every movie since the time
+func (c *Curator) activity(since time.Time) (map[int]int, map[int]int, error) {
+	userRatings, err := c.client.GetUserRatings("")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ratings := map[int]int{}
+	for _, rating := range userRatings {
+		if !rating.UpdatedAt.Before(since) {
+			ratings[rating.MovieID]++
+		}
+	}
+
+	movieViews, err := c.client.GetMovieViews(since)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	views := map[int]int{}
+	for _, v := range movieViews {
+		views[v.MovieID] += v.Views
+	}
+
+	return ratings, views, nil
+}
+
+// ranked scores every movie for trending or leaving, trending rewards activity and high ratings
+// while leaving rewards the lack of both
+func ranked(list string, rule Rule, catalogue []app.MovieDetails, ratings map[int]int, views map[int]int, window time.Duration) []Entry {
+	days := fmt.Sprintf("%d days", int(window.Hours()/24))
+
+	var entries []Entry
+	for _, details := range catalogue {
+		average := details.AverageRating
+		if average < rule.MinAverageRating || (rule.MaxAverageRating > 0 && average > rule.MaxAverageRating) {
+			continue
+		}
+
+		id := details.Movie.ID
+		activity := rule.RatingWeight*float64(ratings[id]) + rule.ViewWeight*float64(views[id])
+
+		var score float64
+		var reasons []string
+		if list == Trending {
+			score = activity + rule.AverageRatingWeight*float64(average)/100
+			if ratings[id] != 0 {
+				reasons = append(reasons, fmt.Sprintf("%d user ratings in the last %s", ratings[id], days))
+			}
+			if views[id] != 0 {
+				reasons = append(reasons, fmt.Sprintf("%d views in the last %s", views[id], days))
+			}
+			reasons = append(reasons, fmt.Sprintf("average rating of %d", average))
+		} else {
+			score = rule.AverageRatingWeight*float64(100-average)/100 - activity
+			reasons = append(reasons, fmt.Sprintf("average rating of %d", average))
+			if ratings[id] == 0 && views[id] == 0 {
+				reasons = append(reasons, fmt.Sprintf("no user ratings or views in the last %s", days))
+			} else {
+				reasons = append(reasons, fmt.Sprintf("only %d user ratings and %d views in the last %s", ratings[id], views[id], days))
+			}
+		}
+
+		entries = append(entries, Entry{Details: details, Score: score, Reasons: reasons})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Score > entries[j].Score
+	})
+
+	return entries
+}
+
+// comingSoon lists the movies released after now and within the window, soonest first
+func comingSoon(catalogue []app.MovieDetails, window time.Duration, now time.Time) []Entry {
+	var entries []Entry
+	for _, details := range catalogue {
+		released, err := time.Parse(releasedLayout, details.Movie.Released)
+		if err != nil || !released.After(now) || released.After(now.Add(window)) {
+			continue
+		}
+
+		days := int(released.Sub(now).Hours()/24) + 1
+		entries = append(entries, Entry{
+			Details: details,
+			Score:   -released.Sub(now).Hours(),
+			Reasons: []string{fmt.Sprintf("released on %s, in %d days", details.Movie.Released, days)},
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Score > entries[j].Score
+	})
+
+	return entries
+}
+
+func applyOverrides(entries []Entry, catalogue []app.MovieDetails, overrides []models.ListOverrides, limit int) []Entry {
+	byID := map[int]app.MovieDetails{}
+	for _, details := range catalogue {
+		byID[details.Movie.ID] = details
+	}
+
+	skip := map[int]bool{}
+	result := []Entry{}
+	for _, override := range overrides {
+		skip[override.MovieID] = true
+
+		details, ok := byID[override.MovieID]
+		if override.Action != ActionPin || !ok {
+			continue
+		}
+
+		reason := "pinned by an editor"
+		if override.Reason != "" {
+			reason = fmt.Sprintf("%s: %s", reason, override.Reason)
+		}
+		result = append(result, Entry{Details: details, Reasons: []string{reason}, Pinned: true})
+	}
+
+	for _, entry := range entries {
+		if !skip[entry.Details.Movie.ID] {
+			result = append(result, entry)
+		}
+	}
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result
+}
+
+// Overrides returns the pins and exclusions of the list
+func (c *Curator) Overrides(list string) ([]models.ListOverrides, error) {
+	if _, err := c.rule(list); err != nil {
+		return []models.ListOverrides{}, err
+	}
+
+	return c.client.GetListOverrides(list)
+}
+
+// SetOverride pins the movie to the list or excludes it. ok is false when there is no movie with the id.
+func (c *Curator) SetOverride(list string, movieID int, action string, reason string, now time.Time) (bool, error) {
+	if _, err := c.rule(list); err != nil {
+		return false, err
+	}
+	if action != ActionPin && action != ActionExclude {
+		return false, ErrUnknownAction
+	}
+
+	_, ok, err := c.client.GetMovie(movieID)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return true, c.client.SaveListOverride(models.ListOverrides{
+		List:      list,
+		MovieID:   movieID,
+		Action:    action,
+		Reason:    reason,
+		CreatedAt: now,
+	})
+}
+
+// RemoveOverride puts the movie back to where its score ranks it. ok is false when it had no override.
+func (c *Curator) RemoveOverride(list string, movieID int) (bool, error) {
+	if _, err := c.rule(list); err != nil {
+		return false, err
+	}
+
+	return c.client.DeleteListOverride(list, movieID)
+}
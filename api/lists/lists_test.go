@@ -0,0 +1,185 @@
+package lists
+
+import (
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"movie-rating-api/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func details(id int, average int, released string) app.MovieDetails {
+	return app.MovieDetails{Movie: models.Movies{ID: id, Released: released}, AverageRating: average}
+}
+
+func entryIDs(entries []Entry) []int {
+	ids := []int{}
+	for _, entry := range entries {
+		ids = append(ids, entry.Details.Movie.ID)
+	}
+	return ids
+}
+
+func TestRanked(t *testing.T) {
+	catalogue := []app.MovieDetails{details(1, 90, ""), details(2, 40, ""), details(3, 60, ""), details(4, 80, "")}
+	// movie 2 is rated and viewed a lot, movie 4 a little
+	ratings := map[int]int{2: 3, 4: 1}
+	views := map[int]int{2: 20, 4: 5}
+	config := DefaultConfig()
+
+	for _, test := range []struct {
+		name string
+		list string
+		rule Rule
+		ids  []int
+	}{
+		// 2 scores 3 + 2 + 0.4, 4 scores 1 + 0.5 + 0.8, 1 scores 0.9 and 3 scores 0.6
+		{"trending", Trending, config.Trending, []int{2, 4, 1, 3}},
+		{"trending with a minimum rating", Trending, Rule{RatingWeight: 1, ViewWeight: 0.1, AverageRatingWeight: 1, MinAverageRating: 70}, []int{4, 1}},
+		// 3 scores 0.4 and 2 scores 0.6 - 5, 1 and 4 are rated above the max
+		{"leaving", Leaving, config.Leaving, []int{3, 2}},
+		{"leaving without a max", Leaving, Rule{RatingWeight: 1, ViewWeight: 0.1, AverageRatingWeight: 1}, []int{3, 1, 4, 2}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			entries := ranked(test.list, test.rule, catalogue, ratings, views, 7*24*time.Hour)
+			if ids := entryIDs(entries); !reflect.DeepEqual(ids, test.ids) {
+				t.Fatalf("expected %v, got %v", test.ids, ids)
+			}
+		})
+	}
+
+	trending := ranked(Trending, config.Trending, catalogue, ratings, views, 7*24*time.Hour)
+	expected := []string{"3 user ratings in the last 7 days", "20 views in the last 7 days", "average rating of 40"}
+	if !reflect.DeepEqual(trending[0].Reasons, expected) {
+		t.Fatalf("expected the reasons of the trending movie, got %v", trending[0].Reasons)
+	}
+	leaving := ranked(Leaving, config.Leaving, catalogue, ratings, views, 30*24*time.Hour)
+	expected = []string{"average rating of 60", "no user ratings or views in the last 30 days"}
+	if !reflect.DeepEqual(leaving[0].Reasons, expected) {
+		t.Fatalf("expected the reasons of the leaving movie, got %v", leaving[0].Reasons)
+	}
+}
+
+func TestComingSoon(t *testing.T) {
+	catalogue := []app.MovieDetails{
+		details(1, 0, "15 Mar 2026"),
+		details(2, 0, "02 Mar 2026"),
+		// released already
+		details(3, 0, "01 Feb 2026"),
+		// further ahead than the window
+		details(4, 0, "01 Mar 2027"),
+		details(5, 0, "N/A"),
+		details(6, 0, ""),
+		details(7, 0, "2026-03-10"),
+		details(8, 0, "31 Feb 2026"),
+	}
+
+	entries := comingSoon(catalogue, 90*24*time.Hour, now)
+	if ids := entryIDs(entries); !reflect.DeepEqual(ids, []int{2, 1}) {
+		t.Fatalf("expected the releases in the window soonest first, got %v", ids)
+	}
+	if reason := entries[0].Reasons[0]; reason != "released on 02 Mar 2026, in 1 days" {
+		t.Fatalf("expected the release date in the reason, got %q", reason)
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	catalogue := []app.MovieDetails{details(1, 90, ""), details(2, 80, ""), details(3, 70, ""), details(4, 60, "")}
+	entries := []Entry{{Details: catalogue[0]}, {Details: catalogue[1]}, {Details: catalogue[2]}, {Details: catalogue[3]}}
+
+	for _, test := range []struct {
+		name      string
+		overrides []models.ListOverrides
+		limit     int
+		ids       []int
+	}{
+		{"no overrides", nil, 10, []int{1, 2, 3, 4}},
+		{"limited", nil, 2, []int{1, 2}},
+		{
+			name:      "pins first in the order they were pinned",
+			overrides: []models.ListOverrides{{MovieID: 4, Action: ActionPin}, {MovieID: 3, Action: ActionPin}},
+			limit:     10,
+			ids:       []int{4, 3, 1, 2},
+		},
+		{
+			name:      "excluded",
+			overrides: []models.ListOverrides{{MovieID: 1, Action: ActionExclude}},
+			limit:     10,
+			ids:       []int{2, 3, 4},
+		},
+		{
+			name:      "pins count towards the limit",
+			overrides: []models.ListOverrides{{MovieID: 4, Action: ActionPin}, {MovieID: 2, Action: ActionExclude}},
+			limit:     2,
+			ids:       []int{4, 1},
+		},
+		{
+			name:      "a pinned movie that is gone",
+			overrides: []models.ListOverrides{{MovieID: 99, Action: ActionPin}},
+			limit:     10,
+			ids:       []int{1, 2, 3, 4},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			result := applyOverrides(entries, catalogue, test.overrides, test.limit)
+			if ids := entryIDs(result); !reflect.DeepEqual(ids, test.ids) {
+				t.Fatalf("expected %v, got %v", test.ids, ids)
+			}
+		})
+	}
+}
+
+func TestSetOverride(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	curator := NewCurator(client, app.New(client), DefaultConfig())
+
+	ok, err := curator.SetOverride(Trending, 2, ActionPin, "staff pick", now)
+	if err != nil || !ok {
+		t.Fatalf("failed to pin movie: %v", err)
+	}
+	ok, err = curator.SetOverride(Trending, 1, ActionExclude, "", now)
+	if err != nil || !ok {
+		t.Fatalf("failed to exclude movie: %v", err)
+	}
+	// a single movie is looked up rather than the whole catalogue
+	if calls := db.FakeCallCount(client, db.MethodGetMovies); calls != 0 {
+		t.Fatalf("expected no full scan of the movies, got %d", calls)
+	}
+
+	entries, err := curator.List(Trending, 0, now)
+	if err != nil {
+		t.Fatalf("failed to list: %s", err.Error())
+	}
+	if entries[0].Details.Movie.ID != 2 || !entries[0].Pinned || entries[0].Reasons[0] != "pinned by an editor: staff pick" {
+		t.Fatalf("expected the pinned movie first, got %+v", entries[0])
+	}
+	for _, entry := range entries {
+		if entry.Details.Movie.ID == 1 {
+			t.Fatalf("expected the excluded movie to be left out")
+		}
+	}
+
+	ok, err = curator.SetOverride(Trending, 999, ActionPin, "", now)
+	if err != nil || ok {
+		t.Fatalf("expected no movie to pin, got %t %v", ok, err)
+	}
+	if _, err = curator.SetOverride("popular", 2, ActionPin, "", now); err != ErrUnknownList {
+		t.Fatalf("expected an unknown list to be refused, got %v", err)
+	}
+	if _, err = curator.SetOverride(Trending, 2, "promote", "", now); err != ErrUnknownAction {
+		t.Fatalf("expected an unknown action to be refused, got %v", err)
+	}
+
+	ok, err = curator.RemoveOverride(Trending, 1)
+	if err != nil || !ok {
+		t.Fatalf("failed to remove override: %v", err)
+	}
+	overrides, err := curator.Overrides(Trending)
+	if err != nil || len(overrides) != 1 || overrides[0].MovieID != 2 {
+		t.Fatalf("expected the pin to be left, got %v %v", overrides, err)
+	}
+}
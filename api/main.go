@@ -1,22 +1,35 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"github.com/gorilla/mux"
 	"log"
 	dbg "runtime/debug"
 
-	"github.com/gorilla/handlers"
-	"github.com/rs/cors"
+	"movie-rating-api/app"
+	"movie-rating-api/batch"
 	"movie-rating-api/db"
 	movieHttp "movie-rating-api/http"
+	"movie-rating-api/httpcache"
+	"movie-rating-api/idempotency"
+	"movie-rating-api/lists"
+	"movie-rating-api/media"
+	"movie-rating-api/openapi"
+	"movie-rating-api/outbox"
+	"movie-rating-api/ratelimit"
+	"movie-rating-api/recommend"
+	"movie-rating-api/rpc"
+	"movie-rating-api/stream"
+	"movie-rating-api/trash"
+	"movie-rating-api/webhook"
 
 	"net/http"
+	"os"
 	"time"
 )
 
-var r = mux.NewRouter()
-
 func main() {
 	defer func() {
 		if err := recover(); err != nil {
@@ -27,36 +40,161 @@ func main() {
 		}
 	}()
 
-	// giving time for postgres db to start up
-	time.Sleep(5 * time.Second)
+	dbKind := flag.String("db", "postgres", "postgres, or fake for an in memory db seeded with the same movies")
+	fakeDBConfig := flag.String("fake-db-config", "", "json file with the latency and failures of the fake db")
+	recommendInterval := flag.Duration("recommend-interval", time.Minute, "how often recommendations are recomputed for users with new ratings")
+	recommendRefresh := flag.Duration("recommend-refresh", time.Hour, "how often recommendations are recomputed for every user")
+	replicaPollInterval := flag.Duration("replica-poll-interval", 5*time.Second, "how often other replicas' writes are polled for when the db has no LISTEN/NOTIFY")
+	flag.Parse()
+
 	log.Print("******* MOVIE RATING API *******")
 
 	const port = "8080"
+	const grpcPort = "9090"
+	const recommendationsPerUser = 50
+
+	var client db.Client
+	var connString string
+	var err error
+	switch *dbKind {
+	case "fake":
+		var config db.FakeConfig
+		if *fakeDBConfig != "" {
+			config, err = db.LoadFakeConfig(*fakeDBConfig)
+			if err != nil {
+				log.Fatalln(fmt.Sprintf("failed to load fake db config: %s\n", err.Error()))
+			}
+		}
+
+		client, err = db.NewFakeClient(config)
+		if err != nil {
+			log.Fatalln(fmt.Sprintf("failed to create fake db: %s\n", err.Error()))
+		}
+		log.Print("using the fake in memory db")
+	case "postgres":
+		// giving time for postgres db to start up
+		time.Sleep(5 * time.Second)
+
+		gormDB, err := db.InitializeDB()
+		if err != nil {
+			log.Fatalln(fmt.Sprintf("failed to initialize db: %s\n", err.Error()))
+		}
+
+		client = db.NewDBCLient(gormDB)
+
+		_, connString, err = db.ConnectionInfoFromEnvironment()
+		if err != nil {
+			log.Fatalln(fmt.Sprintf("failed to get the db connection string: %s\n", err.Error()))
+		}
 
-	err := db.InitializeDB()
+		err = db.InitializeMovies(client)
+		if err != nil {
+			log.Fatalln(fmt.Sprintf("failed to initialize movies: %s\n", err.Error()))
+		}
+	default:
+		log.Fatalf("unknown db %q\n", *dbKind)
+	}
+
+	httpConfig, err := movieHttp.LoadConfig(movieHttp.ConfigPath)
 	if err != nil {
-		log.Fatalln(fmt.Sprintf("failed to initialize db: %s\n", err.Error()))
+		log.Fatalln(fmt.Sprintf("failed to load http config: %s\n", err.Error()))
 	}
 
-	client := db.NewDBCLient(nil)
+	rateLimitConfig, err := ratelimit.LoadConfig(ratelimit.ConfigPath)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("failed to load rate limit config: %s\n", err.Error()))
+	}
 
-	err = db.InitializeMovies(client)
+	httpCacheConfig, err := httpcache.LoadConfig(httpcache.ConfigPath)
 	if err != nil {
-		log.Fatalln(fmt.Sprintf("failed to initialize movies: %s\n", err.Error()))
+		log.Fatalln(fmt.Sprintf("failed to load http cache config: %s\n", err.Error()))
 	}
 
-	movieHttp.ConfigureRouter(r)
+	listsConfig, err := lists.LoadConfig(lists.ConfigPath)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("failed to load lists config: %s\n", err.Error()))
+	}
 
-	log.Printf("starting api on port %s\n", port)
+	webhooksConfig, err := webhook.LoadConfig(webhook.ConfigPath)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("failed to load webhooks config: %s\n", err.Error()))
+	}
+
+	dispatcher, err := webhook.NewDispatcher(client, webhooksConfig)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("failed to create webhook dispatcher: %s\n", err.Error()))
+	}
+
+	outboxConfig, err := outbox.LoadConfig(outbox.ConfigPath)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("failed to load outbox config: %s\n", err.Error()))
+	}
+
+	relay, err := outbox.NewRelay(client, outboxConfig)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("failed to create outbox relay: %s\n", err.Error()))
+	}
 
-	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowCredentials: true,
-		AllowedMethods:   []string{"GET", "DELETE", "POST", "PUT"},
-	})
+	trashConfig, err := trash.LoadConfig(trash.ConfigPath)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("failed to load trash config: %s\n", err.Error()))
+	}
+
+	purger, err := trash.NewJob(client, trashConfig)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("failed to create trash purge job: %s\n", err.Error()))
+	}
 
-	corsObj := handlers.AllowedOrigins([]string{"*"})
-	handler := c.Handler(handlers.CORS(corsObj)(r))
+	streamConfig, err := stream.LoadConfig(stream.ConfigPath)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("failed to load stream config: %s\n", err.Error()))
+	}
+
+	batchConfig, err := batch.LoadConfig(batch.ConfigPath)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("failed to load batch config: %s\n", err.Error()))
+	}
+
+	idempotencyConfig, err := idempotency.LoadConfig(idempotency.ConfigPath)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("failed to load idempotency config: %s\n", err.Error()))
+	}
+
+	mediaConfig, err := media.LoadConfig(media.ConfigPath)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("failed to load media config: %s\n", err.Error()))
+	}
+
+	handler, err := newHandler(client, httpConfig, rateLimitConfig, httpCacheConfig, idempotencyConfig, listsConfig, streamConfig, batchConfig, mediaConfig, os.Getenv("ADMIN_TOKEN"))
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("failed to create handler: %s\n", err.Error()))
+	}
+
+	rpcBroker, err := stream.NewBroker(client, streamConfig)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("failed to create grpc stream broker: %s\n", err.Error()))
+	}
+
+	go func() {
+		log.Printf("starting grpc api on port %s\n", grpcPort)
+		err := rpc.ListenAndServe(grpcPort, app.New(client), rpcBroker)
+		if err != nil {
+			log.Printf("failed to serve grpc api with err: %s\n", err.Error())
+		}
+	}()
+
+	go func() {
+		err := client.WatchReplicas(context.Background(), connString, *replicaPollInterval)
+		if err != nil {
+			log.Printf("failed to watch for other replicas' writes: %s\n", err.Error())
+		}
+	}()
+	go relay.Run(context.Background())
+	go dispatcher.Run(context.Background())
+	go purger.Run(context.Background())
+	go recommend.NewJob(client, app.New(client), *recommendInterval, *recommendRefresh, recommendationsPerUser).Run(context.Background())
+
+	log.Printf("starting api on port %s\n", port)
 
 	// start http server
 	err = http.ListenAndServe(fmt.Sprintf(":%s", port), handler)
@@ -64,3 +202,49 @@ func main() {
 		fmt.Printf("failed to listen and service with err: %s\n", err.Error())
 	}
 }
+
+// newHandler wires every layer of the http api around the client.
+// Nothing is shared between handlers so several isolated apis can run in one process.
+func newHandler(client db.Client, httpConfig movieHttp.Config, rateLimitConfig ratelimit.Config, httpCacheConfig httpcache.Config, idempotencyConfig idempotency.Config, listsConfig lists.Config, streamConfig stream.Config, batchConfig batch.Config, mediaConfig media.Config, adminToken string) (http.Handler, error) {
+	r := mux.NewRouter()
+
+	rateLimitStore := ratelimit.NewMemoryStore()
+	if rateLimitConfig.Store == ratelimit.StorePostgres {
+		rateLimitStore = ratelimit.NewDBStore(client)
+	}
+	r.Use(ratelimit.NewLimiter(rateLimitConfig, rateLimitStore).Middleware)
+	// views are counted before the cache so the reads it answers with a 304 count too
+	r.Use(movieHttp.RecordViews(client))
+	r.Use(httpcache.NewCache(httpCacheConfig, client.CatalogueVersion).Middleware)
+
+	replayer, err := idempotency.NewReplayer(client, idempotencyConfig)
+	if err != nil {
+		return nil, err
+	}
+	// after the rate limiter so retries count against the limit
+	r.Use(replayer.Middleware)
+
+	broker, err := stream.NewBroker(client, streamConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	storage, err := media.NewStorage(mediaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	a := app.New(client)
+	movieHttp.ConfigureRouter(r, movieHttp.NewHandlers(a, client, lists.NewCurator(client, a, listsConfig), broker,
+		batch.NewProcessor(client, a, batchConfig), media.NewLibrary(client, storage, mediaConfig), adminToken, httpConfig))
+
+	mismatches, err := openapi.Verify(r, openapi.Spec())
+	if err != nil {
+		log.Printf("failed to verify openapi spec: %s\n", err.Error())
+	}
+	for _, mismatch := range mismatches {
+		log.Printf("openapi spec out of sync: %s\n", mismatch)
+	}
+
+	return movieHttp.CORS(httpConfig)(r), nil
+}
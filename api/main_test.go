@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"movie-rating-api/batch"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	movieHttp "movie-rating-api/http"
+	"movie-rating-api/httpcache"
+	"movie-rating-api/idempotency"
+	"movie-rating-api/lists"
+	"movie-rating-api/media"
+	"movie-rating-api/ratelimit"
+	"movie-rating-api/stream"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newServer runs a whole api on its own fake db, as main does but without package state
+func newServer(t *testing.T) *httptest.Server {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+
+	mediaConfig := media.DefaultConfig()
+	mediaConfig.Dir = t.TempDir()
+
+	handler, err := newHandler(client, movieHttp.DefaultConfig(), ratelimit.DefaultConfig(), httpcache.DefaultConfig(), idempotency.DefaultConfig(),
+		lists.DefaultConfig(), stream.DefaultConfig(), batch.DefaultConfig(), mediaConfig, "token")
+	if err != nil {
+		t.Fatalf("failed to create handler: %s", err.Error())
+	}
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func movieTitle(t *testing.T, server *httptest.Server, id string) string {
+	resp, err := http.Get(server.URL + "/api/v2/movies/" + id)
+	if err != nil {
+		t.Fatalf("failed to get movie: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 getting movie %s, got %d", id, resp.StatusCode)
+	}
+
+	var movie struct {
+		Title string `json:"title"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&movie)
+	if err != nil {
+		t.Fatalf("failed to decode movie: %s", err.Error())
+	}
+	return movie.Title
+}
+
+func TestServersInOneProcessAreIsolated(t *testing.T) {
+	first, second := newServer(t), newServer(t)
+
+	original := movieTitle(t, second, "1")
+
+	req, err := http.NewRequest(http.MethodPatch, first.URL+"/api/admin/movies/1", strings.NewReader(`{"title":"Renamed"}`))
+	if err != nil {
+		t.Fatalf("failed to create request: %s", err.Error())
+	}
+	req.Header.Set("X-Admin-Token", "token")
+	req.Header.Set("If-Match", "*")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to patch movie: %s", err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 patching movie, got %d", resp.StatusCode)
+	}
+
+	if title := movieTitle(t, first, "1"); title != "Renamed" {
+		t.Fatalf("expected the first server to see the new title, got %q", title)
+	}
+	if title := movieTitle(t, second, "1"); title != original {
+		t.Fatalf("expected the second server to keep %q, got %q", original, title)
+	}
+}
@@ -0,0 +1,97 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ConfigPath is where the playground docker-compose mounts its config directory
+const ConfigPath = "/config/media.json"
+
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+type Config struct {
+	// Backend is where images are stored, BackendLocal or BackendS3
+	Backend string `json:"backend"`
+	// Dir is the directory of the local backend
+	Dir string   `json:"dir"`
+	S3  S3Config `json:"s3"`
+	// MaxUploadBytes is the largest image that can be uploaded
+	MaxUploadBytes int64 `json:"max_upload_bytes"`
+	// ThumbnailWidths are the widths thumbnails are made at, images are never scaled up
+	ThumbnailWidths []int `json:"thumbnail_widths"`
+}
+
+type S3Config struct {
+	// Endpoint is the url of the S3 compatible service, such as https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Endpoint string `json:"endpoint"`
+	Region   string `json:"region"`
+	Bucket   string `json:"bucket"`
+	// PathStyle puts the bucket in the path rather than in the host, which MinIO and most stand-ins need
+	PathStyle bool `json:"path_style"`
+	// AccessKeyID and SecretAccessKey default to the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	// CreateBucket creates the bucket at startup when it does not exist
+	CreateBucket bool `json:"create_bucket"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Backend:         BackendLocal,
+		Dir:             filepath.Join(os.TempDir(), "movie-rating-media"),
+		S3:              S3Config{Region: "us-east-1"},
+		MaxUploadBytes:  10 << 20,
+		ThumbnailWidths: []int{92, 185, 342},
+	}
+}
+
+// LoadConfig reads the config file at path, DefaultConfig is returned when the file does not exist
+func LoadConfig(path string) (Config, error) {
+	bytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read media config: %s", err.Error())
+	}
+
+	config := DefaultConfig()
+	err = json.Unmarshal(bytes, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse media config: %s", err.Error())
+	}
+
+	return config, config.Validate()
+}
+
+func (c Config) Validate() error {
+	switch c.Backend {
+	case BackendLocal:
+		if c.Dir == "" {
+			return fmt.Errorf("the local media backend needs a dir")
+		}
+	case BackendS3:
+		if c.S3.Endpoint == "" || c.S3.Region == "" || c.S3.Bucket == "" {
+			return fmt.Errorf("the s3 media backend needs an endpoint, a region and a bucket")
+		}
+	default:
+		return fmt.Errorf("unknown media backend %q", c.Backend)
+	}
+
+	if c.MaxUploadBytes <= 0 {
+		return fmt.Errorf("media max_upload_bytes must be positive")
+	}
+	for _, width := range c.ThumbnailWidths {
+		if width <= 0 {
+			return fmt.Errorf("media thumbnail widths must be positive, got %d", width)
+		}
+	}
+
+	return nil
+}
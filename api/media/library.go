@@ -0,0 +1,256 @@
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"movie-rating-api/db"
+	"movie-rating-api/models"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VariantOriginal is the uploaded image, thumbnails are w<width>
+const VariantOriginal = "original"
+
+var (
+	ErrUnknownKind = fmt.Errorf("kind must be %s or %s", db.ImagePoster, db.ImageStill)
+	ErrTooLarge    = errors.New("the image is too large")
+	ErrNotFound    = errors.New("image not found")
+)
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Image is an asset as one of a movie's images
+type Image struct {
+	Kind  string
+	Asset models.MediaAssets
+}
+
+// Library stores uploaded images once per content with their thumbnails, and links them to movies
+type Library struct {
+	client         db.Client
+	storage        Storage
+	widths         []int
+	maxUploadBytes int64
+}
+
+func NewLibrary(client db.Client, storage Storage, config Config) *Library {
+	widths := append([]int{}, config.ThumbnailWidths...)
+	sort.Ints(widths)
+
+	return &Library{
+		client:         client,
+		storage:        storage,
+		widths:         widths,
+		maxUploadBytes: config.MaxUploadBytes,
+	}
+}
+
+// MaxUploadBytes is the largest image Upload takes
+func (l *Library) MaxUploadBytes() int64 {
+	return l.maxUploadBytes
+}
+
+// Upload adds the image to the movie as its poster or as a still. An image with the same content that was uploaded before,
+// for this movie or another, is not stored or resized again. created is false when the movie already had the image
+// as that kind, ok is false when there is no movie with the id.
+func (l *Library) Upload(movieID int, kind string, data []byte) (image Image, created bool, ok bool, err error) {
+	if kind != db.ImagePoster && kind != db.ImageStill {
+		return Image{}, false, false, ErrUnknownKind
+	}
+	if int64(len(data)) > l.maxUploadBytes {
+		return Image{}, false, false, fmt.Errorf("%w, the most is %d bytes", ErrTooLarge, l.maxUploadBytes)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	assets, err := l.client.GetMediaAssets([]string{hash})
+	if err != nil {
+		return Image{}, false, false, err
+	}
+	asset, stored := assets[hash]
+	if !stored {
+		asset, err = l.store(hash, data)
+		if err != nil {
+			return Image{}, false, false, err
+		}
+	}
+
+	created, ok, err = l.client.AddMovieImage(models.MovieImages{MovieID: movieID, AssetHash: hash, Kind: kind}, time.Now())
+	if err != nil || !ok {
+		return Image{}, false, ok, err
+	}
+
+	return Image{Kind: kind, Asset: asset}, created, true, nil
+}
+
+// store writes the image and its thumbnails to the storage and records the asset.
+// Objects already in the storage are kept, so an upload that failed half way picks up where it stopped.
+func (l *Library) store(hash string, data []byte) (models.MediaAssets, error) {
+	img, contentType, err := decode(data)
+	if err != nil {
+		return models.MediaAssets{}, err
+	}
+	bounds := img.Bounds()
+
+	asset := models.MediaAssets{
+		Hash:        hash,
+		ContentType: contentType,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		Size:        int64(len(data)),
+		CreatedAt:   time.Now(),
+	}
+
+	err = l.put(Key(hash, VariantOriginal), data, contentType)
+	if err != nil {
+		return models.MediaAssets{}, err
+	}
+
+	var widths []string
+	for _, width := range l.widths {
+		if width >= asset.Width {
+			continue
+		}
+
+		key := Key(hash, ThumbnailVariant(width))
+		exists, err := l.storage.Exists(key)
+		if err != nil {
+			return models.MediaAssets{}, fmt.Errorf("failed to check media storage: %s", err.Error())
+		}
+		if !exists {
+			thumbnail, err := encode(resize(img, width), thumbnailType(contentType))
+			if err != nil {
+				return models.MediaAssets{}, fmt.Errorf("failed to make %dpx thumbnail: %s", width, err.Error())
+			}
+			err = l.storage.Put(key, thumbnail, thumbnailType(contentType))
+			if err != nil {
+				return models.MediaAssets{}, fmt.Errorf("failed to store %s: %s", key, err.Error())
+			}
+		}
+		widths = append(widths, strconv.Itoa(width))
+	}
+	asset.Thumbnails = strings.Join(widths, ",")
+
+	err = l.client.SaveMediaAsset(asset)
+	if err != nil {
+		return models.MediaAssets{}, err
+	}
+	return asset, nil
+}
+
+// put stores the object unless the storage already has it
+func (l *Library) put(key string, body []byte, contentType string) error {
+	exists, err := l.storage.Exists(key)
+	if err != nil {
+		return fmt.Errorf("failed to check media storage: %s", err.Error())
+	}
+	if exists {
+		return nil
+	}
+
+	err = l.storage.Put(key, body, contentType)
+	if err != nil {
+		return fmt.Errorf("failed to store %s: %s", key, err.Error())
+	}
+	return nil
+}
+
+// Images returns the images of the movie, its poster first and then its stills, oldest first
+func (l *Library) Images(movieID int) ([]Image, error) {
+	movieImages, err := l.client.GetMovieImages(movieID)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []string
+	for _, movieImage := range movieImages {
+		hashes = append(hashes, movieImage.AssetHash)
+	}
+	assets, err := l.client.GetMediaAssets(hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	images := []Image{}
+	for _, movieImage := range movieImages {
+		images = append(images, Image{Kind: movieImage.Kind, Asset: assets[movieImage.AssetHash]})
+	}
+	return images, nil
+}
+
+// Open returns the variant of the asset with the hash and its content type, ErrNotFound when there is no such image
+func (l *Library) Open(hash string, variant string) (io.ReadCloser, string, error) {
+	if !hashPattern.MatchString(hash) {
+		return nil, "", ErrNotFound
+	}
+
+	assets, err := l.client.GetMediaAssets([]string{hash})
+	if err != nil {
+		return nil, "", err
+	}
+	asset, ok := assets[hash]
+	if !ok {
+		return nil, "", ErrNotFound
+	}
+
+	contentType := asset.ContentType
+	if variant != VariantOriginal {
+		found := false
+		for _, width := range Thumbnails(asset) {
+			found = found || variant == ThumbnailVariant(width)
+		}
+		if !found {
+			return nil, "", ErrNotFound
+		}
+		contentType = thumbnailType(asset.ContentType)
+	}
+
+	body, err := l.storage.Get(Key(hash, variant))
+	if errors.Is(err, ErrNotExist) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, contentType, nil
+}
+
+// Key is the storage key of a variant of an asset
+func Key(hash string, variant string) string {
+	return hash + "/" + variant
+}
+
+// Path is where the api serves a variant of an asset
+func Path(hash string, variant string) string {
+	return "/api/media/" + Key(hash, variant)
+}
+
+func ThumbnailVariant(width int) string {
+	return "w" + strconv.Itoa(width)
+}
+
+// Thumbnails returns the widths the asset has thumbnails at, smallest first
+func Thumbnails(asset models.MediaAssets) []int {
+	var widths []int
+	for _, width := range strings.Split(asset.Thumbnails, ",") {
+		if w, err := strconv.Atoi(width); err == nil {
+			widths = append(widths, w)
+		}
+	}
+
+	return widths
+}
+
+// ThumbnailHeight is the height of the asset's thumbnail at the width
+func ThumbnailHeight(asset models.MediaAssets, width int) int {
+	return thumbnailHeight(asset.Width, asset.Height, width)
+}
@@ -0,0 +1,143 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"testing"
+)
+
+func pngImage(t *testing.T, width int, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var buffer bytes.Buffer
+	err := png.Encode(&buffer, img)
+	if err != nil {
+		t.Fatalf("failed to encode image: %s", err.Error())
+	}
+	return buffer.Bytes()
+}
+
+func newS3Library(t *testing.T) (*bucket, *Library) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+
+	b, server := newBucket(t, "media", true)
+	config := DefaultConfig()
+	config.Backend = BackendS3
+	config.S3 = s3Config(server.URL)
+	storage, err := NewStorage(config)
+	if err != nil {
+		t.Fatalf("failed to create s3 storage: %s", err.Error())
+	}
+
+	return b, NewLibrary(client, storage, config)
+}
+
+func TestUploadStoresTheImageAndItsThumbnails(t *testing.T) {
+	b, library := newS3Library(t)
+
+	data := pngImage(t, 200, 100)
+	image, created, ok, err := library.Upload(1, db.ImagePoster, data)
+	if err != nil || !ok || !created {
+		t.Fatalf("failed to upload image: ok %t created %t err %v", ok, created, err)
+	}
+	if image.Asset.ContentType != "image/png" || image.Asset.Width != 200 || image.Asset.Height != 100 {
+		t.Fatalf("unexpected asset %+v", image.Asset)
+	}
+
+	// images are never scaled up, so there is no 342px thumbnail
+	widths := Thumbnails(image.Asset)
+	if len(widths) != 2 || widths[0] != 92 || widths[1] != 185 {
+		t.Fatalf("expected thumbnails at 92 and 185, got %v", widths)
+	}
+	if puts := b.putCount(); puts != 3 {
+		t.Fatalf("expected the original and two thumbnails to be stored, got %d", puts)
+	}
+
+	for _, width := range widths {
+		body, contentType, err := library.Open(image.Asset.Hash, ThumbnailVariant(width))
+		if err != nil {
+			t.Fatalf("failed to open %dpx thumbnail: %s", width, err.Error())
+		}
+		thumbnail, err := png.Decode(body)
+		body.Close()
+		if err != nil {
+			t.Fatalf("failed to decode %dpx thumbnail: %s", width, err.Error())
+		}
+		bounds := thumbnail.Bounds()
+		if contentType != "image/png" || bounds.Dx() != width || bounds.Dy() != ThumbnailHeight(image.Asset, width) {
+			t.Fatalf("unexpected %dpx thumbnail %s of %dx%d", width, contentType, bounds.Dx(), bounds.Dy())
+		}
+	}
+
+	body, _, err := library.Open(image.Asset.Hash, VariantOriginal)
+	if err != nil {
+		t.Fatalf("failed to open original: %s", err.Error())
+	}
+	defer body.Close()
+	original, err := io.ReadAll(body)
+	if err != nil || !bytes.Equal(original, data) {
+		t.Fatalf("expected the uploaded bytes back: %v", err)
+	}
+
+	if _, _, err := library.Open(image.Asset.Hash, ThumbnailVariant(342)); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound for a width the image has no thumbnail at, got %v", err)
+	}
+}
+
+func TestUploadStoresTheSameImageOnce(t *testing.T) {
+	b, library := newS3Library(t)
+	data := pngImage(t, 200, 100)
+
+	first, _, _, err := library.Upload(1, db.ImagePoster, data)
+	if err != nil {
+		t.Fatalf("failed to upload image: %s", err.Error())
+	}
+	puts := b.putCount()
+
+	_, created, ok, err := library.Upload(1, db.ImagePoster, data)
+	if err != nil || !ok || created {
+		t.Fatalf("expected the movie to already have the poster: ok %t created %t err %v", ok, created, err)
+	}
+	second, created, ok, err := library.Upload(2, db.ImageStill, data)
+	if err != nil || !ok || !created {
+		t.Fatalf("failed to upload image to another movie: ok %t created %t err %v", ok, created, err)
+	}
+	if second.Asset.Hash != first.Asset.Hash {
+		t.Fatalf("expected the same asset, got %s and %s", first.Asset.Hash, second.Asset.Hash)
+	}
+	if after := b.putCount(); after != puts {
+		t.Fatalf("expected nothing more to be stored, got %d puts after %d", after, puts)
+	}
+
+	images, err := library.Images(2)
+	if err != nil {
+		t.Fatalf("failed to get images: %s", err.Error())
+	}
+	if len(images) != 1 || images[0].Kind != db.ImageStill || images[0].Asset.Hash != first.Asset.Hash {
+		t.Fatalf("expected the image as a still of movie 2, got %+v", images)
+	}
+}
+
+func TestUploadRefusesBadImages(t *testing.T) {
+	_, library := newS3Library(t)
+
+	if _, _, _, err := library.Upload(1, "banner", pngImage(t, 10, 10)); err != ErrUnknownKind {
+		t.Fatalf("expected ErrUnknownKind, got %v", err)
+	}
+	if _, _, _, err := library.Upload(1, db.ImagePoster, []byte("not an image")); err != ErrUnsupportedImage {
+		t.Fatalf("expected ErrUnsupportedImage, got %v", err)
+	}
+	if _, _, ok, err := library.Upload(0, db.ImagePoster, pngImage(t, 10, 10)); err != nil || ok {
+		t.Fatalf("expected no movie with id 0: ok %t err %v", ok, err)
+	}
+}
@@ -0,0 +1,123 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// ErrNotExist is returned when no object has the key
+var ErrNotExist = errors.New("no object with the key")
+
+// Storage keeps the bytes of images and thumbnails by key. Keys are slash separated paths.
+type Storage interface {
+	// Put stores the body under the key, replacing what was there
+	Put(key string, body []byte, contentType string) error
+	// Get opens the object with the key, ErrNotExist when there is none
+	Get(key string) (io.ReadCloser, error)
+	// Exists tells whether an object has the key
+	Exists(key string) (bool, error)
+}
+
+// NewStorage returns the storage of the configured backend
+func NewStorage(config Config) (Storage, error) {
+	switch config.Backend {
+	case BackendLocal:
+		return NewLocalStorage(config.Dir)
+	case BackendS3:
+		return NewS3Storage(config.S3)
+	default:
+		return nil, fmt.Errorf("unknown media backend %q", config.Backend)
+	}
+}
+
+type localStorage struct {
+	dir string
+}
+
+// NewLocalStorage keeps objects as files under dir, each api replica needs the same dir mounted to share them
+func NewLocalStorage(dir string) (Storage, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create media dir: %s", err.Error())
+	}
+
+	return localStorage{
+		dir: dir,
+	}, nil
+}
+
+// file returns the path of the key, refusing keys that would leave the dir
+func (s localStorage) file(key string) (string, error) {
+	if key == "" || path.Clean("/"+key) != "/"+key {
+		return "", fmt.Errorf("invalid media key %q", key)
+	}
+
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file that is renamed into place, so readers never see half an object
+func (s localStorage) Put(key string, body []byte, contentType string) error {
+	file, err := s.file(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+func (s localStorage) Get(key string) (io.ReadCloser, error) {
+	file, err := s.file(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (s localStorage) Exists(key string) (bool, error) {
+	file, err := s.file(key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,67 @@
+package media
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStorageRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "media")
+	storage, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatalf("failed to create local storage: %s", err.Error())
+	}
+
+	key := "abc/original"
+	exists, err := storage.Exists(key)
+	if err != nil || exists {
+		t.Fatalf("expected no object before it was put: %v", err)
+	}
+	if _, err := storage.Get(key); err != ErrNotExist {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+
+	for _, body := range []string{"first", "second"} {
+		err = storage.Put(key, []byte(body), "image/png")
+		if err != nil {
+			t.Fatalf("failed to put object: %s", err.Error())
+		}
+
+		file, err := storage.Get(key)
+		if err != nil {
+			t.Fatalf("failed to get object: %s", err.Error())
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil || string(data) != body {
+			t.Fatalf("expected %q, got %q: %v", body, data, err)
+		}
+	}
+
+	// the temporary files of uploads are gone once they are in place
+	entries, err := os.ReadDir(filepath.Join(dir, "abc"))
+	if err != nil {
+		t.Fatalf("failed to read media dir: %s", err.Error())
+	}
+	if len(entries) != 1 || entries[0].Name() != "original" {
+		t.Fatalf("expected only the object in the dir, got %v", entries)
+	}
+}
+
+func TestLocalStorageRefusesKeysOutsideTheDir(t *testing.T) {
+	storage, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %s", err.Error())
+	}
+
+	for _, key := range []string{"", "../escape", "abc/../../escape", "/abs", "abc//original"} {
+		if err := storage.Put(key, []byte("body"), "image/png"); err == nil {
+			t.Fatalf("expected key %q to be refused", key)
+		}
+		if _, err := storage.Get(key); err == nil {
+			t.Fatalf("expected key %q to be refused", key)
+		}
+	}
+}
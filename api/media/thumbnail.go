@@ -0,0 +1,188 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	// registers gif with image.Decode, jpeg and png are registered by their encoders
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// maxPixels keeps a small file that declares a huge image from taking all the memory when decoded
+const maxPixels = 50000000
+
+var ErrUnsupportedImage = errors.New("images must be jpeg, png or gif")
+
+// contentTypes maps the formats the image package decodes to their content type
+var contentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+}
+
+// decode returns the image and its content type, ErrUnsupportedImage when it is not a jpeg, png or gif
+func decode(data []byte) (image.Image, string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedImage
+	}
+	contentType, ok := contentTypes[format]
+	if !ok {
+		return nil, "", ErrUnsupportedImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, "", fmt.Errorf("%w, at most %d pixels", ErrUnsupportedImage, maxPixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnsupportedImage, err.Error())
+	}
+
+	return img, contentType, nil
+}
+
+// thumbnailType is the content type of the thumbnails of an image, photos stay jpeg and the rest become png
+func thumbnailType(contentType string) string {
+	if contentType == "image/jpeg" {
+		return "image/jpeg"
+	}
+
+	return "image/png"
+}
+
+// encode writes the image in the content type, which is image/jpeg or image/png
+func encode(img image.Image, contentType string) ([]byte, error) {
+	var buffer bytes.Buffer
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 85})
+	case "image/png":
+		err = png.Encode(&buffer, img)
+	default:
+		return nil, fmt.Errorf("can not encode %s", contentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// thumbnailHeight keeps the aspect ratio of a width by height image scaled to the thumbnail width, rounded
+func thumbnailHeight(width int, height int, thumbnailWidth int) int {
+	scaled := (height*thumbnailWidth*2 + width) / (width * 2)
+	if scaled < 1 {
+		return 1
+	}
+
+	return scaled
+}
+
+// resize scales the image down to the width, keeping its aspect ratio.
+// Each pixel of the thumbnail is the average of the pixels of the image it covers, weighted by how much of them it covers,
+// which is what shrinking needs to stay sharp without aliasing.
+func resize(img image.Image, width int) *image.RGBA {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	height := thumbnailHeight(srcWidth, srcHeight, width)
+
+	src, ok := img.(*image.RGBA)
+	if !ok || src.Rect.Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+		draw.Draw(src, src.Rect, img, bounds.Min, draw.Src)
+	}
+
+	// columns and rows are resampled separately, which gives the same result as covering boxes in one go
+	xs := spans(srcWidth, width)
+	ys := spans(srcHeight, height)
+
+	row := make([]float64, width*4)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, ySpan := range ys {
+		for i := range row {
+			row[i] = 0
+		}
+
+		for _, yWeight := range ySpan {
+			line := src.Pix[yWeight.index*src.Stride:]
+			for x, xSpan := range xs {
+				var r, g, b, a float64
+				for _, xWeight := range xSpan {
+					pixel := line[xWeight.index*4:]
+					r += float64(pixel[0]) * xWeight.weight
+					g += float64(pixel[1]) * xWeight.weight
+					b += float64(pixel[2]) * xWeight.weight
+					a += float64(pixel[3]) * xWeight.weight
+				}
+				row[x*4] += r * yWeight.weight
+				row[x*4+1] += g * yWeight.weight
+				row[x*4+2] += b * yWeight.weight
+				row[x*4+3] += a * yWeight.weight
+			}
+		}
+
+		out := dst.Pix[y*dst.Stride:]
+		for i, value := range row {
+			out[i] = clamp(value)
+		}
+	}
+
+	return dst
+}
+
+type weight struct {
+	index  int
+	weight float64
+}
+
+// spans returns for each of the n pixels a line of src pixels is shrunk to the src pixels it covers and how much,
+// the weights of each add up to 1
+func spans(src int, n int) [][]weight {
+	scale := float64(src) / float64(n)
+
+	result := make([][]weight, n)
+	for i := range result {
+		start := float64(i) * scale
+		end := start + scale
+
+		for j := int(start); j < src && float64(j) < end; j++ {
+			covered := minFloat(end, float64(j+1)) - maxFloat(start, float64(j))
+			if covered > 0 {
+				result[i] = append(result[i], weight{index: j, weight: covered / scale})
+			}
+		}
+	}
+
+	return result
+}
+
+func clamp(value float64) uint8 {
+	switch {
+	case value <= 0:
+		return 0
+	case value >= 255:
+		return 255
+	default:
+		return uint8(value + 0.5)
+	}
+}
+
+func minFloat(a float64, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxFloat(a float64, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type MoviesReturnObject struct {
 	Title         string    `json:"title"`
 	Ratings       []Ratings `json:"ratings"`
@@ -8,23 +10,229 @@ type MoviesReturnObject struct {
 	Genre         string
 }
 type Movies struct {
-	ID    int    `gorm:"primary_key"`
-	Title string `gorm:"unique;not null"`
-	Plot  string
-	Genre string
-	Year  string
-	Rated string
+	ID       int    `gorm:"primary_key"`
+	Title    string `gorm:"unique;not null"`
+	Plot     string
+	Genre    string
+	Year     string
+	Rated    string
+	Director string
+	Actors   string
+	// Released is the release date as "02 Jan 2006", or N/A
+	Released string
+	// Version goes up with every write of the movie, writes given an older version are refused
+	Version   int `gorm:"not null;default:1"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// DeletedAt is set while the movie is in the trash, gorm leaves it out of every query that is not Unscoped
+	DeletedAt *time.Time `sql:"index"`
 }
 
 type MovieRatings struct {
 	ID      int       `gorm:"primary_key"`
 	Title   string    `gorm:"unique;not null"`
 	Ratings []Ratings `json:"ratings"`
+	// Version goes up with every write of the movie ratings or their ratings
+	Version   int        `json:"-" gorm:"not null;default:1"`
+	CreatedAt time.Time  `json:"-"`
+	UpdatedAt time.Time  `json:"-"`
+	DeletedAt *time.Time `json:"-" sql:"index"`
 }
 
+// Ratings are part of the frozen v1 response so new fields need to stay out of its json
 type Ratings struct {
 	MovieRatingsID int           `json:"movie_ratings_id,omitempty"`
 	MovieRatings   *MovieRatings `json:"movie_ratings,omitempty" gorm:"foreignKey:MovieRatingsID"`
 	Source         string        `json:"source"`
 	Value          int           `json:"value"`
+	CreatedAt      time.Time     `json:"-"`
+	UpdatedAt      time.Time     `json:"-"`
+	DeletedAt      *time.Time    `json:"-" sql:"index"`
+}
+
+// RateLimitBuckets holds the token bucket of a rate limited client when limits are shared between api replicas
+type RateLimitBuckets struct {
+	Key        string `gorm:"primary_key"`
+	Tokens     float64
+	RefilledAt time.Time
+	// FullAt is when the bucket will have refilled completely if it is left alone, it can be deleted from then on
+	FullAt *time.Time `gorm:"index"`
+}
+
+// UserRatings is the score a user gave a movie, unlike Ratings which come from review sources
+type UserRatings struct {
+	UserID    string `gorm:"primary_key"`
+	MovieID   int    `gorm:"primary_key;auto_increment:false"`
+	Score     int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Recommendations are precomputed by the recommend job so serving them is a lookup
+type Recommendations struct {
+	UserID     string `gorm:"primary_key"`
+	MovieID    int    `gorm:"primary_key;auto_increment:false"`
+	Title      string
+	Rank       int
+	Score      float64
+	Reason     string
+	ComputedAt time.Time
+}
+
+// MovieViews counts how often a movie was looked at on a day
+type MovieViews struct {
+	MovieID int       `gorm:"primary_key;auto_increment:false"`
+	Day     time.Time `gorm:"primary_key"`
+	Views   int
+}
+
+// ListOverrides pin a movie to the top of a curated list or exclude it from the list
+type ListOverrides struct {
+	List      string `gorm:"primary_key"`
+	MovieID   int    `gorm:"primary_key;auto_increment:false"`
+	Action    string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// RatingObservations keep every value a source gave a movie, Ratings only holds the latest one
+type RatingObservations struct {
+	ID             int    `gorm:"primary_key"`
+	MovieRatingsID int    `gorm:"index:idx_rating_observations_movie"`
+	Source         string `gorm:"not null"`
+	Value          int
+	ObservedAt     time.Time `gorm:"index:idx_rating_observations_movie"`
+	// Removed marks the rating being deleted at ObservedAt, Value is the one it had until then
+	Removed bool `gorm:"not null;default:false"`
+}
+
+// WatchlistEntries are the movies a user plans to watch
+type WatchlistEntries struct {
+	UserID  string `gorm:"primary_key"`
+	MovieID int    `gorm:"primary_key;auto_increment:false"`
+	// Priority goes from 1, watch first, to 5
+	Priority  int
+	Notes     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DiaryEntries are the times a user watched a movie
+type DiaryEntries struct {
+	ID        int    `gorm:"primary_key"`
+	UserID    string `gorm:"index;not null"`
+	MovieID   int
+	WatchedOn time.Time
+	Rewatch   bool
+	// Score is the user's own score from 0 to 100, nil when they did not give one
+	Score     *int
+	Notes     string
+	CreatedAt time.Time
+}
+
+// WebhookSubscriptions receive a signed POST for every event they subscribe to
+type WebhookSubscriptions struct {
+	ID  int    `gorm:"primary_key"`
+	URL string `gorm:"not null"`
+	// Events is a comma separated list of event types, * subscribes to every event
+	Events    string
+	Secret    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// WebhookDeliveries queue an event for a subscription until it is delivered or dead lettered
+type WebhookDeliveries struct {
+	ID             int `gorm:"primary_key"`
+	SubscriptionID int `gorm:"index;unique_index:idx_webhook_deliveries_subscription_event"`
+	// EventID is unique per subscription so an event published twice is delivered once
+	EventID string `gorm:"unique_index:idx_webhook_deliveries_subscription_event"`
+	Event   string
+	// Payload is the exact body that is posted and signed
+	Payload        string `gorm:"type:text"`
+	Status         string `gorm:"index"`
+	Attempts       int
+	NextAttemptAt  time.Time `gorm:"index"`
+	LastAttemptAt  *time.Time
+	LastStatusCode int
+	LastError      string
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+// ChangeEvents log every change to the catalogue in the transaction that makes it, the outbox relay passes them on to sinks
+type ChangeEvents struct {
+	// ID orders the changes, consumers catch up with the changes after the last id they saw
+	ID int64 `gorm:"primary_key"`
+	// EventID and Type are the id and type of the event posted to webhooks and streamed to clients
+	EventID   string
+	Type      string
+	Entity    string `gorm:"not null"`
+	EntityID  string `gorm:"not null"`
+	Operation string `gorm:"not null"`
+	// Before and After are json copies of the entity, Before is empty on create and After on delete
+	Before string `gorm:"type:text"`
+	After  string `gorm:"type:text"`
+	// Data is the json data of the event
+	Data string `gorm:"type:text"`
+	// Origin is the replica that made the change
+	Origin    string
+	CreatedAt time.Time
+}
+
+// OutboxCursors are the last change each outbox sink published
+type OutboxCursors struct {
+	Sink         string `gorm:"primary_key"`
+	LastChangeID int64
+	UpdatedAt    time.Time
+}
+
+// MovieRevisions are immutable copies of a movie and its ratings, one is kept for every edit
+type MovieRevisions struct {
+	ID       int `gorm:"primary_key"`
+	MovieID  int `gorm:"unique_index:idx_movie_revisions_movie_revision"`
+	Revision int `gorm:"unique_index:idx_movie_revisions_movie_revision"`
+	Author   string
+	// Snapshot is the json of the movie's fields and its ratings by source after the edit
+	Snapshot string `gorm:"type:text"`
+	// RestoredFrom is the revision a rollback brought back, 0 for other edits
+	RestoredFrom int
+	CreatedAt    time.Time
+}
+
+// IdempotencyKeys hold the response to a POST or PATCH sent with an Idempotency-Key, replayed to the caller's retries
+type IdempotencyKeys struct {
+	Key    string `gorm:"primary_key"`
+	Caller string `gorm:"primary_key"`
+	// Fingerprint is a hash of the method, url and body of the request, a retry has to send the same
+	Fingerprint string `gorm:"not null"`
+	// Status is 0 while the first request is in progress
+	Status int
+	// Headers is the json of the headers the handler set
+	Headers   string `gorm:"type:text"`
+	Body      []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// MediaAssets are uploaded images, stored once per content however many movies use them
+type MediaAssets struct {
+	// Hash is the hex sha256 of the uploaded bytes, the storage keys of the image and its thumbnails start with it
+	Hash        string `gorm:"primary_key"`
+	ContentType string `gorm:"not null"`
+	Width       int
+	Height      int
+	Size        int64
+	// Thumbnails are the comma separated widths of the thumbnails made from the image
+	Thumbnails string
+	CreatedAt  time.Time
+}
+
+// MovieImages link a movie to its poster and stills, a movie has at most one poster
+type MovieImages struct {
+	MovieID   int    `gorm:"primary_key;auto_increment:false"`
+	AssetHash string `gorm:"primary_key"`
+	// Kind is poster or still
+	Kind      string `gorm:"not null"`
+	CreatedAt time.Time
 }
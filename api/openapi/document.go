@@ -0,0 +1,205 @@
+package openapi
+
+import "fmt"
+
+// https://spec.openapis.org/oas/v3.0.3
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem maps a lower case http method to its operation
+type PathItem map[string]Operation
+
+type Operation struct {
+	Summary     string              `json:"summary"`
+	OperationID string              `json:"operationId"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	Deprecated  bool                `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	MaxLength            int                `json:"maxLength,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func arrayOf(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+func object(properties map[string]*Schema, required ...string) *Schema {
+	return &Schema{Type: "object", Properties: properties, Required: required}
+}
+
+func str() *Schema {
+	return &Schema{Type: "string"}
+}
+
+func integer() *Schema {
+	return &Schema{Type: "integer"}
+}
+
+func number() *Schema {
+	return &Schema{Type: "number"}
+}
+
+func binary() *Schema {
+	return &Schema{Type: "string", Format: "binary"}
+}
+
+func jsonContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+func jsonResponse(description string, schema *Schema) Response {
+	return Response{Description: description, Content: jsonContent(schema)}
+}
+
+// notModified is returned by cached routes when the If-None-Match or If-Modified-Since header is still current
+func notModified() Response {
+	return Response{Description: "the client's copy, identified by If-None-Match or If-Modified-Since, is still current"}
+}
+
+// taggedResponse is a json response with the ETag to send back as If-Match when writing the resource
+func taggedResponse(description string, schema *Schema, tag string) Response {
+	return tagged(jsonResponse(description, schema), tag)
+}
+
+// tagged adds the ETag of the resource to a response, writes send the one they left
+func tagged(response Response, tag string) Response {
+	response.Headers = map[string]Header{
+		"ETag": {Description: fmt.Sprintf("\"%s-<version>\", it changes with every write", tag), Schema: str()},
+	}
+
+	return response
+}
+
+// preconditionFailed is returned by writes whose If-Match no longer matches the resource
+func preconditionFailed() Response {
+	return jsonResponse("the If-Match header does not match the current ETag, someone else wrote it since", ref("ErrorV2"))
+}
+
+// preconditionRequired is returned by writes sent without If-Match
+func preconditionRequired() Response {
+	return jsonResponse("the If-Match header is missing", ref("ErrorV2"))
+}
+
+func queryParam(name string, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// userParam is the header naming the user that the /api/v2/me routes act on
+func userParam() Parameter {
+	return Parameter{Name: "X-User-ID", In: "header", Description: "id of the current user", Required: true, Schema: str()}
+}
+
+// authorParam names who made an admin edit
+func authorParam() Parameter {
+	return Parameter{Name: "X-User-ID", In: "header", Description: "who made the edit, defaults to admin", Schema: str()}
+}
+
+// adminParam is the header carrying the admin token on the /api/admin routes
+func adminParam() Parameter {
+	return Parameter{Name: "X-Admin-Token", In: "header", Description: "the ADMIN_TOKEN the api was started with", Required: true, Schema: str()}
+}
+
+// ifMatchParam makes a write conditional on the ETag of the resource it writes
+func ifMatchParam(tag string) Parameter {
+	return Parameter{
+		Name:        "If-Match",
+		In:          "header",
+		Description: fmt.Sprintf("the ETag the edit is based on, \"%s-<version>\", or * to write whatever the version", tag),
+		Required:    true,
+		Schema:      str(),
+	}
+}
+
+// idempotencyKeyParam makes a POST or PATCH safe to retry
+func idempotencyKeyParam() Parameter {
+	return Parameter{
+		Name:        "Idempotency-Key",
+		In:          "header",
+		Description: "a key unique to the request, retries with the same key get the first response back with an Idempotent-Replayed header",
+		Schema:      &Schema{Type: "string", MaxLength: 255},
+	}
+}
+
+// sourceParam is the review source in a path
+func sourceParam() Parameter {
+	return Parameter{Name: "source", In: "path", Description: "review source", Required: true, Schema: str()}
+}
+
+// listParam is the name of a curated list
+func listParam() Parameter {
+	return Parameter{Name: "list", In: "path", Required: true, Schema: &Schema{Type: "string", Enum: []string{"trending", "leaving", "coming-soon"}}}
+}
+
+// modeParam is whether a batch writes all of its items or none, or each item that it can
+func modeParam() Parameter {
+	return queryParam("mode", "atomic, the default, or per_item", &Schema{Type: "string", Enum: []string{"atomic", "per_item"}})
+}
+
+func pathParam(name string, description string) Parameter {
+	return Parameter{Name: name, In: "path", Description: description, Required: true, Schema: integer()}
+}
+
+func dateTime() *Schema {
+	return &Schema{Type: "string", Format: "date-time"}
+}
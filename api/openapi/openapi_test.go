@@ -0,0 +1,43 @@
+package openapi_test
+
+import (
+	"github.com/gorilla/mux"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	movieHttp "movie-rating-api/http"
+	"movie-rating-api/openapi"
+	"testing"
+)
+
+// TestSpecMatchesRoutes fails when a route is registered without being in the spec, or the other way round
+func TestSpecMatchesRoutes(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+
+	r := mux.NewRouter()
+	movieHttp.ConfigureRouter(r, movieHttp.NewHandlers(app.New(client), client, nil, nil, nil, nil, "token", movieHttp.DefaultConfig()))
+
+	mismatches, err := openapi.Verify(r, openapi.Spec())
+	if err != nil {
+		t.Fatalf("failed to verify spec: %s", err.Error())
+	}
+	for _, mismatch := range mismatches {
+		t.Error(mismatch)
+	}
+}
+
+func TestOperationIDsAreUnique(t *testing.T) {
+	seen := map[string]string{}
+	for path, item := range openapi.Spec().Paths {
+		for method, operation := range item {
+			if operation.OperationID == "" {
+				t.Errorf("%s %s has no operation id", method, path)
+				continue
+			}
+			if other, ok := seen[operation.OperationID]; ok {
+				t.Errorf("%s %s and %s share the operation id %s", method, path, other, operation.OperationID)
+			}
+			seen[operation.OperationID] = method + " " + path
+		}
+	}
+}
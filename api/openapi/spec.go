@@ -0,0 +1,1308 @@
+package openapi
+
+const Version = "3.0.3"
+
+// Spec returns the OpenAPI document for every route registered in http.ConfigureRouter.
+// When a route is added or removed there, it needs to be added or removed here as well,
+// Verify reports the routes that are out of sync.
+func Spec() *Document {
+	spec := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title: "Movie Rating API",
+			Description: "Movies and the ratings they received from review sources. " +
+				"Every route is rate limited, responses carry RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers " +
+				"and a 429 with a Retry-After header is returned once the limit is reached. " +
+				"POST and PATCH routes take an Idempotency-Key header, the first response to a key is replayed to retries of the same request. " +
+				"v1 is frozen and deprecated, its responses carry Deprecation, Link and once scheduled Sunset headers.",
+			Version: "1.0.0",
+		},
+		Paths: map[string]PathItem{
+			"/api/health": {
+				"get": {
+					Summary:     "Health check",
+					OperationID: "getHealth",
+					Tags:        []string{"health"},
+					Responses: map[string]Response{
+						"200": jsonResponse("api is up", ref("Health")),
+					},
+				},
+			},
+			"/api/movies": {
+				"get": {
+					Summary:     "Same as /api/v1/movies, kept for clients from before the api was versioned",
+					OperationID: "getMovies",
+					Tags:        []string{"v1"},
+					Responses:   v1MoviesResponses(),
+					Deprecated:  true,
+				},
+			},
+			"/api/v1/movies": {
+				"get": {
+					Summary:     "List movies with their ratings and average rating",
+					OperationID: "getMoviesV1",
+					Tags:        []string{"v1"},
+					Responses:   v1MoviesResponses(),
+					Deprecated:  true,
+				},
+			},
+			"/api/v2/movies": {
+				"get": {
+					Summary:     "List movies with their ratings and average rating",
+					OperationID: "getMoviesV2",
+					Tags:        []string{"v2"},
+					Parameters: []Parameter{
+						queryParam("on_watchlist", "only the movies that are, or with false are not, on the X-User-ID user's watchlist", &Schema{Type: "boolean"}),
+						queryParam("seen", "only the movies the X-User-ID user has, or with false has not, logged in their diary", &Schema{Type: "boolean"}),
+						{Name: "X-User-ID", In: "header", Description: "id of the current user, required by on_watchlist and seen", Schema: str()},
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("movies", ref("MovieListV2")),
+						"304": notModified(),
+						"400": jsonResponse("invalid on_watchlist or seen", ref("ErrorV2")),
+						"401": jsonResponse("on_watchlist or seen without the X-User-ID header", ref("ErrorV2")),
+						"500": jsonResponse("failed to load movies", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/v2/movies/{id}": {
+				"get": {
+					Summary:     "Get a movie with its ratings and average rating",
+					OperationID: "getMovieV2",
+					Tags:        []string{"v2"},
+					Parameters: []Parameter{
+						pathParam("id", "movie id"),
+						queryParam("as_of", "date or RFC 3339 time to return the ratings the movie had then, a date includes the whole day", dateTime()),
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("movie", ref("MovieV2")),
+						"304": notModified(),
+						"400": jsonResponse("invalid movie id or as_of", ref("ErrorV2")),
+						"404": jsonResponse("movie not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to load movies", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/v2/movies/{id}/similar": {
+				"get": {
+					Summary:     "List the movies most similar to a movie by genre, director, actors, era and ratings",
+					OperationID: "getSimilarMoviesV2",
+					Tags:        []string{"v2"},
+					Parameters: []Parameter{
+						pathParam("id", "movie id"),
+						queryParam("limit", "maximum number of movies to return, defaults to 10", integer()),
+						queryParam("genre_weight", "weight of shared genres, defaults to 3", number()),
+						queryParam("director_weight", "weight of a shared director, defaults to 2", number()),
+						queryParam("actors_weight", "weight of shared actors, defaults to 2", number()),
+						queryParam("era_weight", "weight of being released within 20 years, defaults to 1", number()),
+						queryParam("ratings_weight", "weight of getting the same ratings from the same sources, defaults to 2", number()),
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("similar movies, most similar first", ref("SimilarMovieListV2")),
+						"304": notModified(),
+						"400": jsonResponse("invalid movie id, limit or weight", ref("ErrorV2")),
+						"404": jsonResponse("movie not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to load movies", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/v2/me/ratings": {
+				"get": {
+					Summary:     "List the scores the current user gave movies",
+					OperationID: "getMyRatingsV2",
+					Tags:        []string{"v2"},
+					Parameters:  []Parameter{userParam()},
+					Responses: map[string]Response{
+						"200": jsonResponse("the user's ratings", ref("UserRatingListV2")),
+						"401": jsonResponse("missing X-User-ID header", ref("ErrorV2")),
+						"500": jsonResponse("failed to load ratings", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/v2/me/ratings/{id}": {
+				"put": {
+					Summary:     "Rate a movie as the current user, replacing any earlier score",
+					OperationID: "putMyRatingV2",
+					Tags:        []string{"v2"},
+					Parameters:  []Parameter{userParam(), pathParam("id", "movie id")},
+					RequestBody: &RequestBody{Required: true, Content: jsonContent(ref("UserRatingRequestV2"))},
+					Responses: map[string]Response{
+						"204": {Description: "rating saved"},
+						"400": jsonResponse("invalid movie id or score", ref("ErrorV2")),
+						"401": jsonResponse("missing X-User-ID header", ref("ErrorV2")),
+						"404": jsonResponse("movie not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to save rating", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/v2/me/recommendations": {
+				"get": {
+					Summary: "List movies recommended to the current user from their ratings, " +
+						"users without ratings get the best rated movies",
+					OperationID: "getMyRecommendationsV2",
+					Tags:        []string{"v2"},
+					Parameters: []Parameter{
+						userParam(),
+						queryParam("limit", "maximum number of recommendations to return, defaults to 10", integer()),
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("recommendations, best first", ref("RecommendationListV2")),
+						"400": jsonResponse("invalid limit", ref("ErrorV2")),
+						"401": jsonResponse("missing X-User-ID header", ref("ErrorV2")),
+						"500": jsonResponse("failed to load recommendations", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/v2/me/watchlist": {
+				"get": {
+					Summary:     "List the movies on the current user's watchlist by priority",
+					OperationID: "getMyWatchlistV2",
+					Tags:        []string{"v2"},
+					Parameters:  []Parameter{userParam()},
+					Responses: map[string]Response{
+						"200": jsonResponse("the watchlist", ref("WatchlistListV2")),
+						"401": jsonResponse("missing X-User-ID header", ref("ErrorV2")),
+						"500": jsonResponse("failed to load the watchlist", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/v2/me/watchlist/{id}": {
+				"put": {
+					Summary:     "Add a movie to the current user's watchlist or change its priority and notes",
+					OperationID: "putMyWatchlistEntryV2",
+					Tags:        []string{"v2"},
+					Parameters:  []Parameter{userParam(), pathParam("id", "movie id")},
+					RequestBody: &RequestBody{Content: jsonContent(ref("WatchlistRequestV2"))},
+					Responses: map[string]Response{
+						"204": {Description: "watchlist entry saved"},
+						"400": jsonResponse("invalid movie id or priority", ref("ErrorV2")),
+						"401": jsonResponse("missing X-User-ID header", ref("ErrorV2")),
+						"404": jsonResponse("movie not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to save the watchlist entry", ref("ErrorV2")),
+					},
+				},
+				"delete": {
+					Summary:     "Take a movie off the current user's watchlist",
+					OperationID: "deleteMyWatchlistEntryV2",
+					Tags:        []string{"v2"},
+					Parameters:  []Parameter{userParam(), pathParam("id", "movie id")},
+					Responses: map[string]Response{
+						"204": {Description: "watchlist entry removed"},
+						"400": jsonResponse("invalid movie id", ref("ErrorV2")),
+						"401": jsonResponse("missing X-User-ID header", ref("ErrorV2")),
+						"404": jsonResponse("movie not on the watchlist", ref("ErrorV2")),
+						"500": jsonResponse("failed to remove the watchlist entry", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/v2/me/diary": {
+				"get": {
+					Summary:     "List the current user's diary, oldest watch first",
+					OperationID: "getMyDiaryV2",
+					Tags:        []string{"v2"},
+					Parameters: []Parameter{
+						userParam(),
+						queryParam("from", "date or RFC 3339 time of the first watch to list", dateTime()),
+						queryParam("to", "date or RFC 3339 time of the last watch to list", dateTime()),
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("the diary", ref("DiaryListV2")),
+						"400": jsonResponse("invalid from or to", ref("ErrorV2")),
+						"401": jsonResponse("missing X-User-ID header", ref("ErrorV2")),
+						"500": jsonResponse("failed to load the diary", ref("ErrorV2")),
+					},
+				},
+				"post": {
+					Summary:     "Log a watch of a movie in the current user's diary, the movie is taken off their watchlist",
+					OperationID: "postMyDiaryEntryV2",
+					Tags:        []string{"v2"},
+					Parameters:  []Parameter{userParam()},
+					RequestBody: &RequestBody{Required: true, Content: jsonContent(ref("DiaryRequestV2"))},
+					Responses: map[string]Response{
+						"201": jsonResponse("the diary entry", ref("DiaryEntryV2")),
+						"400": jsonResponse("invalid movie id, watched_on or score", ref("ErrorV2")),
+						"401": jsonResponse("missing X-User-ID header", ref("ErrorV2")),
+						"404": jsonResponse("movie not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to save the diary entry", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/v2/me/diary/stats": {
+				"get": {
+					Summary:     "Summarise the current user's diary by month and by genre",
+					OperationID: "getMyDiaryStatsV2",
+					Tags:        []string{"v2"},
+					Parameters: []Parameter{
+						userParam(),
+						queryParam("from", "date or RFC 3339 time of the first watch counted", dateTime()),
+						queryParam("to", "date or RFC 3339 time of the last watch counted", dateTime()),
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("diary stats", ref("DiaryStatsV2")),
+						"400": jsonResponse("invalid from or to", ref("ErrorV2")),
+						"401": jsonResponse("missing X-User-ID header", ref("ErrorV2")),
+						"500": jsonResponse("failed to load the diary", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/v2/me/diary/{entry}": {
+				"delete": {
+					Summary:     "Remove an entry from the current user's diary",
+					OperationID: "deleteMyDiaryEntryV2",
+					Tags:        []string{"v2"},
+					Parameters: []Parameter{
+						userParam(),
+						{Name: "entry", In: "path", Description: "diary entry id", Required: true, Schema: integer()},
+					},
+					Responses: map[string]Response{
+						"204": {Description: "diary entry removed"},
+						"400": jsonResponse("invalid diary entry id", ref("ErrorV2")),
+						"401": jsonResponse("missing X-User-ID header", ref("ErrorV2")),
+						"404": jsonResponse("diary entry not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to remove the diary entry", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/lists/{list}": {
+				"get": {
+					Summary: "A curated list of movies ranked by user ratings, views, critic ratings or release date, " +
+						"with the reasons each movie is in it. Movies pinned by an admin come first.",
+					OperationID: "getList",
+					Tags:        []string{"lists"},
+					Parameters: []Parameter{
+						listParam(),
+						queryParam("limit", "maximum number of movies to return, defaults to the list's configured limit", integer()),
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("the list, best first", ref("ListEntryListV2")),
+						"400": jsonResponse("invalid limit", ref("ErrorV2")),
+						"404": jsonResponse("unknown list", ref("ErrorV2")),
+						"500": jsonResponse("failed to build the list", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/changes": {
+				"get": {
+					Summary: "The change log of the catalogue, oldest first. Every create, update and delete of a movie, " +
+						"movie ratings or a source's rating is logged with the entity before and after it.",
+					OperationID: "getChanges",
+					Tags:        []string{"changes"},
+					Parameters: []Parameter{
+						queryParam("since", "only the changes after this id, pass back next to catch up", integer()),
+						queryParam("limit", "maximum number of changes to return, 100 by default and at most 1000", integer()),
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("the changes", ref("ChangeListV2")),
+						"400": jsonResponse("invalid since or limit", ref("ErrorV2")),
+						"500": jsonResponse("failed to load changes", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/stream": {
+				"get": {
+					Summary: "Server-sent events of every committed movie and rating change, named by the event type. " +
+						"Idle streams get a heartbeat comment and a reset event means missed events could not be replayed.",
+					OperationID: "getStream",
+					Tags:        []string{"stream"},
+					Parameters: []Parameter{
+						queryParam("movie_ids", "comma separated movie ids to receive the events of, every movie when empty", str()),
+						queryParam("last_event_id", "resume after this event id, the Last-Event-ID header takes precedence", str()),
+						{Name: "Last-Event-ID", In: "header", Description: "resume after this event id, sent by EventSource when it reconnects", Schema: str()},
+					},
+					Responses: map[string]Response{
+						"200": {Description: "the stream, each event's data is an Event", Content: map[string]MediaType{"text/event-stream": {Schema: str()}}},
+						"400": jsonResponse("invalid movie ids", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/stream/ws": {
+				"get": {
+					Summary: "The same events as /api/stream as StreamMessageV2 over a websocket. " +
+						"Clients send a StreamRequestV2 to change the movies they receive.",
+					OperationID: "getStreamWebSocket",
+					Tags:        []string{"stream"},
+					Parameters: []Parameter{
+						queryParam("movie_ids", "comma separated movie ids to receive the events of, every movie when empty", str()),
+						queryParam("last_event_id", "resume after this event id", str()),
+					},
+					Responses: map[string]Response{
+						"101": {Description: "switched to the websocket protocol"},
+						"400": jsonResponse("invalid movie ids or not a websocket handshake", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/admin/lists/{list}/overrides": {
+				"get": {
+					Summary:     "List the movies pinned to or excluded from a curated list",
+					OperationID: "getListOverrides",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), listParam()},
+					Responses: map[string]Response{
+						"200": jsonResponse("the overrides, oldest first", ref("ListOverrideListV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("unknown list", ref("ErrorV2")),
+						"500": jsonResponse("failed to load overrides", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/admin/lists/{list}/overrides/{id}": {
+				"put": {
+					Summary:     "Pin a movie to the top of a curated list or exclude it from the list",
+					OperationID: "putListOverride",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), listParam(), pathParam("id", "movie id")},
+					RequestBody: &RequestBody{Required: true, Content: jsonContent(ref("ListOverrideRequestV2"))},
+					Responses: map[string]Response{
+						"204": {Description: "override saved"},
+						"400": jsonResponse("invalid movie id or action", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("unknown list or movie", ref("ErrorV2")),
+						"500": jsonResponse("failed to save override", ref("ErrorV2")),
+					},
+				},
+				"delete": {
+					Summary:     "Remove the pin or exclusion of a movie in a curated list",
+					OperationID: "deleteListOverride",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), listParam(), pathParam("id", "movie id")},
+					Responses: map[string]Response{
+						"204": {Description: "override removed"},
+						"400": jsonResponse("invalid movie id", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("unknown list or the movie has no override", ref("ErrorV2")),
+						"500": jsonResponse("failed to remove override", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/v2/movies/{id}/ratings/history": {
+				"get": {
+					Summary:     "Every review source's rating of a movie over time, grouped by day, week or month",
+					OperationID: "getRatingHistoryV2",
+					Tags:        []string{"v2"},
+					Parameters: []Parameter{
+						pathParam("id", "movie id"),
+						queryParam("bucket", "day, week or month, defaults to day", &Schema{Type: "string", Enum: []string{"day", "week", "month"}}),
+						queryParam("from", "date or RFC 3339 time the history starts at, defaults to the first rating", dateTime()),
+						queryParam("to", "date or RFC 3339 time the history ends at, defaults to now", dateTime()),
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("rating history", ref("RatingHistoryV2")),
+						"400": jsonResponse("invalid movie id, bucket or range", ref("ErrorV2")),
+						"404": jsonResponse("movie not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to load the history", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/v2/movies/{id}/revisions": {
+				"get": {
+					Summary:     "The revisions of a movie oldest first, each with the fields it changed since the one before",
+					OperationID: "getMovieRevisionsV2",
+					Tags:        []string{"v2"},
+					Parameters:  []Parameter{pathParam("id", "movie id")},
+					Responses: map[string]Response{
+						"200": jsonResponse("the revisions, empty until the movie is first edited", ref("RevisionListV2")),
+						"400": jsonResponse("invalid movie id", ref("ErrorV2")),
+						"404": jsonResponse("movie not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to load the revisions", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/v2/movies/{id}/images": {
+				"get": {
+					Summary:     "The images of a movie, its poster first and then its stills oldest first",
+					OperationID: "getMovieImagesV2",
+					Tags:        []string{"v2"},
+					Parameters:  []Parameter{pathParam("id", "movie id")},
+					Responses: map[string]Response{
+						"200": jsonResponse("the images", ref("ImageListV2")),
+						"400": jsonResponse("invalid movie id", ref("ErrorV2")),
+						"404": jsonResponse("movie not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to load the images", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/media/{hash}/{variant}": {
+				"get": {
+					Summary:     "An uploaded image or one of its thumbnails, at the urls of an ImageV2. They never change and may be cached for good.",
+					OperationID: "getMedia",
+					Tags:        []string{"media"},
+					Parameters:  []Parameter{pathParam("hash", "sha256 of the uploaded image"), pathParam("variant", "original or w<width> for a thumbnail")},
+					Responses: map[string]Response{
+						"200": {
+							Description: "the image",
+							Content: map[string]MediaType{
+								"image/jpeg": {Schema: binary()},
+								"image/png":  {Schema: binary()},
+								"image/gif":  {Schema: binary()},
+							},
+							Headers: map[string]Header{"ETag": {Description: "\"<hash>-<variant>\"", Schema: str()}},
+						},
+						"304": notModified(),
+						"404": jsonResponse("image not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to load the image", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/admin/movies/{id}/images": {
+				"post": {
+					Summary: "Upload a poster or a still of a movie as the body or as the file field of a form. " +
+						"Thumbnails are made of new images, an image uploaded before is stored only once. A new poster replaces the old one.",
+					OperationID: "postMovieImage",
+					Tags:        []string{"admin"},
+					Parameters: []Parameter{
+						adminParam(),
+						pathParam("id", "movie id"),
+						queryParam("kind", "poster by default", &Schema{Type: "string", Enum: []string{"poster", "still"}}),
+						authorParam(),
+					},
+					RequestBody: &RequestBody{Required: true, Content: map[string]MediaType{
+						"image/jpeg": {Schema: binary()},
+						"image/png":  {Schema: binary()},
+						"image/gif":  {Schema: binary()},
+						"multipart/form-data": {Schema: object(map[string]*Schema{
+							"file": binary(),
+						}, "file")},
+					}},
+					Responses: map[string]Response{
+						"200": jsonResponse("the movie already had the image as that kind", ref("ImageV2")),
+						"201": jsonResponse("the image was added", ref("ImageV2")),
+						"400": jsonResponse("invalid movie id, kind or body", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("movie not found", ref("ErrorV2")),
+						"413": jsonResponse("the image is larger than the maximum upload size", ref("ErrorV2")),
+						"415": jsonResponse("the body is not a jpeg, png or gif", ref("ErrorV2")),
+						"500": jsonResponse("failed to store the image", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/admin/movies/{id}": {
+				"get": {
+					Summary:     "A movie with the ETag to send as If-Match when editing or deleting it",
+					OperationID: "getAdminMovie",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), pathParam("id", "movie id")},
+					Responses: map[string]Response{
+						"200": taggedResponse("the movie", ref("MovieV2"), "movie"),
+						"400": jsonResponse("invalid movie id", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("movie not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to load the movie", ref("ErrorV2")),
+					},
+				},
+				"patch": {
+					Summary:     "Change the fields of a movie, the edit is kept as a revision by the X-User-ID user or admin",
+					OperationID: "patchMovie",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), pathParam("id", "movie id"), ifMatchParam("movie"), authorParam()},
+					RequestBody: &RequestBody{Required: true, Content: jsonContent(ref("MoviePatchV2"))},
+					Responses: map[string]Response{
+						"200": taggedResponse("the revision of the edit, the latest revision when nothing changed", ref("RevisionV2"), "movie"),
+						"400": jsonResponse("invalid movie id, body or If-Match", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("movie not found", ref("ErrorV2")),
+						"409": jsonResponse("another movie has the title", ref("ErrorV2")),
+						"412": preconditionFailed(),
+						"428": preconditionRequired(),
+						"500": jsonResponse("failed to save movie", ref("ErrorV2")),
+					},
+				},
+				"delete": {
+					Summary:     "Move a movie to the trash with its ratings, it can be restored until the trash is purged",
+					OperationID: "deleteMovie",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), pathParam("id", "movie id"), ifMatchParam("movie")},
+					Responses: map[string]Response{
+						"204": {Description: "movie moved to the trash"},
+						"400": jsonResponse("invalid movie id or If-Match", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("movie not found", ref("ErrorV2")),
+						"412": preconditionFailed(),
+						"428": preconditionRequired(),
+						"500": jsonResponse("failed to update the trash", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/admin/movies/{id}/revisions/{revision}/rollback": {
+				"post": {
+					Summary:     "Bring a movie's fields and ratings back to a revision, recorded as a new revision",
+					OperationID: "postMovieRollback",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), pathParam("id", "movie id"), pathParam("revision", "revision to bring back"), authorParam()},
+					Responses: map[string]Response{
+						"200": taggedResponse("the revision of the rollback, the latest revision when nothing changed", ref("RevisionV2"), "movie"),
+						"400": jsonResponse("invalid movie id or revision", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("movie or revision not found", ref("ErrorV2")),
+						"409": jsonResponse("another movie has the title of the revision", ref("ErrorV2")),
+						"500": jsonResponse("failed to save movie", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/admin/movies/{id}/ratings": {
+				"get": {
+					Summary:     "The review sources' ratings of a movie with the ETag to send as If-Match when changing them",
+					OperationID: "getAdminMovieRatings",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), pathParam("id", "movie id")},
+					Responses: map[string]Response{
+						"200": taggedResponse("the ratings", ref("RatingListV2"), "ratings"),
+						"400": jsonResponse("invalid movie id", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("movie not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to load the ratings", ref("ErrorV2")),
+					},
+				},
+				"put": {
+					Summary:     "Change the rating a review source gave a movie, the previous value is kept in its history",
+					OperationID: "putSourceRating",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), pathParam("id", "movie id"), ifMatchParam("ratings"), authorParam()},
+					RequestBody: &RequestBody{Required: true, Content: jsonContent(ref("SourceRatingRequestV2"))},
+					Responses: map[string]Response{
+						"204": tagged(Response{Description: "rating saved"}, "ratings"),
+						"400": jsonResponse("invalid movie id, source, value or If-Match", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("movie not found", ref("ErrorV2")),
+						"412": preconditionFailed(),
+						"428": preconditionRequired(),
+						"500": jsonResponse("failed to save rating", ref("ErrorV2")),
+					},
+				},
+				"delete": {
+					Summary:     "Move the ratings of a movie to the trash, recorded as a revision by the X-User-ID user or admin",
+					OperationID: "deleteMovieRatings",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), pathParam("id", "movie id"), ifMatchParam("ratings"), authorParam()},
+					Responses: map[string]Response{
+						"204": {Description: "ratings moved to the trash"},
+						"400": jsonResponse("invalid movie id or If-Match", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("movie not found or it has no ratings", ref("ErrorV2")),
+						"412": preconditionFailed(),
+						"428": preconditionRequired(),
+						"500": jsonResponse("failed to update the trash", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/admin/movies/{id}/ratings/{source}": {
+				"delete": {
+					Summary:     "Move the rating a review source gave a movie to the trash, recorded as a revision",
+					OperationID: "deleteSourceRating",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), pathParam("id", "movie id"), ifMatchParam("ratings"), sourceParam(), authorParam()},
+					Responses: map[string]Response{
+						"204": tagged(Response{Description: "rating moved to the trash"}, "ratings"),
+						"400": jsonResponse("invalid movie id or If-Match", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("movie not found or the source has not rated it", ref("ErrorV2")),
+						"412": preconditionFailed(),
+						"428": preconditionRequired(),
+						"500": jsonResponse("failed to update the trash", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/admin/movies/{id}/restore": {
+				"post": {
+					Summary:     "Bring a movie back from the trash with the ratings deleted along with it",
+					OperationID: "postMovieRestore",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), pathParam("id", "movie id")},
+					Responses: map[string]Response{
+						"204": tagged(Response{Description: "movie restored"}, "movie"),
+						"400": jsonResponse("invalid movie id", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("the movie is not in the trash", ref("ErrorV2")),
+						"409": jsonResponse("a restored rating's source has rated the movie again since", ref("ErrorV2")),
+						"500": jsonResponse("failed to update the trash", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/admin/movies/{id}/ratings/restore": {
+				"post": {
+					Summary:     "Bring the ratings of a movie back from the trash, recorded as a revision",
+					OperationID: "postMovieRatingsRestore",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), pathParam("id", "movie id"), authorParam()},
+					Responses: map[string]Response{
+						"204": tagged(Response{Description: "ratings restored"}, "ratings"),
+						"400": jsonResponse("invalid movie id", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("the trash has no ratings of the movie", ref("ErrorV2")),
+						"409": jsonResponse("the movie is in the trash or a source has rated it again since", ref("ErrorV2")),
+						"500": jsonResponse("failed to update the trash", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/admin/movies/{id}/ratings/{source}/restore": {
+				"post": {
+					Summary:     "Bring back the last deleted rating a review source gave a movie, recorded as a revision",
+					OperationID: "postSourceRatingRestore",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), pathParam("id", "movie id"), sourceParam(), authorParam()},
+					Responses: map[string]Response{
+						"204": tagged(Response{Description: "rating restored"}, "ratings"),
+						"400": jsonResponse("invalid movie id", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("the trash has no rating of the source for the movie", ref("ErrorV2")),
+						"409": jsonResponse("the movie or its ratings are in the trash, or the source has rated it again since", ref("ErrorV2")),
+						"500": jsonResponse("failed to update the trash", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/trash": {
+				"get": {
+					Summary:     "The movies, movie ratings and ratings in the trash, the most recently deleted first",
+					OperationID: "getTrash",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam()},
+					Responses: map[string]Response{
+						"200": jsonResponse("the trash", ref("TrashListV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"500": jsonResponse("failed to load the trash", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/movies:batchCreate": {
+				"post": {
+					Summary:     "Create movies with their ratings, all or none of them in atomic mode, those that can be in per_item mode",
+					OperationID: "postMoviesBatchCreate",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), modeParam()},
+					RequestBody: &RequestBody{Required: true, Content: jsonContent(ref("BatchCreateRequestV2"))},
+					Responses: map[string]Response{
+						"200": jsonResponse("every movie was created", ref("BatchV2")),
+						"207": jsonResponse("some movies were created in per_item mode", ref("BatchV2")),
+						"400": jsonResponse("invalid body or mode, an empty batch, or an invalid movie of an atomic batch", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"409": jsonResponse("a movie of an atomic batch has a title that is taken", ref("BatchV2")),
+						"413": jsonResponse("the batch holds more than the maximum batch size", ref("ErrorV2")),
+						"500": jsonResponse("failed to create the movies", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/ratings:batchUpsert": {
+				"post": {
+					Summary:     "Set the ratings review sources gave movies, all or none of them in atomic mode, those that can be in per_item mode",
+					OperationID: "postRatingsBatchUpsert",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), modeParam(), authorParam()},
+					RequestBody: &RequestBody{Required: true, Content: jsonContent(ref("BatchUpsertRequestV2"))},
+					Responses: map[string]Response{
+						"200": jsonResponse("every rating was set", ref("BatchV2")),
+						"207": jsonResponse("some ratings were set in per_item mode", ref("BatchV2")),
+						"400": jsonResponse("invalid body or mode, an empty batch, or an invalid rating of an atomic batch", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("a rating of an atomic batch is of a movie that does not exist", ref("BatchV2")),
+						"412": jsonResponse("a rating of an atomic batch has a version that is not the current one", ref("BatchV2")),
+						"413": jsonResponse("the batch holds more than the maximum batch size", ref("ErrorV2")),
+						"500": jsonResponse("failed to set the ratings", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/movies:batchGet": {
+				"get": {
+					Summary:     "Get several movies by id, in the order of the ids",
+					OperationID: "getMoviesBatchGet",
+					Tags:        []string{"movies"},
+					Parameters: []Parameter{
+						queryParam("ids", "comma separated movie ids, the param can also be repeated", str()),
+						modeParam(),
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("every movie was found", ref("BatchV2")),
+						"207": jsonResponse("some movies were found in per_item mode", ref("BatchV2")),
+						"400": jsonResponse("invalid ids or mode, or no ids", ref("ErrorV2")),
+						"404": jsonResponse("a movie of an atomic batch was not found", ref("BatchV2")),
+						"413": jsonResponse("more ids than the maximum batch size", ref("ErrorV2")),
+						"500": jsonResponse("failed to load the movies", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/admin/webhooks": {
+				"get": {
+					Summary:     "List the webhook subscriptions, without their secrets",
+					OperationID: "getWebhooks",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam()},
+					Responses: map[string]Response{
+						"200": jsonResponse("the subscriptions", ref("WebhookListV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"500": jsonResponse("failed to load webhooks", ref("ErrorV2")),
+					},
+				},
+				"post": {
+					Summary: "Subscribe a url to events. Deliveries are signed with the secret, " +
+						"X-Webhook-Signature is sha256= and the hex HMAC-SHA256 of the X-Webhook-Timestamp, a dot and the body.",
+					OperationID: "postWebhook",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam()},
+					RequestBody: &RequestBody{Required: true, Content: jsonContent(ref("WebhookRequestV2"))},
+					Responses: map[string]Response{
+						"201": jsonResponse("the subscription with its secret, which is not returned again", ref("WebhookV2")),
+						"400": jsonResponse("invalid url or events", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"500": jsonResponse("failed to create the webhook", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/admin/webhooks/{id}": {
+				"get": {
+					Summary:     "Get a webhook subscription, without its secret",
+					OperationID: "getWebhook",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), pathParam("id", "webhook id")},
+					Responses: map[string]Response{
+						"200": jsonResponse("the subscription", ref("WebhookV2")),
+						"400": jsonResponse("invalid webhook id", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("webhook not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to load the webhook", ref("ErrorV2")),
+					},
+				},
+				"delete": {
+					Summary:     "Delete a webhook subscription and its pending deliveries",
+					OperationID: "deleteWebhook",
+					Tags:        []string{"admin"},
+					Parameters:  []Parameter{adminParam(), pathParam("id", "webhook id")},
+					Responses: map[string]Response{
+						"204": {Description: "webhook deleted"},
+						"400": jsonResponse("invalid webhook id", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("webhook not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to delete the webhook", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/admin/webhooks/{id}/deliveries": {
+				"get": {
+					Summary:     "The delivery log of a webhook, newest first",
+					OperationID: "getWebhookDeliveries",
+					Tags:        []string{"admin"},
+					Parameters: []Parameter{
+						adminParam(),
+						pathParam("id", "webhook id"),
+						queryParam("status", "only the deliveries with the status", &Schema{Type: "string", Enum: []string{"pending", "delivered", "dead"}}),
+						queryParam("limit", "maximum number of deliveries to return, at most and by default 100", integer()),
+					},
+					Responses: map[string]Response{
+						"200": jsonResponse("the deliveries", ref("WebhookDeliveryListV2")),
+						"400": jsonResponse("invalid webhook id, status or limit", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("webhook not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to load deliveries", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/admin/webhooks/{id}/deliveries/{delivery}/retry": {
+				"post": {
+					Summary:     "Queue a dead lettered or delivered delivery again",
+					OperationID: "postWebhookDeliveryRetry",
+					Tags:        []string{"admin"},
+					Parameters: []Parameter{
+						adminParam(),
+						pathParam("id", "webhook id"),
+						pathParam("delivery", "delivery id"),
+					},
+					Responses: map[string]Response{
+						"202": {Description: "delivery queued"},
+						"400": jsonResponse("invalid webhook or delivery id", ref("ErrorV2")),
+						"401": jsonResponse("missing or wrong admin token", ref("ErrorV2")),
+						"403": jsonResponse("admin routes are disabled", ref("ErrorV2")),
+						"404": jsonResponse("webhook or delivery not found", ref("ErrorV2")),
+						"500": jsonResponse("failed to queue the delivery", ref("ErrorV2")),
+					},
+				},
+			},
+			"/api/openapi.json": {
+				"get": {
+					Summary:     "This OpenAPI document",
+					OperationID: "getOpenAPI",
+					Tags:        []string{"docs"},
+					Responses: map[string]Response{
+						"200": jsonResponse("OpenAPI 3 document", &Schema{Type: "object"}),
+						"304": notModified(),
+					},
+				},
+			},
+			"/api/docs": {
+				"get": {
+					Summary:     "Interactive API documentation",
+					OperationID: "getDocs",
+					Tags:        []string{"docs"},
+					Responses: map[string]Response{
+						"200": {
+							Description: "html page rendering the OpenAPI document",
+							Content:     map[string]MediaType{"text/html": {Schema: str()}},
+						},
+					},
+				},
+			},
+			"/api/graphql": {
+				"get": {
+					Summary:     "Run a graphql query passed as query params, or open GraphiQL when there is no query",
+					OperationID: "getGraphQL",
+					Tags:        []string{"graphql"},
+					Parameters: []Parameter{
+						queryParam("query", "graphql query document", str()),
+						queryParam("operationName", "operation to run when the document has several", str()),
+						queryParam("variables", "json encoded variables", str()),
+					},
+					Responses: map[string]Response{
+						"200": {
+							Description: "graphql result, or the GraphiQL page when no query is given",
+							Content: map[string]MediaType{
+								"application/json": {Schema: ref("GraphQLResponse")},
+								"text/html":        {Schema: str()},
+							},
+						},
+						"304": notModified(),
+						"400": jsonResponse("invalid variables", ref("Error")),
+					},
+				},
+				"post": {
+					Summary:     "Run a graphql query",
+					OperationID: "postGraphQL",
+					Tags:        []string{"graphql"},
+					RequestBody: &RequestBody{Required: true, Content: jsonContent(ref("GraphQLRequest"))},
+					Responses: map[string]Response{
+						"200": jsonResponse("graphql result, query errors are reported in errors", ref("GraphQLResponse")),
+						"400": jsonResponse("invalid request body", ref("Error")),
+					},
+				},
+			},
+		},
+		Components: Components{
+			Schemas: map[string]*Schema{
+				"Health": object(map[string]*Schema{
+					"health": {Type: "string", Enum: []string{"OK"}},
+				}, "health"),
+				// Plot and Genre have no json tags on models.MoviesReturnObject so they keep their go names
+				"MoviesReturnObject": object(map[string]*Schema{
+					"title":          str(),
+					"ratings":        arrayOf(ref("Ratings")),
+					"average_rating": {Type: "integer", Description: "integer average of all rating values"},
+					"Plot":           str(),
+					"Genre":          {Type: "string", Description: "comma separated list of genres"},
+				}, "title", "ratings", "average_rating", "Plot", "Genre"),
+				"Ratings": object(map[string]*Schema{
+					"movie_ratings_id": integer(),
+					"movie_ratings":    {Ref: "#/components/schemas/MovieRatings", Nullable: true},
+					"source":           str(),
+					"value":            {Type: "integer", Description: "score out of 100"},
+				}, "source", "value"),
+				"MovieRatings": object(map[string]*Schema{
+					"ID":      integer(),
+					"Title":   str(),
+					"ratings": arrayOf(ref("Ratings")),
+				}),
+				"MovieV2": object(map[string]*Schema{
+					"id":             integer(),
+					"title":          str(),
+					"plot":           str(),
+					"genres":         arrayOf(str()),
+					"year":           str(),
+					"rated":          str(),
+					"average_rating": {Type: "integer", Description: "integer average of all rating values"},
+					"ratings":        arrayOf(ref("RatingV2")),
+					"poster":         {Ref: "#/components/schemas/ImageV2", Nullable: true},
+					"created_at":     dateTime(),
+					"updated_at":     dateTime(),
+				}, "id", "title", "plot", "genres", "year", "rated", "average_rating", "ratings", "poster", "created_at", "updated_at"),
+				"RatingV2": object(map[string]*Schema{
+					"source":     str(),
+					"value":      {Type: "integer", Description: "score out of 100"},
+					"created_at": dateTime(),
+					"updated_at": dateTime(),
+				}, "source", "value", "created_at", "updated_at"),
+				"MovieListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("MovieV2")),
+					"count": integer(),
+				}, "data", "count"),
+				"SimilarMovieV2": object(map[string]*Schema{
+					"movie":       ref("MovieV2"),
+					"score":       {Type: "number", Description: "between 0 and 1, 1 being the most similar"},
+					"explanation": arrayOf(str()),
+				}, "movie", "score", "explanation"),
+				"SimilarMovieListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("SimilarMovieV2")),
+					"count": integer(),
+				}, "data", "count"),
+				"UserRatingV2": object(map[string]*Schema{
+					"movie_id":   integer(),
+					"score":      {Type: "integer", Description: "between 0 and 100"},
+					"created_at": dateTime(),
+					"updated_at": dateTime(),
+				}, "movie_id", "score", "created_at", "updated_at"),
+				"UserRatingListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("UserRatingV2")),
+					"count": integer(),
+				}, "data", "count"),
+				"UserRatingRequestV2": object(map[string]*Schema{
+					"score": {Type: "integer", Description: "between 0 and 100"},
+				}, "score"),
+				"RecommendationV2": object(map[string]*Schema{
+					"movie_id":    integer(),
+					"title":       str(),
+					"rank":        {Type: "integer", Description: "1 is the best recommendation"},
+					"score":       number(),
+					"reason":      str(),
+					"computed_at": dateTime(),
+				}, "movie_id", "title", "rank", "score", "reason", "computed_at"),
+				"RecommendationListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("RecommendationV2")),
+					"count": integer(),
+				}, "data", "count"),
+				"ListEntryV2": object(map[string]*Schema{
+					"rank":    {Type: "integer", Description: "1 is the top of the list"},
+					"movie":   ref("MovieV2"),
+					"score":   {Type: "number", Description: "what the movies that are not pinned are ranked by"},
+					"reasons": arrayOf(str()),
+					"pinned":  {Type: "boolean"},
+				}, "rank", "movie", "score", "reasons", "pinned"),
+				"ListEntryListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("ListEntryV2")),
+					"count": integer(),
+				}, "data", "count"),
+				"ListOverrideV2": object(map[string]*Schema{
+					"movie_id":   integer(),
+					"action":     {Type: "string", Enum: []string{"pin", "exclude"}},
+					"reason":     str(),
+					"created_at": dateTime(),
+				}, "movie_id", "action", "reason", "created_at"),
+				"ListOverrideListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("ListOverrideV2")),
+					"count": integer(),
+				}, "data", "count"),
+				"ListOverrideRequestV2": object(map[string]*Schema{
+					"action": {Type: "string", Enum: []string{"pin", "exclude"}},
+					"reason": {Type: "string", Description: "shown as the reason a pinned movie is in the list"},
+				}, "action"),
+				"RatingHistoryV2": object(map[string]*Schema{
+					"movie_id": integer(),
+					"bucket":   str(),
+					"from":     dateTime(),
+					"to":       dateTime(),
+					"sources": arrayOf(object(map[string]*Schema{
+						"source": str(),
+						"points": arrayOf(ref("RatingPointV2")),
+					}, "source", "points")),
+					"average": arrayOf(object(map[string]*Schema{
+						"start": dateTime(),
+						"value": integer(),
+					}, "start", "value")),
+				}, "movie_id", "bucket", "from", "to", "sources", "average"),
+				"RatingPointV2": object(map[string]*Schema{
+					"start":        dateTime(),
+					"value":        {Type: "integer", Description: "the rating at the end of the bucket, carried forward when nothing was observed"},
+					"min":          integer(),
+					"max":          integer(),
+					"observations": {Type: "integer", Description: "how many times the rating changed in the bucket"},
+				}, "start", "value", "min", "max", "observations"),
+				"SourceRatingRequestV2": object(map[string]*Schema{
+					"source": str(),
+					"value":  {Type: "integer", Description: "between 0 and 100"},
+				}, "source", "value"),
+				"RevisionV2": object(map[string]*Schema{
+					"revision":      integer(),
+					"movie_id":      integer(),
+					"author":        {Type: "string", Description: "system for the revision kept before the first edit"},
+					"restored_from": {Type: "integer", Nullable: true, Description: "the revision a rollback brought back"},
+					"movie": object(map[string]*Schema{
+						"title":    str(),
+						"plot":     str(),
+						"genres":   arrayOf(str()),
+						"year":     str(),
+						"rated":    str(),
+						"director": str(),
+						"actors":   str(),
+						"released": str(),
+						"ratings":  {Type: "object", AdditionalProperties: integer(), Description: "rating by source"},
+					}, "title", "plot", "genres", "year", "rated", "director", "actors", "released", "ratings"),
+					"changes": arrayOf(object(map[string]*Schema{
+						"field":  {Type: "string", Description: "a movie field or ratings.<source>"},
+						"before": {Nullable: true, Description: "null when a rating was added"},
+						"after":  {Nullable: true, Description: "null when a rating was removed"},
+					}, "field", "before", "after")),
+					"created_at": dateTime(),
+				}, "revision", "movie_id", "author", "restored_from", "movie", "changes", "created_at"),
+				"RatingListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("RatingV2")),
+					"count": integer(),
+				}, "data", "count"),
+				"RevisionListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("RevisionV2")),
+					"count": integer(),
+				}, "data", "count"),
+				"ImageV2": object(map[string]*Schema{
+					"hash":         {Type: "string", Description: "sha256 of the uploaded image"},
+					"kind":         {Type: "string", Enum: []string{"poster", "still"}, Description: "left out of a movie's poster"},
+					"content_type": str(),
+					"width":        integer(),
+					"height":       integer(),
+					"size":         {Type: "integer", Description: "bytes"},
+					"url":          str(),
+					"thumbnails":   {Type: "array", Items: ref("ThumbnailV2"), Description: "smallest first, only those narrower than the image"},
+				}, "hash", "content_type", "width", "height", "size", "url", "thumbnails"),
+				"ThumbnailV2": object(map[string]*Schema{
+					"width":  integer(),
+					"height": integer(),
+					"url":    str(),
+				}, "width", "height", "url"),
+				"ImageListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("ImageV2")),
+					"count": integer(),
+				}, "data", "count"),
+				"TrashItemV2": object(map[string]*Schema{
+					"entity":     {Type: "string", Enum: []string{"movie", "movie_ratings", "rating"}},
+					"entity_id":  {Type: "string", Description: "the movie or movie ratings id, <movie ratings id>/<source> for ratings"},
+					"movie_id":   {Type: "integer", Description: "0 when no movie has the title any more"},
+					"title":      str(),
+					"source":     {Type: "string", Description: "only on ratings"},
+					"value":      {Type: "integer", Description: "only on ratings"},
+					"deleted_at": dateTime(),
+				}, "entity", "entity_id", "movie_id", "title", "deleted_at"),
+				"TrashListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("TrashItemV2")),
+					"count": integer(),
+				}, "data", "count"),
+				"BatchMovieV2": object(map[string]*Schema{
+					"title":    str(),
+					"plot":     str(),
+					"genre":    {Type: "string", Description: "comma separated genres"},
+					"year":     str(),
+					"rated":    str(),
+					"director": str(),
+					"actors":   str(),
+					"released": str(),
+					"ratings":  arrayOf(ref("SourceRatingRequestV2")),
+				}, "title"),
+				"BatchCreateRequestV2": object(map[string]*Schema{
+					"movies": arrayOf(ref("BatchMovieV2")),
+				}, "movies"),
+				"BatchRatingV2": object(map[string]*Schema{
+					"movie_id": integer(),
+					"source":   str(),
+					"value":    {Type: "integer", Description: "between 0 and 100"},
+					"version":  {Type: "integer", Description: "the version in the ETag of the movie's ratings, the rating is set whatever the version without it"},
+				}, "movie_id", "source", "value"),
+				"BatchUpsertRequestV2": object(map[string]*Schema{
+					"ratings": arrayOf(ref("BatchRatingV2")),
+				}, "ratings"),
+				"BatchItemV2": object(map[string]*Schema{
+					"index":   {Type: "integer", Description: "the position of the item in the request"},
+					"status":  {Type: "integer", Description: "the status the item would have got as a request of its own, 424 when an atomic batch left it out"},
+					"movie":   ref("MovieV2"),
+					"changed": {Type: "boolean", Description: "only on ratings, false when the source had already given the value"},
+					"error":   {Type: "string", Description: "only on items that failed"},
+				}, "index", "status"),
+				"BatchV2": object(map[string]*Schema{
+					"mode":   {Type: "string", Enum: []string{"atomic", "per_item"}},
+					"data":   arrayOf(ref("BatchItemV2")),
+					"count":  integer(),
+					"failed": integer(),
+				}, "mode", "data", "count", "failed"),
+				"MoviePatchV2": object(map[string]*Schema{
+					"title":    str(),
+					"plot":     str(),
+					"genre":    {Type: "string", Description: "comma separated genres"},
+					"year":     str(),
+					"rated":    str(),
+					"director": str(),
+					"actors":   str(),
+					"released": str(),
+				}),
+				"WatchlistEntryV2": object(map[string]*Schema{
+					"movie_id":   integer(),
+					"priority":   {Type: "integer", Description: "1, watch first, to 5"},
+					"notes":      str(),
+					"created_at": dateTime(),
+					"updated_at": dateTime(),
+				}, "movie_id", "priority", "notes", "created_at", "updated_at"),
+				"WatchlistListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("WatchlistEntryV2")),
+					"count": integer(),
+				}, "data", "count"),
+				"WatchlistRequestV2": object(map[string]*Schema{
+					"priority": {Type: "integer", Description: "1, watch first, to 5, defaults to 3"},
+					"notes":    str(),
+				}),
+				"DiaryEntryV2": object(map[string]*Schema{
+					"id":         integer(),
+					"movie_id":   integer(),
+					"watched_on": {Type: "string", Format: "date"},
+					"rewatch":    {Type: "boolean"},
+					"score":      {Type: "integer", Description: "the user's own score between 0 and 100", Nullable: true},
+					"notes":      str(),
+					"created_at": dateTime(),
+				}, "id", "movie_id", "watched_on", "rewatch", "score", "notes", "created_at"),
+				"DiaryListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("DiaryEntryV2")),
+					"count": integer(),
+				}, "data", "count"),
+				"DiaryRequestV2": object(map[string]*Schema{
+					"movie_id":   integer(),
+					"watched_on": {Type: "string", Format: "date", Description: "defaults to today"},
+					"rewatch":    {Type: "boolean", Description: "defaults to whether the diary already has the movie"},
+					"score":      {Type: "integer", Description: "between 0 and 100"},
+					"notes":      str(),
+				}, "movie_id"),
+				"DiaryStatsV2": object(map[string]*Schema{
+					"watched":       integer(),
+					"rewatches":     integer(),
+					"scored":        {Type: "integer", Description: "how many entries have a score"},
+					"average_score": {Type: "number", Description: "0 when no entry has a score"},
+					"by_month":      arrayOf(diaryGroup("month")),
+					"by_genre":      arrayOf(diaryGroup("genre")),
+				}, "watched", "rewatches", "scored", "average_score", "by_month", "by_genre"),
+				"WebhookV2": object(map[string]*Schema{
+					"id":         integer(),
+					"url":        str(),
+					"events":     arrayOf(webhookEvent()),
+					"secret":     {Type: "string", Description: "only returned when the subscription is created"},
+					"created_at": dateTime(),
+				}, "id", "url", "events", "created_at"),
+				"WebhookListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("WebhookV2")),
+					"count": integer(),
+				}, "data", "count"),
+				"WebhookRequestV2": object(map[string]*Schema{
+					"url":    str(),
+					"events": arrayOf(webhookEvent()),
+					"secret": {Type: "string", Description: "signs the deliveries, a random one is made up when it is empty"},
+				}, "url", "events"),
+				"WebhookDeliveryV2": object(map[string]*Schema{
+					"id":               integer(),
+					"event_id":         str(),
+					"event":            webhookEvent(),
+					"status":           {Type: "string", Enum: []string{"pending", "delivered", "dead"}},
+					"attempts":         integer(),
+					"next_attempt_at":  {Type: "string", Format: "date-time", Nullable: true},
+					"last_attempt_at":  {Type: "string", Format: "date-time", Nullable: true},
+					"last_status_code": {Type: "integer", Description: "0 when the receiver could not be reached"},
+					"last_error":       str(),
+					"delivered_at":     {Type: "string", Format: "date-time", Nullable: true},
+					"created_at":       dateTime(),
+					"payload":          {Type: "object", Description: "the posted body, with id, type, created_at and data"},
+				}, "id", "event_id", "event", "status", "attempts", "created_at", "payload"),
+				"WebhookDeliveryListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("WebhookDeliveryV2")),
+					"count": integer(),
+				}, "data", "count"),
+				"ChangeV2": object(map[string]*Schema{
+					"id":         {Type: "integer", Format: "int64"},
+					"event_id":   {Type: "string", Description: "the id of the event published for the change, if any"},
+					"type":       {Type: "string", Description: "the type of the event published for the change, if any"},
+					"entity":     {Type: "string", Enum: []string{"movie", "movie_ratings", "rating", "movie_image"}},
+					"entity_id":  {Type: "string", Description: "ratings are <movie ratings id>/<source>, movie images <movie id>/<hash>"},
+					"operation":  {Type: "string", Enum: []string{"create", "update", "delete"}},
+					"before":     {Type: "object", Nullable: true, Description: "null on create"},
+					"after":      {Type: "object", Nullable: true, Description: "null on delete"},
+					"created_at": dateTime(),
+				}, "id", "entity", "entity_id", "operation", "before", "after", "created_at"),
+				"ChangeListV2": object(map[string]*Schema{
+					"data":  arrayOf(ref("ChangeV2")),
+					"count": integer(),
+					"next":  {Type: "integer", Format: "int64", Description: "the since param of the next page"},
+				}, "data", "count", "next"),
+				"Event": object(map[string]*Schema{
+					"id":         str(),
+					"type":       {Type: "string", Enum: []string{"movie.created", "movie.updated", "movie.deleted", "rating.created", "rating.updated", "rating.deleted"}},
+					"created_at": dateTime(),
+					"data":       {Type: "object", Description: "the movie for movie events, the source's rating for rating events"},
+				}, "id", "type", "created_at", "data"),
+				"StreamMessageV2": object(map[string]*Schema{
+					"type":  {Type: "string", Enum: []string{"event", "heartbeat", "reset"}},
+					"id":    {Type: "string", Description: "position of the event in the stream, only on events"},
+					"event": ref("Event"),
+				}, "type"),
+				"StreamRequestV2": object(map[string]*Schema{
+					"movie_ids":     arrayOf(integer()),
+					"last_event_id": {Type: "string", Description: "defaults to the last event sent on the connection"},
+				}),
+				"ErrorV2": object(map[string]*Schema{
+					"error": object(map[string]*Schema{
+						"status":  integer(),
+						"message": str(),
+					}, "status", "message"),
+				}, "error"),
+				"GraphQLRequest": object(map[string]*Schema{
+					"query":         str(),
+					"operationName": str(),
+					"variables":     {Type: "object"},
+				}, "query"),
+				"GraphQLResponse": object(map[string]*Schema{
+					"data":   {Type: "object", Nullable: true},
+					"errors": arrayOf(object(map[string]*Schema{"message": str()})),
+				}),
+				"Error": {Type: "object", Description: "errors are encoded as json objects and may be empty"},
+			},
+		},
+	}
+
+	idempotent(spec)
+	return spec
+}
+
+func webhookEvent() *Schema {
+	return &Schema{Type: "string", Enum: []string{"*", "movie.created", "movie.updated", "movie.deleted", "rating.created", "rating.updated", "rating.deleted"}}
+}
+
+// diaryGroup is the schema of the diary stats of a month or a genre
+func diaryGroup(key string) *Schema {
+	return object(map[string]*Schema{
+		key:             str(),
+		"watched":       integer(),
+		"rewatches":     integer(),
+		"scored":        integer(),
+		"average_score": number(),
+	}, key, "watched", "rewatches", "scored", "average_score")
+}
+
+func v1MoviesResponses() map[string]Response {
+	return map[string]Response{
+		"200": jsonResponse("movies", arrayOf(ref("MoviesReturnObject"))),
+		"304": notModified(),
+		"500": jsonResponse("failed to load movies", ref("Error")),
+	}
+}
+
+// idempotent documents the Idempotency-Key header on every POST and PATCH
+func idempotent(spec *Document) {
+	for _, item := range spec.Paths {
+		for method, operation := range item {
+			if method != "post" && method != "patch" {
+				continue
+			}
+
+			operation.Parameters = append(operation.Parameters, idempotencyKeyParam())
+			operation.Responses["422"] = jsonResponse("the Idempotency-Key was already used for a different request", ref("ErrorV2"))
+			if _, ok := operation.Responses["409"]; !ok {
+				operation.Responses["409"] = jsonResponse("a request with the Idempotency-Key is still in progress", ref("ErrorV2"))
+			}
+			item[method] = operation
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package openapi
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"sort"
+	"strings"
+)
+
+// Verify diffs the routes registered on the router against the paths in the document
+// and returns one message per route or operation that only exists on one side.
+func Verify(r *mux.Router, doc *Document) ([]string, error) {
+	registered := map[string]bool{}
+
+	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			// subrouters only carry a path prefix
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		for _, method := range methods {
+			registered[operationKey(method, path)] = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk router: %s", err.Error())
+	}
+
+	documented := map[string]bool{}
+	for path, item := range doc.Paths {
+		for method := range item {
+			documented[operationKey(method, path)] = true
+		}
+	}
+
+	var mismatches []string
+	for key := range registered {
+		if !documented[key] {
+			mismatches = append(mismatches, fmt.Sprintf("%s is registered but missing from the spec", key))
+		}
+	}
+	for key := range documented {
+		if !registered[key] {
+			mismatches = append(mismatches, fmt.Sprintf("%s is in the spec but not registered", key))
+		}
+	}
+
+	sort.Strings(mismatches)
+
+	return mismatches, nil
+}
+
+func operationKey(method string, path string) string {
+	return fmt.Sprintf("%s %s", strings.ToUpper(method), path)
+}
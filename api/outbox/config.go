@@ -0,0 +1,115 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ConfigPath is where the playground docker-compose mounts its config directory
+const ConfigPath = "/config/outbox.json"
+
+// The kinds of sink
+const (
+	SinkWebhooks = "webhooks"
+	SinkStdout   = "stdout"
+	SinkFile     = "file"
+	SinkNATS     = "nats"
+)
+
+type Config struct {
+	// PollInterval is how often the change log is checked for changes a sink has not published yet,
+	// as a time.ParseDuration string. Changes made by this replica are relayed straight away.
+	PollInterval string `json:"poll_interval"`
+	// BatchSize is how many changes are published to a sink at once
+	BatchSize int          `json:"batch_size"`
+	Sinks     []SinkConfig `json:"sinks"`
+}
+
+type SinkConfig struct {
+	// Type is one of SinkWebhooks, SinkStdout, SinkFile or SinkNATS
+	Type string `json:"type"`
+	// Name keeps the sink's position in the change log, it defaults to the type.
+	// Renaming a sink publishes the whole change log to it again.
+	Name string `json:"name,omitempty"`
+	// Path is the file that file sinks append json lines to
+	Path string `json:"path,omitempty"`
+	// URL is the nats://host:port of the server nats sinks publish to
+	URL string `json:"url,omitempty"`
+	// Subject prefixes the subjects nats sinks publish to, changes go to <subject>.<entity>.<operation>
+	Subject string `json:"subject,omitempty"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		PollInterval: "1s",
+		BatchSize:    100,
+		Sinks:        []SinkConfig{{Type: SinkWebhooks}},
+	}
+}
+
+// LoadConfig reads the config file at path, DefaultConfig is returned when the file does not exist
+func LoadConfig(path string) (Config, error) {
+	bytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read outbox config: %s", err.Error())
+	}
+
+	config := DefaultConfig()
+	err = json.Unmarshal(bytes, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse outbox config: %s", err.Error())
+	}
+
+	_, err = config.pollInterval()
+	return config, err
+}
+
+func (c Config) pollInterval() (time.Duration, error) {
+	interval, err := time.ParseDuration(c.PollInterval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid outbox poll_interval: %s", err.Error())
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("outbox poll_interval must be positive")
+	}
+	if c.BatchSize <= 0 {
+		return 0, fmt.Errorf("outbox batch_size must be positive")
+	}
+
+	names := map[string]bool{}
+	for _, sink := range c.Sinks {
+		switch sink.Type {
+		case SinkWebhooks, SinkStdout:
+		case SinkFile:
+			if sink.Path == "" {
+				return 0, fmt.Errorf("outbox file sinks need a path")
+			}
+		case SinkNATS:
+			if sink.URL == "" {
+				return 0, fmt.Errorf("outbox nats sinks need a url")
+			}
+		default:
+			return 0, fmt.Errorf("unknown outbox sink %q", sink.Type)
+		}
+
+		if names[sink.name()] {
+			return 0, fmt.Errorf("outbox sink %q is configured twice, give them different names", sink.name())
+		}
+		names[sink.name()] = true
+	}
+
+	return interval, nil
+}
+
+func (s SinkConfig) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+
+	return s.Type
+}
@@ -0,0 +1,129 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"movie-rating-api/db"
+	"movie-rating-api/models"
+	"time"
+)
+
+// Sink is somewhere the change log is published to. Changes are published at least once and in order,
+// a batch that fails is published again.
+type Sink interface {
+	Publish(changes []models.ChangeEvents) error
+}
+
+// Relay publishes the change log to the configured sinks, each sink keeps its own position
+type Relay struct {
+	client       db.Client
+	sinks        map[string]Sink
+	pollInterval time.Duration
+	batchSize    int
+	// wake is signalled when this replica commits an event so it is relayed without waiting for the poll
+	wake chan struct{}
+}
+
+func NewRelay(client db.Client, config Config) (*Relay, error) {
+	pollInterval, err := config.pollInterval()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Relay{
+		client:       client,
+		sinks:        map[string]Sink{},
+		pollInterval: pollInterval,
+		batchSize:    config.BatchSize,
+		wake:         make(chan struct{}, 1),
+	}
+
+	for _, sinkConfig := range config.Sinks {
+		r.sinks[sinkConfig.name()] = newSink(client, sinkConfig)
+	}
+
+	client.OnEvent(func(db.Event) {
+		select {
+		case r.wake <- struct{}{}:
+		default:
+		}
+	})
+
+	return r, nil
+}
+
+func newSink(client db.Client, config SinkConfig) Sink {
+	switch config.Type {
+	case SinkStdout:
+		return stdoutSink{}
+	case SinkFile:
+		return fileSink{path: config.Path}
+	case SinkNATS:
+		return newNATSSink(config.URL, config.Subject)
+	default:
+		return webhookSink{client: client}
+	}
+}
+
+// Run relays the changes every poll interval, and whenever this replica commits one, until the context is done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for name, err := range r.RunOnce() {
+			log.Printf("failed to relay changes to the %s sink: %s\n", name, err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// RunOnce publishes every change the sinks have not published yet and returns the errors by sink
+func (r *Relay) RunOnce() map[string]error {
+	errs := map[string]error{}
+	for name, sink := range r.sinks {
+		for {
+			published, ok, err := r.client.RelayChanges(name, r.batchSize, sink.Publish)
+			if err != nil {
+				errs[name] = err
+				break
+			}
+			// another replica is relaying to the sink, or it is up to date
+			if !ok || published < r.batchSize {
+				break
+			}
+		}
+	}
+
+	return errs
+}
+
+// webhookSink queues the events of the changes for the webhook subscriptions, the webhook dispatcher delivers them.
+// It queues outside the relay's transaction, which is safe because queueing an event that is already queued does nothing,
+// so a batch published again after its cursor failed to move is not delivered twice.
+type webhookSink struct {
+	client db.Client
+}
+
+func (s webhookSink) Publish(changes []models.ChangeEvents) error {
+	for _, change := range changes {
+		event, ok := db.ChangeEvent(change)
+		if !ok {
+			continue
+		}
+
+		_, err := s.client.EnqueueWebhookEvent(event)
+		if err != nil {
+			return fmt.Errorf("failed to queue event %s: %s", event.ID, err.Error())
+		}
+	}
+
+	return nil
+}
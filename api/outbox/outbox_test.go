@@ -0,0 +1,115 @@
+package outbox
+
+import (
+	"fmt"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"movie-rating-api/models"
+	"testing"
+)
+
+// recordingSink keeps the ids of the changes published to it and fails while failing is set
+type recordingSink struct {
+	ids     []int64
+	failing bool
+}
+
+func (s *recordingSink) Publish(changes []models.ChangeEvents) error {
+	if s.failing {
+		return fmt.Errorf("sink is down")
+	}
+	for _, change := range changes {
+		s.ids = append(s.ids, change.ID)
+	}
+	return nil
+}
+
+func newTestRelay(t *testing.T, client db.Client, sinks map[string]Sink) *Relay {
+	config := DefaultConfig()
+	config.BatchSize = 2
+	config.Sinks = nil
+	relay, err := NewRelay(client, config)
+	if err != nil {
+		t.Fatalf("failed to create relay: %s", err.Error())
+	}
+	relay.sinks = sinks
+	return relay
+}
+
+func createMovies(t *testing.T, client db.Client, titles ...string) {
+	for _, title := range titles {
+		err := client.CreateMovie(models.Movies{Title: title})
+		if err != nil {
+			t.Fatalf("failed to create movie: %s", err.Error())
+		}
+	}
+}
+
+func TestRelayPublishesEveryChangeOnceInOrder(t *testing.T) {
+	client, _ := dbtest.NewSQLite(t)
+	first, second := &recordingSink{}, &recordingSink{}
+	relay := newTestRelay(t, client, map[string]Sink{"first": first, "second": second})
+
+	// more changes than fit in a batch
+	createMovies(t, client, "Brazil", "Delicatessen", "Amélie")
+	second.failing = true
+	errs := relay.RunOnce()
+	if len(errs) != 1 || errs["second"] == nil {
+		t.Fatalf("expected the second sink to fail, got %v", errs)
+	}
+	if len(first.ids) != 3 || first.ids[0] != 1 || first.ids[2] != 3 {
+		t.Fatalf("expected every change in order, got %v", first.ids)
+	}
+
+	// the failed sink catches up from its own cursor, the other only gets what is new
+	second.failing = false
+	createMovies(t, client, "Alien")
+	if errs := relay.RunOnce(); len(errs) != 0 {
+		t.Fatalf("failed to relay: %v", errs)
+	}
+	if len(first.ids) != 4 || first.ids[3] != 4 {
+		t.Fatalf("expected the first sink to get the new change once, got %v", first.ids)
+	}
+	if len(second.ids) != 4 || second.ids[0] != 1 || second.ids[3] != 4 {
+		t.Fatalf("expected the second sink to catch up, got %v", second.ids)
+	}
+
+	if errs := relay.RunOnce(); len(errs) != 0 || len(first.ids) != 4 || len(second.ids) != 4 {
+		t.Fatalf("expected nothing to publish when up to date, got %v %v %v", errs, first.ids, second.ids)
+	}
+}
+
+func TestWebhookSinkQueuesEachEventOnce(t *testing.T) {
+	client, _ := dbtest.NewSQLite(t)
+	subscription, err := client.CreateWebhookSubscription(models.WebhookSubscriptions{URL: "http://example.com", Events: "*"})
+	if err != nil {
+		t.Fatalf("failed to create subscription: %s", err.Error())
+	}
+	createMovies(t, client, "Brazil", "Delicatessen")
+
+	changes, err := client.GetChanges(0, 10)
+	if err != nil {
+		t.Fatalf("failed to get changes: %s", err.Error())
+	}
+	sink := webhookSink{client: client}
+	// publishing a batch again, as after the cursor failed to move, queues nothing new
+	for i := 0; i < 2; i++ {
+		err = sink.Publish(changes)
+		if err != nil {
+			t.Fatalf("failed to publish: %s", err.Error())
+		}
+	}
+
+	deliveries, err := client.GetWebhookDeliveries(subscription.ID, db.DeliveryPending, 10)
+	if err != nil {
+		t.Fatalf("failed to get deliveries: %s", err.Error())
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("expected a delivery per event, got %d", len(deliveries))
+	}
+	event, _ := db.ChangeEvent(changes[0])
+	queued, err := client.EnqueueWebhookEvent(event)
+	if err != nil || queued != 0 {
+		t.Fatalf("expected an event that is already queued to queue nothing, got %d %v", queued, err)
+	}
+}
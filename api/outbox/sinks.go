@@ -0,0 +1,191 @@
+package outbox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"movie-rating-api/dto"
+	"movie-rating-api/models"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jsonLines encodes the changes as one json object per line
+func jsonLines(changes []models.ChangeEvents) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for _, change := range changes {
+		err := encoder.Encode(dto.NewChangeV2(change))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// stdoutSink prints the changes as json lines
+type stdoutSink struct{}
+
+func (stdoutSink) Publish(changes []models.ChangeEvents) error {
+	lines, err := jsonLines(changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(lines)
+	return err
+}
+
+// fileSink appends the changes to a file as json lines
+type fileSink struct {
+	path string
+}
+
+func (s fileSink) Publish(changes []models.ChangeEvents) error {
+	lines, err := jsonLines(changes)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(lines)
+	if err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+// natsTimeout bounds connecting to and every exchange with the nats server
+const natsTimeout = 5 * time.Second
+
+// natsSink publishes every change to <subject>.<entity>.<operation> over the nats text protocol,
+// so any nats compatible broker can fan them out. https://docs.nats.io/reference/reference-protocols/nats-protocol
+type natsSink struct {
+	address string
+	subject string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newNATSSink(rawURL string, subject string) *natsSink {
+	address := rawURL
+	parsed, err := url.Parse(rawURL)
+	if err == nil && parsed.Host != "" {
+		address = parsed.Host
+	}
+	if subject == "" {
+		subject = "changes"
+	}
+
+	return &natsSink{address: address, subject: subject}
+}
+
+func (s *natsSink) Publish(changes []models.ChangeEvents) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.publish(changes)
+	if err != nil && s.conn != nil {
+		// the next batch reconnects
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	return err
+}
+
+func (s *natsSink) publish(changes []models.ChangeEvents) error {
+	if s.conn == nil {
+		err := s.connect()
+		if err != nil {
+			return fmt.Errorf("failed to connect to nats at %s: %s", s.address, err.Error())
+		}
+	}
+
+	err := s.conn.SetDeadline(time.Now().Add(natsTimeout))
+	if err != nil {
+		return err
+	}
+
+	var buffer bytes.Buffer
+	for _, change := range changes {
+		payload, err := json.Marshal(dto.NewChangeV2(change))
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(&buffer, "PUB %s.%s.%s %d\r\n", s.subject, change.Entity, change.Operation, len(payload))
+		buffer.Write(payload)
+		buffer.WriteString("\r\n")
+	}
+	// the server answers PONG once it has processed everything sent before the PING
+	buffer.WriteString("PING\r\n")
+
+	_, err = s.conn.Write(buffer.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return s.awaitPong()
+}
+
+func (s *natsSink) connect() error {
+	conn, err := net.DialTimeout("tcp", s.address, natsTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+
+	err = conn.SetDeadline(time.Now().Add(natsTimeout))
+	if err != nil {
+		return err
+	}
+
+	// the server greets with INFO before anything else
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO") {
+		return fmt.Errorf("expected INFO, got %q", strings.TrimSpace(line))
+	}
+
+	_, err = conn.Write([]byte("CONNECT {\"verbose\":false,\"pedantic\":false,\"name\":\"movie-rating-api\"}\r\n"))
+	return err
+}
+
+func (s *natsSink) awaitPong() error {
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			_, err = s.conn.Write([]byte("PONG\r\n"))
+			if err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", line)
+		}
+	}
+}
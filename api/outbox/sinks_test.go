@@ -0,0 +1,239 @@
+package outbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"movie-rating-api/dto"
+	"movie-rating-api/models"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testChanges(ids ...int64) []models.ChangeEvents {
+	var changes []models.ChangeEvents
+	for _, id := range ids {
+		changes = append(changes, models.ChangeEvents{
+			ID:        id,
+			Entity:    "movie",
+			EntityID:  strconv.FormatInt(id, 10),
+			Operation: "update",
+			After:     fmt.Sprintf(`{"ID":%d}`, id),
+			CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	return changes
+}
+
+// decodeLines decodes json lines as the changes the sinks publish
+func decodeLines(t *testing.T, lines string) []dto.ChangeV2 {
+	var changes []dto.ChangeV2
+	for _, line := range strings.Split(strings.TrimSpace(lines), "\n") {
+		var change dto.ChangeV2
+		err := json.Unmarshal([]byte(line), &change)
+		if err != nil {
+			t.Fatalf("failed to decode %q: %s", line, err.Error())
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func TestFileSinkAppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.jsonl")
+	sink := fileSink{path: path}
+
+	for _, batch := range [][]models.ChangeEvents{testChanges(1, 2), testChanges(3)} {
+		err := sink.Publish(batch)
+		if err != nil {
+			t.Fatalf("failed to publish: %s", err.Error())
+		}
+	}
+
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %s", err.Error())
+	}
+	changes := decodeLines(t, string(bytes))
+	if len(changes) != 3 || changes[0].ID != 1 || changes[2].ID != 3 {
+		t.Fatalf("expected the three changes in order, got %v", changes)
+	}
+	if string(changes[0].After) != `{"ID":1}` || string(changes[0].Before) != "null" {
+		t.Fatalf("expected the entity json as is, got before %s after %s", changes[0].Before, changes[0].After)
+	}
+
+	err = fileSink{path: filepath.Join(t.TempDir(), "missing", "changes.jsonl")}.Publish(testChanges(1))
+	if err == nil {
+		t.Fatalf("expected a file that cannot be created to fail")
+	}
+}
+
+func TestStdoutSinkPrintsJSONLines(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %s", err.Error())
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	err = stdoutSink{}.Publish(testChanges(1, 2))
+	os.Stdout = stdout
+	writer.Close()
+	if err != nil {
+		t.Fatalf("failed to publish: %s", err.Error())
+	}
+
+	bytes, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read stdout: %s", err.Error())
+	}
+	if changes := decodeLines(t, string(bytes)); len(changes) != 2 || changes[1].ID != 2 {
+		t.Fatalf("expected the two changes, got %v", changes)
+	}
+}
+
+// natsServer is a stand-in for a nats server that keeps what is published to it.
+// It answers a PING with reply, PONG unless a test wants an error.
+type natsServer struct {
+	listener net.Listener
+
+	mu    sync.Mutex
+	reply string
+	// published receives the subject and payload of every PUB
+	published chan [2]string
+	// connections counts the clients that connected
+	connections chan struct{}
+}
+
+func newNATSServer(t *testing.T) *natsServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err.Error())
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &natsServer{listener: listener, reply: "PONG", published: make(chan [2]string, 16), connections: make(chan struct{}, 16)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.connections <- struct{}{}
+			go s.serve(t, conn)
+		}
+	}()
+	return s
+}
+
+func (s *natsServer) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	fmt.Fprint(conn, "INFO {\"server_id\":\"test\"}\r\n")
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "CONNECT", "PONG":
+		case "PUB":
+			size, err := strconv.Atoi(fields[2])
+			if err != nil {
+				t.Errorf("unexpected PUB %q", line)
+				return
+			}
+			payload := make([]byte, size+2)
+			_, err = io.ReadFull(reader, payload)
+			if err != nil {
+				return
+			}
+			s.published <- [2]string{fields[1], string(payload[:size])}
+		case "PING":
+			// the server pings too, the client has to answer before its PONG arrives
+			fmt.Fprintf(conn, "PING\r\n%s\r\n", s.pingReply())
+		default:
+			t.Errorf("unexpected nats command %q", line)
+		}
+	}
+}
+
+func (s *natsServer) pingReply() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reply
+}
+
+func (s *natsServer) setPingReply(reply string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reply = reply
+}
+
+func TestNATSSinkPublishesEveryChange(t *testing.T) {
+	server := newNATSServer(t)
+	sink := newNATSSink("nats://"+server.listener.Addr().String(), "movies")
+
+	for _, batch := range [][]models.ChangeEvents{testChanges(1, 2), testChanges(3)} {
+		err := sink.Publish(batch)
+		if err != nil {
+			t.Fatalf("failed to publish: %s", err.Error())
+		}
+	}
+
+	for id := int64(1); id <= 3; id++ {
+		published := <-server.published
+		if published[0] != "movies.movie.update" {
+			t.Fatalf("expected the entity and operation in the subject, got %s", published[0])
+		}
+		var change dto.ChangeV2
+		err := json.Unmarshal([]byte(published[1]), &change)
+		if err != nil || change.ID != id {
+			t.Fatalf("expected change %d, got %s", id, published[1])
+		}
+	}
+	if len(server.connections) != 1 {
+		t.Fatalf("expected the batches to share a connection, got %d", len(server.connections))
+	}
+}
+
+func TestNATSSinkReconnectsAfterAnError(t *testing.T) {
+	server := newNATSServer(t)
+	server.setPingReply("-ERR 'Authorization Violation'")
+	sink := newNATSSink(server.listener.Addr().String(), "")
+
+	err := sink.Publish(testChanges(1))
+	if err == nil || !strings.Contains(err.Error(), "Authorization Violation") {
+		t.Fatalf("expected the server's error, got %v", err)
+	}
+	if published := <-server.published; published[0] != "changes.movie.update" {
+		t.Fatalf("expected the default subject, got %s", published[0])
+	}
+
+	server.setPingReply("PONG")
+	err = sink.Publish(testChanges(1))
+	if err != nil {
+		t.Fatalf("failed to publish again: %s", err.Error())
+	}
+	if len(server.connections) != 2 {
+		t.Fatalf("expected the failed connection to be replaced, got %d connections", len(server.connections))
+	}
+
+	unreachable := newNATSSink("nats://127.0.0.1:1", "")
+	err = unreachable.Publish(testChanges(1))
+	if err == nil || !strings.Contains(err.Error(), "failed to connect to nats") {
+		t.Fatalf("expected a connection error, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ConfigPath is where the playground docker-compose mounts its config directory
+const ConfigPath = "/config/ratelimit.json"
+
+const (
+	KeyByIP     = "ip"
+	KeyByAPIKey = "api_key"
+	KeyByUser   = "user"
+
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+type Config struct {
+	// Enabled turns the middleware on, every request is let through when false
+	Enabled bool `json:"enabled"`
+	// Key is what clients are told apart by, one of KeyByIP, KeyByAPIKey or KeyByUser
+	Key string `json:"key"`
+	// APIKeys are the X-API-Key values of known clients. The headers are not authenticated otherwise,
+	// so KeyByAPIKey only gives these keys a bucket of their own and KeyByUser only trusts X-User-ID on requests
+	// with one of them, such as from a frontend that signs its users in. Every other request is limited by ip.
+	APIKeys []string `json:"api_keys"`
+	// TrustForwardedFor uses the first X-Forwarded-For address as the client ip, only turn on behind a proxy
+	TrustForwardedFor bool `json:"trust_forwarded_for"`
+	// Store is where the buckets are kept, StorePostgres shares limits between api replicas
+	Store string `json:"store"`
+	// Default applies to every route that is not in Routes
+	Default Limit `json:"default"`
+	// Routes maps a mux path template such as /api/movies to its limit
+	Routes map[string]Limit `json:"routes"`
+}
+
+type Limit struct {
+	// Requests are allowed every Per on average
+	Requests int `json:"requests"`
+	// Per is a time.ParseDuration string such as "1m"
+	Per string `json:"per"`
+	// Burst is how many requests can be made at once, defaults to Requests
+	Burst int `json:"burst"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled: true,
+		Key:     KeyByIP,
+		Store:   StoreMemory,
+		Default: Limit{Requests: 120, Per: "1m", Burst: 20},
+		Routes: map[string]Limit{
+			// every call to /api/movies takes a db connection for several seconds
+			"/api/movies":                 {Requests: 10, Per: "1m", Burst: 3},
+			"/api/v1/movies":              {Requests: 10, Per: "1m", Burst: 3},
+			"/api/v2/movies":              {Requests: 10, Per: "1m", Burst: 3},
+			"/api/v2/movies/{id}":         {Requests: 10, Per: "1m", Burst: 3},
+			"/api/v2/movies/{id}/similar": {Requests: 10, Per: "1m", Burst: 3},
+		},
+	}
+}
+
+// LoadConfig reads the config file at path, DefaultConfig is returned when the file does not exist
+func LoadConfig(path string) (Config, error) {
+	bytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read rate limit config: %s", err.Error())
+	}
+
+	config := DefaultConfig()
+	err = json.Unmarshal(bytes, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse rate limit config: %s", err.Error())
+	}
+
+	return config, config.Validate()
+}
+
+func (c Config) Validate() error {
+	switch c.Key {
+	case KeyByIP:
+	case KeyByAPIKey, KeyByUser:
+		if len(c.APIKeys) == 0 {
+			return fmt.Errorf("rate limit key %q needs api_keys to tell the clients it trusts", c.Key)
+		}
+	default:
+		return fmt.Errorf("unknown rate limit key %q", c.Key)
+	}
+
+	switch c.Store {
+	case StoreMemory, StorePostgres:
+	default:
+		return fmt.Errorf("unknown rate limit store %q", c.Store)
+	}
+
+	if _, _, err := c.Default.bucket(); err != nil {
+		return fmt.Errorf("invalid default rate limit: %s", err.Error())
+	}
+
+	for route, limit := range c.Routes {
+		if _, _, err := limit.bucket(); err != nil {
+			return fmt.Errorf("invalid rate limit for %s: %s", route, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// bucket returns the capacity and refill rate of the token bucket enforcing the limit
+func (l Limit) bucket() (float64, float64, error) {
+	if l.Requests <= 0 {
+		return 0, 0, fmt.Errorf("requests must be positive")
+	}
+
+	per, err := time.ParseDuration(l.Per)
+	if err != nil {
+		return 0, 0, err
+	}
+	if per <= 0 {
+		return 0, 0, fmt.Errorf("per must be positive")
+	}
+
+	capacity := l.Burst
+	if capacity <= 0 {
+		capacity = l.Requests
+	}
+
+	return float64(capacity), float64(l.Requests) / per.Seconds(), nil
+}
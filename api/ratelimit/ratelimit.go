@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+	UserHeader   = "X-User-ID"
+)
+
+type Limiter struct {
+	config  Config
+	apiKeys map[string]bool
+	store   Store
+	now     func() time.Time
+}
+
+func NewLimiter(config Config, store Store) *Limiter {
+	apiKeys := map[string]bool{}
+	for _, key := range config.APIKeys {
+		apiKeys[key] = true
+	}
+
+	return &Limiter{
+		config:  config,
+		apiKeys: apiKeys,
+		store:   store,
+		now:     time.Now,
+	}
+}
+
+// Middleware answers 429 once a client runs out of tokens for the matched route.
+// Every response carries RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers,
+// 429 responses also carry Retry-After.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.config.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route, limit := l.limitFor(r)
+		capacity, refillPerSecond, err := limit.bucket()
+		if err != nil {
+			log.Printf("invalid rate limit for %s: %s\n", route, err.Error())
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := fmt.Sprintf("%s|%s", l.clientKey(r), route)
+		tokens, allowed, err := l.store.Take(key, capacity, refillPerSecond, l.now())
+		if err != nil {
+			// a broken store should not take the api down with it
+			log.Printf("failed to take rate limit token for %s: %s\n", key, err.Error())
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", fmt.Sprintf("%d", int(capacity)))
+		w.Header().Set("RateLimit-Remaining", fmt.Sprintf("%d", int(math.Floor(tokens))))
+		w.Header().Set("RateLimit-Reset", fmt.Sprintf("%d", secondsUntil(capacity-tokens, refillPerSecond)))
+
+		if !allowed {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", secondsUntil(1-tokens, refillPerSecond)))
+			err = writeTooManyRequests(w)
+			if err != nil {
+				fmt.Println("failed to write rate limit body:", err.Error())
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitFor returns the matched route template and its limit, or "*" and the default limit
+func (l *Limiter) limitFor(r *http.Request) (string, Limit) {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			if limit, ok := l.config.Routes[template]; ok {
+				return template, limit
+			}
+		}
+	}
+
+	return "*", l.config.Default
+}
+
+// clientKey tells clients apart, falling back to the ip when the client did not send a known api key.
+// Anyone can send any header, so a client that made up a new key or user for every request
+// would get a full bucket every time if they were taken at their word.
+func (l *Limiter) clientKey(r *http.Request) string {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" || !l.apiKeys[key] {
+		return "ip:" + l.clientIP(r)
+	}
+
+	switch l.config.Key {
+	case KeyByAPIKey:
+		return "key:" + key
+	case KeyByUser:
+		if user := r.Header.Get(UserHeader); user != "" {
+			return "user:" + user
+		}
+	}
+
+	return "ip:" + l.clientIP(r)
+}
+
+func (l *Limiter) clientIP(r *http.Request) string {
+	if l.config.TrustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func secondsUntil(tokens float64, refillPerSecond float64) int {
+	if tokens <= 0 {
+		return 0
+	}
+
+	return int(math.Ceil(tokens / refillPerSecond))
+}
+
+func writeTooManyRequests(w http.ResponseWriter) error {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	_, err := w.Write([]byte(`{"error":"rate limit exceeded"}`))
+	return err
+}
@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"fmt"
+	"movie-rating-api/db/dbtest"
+	"movie-rating-api/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(t *testing.T, config Config) (http.Handler, *time.Time) {
+	t.Helper()
+
+	err := config.Validate()
+	if err != nil {
+		t.Fatalf("invalid config: %s", err.Error())
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(config, NewMemoryStore())
+	limiter.now = func() time.Time {
+		return now
+	}
+
+	return limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})), &now
+}
+
+func send(handler http.Handler, headers map[string]string) int {
+	r := httptest.NewRequest(http.MethodGet, "/api/v2/movies", nil)
+	r.RemoteAddr = "203.0.113.7:4321"
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestMadeUpHeadersShareTheIPBucket(t *testing.T) {
+	for _, key := range []string{KeyByAPIKey, KeyByUser} {
+		config := DefaultConfig()
+		config.Key = key
+		config.APIKeys = []string{"known"}
+		config.Default = Limit{Requests: 2, Per: "1m"}
+		handler, _ := newTestLimiter(t, config)
+
+		for i := 0; i < 2; i++ {
+			headers := map[string]string{APIKeyHeader: fmt.Sprintf("made-up-%d", i), UserHeader: fmt.Sprintf("user-%d", i)}
+			if code := send(handler, headers); code != http.StatusOK {
+				t.Fatalf("%s: request %d got %d", key, i, code)
+			}
+		}
+
+		headers := map[string]string{APIKeyHeader: "made-up-2", UserHeader: "user-2"}
+		if code := send(handler, headers); code != http.StatusTooManyRequests {
+			t.Errorf("%s: a new made up header got %d rather than the exhausted ip bucket", key, code)
+		}
+
+		headers = map[string]string{APIKeyHeader: "known", UserHeader: "user-2"}
+		if code := send(handler, headers); code != http.StatusOK {
+			t.Errorf("%s: a known api key got %d rather than a bucket of its own", key, code)
+		}
+	}
+}
+
+func TestSlowLimitsAreNotResetBySweeping(t *testing.T) {
+	config := DefaultConfig()
+	config.Default = Limit{Requests: 2, Per: "1h"}
+	handler, now := newTestLimiter(t, config)
+
+	for i := 0; i < 2; i++ {
+		if code := send(handler, nil); code != http.StatusOK {
+			t.Fatalf("request %d got %d", i, code)
+		}
+	}
+
+	// well past when buckets used to be swept, but short of refilling a token
+	*now = now.Add(20 * time.Minute)
+	if code := send(handler, nil); code != http.StatusTooManyRequests {
+		t.Fatalf("got %d after 20 minutes, the bucket was swept before it refilled", code)
+	}
+
+	*now = now.Add(time.Hour)
+	if code := send(handler, nil); code != http.StatusOK {
+		t.Fatalf("got %d once the bucket refilled", code)
+	}
+}
+
+func TestSweepForgetsFullBuckets(t *testing.T) {
+	store := NewMemoryStore().(*memoryStore)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, _, _ = store.Take("a", 2, 1, now)
+	_, _, _ = store.Take("b", 100, 0.001, now)
+
+	_, _, _ = store.Take("c", 1, 1, now.Add(2*time.Minute))
+	if _, ok := store.buckets["a"]; ok {
+		t.Error("a refilled bucket was kept")
+	}
+	if _, ok := store.buckets["b"]; !ok {
+		t.Error("a bucket still refilling was swept")
+	}
+}
+
+func TestDBStoreSweepsFullBuckets(t *testing.T) {
+	client, gormDB := dbtest.NewSQLite(t)
+	store := NewDBStore(client)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	keys := func() map[string]bool {
+		var buckets []models.RateLimitBuckets
+		err := gormDB.Find(&buckets).Error
+		if err != nil {
+			t.Fatalf("failed to get buckets: %s", err.Error())
+		}
+		keys := map[string]bool{}
+		for _, bucket := range buckets {
+			keys[bucket.Key] = true
+		}
+		return keys
+	}
+
+	_, _, _ = store.Take("a", 2, 1, now)
+	_, _, _ = store.Take("b", 100, 0.001, now)
+	// the first take swept, the next sweep is a minute later
+	_, _, _ = store.Take("c", 1, 1, now.Add(30*time.Second))
+	if buckets := keys(); !buckets["a"] || !buckets["b"] {
+		t.Fatalf("expected no sweep within a minute of the last, got %v", buckets)
+	}
+
+	_, _, _ = store.Take("c", 1, 1, now.Add(2*time.Minute))
+	buckets := keys()
+	if buckets["a"] {
+		t.Error("a refilled bucket was kept")
+	}
+	if !buckets["b"] {
+		t.Error("a bucket still refilling was swept")
+	}
+
+	// a swept bucket starts over full
+	tokens, allowed, err := store.Take("a", 2, 1, now.Add(3*time.Minute))
+	if err != nil || !allowed || tokens != 1 {
+		t.Fatalf("expected a full bucket for a, got %f %t %v", tokens, allowed, err)
+	}
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"movie-rating-api/db"
+	"sync"
+	"time"
+)
+
+// Store keeps a token bucket per key
+type Store interface {
+	// Take refills the key's bucket up to now and takes one token from it when there is one.
+	// It returns the tokens left in the bucket and whether a token was taken.
+	Take(key string, capacity float64, refillPerSecond float64, now time.Time) (float64, bool, error)
+}
+
+type bucket struct {
+	tokens     float64
+	refilledAt time.Time
+	// fullAt is when the bucket will have refilled completely if it is left alone
+	fullAt time.Time
+}
+
+// sweeper runs the sweep of a store at most once a minute
+type sweeper struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// due is true when a minute has passed since the last sweep, which is then counted as done
+func (s *sweeper) due(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.last) < time.Minute {
+		return false
+	}
+	s.last = now
+	return true
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	sweeper sweeper
+}
+
+// NewMemoryStore keeps buckets in this process, each api replica enforces its own limits
+func NewMemoryStore() Store {
+	return &memoryStore{
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (s *memoryStore) Take(key string, capacity float64, refillPerSecond float64, now time.Time) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, refilledAt: now}
+		s.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.refilledAt).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	b.tokens = math.Min(capacity, b.tokens+elapsed*refillPerSecond)
+	b.refilledAt = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.fullAt = now.Add(time.Duration((capacity - b.tokens) / refillPerSecond * float64(time.Second)))
+
+	return b.tokens, allowed, nil
+}
+
+// sweep forgets the buckets that have refilled completely since they were last used,
+// a new bucket starts full so forgetting them changes nothing
+func (s *memoryStore) sweep(now time.Time) {
+	if !s.sweeper.due(now) {
+		return
+	}
+
+	for key, b := range s.buckets {
+		if !now.Before(b.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+type dbStore struct {
+	client  db.Client
+	sweeper *sweeper
+}
+
+// NewDBStore keeps buckets in the database so limits hold across api replicas.
+// Each replica sweeps the buckets that have refilled like the memory store does.
+func NewDBStore(client db.Client) Store {
+	return dbStore{
+		client:  client,
+		sweeper: &sweeper{},
+	}
+}
+
+func (s dbStore) Take(key string, capacity float64, refillPerSecond float64, now time.Time) (float64, bool, error) {
+	if s.sweeper.due(now) {
+		_, err := s.client.SweepRateLimitBuckets(now)
+		if err != nil {
+			log.Printf("failed to sweep rate limit buckets: %s\n", err.Error())
+		}
+	}
+
+	return s.client.TakeRateLimitToken(key, capacity, refillPerSecond, now)
+}
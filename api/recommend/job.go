@@ -0,0 +1,107 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"time"
+)
+
+// AnonymousUser holds the recommendations for users that have not rated anything
+const AnonymousUser = ""
+
+// Job keeps the stored recommendations up to date
+type Job struct {
+	client   db.Client
+	app      app.App
+	interval time.Duration
+	// refresh is how often every user is recomputed, since other users' ratings and the catalogue change theirs too
+	refresh time.Duration
+	k       int
+	// lastRun is when the previous run read the user ratings, zero before the first run
+	lastRun time.Time
+	// lastRefresh is when every user was last recomputed, zero before the first run
+	lastRefresh time.Time
+}
+
+func NewJob(client db.Client, a app.App, interval time.Duration, refresh time.Duration, k int) *Job {
+	return &Job{
+		client:   client,
+		app:      a,
+		interval: interval,
+		refresh:  refresh,
+		k:        k,
+	}
+}
+
+// Run recomputes recommendations every interval until the context is done
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		updated, err := j.RunOnce(time.Now())
+		if err != nil {
+			log.Printf("failed to recompute recommendations: %s\n", err.Error())
+		} else if updated != 0 {
+			log.Printf("recomputed recommendations for %d users\n", updated)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce retrains the model and recomputes the recommendations of the users who rated a movie
+// since the previous run, and those of users who have not rated anything. Every user is recomputed
+// on the first run and once per refresh. It returns how many users with ratings were updated.
+func (j *Job) RunOnce(now time.Time) (int, error) {
+	ratings, err := j.client.GetUserRatings("")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user ratings: %s", err.Error())
+	}
+
+	refresh := j.lastRefresh.IsZero() || !now.Before(j.lastRefresh.Add(j.refresh))
+	users := map[string]bool{}
+	for _, rating := range ratings {
+		if refresh || rating.UpdatedAt.After(j.lastRun) {
+			users[rating.UserID] = true
+		}
+	}
+
+	catalogue, err := j.app.GetMovieDetails(nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get movies: %s", err.Error())
+	}
+
+	model := Train(ratings)
+
+	// the fallback list follows the critics' ratings and the catalogue, so it is rebuilt on every run
+	err = j.client.WithTx(func(tx db.Client) error {
+		for userID := range users {
+			err := tx.ReplaceRecommendations(userID, Recommend(model, userID, catalogue, j.k, now))
+			if err != nil {
+				return fmt.Errorf("failed to save recommendations of %q: %s", userID, err.Error())
+			}
+		}
+		err := tx.ReplaceRecommendations(AnonymousUser, Recommend(model, AnonymousUser, catalogue, j.k, now))
+		if err != nil {
+			return fmt.Errorf("failed to save recommendations of anonymous users: %s", err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	j.lastRun = now
+	if refresh {
+		j.lastRefresh = now
+	}
+	return len(users), nil
+}
@@ -0,0 +1,103 @@
+package recommend
+
+import (
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"movie-rating-api/models"
+	"testing"
+	"time"
+)
+
+func recommendations(t *testing.T, client db.Client, userID string) []models.Recommendations {
+	recommendations, err := client.GetRecommendations(userID)
+	if err != nil {
+		t.Fatalf("failed to get recommendations: %s", err.Error())
+	}
+	if len(recommendations) == 0 {
+		t.Fatalf("expected recommendations for %q", userID)
+	}
+	return recommendations
+}
+
+func TestRunOnceRebuildsTheFallbackEveryRun(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	a := app.New(client)
+	job := NewJob(client, a, time.Minute, time.Hour, 3)
+
+	start := time.Now()
+	if _, err := job.RunOnce(start); err != nil {
+		t.Fatalf("failed to run: %s", err.Error())
+	}
+
+	// the critics now rate a movie that was not recommended above everything else
+	recommended := map[int]bool{}
+	for _, recommendation := range recommendations(t, client, AnonymousUser) {
+		recommended[recommendation.MovieID] = true
+	}
+	catalogue, err := a.GetMovieDetails(nil)
+	if err != nil {
+		t.Fatalf("failed to get movies: %s", err.Error())
+	}
+	promoted := 0
+	for _, details := range catalogue {
+		if recommended[details.Movie.ID] || len(details.MovieRatings.Ratings) == 0 {
+			continue
+		}
+		promoted = details.Movie.ID
+		for _, rating := range details.MovieRatings.Ratings {
+			_, err := a.SetSourceRating(promoted, rating.Source, 100, db.AnyVersion, "test")
+			if err != nil {
+				t.Fatalf("failed to set rating: %s", err.Error())
+			}
+		}
+		break
+	}
+
+	// no user rated anything in between
+	updated, err := job.RunOnce(start.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to run: %s", err.Error())
+	}
+	if updated != 0 {
+		t.Fatalf("expected no users with ratings to be updated, got %d", updated)
+	}
+	if top := recommendations(t, client, AnonymousUser)[0]; top.MovieID != promoted {
+		t.Fatalf("expected movie %d to lead the fallback list, got %d", promoted, top.MovieID)
+	}
+}
+
+func TestRunOnceRefreshesEveryUserOnSchedule(t *testing.T) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	job := NewJob(client, app.New(client), time.Minute, time.Hour, 3)
+
+	err := client.SaveUserRating(models.UserRatings{UserID: "alice", MovieID: 1, Score: 90})
+	if err != nil {
+		t.Fatalf("failed to save rating: %s", err.Error())
+	}
+
+	start := time.Now().Add(time.Second)
+	for _, run := range []struct {
+		at       time.Time
+		updated  int
+		computed time.Time
+	}{
+		{at: start, updated: 1, computed: start},
+		// alice has not rated anything since, so her recommendations are left alone
+		{at: start.Add(time.Minute), updated: 0, computed: start},
+		// until the refresh is due
+		{at: start.Add(time.Hour), updated: 1, computed: start.Add(time.Hour)},
+		{at: start.Add(time.Hour + time.Minute), updated: 0, computed: start.Add(time.Hour)},
+	} {
+		updated, err := job.RunOnce(run.at)
+		if err != nil {
+			t.Fatalf("failed to run: %s", err.Error())
+		}
+		if updated != run.updated {
+			t.Fatalf("expected %d users updated at %s, got %d", run.updated, run.at, updated)
+		}
+		if computed := recommendations(t, client, "alice")[0].ComputedAt; !computed.Equal(run.computed) {
+			t.Fatalf("expected alice's recommendations from %s at %s, got %s", run.computed, run.at, computed)
+		}
+	}
+}
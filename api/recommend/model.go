@@ -0,0 +1,119 @@
+package recommend
+
+import (
+	"math"
+	"movie-rating-api/models"
+)
+
+// Model is an item-item collaborative filter, two movies are similar when the same users
+// rated them alike. Similarity is the adjusted cosine, each score is centered on its user's mean.
+type Model struct {
+	// ratings maps a user to the scores they gave each movie
+	ratings map[string]map[int]float64
+	// similarity maps a pair of movies to their similarity, both orders are stored
+	similarity map[int]map[int]float64
+}
+
+// minCoRaters is how many users must have rated both movies before their similarity is trusted
+const minCoRaters = 2
+
+func Train(userRatings []models.UserRatings) *Model {
+	m := &Model{
+		ratings:    map[string]map[int]float64{},
+		similarity: map[int]map[int]float64{},
+	}
+
+	for _, rating := range userRatings {
+		if m.ratings[rating.UserID] == nil {
+			m.ratings[rating.UserID] = map[int]float64{}
+		}
+		m.ratings[rating.UserID][rating.MovieID] = float64(rating.Score)
+	}
+
+	// centered holds every user's scores minus their mean, grouped by movie
+	centered := map[int]map[string]float64{}
+	for user, scores := range m.ratings {
+		var total float64
+		for _, score := range scores {
+			total += score
+		}
+		mean := total / float64(len(scores))
+
+		for movie, score := range scores {
+			if centered[movie] == nil {
+				centered[movie] = map[string]float64{}
+			}
+			centered[movie][user] = score - mean
+		}
+	}
+
+	for a, usersA := range centered {
+		for b, usersB := range centered {
+			if a >= b {
+				continue
+			}
+
+			var dot, normA, normB float64
+			var coRaters int
+			for user, scoreA := range usersA {
+				scoreB, ok := usersB[user]
+				if !ok {
+					continue
+				}
+
+				coRaters++
+				dot += scoreA * scoreB
+				normA += scoreA * scoreA
+				normB += scoreB * scoreB
+			}
+
+			if coRaters < minCoRaters || normA == 0 || normB == 0 {
+				continue
+			}
+
+			similarity := dot / (math.Sqrt(normA) * math.Sqrt(normB))
+			m.set(a, b, similarity)
+			m.set(b, a, similarity)
+		}
+	}
+
+	return m
+}
+
+func (m *Model) set(a int, b int, similarity float64) {
+	if m.similarity[a] == nil {
+		m.similarity[a] = map[int]float64{}
+	}
+	m.similarity[a][b] = similarity
+}
+
+// Rated returns the scores the user gave each movie
+func (m *Model) Rated(userID string) map[int]float64 {
+	return m.ratings[userID]
+}
+
+// Predict estimates the score the user would give the movie from the scores they gave similar movies.
+// It also returns the rated movie that contributed the most, ok is false when no rated movie is similar.
+func (m *Model) Predict(userID string, movieID int) (float64, int, bool) {
+	var weighted, totalSimilarity, best float64
+	var because int
+	for rated, score := range m.ratings[userID] {
+		similarity, ok := m.similarity[movieID][rated]
+		if !ok || similarity <= 0 {
+			continue
+		}
+
+		weighted += similarity * score
+		totalSimilarity += similarity
+		if similarity > best {
+			best = similarity
+			because = rated
+		}
+	}
+
+	if totalSimilarity == 0 {
+		return 0, 0, false
+	}
+
+	return weighted / totalSimilarity, because, true
+}
@@ -0,0 +1,106 @@
+package recommend
+
+import (
+	"fmt"
+	"movie-rating-api/app"
+	"movie-rating-api/models"
+	"sort"
+	"time"
+)
+
+const (
+	// coldStartRatings is how many ratings a user needs before collaborative filtering is trusted fully,
+	// below it the collaborative score is blended with content based similarity
+	coldStartRatings = 5
+	// likedScore is the lowest score that counts as the user liking a movie
+	likedScore = 70
+)
+
+// Recommend ranks the movies the user has not rated and returns the best k.
+// Users without ratings get the movies with the highest average rating.
+func Recommend(model *Model, userID string, catalogue []app.MovieDetails, k int, now time.Time) []models.Recommendations {
+	rated := model.Rated(userID)
+
+	byID := map[int]app.MovieDetails{}
+	for _, details := range catalogue {
+		byID[details.Movie.ID] = details
+	}
+
+	// alpha is how much the collaborative score counts, the rest comes from content similarity
+	alpha := float64(len(rated)) / coldStartRatings
+	if alpha > 1 {
+		alpha = 1
+	}
+
+	var recommendations []models.Recommendations
+	for _, candidate := range catalogue {
+		if _, ok := rated[candidate.Movie.ID]; ok {
+			continue
+		}
+
+		var score float64
+		var reason string
+		switch {
+		case len(rated) == 0:
+			score = float64(candidate.AverageRating) / 100
+			reason = fmt.Sprintf("rated %d on average by critics", candidate.AverageRating)
+		default:
+			contentScore, likedTitle := contentScore(candidate, rated, byID)
+
+			predicted, because, ok := model.Predict(userID, candidate.Movie.ID)
+			if ok {
+				score = alpha*predicted/100 + (1-alpha)*contentScore
+				reason = fmt.Sprintf("people who rated %s like you also liked it", byID[because].Movie.Title)
+			} else {
+				score = contentScore
+				reason = fmt.Sprintf("similar to %s", likedTitle)
+			}
+
+			if likedTitle == "" && !ok {
+				continue
+			}
+		}
+
+		recommendations = append(recommendations, models.Recommendations{
+			UserID:     userID,
+			MovieID:    candidate.Movie.ID,
+			Title:      candidate.Movie.Title,
+			Score:      score,
+			Reason:     reason,
+			ComputedAt: now,
+		})
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		return recommendations[i].Score > recommendations[j].Score
+	})
+
+	if k > 0 && len(recommendations) > k {
+		recommendations = recommendations[:k]
+	}
+	for i := range recommendations {
+		recommendations[i].Rank = i + 1
+	}
+
+	return recommendations
+}
+
+// contentScore is the highest similarity between the candidate and a movie the user liked
+func contentScore(candidate app.MovieDetails, rated map[int]float64, byID map[int]app.MovieDetails) (float64, string) {
+	var best float64
+	var title string
+	for movieID, score := range rated {
+		liked, ok := byID[movieID]
+		if !ok || score < likedScore {
+			continue
+		}
+
+		similarity, _ := app.Similarity(candidate, liked, app.DefaultSimilarityWeights())
+		if similarity > best {
+			best = similarity
+			title = liked.Movie.Title
+		}
+	}
+
+	return best, title
+}
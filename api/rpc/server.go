@@ -0,0 +1,268 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/models"
+	"movie-rating-api/rpc/moviepb"
+	"movie-rating-api/stream"
+	"net"
+	"net/url"
+)
+
+type movieServer struct {
+	moviepb.UnimplementedMovieServiceServer
+	app app.App
+	// broker feeds WatchRatings the committed changes
+	broker *stream.Broker
+}
+
+func NewMovieServer(a app.App, broker *stream.Broker) moviepb.MovieServiceServer {
+	return &movieServer{
+		app:    a,
+		broker: broker,
+	}
+}
+
+// ListenAndServe serves the MovieService on the port until the listener fails
+func ListenAndServe(port string, a app.App, broker *stream.Broker) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on port %s: %s", port, err.Error())
+	}
+
+	server := grpc.NewServer()
+	moviepb.RegisterMovieServiceServer(server, NewMovieServer(a, broker))
+
+	return server.Serve(listener)
+}
+
+func (s *movieServer) ListMovies(ctx context.Context, request *moviepb.ListMoviesRequest) (*moviepb.ListMoviesResponse, error) {
+	movies, err := s.app.GetMovies(url.Values{})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get movies: %s", err.Error())
+	}
+
+	response := &moviepb.ListMoviesResponse{}
+	for _, movie := range movies {
+		response.Movies = append(response.Movies, toMovie(movie))
+	}
+
+	return response, nil
+}
+
+func (s *movieServer) GetMovie(ctx context.Context, request *moviepb.GetMovieRequest) (*moviepb.Movie, error) {
+	if request.GetTitle() == "" {
+		return nil, status.Error(codes.InvalidArgument, "title is required")
+	}
+
+	movies, err := s.app.GetMovies(url.Values{})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get movies: %s", err.Error())
+	}
+
+	for _, movie := range movies {
+		if movie.Title == request.GetTitle() {
+			return toMovie(movie), nil
+		}
+	}
+
+	return nil, status.Errorf(codes.NotFound, "movie %q not found", request.GetTitle())
+}
+
+func (s *movieServer) ListRatings(ctx context.Context, request *moviepb.ListRatingsRequest) (*moviepb.ListRatingsResponse, error) {
+	movies, err := s.app.GetMovies(url.Values{})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get movies: %s", err.Error())
+	}
+
+	response := &moviepb.ListRatingsResponse{}
+	for _, movie := range movies {
+		if request.GetTitle() != "" && movie.Title != request.GetTitle() {
+			continue
+		}
+
+		for _, rating := range movie.Ratings {
+			response.Ratings = append(response.Ratings, toMovieRating(movie.Title, rating))
+		}
+	}
+
+	return response, nil
+}
+
+// WatchRatings sends every rating of the watched movies as added, then follows the change stream.
+// Rating events are applied as they come. Movie events, which can take a movie's ratings with them,
+// and a subscription that fell behind are caught up with by comparing against the movies once more.
+func (s *movieServer) WatchRatings(request *moviepb.WatchRatingsRequest, stream moviepb.MovieService_WatchRatingsServer) error {
+	w := &ratingWatch{
+		stream:   stream,
+		watched:  map[string]bool{},
+		previous: map[[2]string]int{},
+	}
+	for _, title := range request.GetTitles() {
+		w.watched[title] = true
+	}
+
+	// subscribed before the first sync so nothing committed in between is missed
+	subscription, _ := s.broker.Subscribe(nil, "")
+	defer func() {
+		subscription.Close()
+	}()
+
+	stale := true
+	for {
+		if stale && len(subscription.Messages()) == 0 {
+			err := w.sync(s.app)
+			if err != nil {
+				return err
+			}
+			stale = false
+		}
+
+		select {
+		case <-stream.Context().Done():
+			log.Printf("stopped watching ratings: %s\n", stream.Context().Err())
+			return nil
+		case <-subscription.Closed():
+			subscription, _ = s.broker.Subscribe(nil, "")
+			stale = true
+		case message := <-subscription.Messages():
+			rating, ok := message.Event.Data.(db.RatingEvent)
+			if !ok {
+				stale = true
+				continue
+			}
+			err := w.apply(message.Event.Type, rating)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ratingWatch is the state of one WatchRatings call
+type ratingWatch struct {
+	stream  moviepb.MovieService_WatchRatingsServer
+	watched map[string]bool
+	// previous holds the last sent value of every movie title and rating source
+	previous map[[2]string]int
+}
+
+func (w *ratingWatch) wants(title string) bool {
+	return len(w.watched) == 0 || w.watched[title]
+}
+
+// sync sends what changed between the ratings that were sent and those of the movies now
+func (w *ratingWatch) sync(a app.App) error {
+	movies, err := a.GetMovies(url.Values{})
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to get movies: %s", err.Error())
+	}
+
+	current := map[[2]string]int{}
+	for _, movie := range movies {
+		if !w.wants(movie.Title) {
+			continue
+		}
+
+		for _, rating := range movie.Ratings {
+			key := [2]string{movie.Title, rating.Source}
+			current[key] = rating.Value
+			err = w.set(key, rating.Value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for key := range w.previous {
+		if _, ok := current[key]; !ok {
+			err = w.remove(key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// apply sends the change of a rating event. Ratings of ratings without a movie are not listed by GetMovies so they are left out too.
+func (w *ratingWatch) apply(eventType string, rating db.RatingEvent) error {
+	if rating.MovieID == 0 || !w.wants(rating.Title) {
+		return nil
+	}
+
+	key := [2]string{rating.Title, rating.Source}
+	if eventType == db.EventRatingDeleted {
+		return w.remove(key)
+	}
+	return w.set(key, rating.Value)
+}
+
+// set sends the rating as added or changed, nothing when it was already sent with the value
+func (w *ratingWatch) set(key [2]string, value int) error {
+	previous, seen := w.previous[key]
+	if seen && previous == value {
+		return nil
+	}
+	w.previous[key] = value
+
+	kind := moviepb.RatingEvent_CHANGED
+	if !seen {
+		kind = moviepb.RatingEvent_ADDED
+	}
+	return sendRatingEvent(w.stream, kind, key, value)
+}
+
+func (w *ratingWatch) remove(key [2]string) error {
+	value, seen := w.previous[key]
+	if !seen {
+		return nil
+	}
+	delete(w.previous, key)
+
+	return sendRatingEvent(w.stream, moviepb.RatingEvent_REMOVED, key, value)
+}
+
+func sendRatingEvent(stream moviepb.MovieService_WatchRatingsServer, kind moviepb.RatingEvent_Kind, key [2]string, value int) error {
+	return stream.Send(&moviepb.RatingEvent{
+		Kind:        kind,
+		MovieRating: toMovieRating(key[0], models.Ratings{Source: key[1], Value: value}),
+	})
+}
+
+func toMovie(movie models.MoviesReturnObject) *moviepb.Movie {
+	result := &moviepb.Movie{
+		Title:         movie.Title,
+		Plot:          movie.Plot,
+		Genre:         movie.Genre,
+		AverageRating: int32(movie.AverageRating),
+	}
+
+	for _, rating := range movie.Ratings {
+		result.Ratings = append(result.Ratings, toRating(rating))
+	}
+
+	return result
+}
+
+func toRating(rating models.Ratings) *moviepb.Rating {
+	return &moviepb.Rating{
+		Source: rating.Source,
+		Value:  int32(rating.Value),
+	}
+}
+
+func toMovieRating(title string, rating models.Ratings) *moviepb.MovieRating {
+	return &moviepb.MovieRating{
+		Title:  title,
+		Rating: toRating(rating),
+	}
+}
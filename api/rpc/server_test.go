@@ -0,0 +1,222 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"movie-rating-api/app"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	movieHttp "movie-rating-api/http"
+	"movie-rating-api/models"
+	"movie-rating-api/rpc/moviepb"
+	"movie-rating-api/stream"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// servers runs the grpc api over an in memory listener and the http api on an httptest server, both on one fake db
+type servers struct {
+	client db.Client
+	app    app.App
+	grpc   moviepb.MovieServiceClient
+	http   *httptest.Server
+}
+
+func newServers(t *testing.T) *servers {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+	a := app.New(client)
+
+	broker, err := stream.NewBroker(client, stream.DefaultConfig())
+	if err != nil {
+		t.Fatalf("failed to create broker: %s", err.Error())
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	moviepb.RegisterMovieServiceServer(server, NewMovieServer(a, broker))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial grpc: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	r := mux.NewRouter()
+	movieHttp.ConfigureRouter(r, movieHttp.NewHandlers(a, client, nil, nil, nil, nil, "", movieHttp.DefaultConfig()))
+	httpServer := httptest.NewServer(r)
+	t.Cleanup(httpServer.Close)
+
+	return &servers{
+		client: client,
+		app:    a,
+		grpc:   moviepb.NewMovieServiceClient(conn),
+		http:   httpServer,
+	}
+}
+
+func (s *servers) httpMovies(t *testing.T) []models.MoviesReturnObject {
+	resp, err := http.Get(s.http.URL + "/api/v1/movies")
+	if err != nil {
+		t.Fatalf("failed to get movies over http: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("http movies answered %s", resp.Status)
+	}
+	var movies []models.MoviesReturnObject
+	err = json.NewDecoder(resp.Body).Decode(&movies)
+	if err != nil {
+		t.Fatalf("failed to decode http movies: %s", err.Error())
+	}
+	return movies
+}
+
+func TestListMoviesMatchesHTTP(t *testing.T) {
+	s := newServers(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	expected := s.httpMovies(t)
+	if len(expected) == 0 {
+		t.Fatal("the fake db has no movies")
+	}
+
+	response, err := s.grpc.ListMovies(ctx, &moviepb.ListMoviesRequest{})
+	if err != nil {
+		t.Fatalf("failed to list movies over grpc: %s", err.Error())
+	}
+	if len(response.Movies) != len(expected) {
+		t.Fatalf("grpc listed %d movies, http %d", len(response.Movies), len(expected))
+	}
+
+	for i, movie := range expected {
+		assertMovie(t, response.Movies[i], movie)
+	}
+}
+
+func TestGetMovieAndListRatingsMatchHTTP(t *testing.T) {
+	s := newServers(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	expected := s.httpMovies(t)[0]
+
+	movie, err := s.grpc.GetMovie(ctx, &moviepb.GetMovieRequest{Title: expected.Title})
+	if err != nil {
+		t.Fatalf("failed to get movie over grpc: %s", err.Error())
+	}
+	assertMovie(t, movie, expected)
+
+	ratings, err := s.grpc.ListRatings(ctx, &moviepb.ListRatingsRequest{Title: expected.Title})
+	if err != nil {
+		t.Fatalf("failed to list ratings over grpc: %s", err.Error())
+	}
+	if len(ratings.Ratings) != len(expected.Ratings) {
+		t.Fatalf("grpc listed %d ratings, http %d", len(ratings.Ratings), len(expected.Ratings))
+	}
+	for i, rating := range expected.Ratings {
+		got := ratings.Ratings[i]
+		if got.Title != expected.Title || got.Rating.Source != rating.Source || int(got.Rating.Value) != rating.Value {
+			t.Errorf("rating %d is %s %s %d over grpc, %s %s %d over http", i,
+				got.Title, got.Rating.Source, got.Rating.Value, expected.Title, rating.Source, rating.Value)
+		}
+	}
+}
+
+func TestWatchRatingsFollowsCommittedChanges(t *testing.T) {
+	s := newServers(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	details, err := s.app.GetMovieDetails(nil)
+	if err != nil {
+		t.Fatalf("failed to get movies: %s", err.Error())
+	}
+	detail := details[0]
+
+	watch, err := s.grpc.WatchRatings(ctx, &moviepb.WatchRatingsRequest{Titles: []string{detail.Movie.Title}})
+	if err != nil {
+		t.Fatalf("failed to watch ratings: %s", err.Error())
+	}
+
+	for range detail.MovieRatings.Ratings {
+		event := receive(t, watch)
+		if event.Kind != moviepb.RatingEvent_ADDED || event.MovieRating.Title != detail.Movie.Title {
+			t.Fatalf("expected the current ratings of %s as added, got %v", detail.Movie.Title, event)
+		}
+	}
+
+	// a change to another movie is not sent
+	_, err = s.app.SetSourceRating(details[1].Movie.ID, "Rotten Tomatoes", 1, db.AnyVersion, "test")
+	if err != nil {
+		t.Fatalf("failed to set rating: %s", err.Error())
+	}
+
+	source := detail.MovieRatings.Ratings[0].Source
+	value := (detail.MovieRatings.Ratings[0].Value + 1) % 100
+	_, err = s.app.SetSourceRating(detail.Movie.ID, source, value, db.AnyVersion, "test")
+	if err != nil {
+		t.Fatalf("failed to set rating: %s", err.Error())
+	}
+
+	event := receive(t, watch)
+	if event.Kind != moviepb.RatingEvent_CHANGED || event.MovieRating.Rating.Source != source || int(event.MovieRating.Rating.Value) != value {
+		t.Fatalf("expected %s to change to %d, got %v", source, value, event)
+	}
+
+	_, err = s.app.SetSourceRating(detail.Movie.ID, "A New Source", 42, db.AnyVersion, "test")
+	if err != nil {
+		t.Fatalf("failed to set rating: %s", err.Error())
+	}
+
+	event = receive(t, watch)
+	if event.Kind != moviepb.RatingEvent_ADDED || event.MovieRating.Rating.Source != "A New Source" || event.MovieRating.Rating.Value != 42 {
+		t.Fatalf("expected the new source to be added, got %v", event)
+	}
+}
+
+func receive(t *testing.T, watch moviepb.MovieService_WatchRatingsClient) *moviepb.RatingEvent {
+	t.Helper()
+
+	event, err := watch.Recv()
+	if err != nil {
+		t.Fatalf("failed to receive rating event: %s", err.Error())
+	}
+	return event
+}
+
+func assertMovie(t *testing.T, got *moviepb.Movie, expected models.MoviesReturnObject) {
+	t.Helper()
+
+	if got.Title != expected.Title || got.Plot != expected.Plot || got.Genre != expected.Genre || int(got.AverageRating) != expected.AverageRating {
+		t.Errorf("grpc movie %q differs from http movie %q", got.Title, expected.Title)
+	}
+	if len(got.Ratings) != len(expected.Ratings) {
+		t.Errorf("%s has %d ratings over grpc, %d over http", expected.Title, len(got.Ratings), len(expected.Ratings))
+		return
+	}
+	for i, rating := range expected.Ratings {
+		if got.Ratings[i].Source != rating.Source || int(got.Ratings[i].Value) != rating.Value {
+			t.Errorf("%s rating %d is %s %d over grpc, %s %d over http", expected.Title, i,
+				got.Ratings[i].Source, got.Ratings[i].Value, rating.Source, rating.Value)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ConfigPath is where the playground docker-compose mounts its config directory
+const ConfigPath = "/config/stream.json"
+
+type Config struct {
+	// Heartbeat is how often an idle connection is sent a heartbeat, as a time.ParseDuration string
+	Heartbeat string `json:"heartbeat"`
+	// History is how many recent events are kept so reconnecting clients can resume
+	History int `json:"history"`
+	// Buffer is how many events can wait for a slow connection before it is closed
+	Buffer int `json:"buffer"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Heartbeat: "15s",
+		History:   1000,
+		Buffer:    64,
+	}
+}
+
+// LoadConfig reads the config file at path, DefaultConfig is returned when the file does not exist
+func LoadConfig(path string) (Config, error) {
+	bytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read stream config: %s", err.Error())
+	}
+
+	config := DefaultConfig()
+	err = json.Unmarshal(bytes, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse stream config: %s", err.Error())
+	}
+
+	_, err = config.heartbeat()
+	return config, err
+}
+
+func (c Config) heartbeat() (time.Duration, error) {
+	heartbeat, err := time.ParseDuration(c.Heartbeat)
+	if err != nil {
+		return 0, fmt.Errorf("invalid stream heartbeat: %s", err.Error())
+	}
+	if heartbeat <= 0 {
+		return 0, fmt.Errorf("stream heartbeat must be positive")
+	}
+	if c.History < 0 {
+		return 0, fmt.Errorf("stream history must not be negative")
+	}
+	if c.Buffer <= 0 {
+		return 0, fmt.Errorf("stream buffer must be positive")
+	}
+
+	return heartbeat, nil
+}
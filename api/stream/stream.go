@@ -0,0 +1,205 @@
+package stream
+
+import (
+	"fmt"
+	"movie-rating-api/db"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is an event with its position in the stream
+type Message struct {
+	// ID is what clients send back as Last-Event-ID to resume after it
+	ID    string
+	Event db.Event
+	// Reset is set instead of Event when events may have been missed, the client should reload what it shows
+	Reset bool
+}
+
+// Broker fans the committed events of a client out to the connected streams.
+// It keeps the recent events so a client that reconnects gets what it missed.
+type Broker struct {
+	heartbeat time.Duration
+	buffer    int
+
+	mu sync.Mutex
+	// epoch keeps the ids from before a restart from being resumed after it
+	epoch       int64
+	sequence    uint64
+	history     []Message
+	maxHistory  int
+	subscribers map[*Subscription]bool
+}
+
+func NewBroker(client db.EventDB, config Config) (*Broker, error) {
+	heartbeat, err := config.heartbeat()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Broker{
+		heartbeat:   heartbeat,
+		buffer:      config.Buffer,
+		epoch:       time.Now().UnixNano(),
+		maxHistory:  config.History,
+		subscribers: map[*Subscription]bool{},
+	}
+	client.OnEvent(b.Publish)
+	client.OnInvalidate(b.Invalidate)
+
+	return b, nil
+}
+
+// Heartbeat is how often idle connections are sent a heartbeat
+func (b *Broker) Heartbeat() time.Duration {
+	return b.heartbeat
+}
+
+// Publish sends the event to every subscription that wants it.
+// A subscription whose buffer is full is closed instead of slowing everyone else down.
+func (b *Broker) Publish(event db.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sequence++
+	message := Message{ID: fmt.Sprintf("%x-%d", b.epoch, b.sequence), Event: event}
+
+	b.history = append(b.history, message)
+	if len(b.history) > b.maxHistory {
+		b.history = b.history[len(b.history)-b.maxHistory:]
+	}
+
+	for subscription := range b.subscribers {
+		if !subscription.wants(event) {
+			continue
+		}
+
+		select {
+		case subscription.messages <- message:
+		default:
+			b.remove(subscription)
+		}
+	}
+}
+
+// Invalidate forgets the history, for when events may have been missed, and sends every subscription a reset.
+// The streams carry on in a new epoch, so ids from before get a reset when a client reconnects with them.
+func (b *Broker) Invalidate() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.epoch = time.Now().UnixNano()
+	b.sequence = 0
+	b.history = nil
+
+	// resuming after the reset replays what comes next
+	reset := Message{ID: fmt.Sprintf("%x-%d", b.epoch, b.sequence), Reset: true}
+	for subscription := range b.subscribers {
+		select {
+		case subscription.messages <- reset:
+		default:
+			b.remove(subscription)
+		}
+	}
+}
+
+// Subscribe starts a subscription to the events of the movies, every event when movieIDs is empty.
+// The events after lastEventID are replayed first. resumed is false when lastEventID was given
+// but those events are no longer known, the client should then reload what it shows.
+func (b *Broker) Subscribe(movieIDs []int, lastEventID string) (*Subscription, bool) {
+	subscription := &Subscription{
+		broker:   b,
+		movieIDs: map[int]bool{},
+		closed:   make(chan struct{}),
+	}
+	for _, id := range movieIDs {
+		subscription.movieIDs[id] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	missed, resumed := b.since(lastEventID)
+	var replay []Message
+	for _, message := range missed {
+		if subscription.wants(message.Event) {
+			replay = append(replay, message)
+		}
+	}
+
+	// the replay always fits so resuming never closes the subscription straight away
+	subscription.messages = make(chan Message, len(replay)+b.buffer)
+	for _, message := range replay {
+		subscription.messages <- message
+	}
+	b.subscribers[subscription] = true
+
+	return subscription, resumed
+}
+
+// since returns the events after the id, the caller holds the lock
+func (b *Broker) since(lastEventID string) ([]Message, bool) {
+	if lastEventID == "" {
+		return nil, true
+	}
+
+	parts := strings.SplitN(lastEventID, "-", 2)
+	if len(parts) != 2 || parts[0] != fmt.Sprintf("%x", b.epoch) {
+		return nil, false
+	}
+	sequence, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil || sequence > b.sequence {
+		return nil, false
+	}
+
+	// history holds the sequences after oldest
+	oldest := b.sequence - uint64(len(b.history))
+	if sequence < oldest {
+		return nil, false
+	}
+
+	return b.history[sequence-oldest:], true
+}
+
+// remove closes the subscription, the caller holds the lock
+func (b *Broker) remove(subscription *Subscription) {
+	if !b.subscribers[subscription] {
+		return
+	}
+
+	delete(b.subscribers, subscription)
+	close(subscription.closed)
+}
+
+// Subscription receives the events a stream connection asked for
+type Subscription struct {
+	broker   *Broker
+	movieIDs map[int]bool
+	messages chan Message
+	// closed is closed when the subscription ends, either by Close or because it fell behind
+	closed chan struct{}
+}
+
+// Messages are the events to send, in the order they were committed
+func (s *Subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+// Closed is closed when the connection fell too far behind and should be ended,
+// the client can reconnect with the last id it got to resume
+func (s *Subscription) Closed() <-chan struct{} {
+	return s.closed
+}
+
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.remove(s)
+}
+
+func (s *Subscription) wants(event db.Event) bool {
+	return len(s.movieIDs) == 0 || s.movieIDs[event.MovieID()]
+}
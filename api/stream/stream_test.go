@@ -0,0 +1,193 @@
+package stream
+
+import (
+	"movie-rating-api/db"
+	"testing"
+)
+
+// events is a db.EventDB that the tests publish and invalidate through
+type events struct {
+	publish    func(db.Event)
+	invalidate func()
+}
+
+func (e *events) OnEvent(fn func(db.Event)) {
+	e.publish = fn
+}
+
+func (e *events) OnInvalidate(fn func()) {
+	e.invalidate = fn
+}
+
+func newTestBroker(t *testing.T, config Config) (*Broker, *events) {
+	client := &events{}
+	broker, err := NewBroker(client, config)
+	if err != nil {
+		t.Fatalf("failed to create broker: %s", err.Error())
+	}
+	return broker, client
+}
+
+func movieEvent(id int) db.Event {
+	return db.Event{Type: db.EventMovieUpdated, Data: db.MovieEvent{ID: id}}
+}
+
+// receive returns the messages waiting on the subscription
+func receive(subscription *Subscription) []Message {
+	var messages []Message
+	for {
+		select {
+		case message := <-subscription.Messages():
+			messages = append(messages, message)
+		default:
+			return messages
+		}
+	}
+}
+
+func movieIDs(messages []Message) []int {
+	var ids []int
+	for _, message := range messages {
+		ids = append(ids, message.Event.MovieID())
+	}
+	return ids
+}
+
+func TestSubscriptionsGetTheEventsOfTheirMovies(t *testing.T) {
+	broker, client := newTestBroker(t, DefaultConfig())
+	all, _ := broker.Subscribe(nil, "")
+	some, _ := broker.Subscribe([]int{2}, "")
+
+	client.publish(movieEvent(1))
+	client.publish(movieEvent(2))
+
+	if ids := movieIDs(receive(all)); len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Fatalf("expected every event in order, got movies %v", ids)
+	}
+	if ids := movieIDs(receive(some)); len(ids) != 1 || ids[0] != 2 {
+		t.Fatalf("expected the events of movie 2, got movies %v", ids)
+	}
+}
+
+func TestSubscribeResumesAfterTheLastEventID(t *testing.T) {
+	config := DefaultConfig()
+	config.History = 3
+	broker, client := newTestBroker(t, config)
+	first, _ := broker.Subscribe(nil, "")
+	for id := 1; id <= 5; id++ {
+		client.publish(movieEvent(id))
+	}
+	messages := receive(first)
+	first.Close()
+
+	resumed, ok := broker.Subscribe(nil, messages[1].ID)
+	if !ok {
+		t.Fatalf("expected the stream to resume after the second event")
+	}
+	if ids := movieIDs(receive(resumed)); len(ids) != 3 || ids[0] != 3 || ids[2] != 5 {
+		t.Fatalf("expected the events after the second to be replayed, got movies %v", ids)
+	}
+
+	// the first event is no longer kept
+	_, ok = broker.Subscribe(nil, messages[0].ID)
+	if ok {
+		t.Fatalf("expected an id older than the history not to resume")
+	}
+	for _, id := range []string{"unknown", "1-1", messages[4].ID + "0"} {
+		if _, ok := broker.Subscribe(nil, id); ok {
+			t.Fatalf("expected %q not to resume", id)
+		}
+	}
+
+	latest, ok := broker.Subscribe(nil, messages[4].ID)
+	if !ok || len(receive(latest)) != 0 {
+		t.Fatalf("expected the latest id to resume with nothing to replay")
+	}
+}
+
+func TestSlowSubscriptionsAreClosed(t *testing.T) {
+	config := DefaultConfig()
+	config.Buffer = 2
+	broker, client := newTestBroker(t, config)
+	slow, _ := broker.Subscribe(nil, "")
+	other, _ := broker.Subscribe([]int{9}, "")
+
+	for id := 1; id <= 3; id++ {
+		client.publish(movieEvent(id))
+	}
+
+	select {
+	case <-slow.Closed():
+	default:
+		t.Fatalf("expected the subscription that fell behind to be closed")
+	}
+	select {
+	case <-other.Closed():
+		t.Fatalf("expected the subscription to other movies to stay open")
+	default:
+	}
+
+	// what it got before falling behind can still be resumed after
+	messages := receive(slow)
+	if len(messages) != 2 {
+		t.Fatalf("expected the buffered events, got %d", len(messages))
+	}
+	resumed, ok := broker.Subscribe(nil, messages[1].ID)
+	if !ok {
+		t.Fatalf("expected the slow subscription to resume")
+	}
+	if ids := movieIDs(receive(resumed)); len(ids) != 1 || ids[0] != 3 {
+		t.Fatalf("expected the dropped event to be replayed, got movies %v", ids)
+	}
+}
+
+func TestInvalidateResetsSubscriptionsWithoutClosingThem(t *testing.T) {
+	broker, client := newTestBroker(t, DefaultConfig())
+	subscription, _ := broker.Subscribe([]int{1}, "")
+	client.publish(movieEvent(1))
+	before := receive(subscription)
+
+	client.invalidate()
+
+	select {
+	case <-subscription.Closed():
+		t.Fatalf("expected the subscription to stay open")
+	default:
+	}
+	messages := receive(subscription)
+	if len(messages) != 1 || !messages[0].Reset {
+		t.Fatalf("expected a reset, got %v", messages)
+	}
+
+	// the subscription carries on and the reset can be resumed from, the ids from before cannot
+	client.publish(movieEvent(1))
+	if ids := movieIDs(receive(subscription)); len(ids) != 1 || ids[0] != 1 {
+		t.Fatalf("expected events after the reset, got movies %v", ids)
+	}
+	resumed, ok := broker.Subscribe(nil, messages[0].ID)
+	if !ok {
+		t.Fatalf("expected the reset id to resume")
+	}
+	if ids := movieIDs(receive(resumed)); len(ids) != 1 || ids[0] != 1 {
+		t.Fatalf("expected the event after the reset to be replayed, got movies %v", ids)
+	}
+	if _, ok := broker.Subscribe(nil, before[0].ID); ok {
+		t.Fatalf("expected an id from before the reset not to resume")
+	}
+}
+
+func TestInvalidateClosesSubscriptionsWithoutRoomForTheReset(t *testing.T) {
+	config := DefaultConfig()
+	config.Buffer = 1
+	broker, client := newTestBroker(t, config)
+	subscription, _ := broker.Subscribe(nil, "")
+	client.publish(movieEvent(1))
+
+	client.invalidate()
+
+	select {
+	case <-subscription.Closed():
+	default:
+		t.Fatalf("expected the full subscription to be closed")
+	}
+}
@@ -0,0 +1,66 @@
+package trash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ConfigPath is where the playground docker-compose mounts its config directory
+const ConfigPath = "/config/trash.json"
+
+type Config struct {
+	// Retention is how long deleted movies and ratings stay in the trash before they are purged,
+	// as a time.ParseDuration string
+	Retention string `json:"retention"`
+	// PurgeInterval is how often the trash is checked for rows past the retention, as a time.ParseDuration string
+	PurgeInterval string `json:"purge_interval"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Retention:     "720h",
+		PurgeInterval: "1h",
+	}
+}
+
+// LoadConfig reads the config file at path, DefaultConfig is returned when the file does not exist
+func LoadConfig(path string) (Config, error) {
+	bytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read trash config: %s", err.Error())
+	}
+
+	config := DefaultConfig()
+	err = json.Unmarshal(bytes, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse trash config: %s", err.Error())
+	}
+
+	_, _, err = config.durations()
+	return config, err
+}
+
+func (c Config) durations() (retention time.Duration, interval time.Duration, err error) {
+	retention, err = time.ParseDuration(c.Retention)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid trash retention: %s", err.Error())
+	}
+	if retention < 0 {
+		return 0, 0, fmt.Errorf("trash retention can not be negative")
+	}
+
+	interval, err = time.ParseDuration(c.PurgeInterval)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid trash purge_interval: %s", err.Error())
+	}
+	if interval <= 0 {
+		return 0, 0, fmt.Errorf("trash purge_interval must be positive")
+	}
+
+	return retention, interval, nil
+}
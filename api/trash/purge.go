@@ -0,0 +1,61 @@
+package trash
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"movie-rating-api/db"
+	"time"
+)
+
+// Job hard-deletes what has been in the trash for longer than the retention
+type Job struct {
+	client    db.Client
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewJob(client db.Client, config Config) (*Job, error) {
+	retention, interval, err := config.durations()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{
+		client:    client,
+		retention: retention,
+		interval:  interval,
+	}, nil
+}
+
+// Run purges the trash every interval until the context is done
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := j.RunOnce(time.Now())
+		if err != nil {
+			log.Printf("failed to purge the trash: %s\n", err.Error())
+		} else if purged != 0 {
+			log.Printf("purged %d rows from the trash\n", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce purges the rows deleted more than the retention before now and returns how many were purged.
+// Rows that others in the trash still refer to wait for them.
+func (j *Job) RunOnce(now time.Time) (int, error) {
+	purged, err := j.client.PurgeTrash(now.Add(-j.retention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge trash: %s", err.Error())
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ConfigPath is where the playground docker-compose mounts its config directory
+const ConfigPath = "/config/webhooks.json"
+
+// Config durations are time.ParseDuration strings such as "10s"
+type Config struct {
+	// PollInterval is how often the queue is checked for due deliveries
+	PollInterval string `json:"poll_interval"`
+	// Timeout is how long a receiver has to answer
+	Timeout string `json:"timeout"`
+	// MaxAttempts is how many times a delivery is tried before it is dead lettered
+	MaxAttempts int `json:"max_attempts"`
+	// BaseBackoff is the wait after the first failure, it doubles with every failure up to MaxBackoff
+	BaseBackoff string `json:"base_backoff"`
+	MaxBackoff  string `json:"max_backoff"`
+	// BatchSize is how many deliveries are claimed at once
+	BatchSize int `json:"batch_size"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		PollInterval: "2s",
+		Timeout:      "10s",
+		MaxAttempts:  8,
+		BaseBackoff:  "10s",
+		MaxBackoff:   "1h",
+		BatchSize:    20,
+	}
+}
+
+// LoadConfig reads the config file at path, DefaultConfig is returned when the file does not exist
+func LoadConfig(path string) (Config, error) {
+	bytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read webhooks config: %s", err.Error())
+	}
+
+	config := DefaultConfig()
+	err = json.Unmarshal(bytes, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse webhooks config: %s", err.Error())
+	}
+
+	_, err = config.durations()
+	return config, err
+}
+
+type durations struct {
+	pollInterval time.Duration
+	timeout      time.Duration
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+}
+
+func (c Config) durations() (durations, error) {
+	var d durations
+	for name, field := range map[string]struct {
+		value string
+		into  *time.Duration
+	}{
+		"poll_interval": {c.PollInterval, &d.pollInterval},
+		"timeout":       {c.Timeout, &d.timeout},
+		"base_backoff":  {c.BaseBackoff, &d.baseBackoff},
+		"max_backoff":   {c.MaxBackoff, &d.maxBackoff},
+	} {
+		duration, err := time.ParseDuration(field.value)
+		if err != nil {
+			return durations{}, fmt.Errorf("invalid webhooks %s: %s", name, err.Error())
+		}
+		if duration <= 0 {
+			return durations{}, fmt.Errorf("webhooks %s must be positive", name)
+		}
+		*field.into = duration
+	}
+
+	if c.MaxAttempts <= 0 {
+		return durations{}, fmt.Errorf("webhooks max_attempts must be positive")
+	}
+	if c.BatchSize <= 0 {
+		return durations{}, fmt.Errorf("webhooks batch_size must be positive")
+	}
+
+	return d, nil
+}
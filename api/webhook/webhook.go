@@ -0,0 +1,273 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"movie-rating-api/db"
+	"movie-rating-api/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The headers sent with every delivery
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// Sign returns the signature header of a body sent at the unix timestamp.
+// It is the hex HMAC-SHA256 of "<timestamp>.<body>" keyed by the secret, so receivers can reject replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify is what receivers run to check the signature of a delivery
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Dispatcher posts the queued deliveries to their subscriptions
+type Dispatcher struct {
+	client     db.Client
+	config     Config
+	durations  durations
+	httpClient *http.Client
+}
+
+func NewDispatcher(client db.Client, config Config) (*Dispatcher, error) {
+	d, err := config.durations()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Dispatcher{
+		client:     client,
+		config:     config,
+		durations:  d,
+		httpClient: &http.Client{Timeout: d.timeout},
+	}, nil
+}
+
+// Run delivers due deliveries every poll interval until the context is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.durations.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := d.RunOnce(ctx, time.Now())
+		if err != nil {
+			log.Printf("failed to deliver webhooks: %s\n", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce attempts every delivery that is due and returns how many were attempted.
+// Deliveries to one subscription are posted in order, different subscriptions are posted in parallel.
+func (d *Dispatcher) RunOnce(ctx context.Context, now time.Time) (int, error) {
+	// a claimed delivery is not claimed again until the batch would have timed out posting all of it to one subscription
+	lease := time.Duration(d.config.BatchSize+1) * d.durations.timeout
+	deliveries, err := d.client.ClaimWebhookDeliveries(now, lease, d.config.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim deliveries: %s", err.Error())
+	}
+
+	var subscriptionIDs []int
+	bySubscription := map[int][]models.WebhookDeliveries{}
+	for _, delivery := range deliveries {
+		if _, ok := bySubscription[delivery.SubscriptionID]; !ok {
+			subscriptionIDs = append(subscriptionIDs, delivery.SubscriptionID)
+		}
+		bySubscription[delivery.SubscriptionID] = append(bySubscription[delivery.SubscriptionID], delivery)
+	}
+
+	var wg sync.WaitGroup
+	attempted := make([]int, len(subscriptionIDs))
+	errs := make([]error, len(subscriptionIDs))
+	for i, subscriptionID := range subscriptionIDs {
+		subscription, ok, err := d.client.GetWebhookSubscription(subscriptionID)
+		if err != nil {
+			errs[i] = fmt.Errorf("failed to get subscription %d: %s", subscriptionID, err.Error())
+			continue
+		}
+		if !ok {
+			errs[i] = d.bury(bySubscription[subscriptionID], now)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, subscription models.WebhookSubscriptions, deliveries []models.WebhookDeliveries) {
+			defer wg.Done()
+			for _, delivery := range deliveries {
+				delivery = d.attempt(ctx, subscription, delivery, time.Now())
+				err := d.client.SaveWebhookDelivery(delivery)
+				if err != nil {
+					errs[i] = fmt.Errorf("failed to save delivery %d: %s", delivery.ID, err.Error())
+					return
+				}
+				attempted[i]++
+			}
+		}(i, subscription, bySubscription[subscriptionID])
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range subscriptionIDs {
+		total += attempted[i]
+	}
+	for _, err := range errs {
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// bury dead letters the deliveries of a subscription that was deleted, they would stay pending forever otherwise
+func (d *Dispatcher) bury(deliveries []models.WebhookDeliveries, now time.Time) error {
+	for _, delivery := range deliveries {
+		delivery.Status = db.DeliveryDead
+		delivery.LastError = "the subscription was deleted"
+		delivery.NextAttemptAt = now
+		err := d.client.SaveWebhookDelivery(delivery)
+		if err != nil {
+			return fmt.Errorf("failed to save delivery %d: %s", delivery.ID, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// attempt posts the delivery once and returns it with the outcome
+func (d *Dispatcher) attempt(ctx context.Context, subscription models.WebhookSubscriptions, delivery models.WebhookDeliveries, now time.Time) models.WebhookDeliveries {
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+
+	status, err := d.post(ctx, subscription, delivery, now)
+	delivery.LastStatusCode = status
+	delivery.LastError = ""
+	if err == nil {
+		delivery.Status = db.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		return delivery
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.config.MaxAttempts {
+		delivery.Status = db.DeliveryDead
+		log.Printf("dead lettered webhook delivery %d to %s after %d attempts: %s\n", delivery.ID, subscription.URL, delivery.Attempts, err.Error())
+		return delivery
+	}
+
+	delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+	return delivery
+}
+
+func (d *Dispatcher) post(ctx context.Context, subscription models.WebhookSubscriptions, delivery models.WebhookDeliveries, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "movie-rating-api-webhooks")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(DeliveryHeader, strconv.Itoa(delivery.ID))
+	request.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	request.Header.Set(SignatureHeader, Sign(subscription.Secret, now.Unix(), body))
+
+	response, err := d.httpClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("receiver answered %s", response.Status)
+	}
+
+	return response.StatusCode, nil
+}
+
+// backoff is how long to wait after the attempt-th failure
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.durations.baseBackoff
+	for i := 1; i < attempt && wait < d.durations.maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.durations.maxBackoff {
+		wait = d.durations.maxBackoff
+	}
+
+	return wait
+}
+
+var (
+	ErrInvalidURL   = fmt.Errorf("url must be an absolute http or https url")
+	ErrNoEvents     = fmt.Errorf("events must list at least one event")
+	ErrUnknownEvent = fmt.Errorf("events must be * or among %s", strings.Join(db.Events, ", "))
+)
+
+// NewSubscription validates a subscription, a random secret is made up when secret is empty
+func NewSubscription(rawURL string, events []string, secret string, now time.Time) (models.WebhookSubscriptions, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return models.WebhookSubscriptions{}, ErrInvalidURL
+	}
+
+	if len(events) == 0 {
+		return models.WebhookSubscriptions{}, ErrNoEvents
+	}
+	for _, event := range events {
+		known := event == "*"
+		for _, e := range db.Events {
+			known = known || e == event
+		}
+		if !known {
+			return models.WebhookSubscriptions{}, ErrUnknownEvent
+		}
+	}
+
+	if secret == "" {
+		random := make([]byte, 32)
+		_, err = rand.Read(random)
+		if err != nil {
+			return models.WebhookSubscriptions{}, err
+		}
+		secret = hex.EncodeToString(random)
+	}
+
+	return models.WebhookSubscriptions{
+		URL:       rawURL,
+		Events:    strings.Join(events, ","),
+		Secret:    secret,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
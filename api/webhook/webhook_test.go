@@ -0,0 +1,173 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"movie-rating-api/db"
+	"movie-rating-api/db/dbtest"
+	"movie-rating-api/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newDispatcher(t *testing.T) (db.Client, *Dispatcher) {
+	client := dbtest.NewFake(t, db.FakeConfig{})
+
+	config := DefaultConfig()
+	config.Timeout = "5s"
+	dispatcher, err := NewDispatcher(client, config)
+	if err != nil {
+		t.Fatalf("failed to create dispatcher: %s", err.Error())
+	}
+
+	return client, dispatcher
+}
+
+func subscribe(t *testing.T, client db.Client, url string) models.WebhookSubscriptions {
+	subscription, err := NewSubscription(url, []string{"*"}, "secret", time.Now())
+	if err != nil {
+		t.Fatalf("failed to build subscription: %s", err.Error())
+	}
+	subscription, err = client.CreateWebhookSubscription(subscription)
+	if err != nil {
+		t.Fatalf("failed to create subscription: %s", err.Error())
+	}
+	return subscription
+}
+
+func enqueue(t *testing.T, client db.Client, count int, at time.Time) {
+	for i := 0; i < count; i++ {
+		_, err := client.EnqueueWebhookEvent(db.Event{
+			ID:        fmt.Sprintf("event-%d-%d", at.UnixNano(), i),
+			Type:      db.EventMovieCreated,
+			CreatedAt: at,
+			Data:      db.MovieEvent{ID: 1},
+		})
+		if err != nil {
+			t.Fatalf("failed to enqueue event: %s", err.Error())
+		}
+	}
+}
+
+func deliveries(t *testing.T, client db.Client, subscriptionID int) []models.WebhookDeliveries {
+	result, err := client.GetWebhookDeliveries(subscriptionID, "", 100)
+	if err != nil {
+		t.Fatalf("failed to get deliveries: %s", err.Error())
+	}
+	return result
+}
+
+func TestRunOnceDeliversSignedInOrderAndInParallel(t *testing.T) {
+	client, dispatcher := newDispatcher(t)
+
+	// the slow receiver only answers once the fast one has had all of its deliveries
+	fastDone := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-fastDone:
+		case <-time.After(3 * time.Second):
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer slow.Close()
+
+	var mu sync.Mutex
+	var received []int
+	var verified bool
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+		id, _ := strconv.Atoi(r.Header.Get(DeliveryHeader))
+
+		mu.Lock()
+		defer mu.Unlock()
+		verified = Verify("secret", timestamp, body, r.Header.Get(SignatureHeader))
+		received = append(received, id)
+		if len(received) == 3 {
+			close(fastDone)
+		}
+	}))
+	defer fast.Close()
+
+	slowSubscription := subscribe(t, client, slow.URL)
+	fastSubscription := subscribe(t, client, fast.URL)
+	now := time.Now()
+	enqueue(t, client, 3, now)
+
+	attempted, err := dispatcher.RunOnce(context.Background(), now)
+	if err != nil {
+		t.Fatalf("failed to run: %s", err.Error())
+	}
+	if attempted != 6 {
+		t.Fatalf("expected 6 attempts, got %d", attempted)
+	}
+
+	if !verified {
+		t.Fatalf("expected the deliveries to be signed with the secret")
+	}
+	for i := 1; i < len(received); i++ {
+		if received[i] < received[i-1] {
+			t.Fatalf("expected the deliveries of a subscription in order, got %v", received)
+		}
+	}
+	for _, subscription := range []models.WebhookSubscriptions{slowSubscription, fastSubscription} {
+		for _, delivery := range deliveries(t, client, subscription.ID) {
+			if delivery.Status != db.DeliveryDelivered {
+				t.Fatalf("expected delivery %d to %s to be delivered, got %s: %s", delivery.ID, subscription.URL, delivery.Status, delivery.LastError)
+			}
+		}
+	}
+}
+
+func TestRunOnceDeadLettersDeliveriesOfDeletedSubscriptions(t *testing.T) {
+	client, dispatcher := newDispatcher(t)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	subscription := subscribe(t, client, receiver.URL)
+	now := time.Now()
+	enqueue(t, client, 1, now)
+
+	_, err := dispatcher.RunOnce(context.Background(), now)
+	if err != nil {
+		t.Fatalf("failed to run: %s", err.Error())
+	}
+	delivery := deliveries(t, client, subscription.ID)[0]
+
+	// a delivery retried after its subscription was deleted has nowhere to go
+	_, err = client.DeleteWebhookSubscription(subscription.ID)
+	if err != nil {
+		t.Fatalf("failed to delete subscription: %s", err.Error())
+	}
+	ok, err := client.RetryWebhookDelivery(subscription.ID, delivery.ID, now)
+	if err != nil || !ok {
+		t.Fatalf("failed to retry delivery: %v", err)
+	}
+
+	attempted, err := dispatcher.RunOnce(context.Background(), now)
+	if err != nil {
+		t.Fatalf("failed to run: %s", err.Error())
+	}
+	if attempted != 0 {
+		t.Fatalf("expected no attempts, got %d", attempted)
+	}
+
+	delivery = deliveries(t, client, subscription.ID)[0]
+	if delivery.Status != db.DeliveryDead {
+		t.Fatalf("expected the delivery to be dead lettered, got %s", delivery.Status)
+	}
+
+	claimed, err := client.ClaimWebhookDeliveries(now.Add(time.Hour), time.Minute, 10)
+	if err != nil {
+		t.Fatalf("failed to claim deliveries: %s", err.Error())
+	}
+	if len(claimed) != 0 {
+		t.Fatalf("expected nothing left to deliver, got %d", len(claimed))
+	}
+}
@@ -0,0 +1,17 @@
+import React from "react";
+import Movie from "./MovieCard";
+import useList from "./useList";
+
+const CuratedList = ({name, empty}) => {
+    const {data: entries, isLoading, isError} = useList(name);
+    if (isLoading) return <>Loading...</>
+    if (isError) return <>Error!!</>
+    if (!entries?.length) return <>{empty}</>
+
+    return <>{entries.map((entry) => <React.Fragment key={entry.movie.id}>
+        <Movie movie={entry.movie} />
+        <ul>{entry.reasons.map((reason) => <li key={reason}>{reason}</li>)}</ul>
+    </React.Fragment>)}</>
+}
+
+export default CuratedList;
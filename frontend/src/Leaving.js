@@ -1,23 +1,7 @@
-import Movie from "./MovieCard";
-import useMovies from "./useMovies"
-
-const lowestRaiting = (movies) => {
-    let movie = {average_rating: 100};
-    movies?.forEach(element => {
-        if(Number(element?.average_rating) <= Number(movie?.average_rating)){
-            movie = {...element}
-        }
-    });
-    return movie;
-}
+import CuratedList from "./CuratedList";
 
 const Leaving = () => {
-    const {data, isLoading, isError} = useMovies();
-    if (isLoading) return <>Loading...</>
-    if (isError) return <>Error!!</>
-    const movie = lowestRaiting(data);
-    return <Movie movie={movie} />
-
+    return <CuratedList name="leaving" empty="Nothing is leaving soon" />
 }
 
-export default Leaving;
\ No newline at end of file
+export default Leaving;
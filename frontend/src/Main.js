@@ -2,9 +2,10 @@ import React from 'react';
 import './Main.css';
 
 import { NavLink, Outlet } from 'react-router-dom';
+import useStream from './useStream';
 
 const MovieDashboard = () => {
-
+    useStream();
 
     return (
         <div>
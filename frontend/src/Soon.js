@@ -1,5 +1,7 @@
+import CuratedList from "./CuratedList";
+
 const Soon = () => {
-    return <>Soon!!</>
+    return <CuratedList name="coming-soon" empty="Soon!!" />
 }
 
-export default Soon;
\ No newline at end of file
+export default Soon;
@@ -0,0 +1,14 @@
+import axios from "axios";
+import { useQuery } from "react-query";
+
+const fetchList = async (name) => {
+    const { data } = await axios.get(`/lists/${name}`);
+    return data;
+  };
+
+  // useList loads a curated list computed by the api, name is trending, leaving or coming-soon
+  const useList = (name) => useQuery(["list", name], () => fetchList(name), {
+    select: (list) => list.data
+  })
+
+  export default useList;
@@ -9,7 +9,7 @@ const calculateAverageScore = (movie) => {
 };
 
 const fetchMovies = async () => {
-    const { data } = await axios.get(`/movies`);
+    const { data } = await axios.get(`/v1/movies`);
     return data;
   };
 
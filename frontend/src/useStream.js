@@ -0,0 +1,28 @@
+import { useEffect } from "react";
+import axios from "axios";
+import { useQueryClient } from "react-query";
+import { KEY } from "./useMovies";
+
+const EVENTS = ["movie.created", "movie.updated", "movie.deleted", "rating.created", "rating.updated", "rating.deleted"]
+
+  // useStream refetches the movies and curated lists whenever the api commits a movie or rating change.
+  // EventSource reconnects by itself and resumes from the last event it got.
+  const useStream = () => {
+    const queryClient = useQueryClient();
+
+    useEffect(() => {
+        const source = new EventSource(`${axios.defaults.baseURL}/stream`);
+        const refetch = () => {
+            queryClient.invalidateQueries(KEY);
+            queryClient.invalidateQueries("list");
+        };
+
+        EVENTS.forEach((event) => source.addEventListener(event, refetch));
+        // the events since the last one could not be replayed, so everything may be stale
+        source.addEventListener("reset", () => queryClient.invalidateQueries());
+
+        return () => source.close();
+    }, [queryClient]);
+  }
+
+  export default useStream;